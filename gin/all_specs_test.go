@@ -13,5 +13,9 @@ func TestAllSpecs(t *testing.T) {
   r.AddSpec(EventSpec)
   r.AddSpec(EventListenerSpec)
   r.AddSpec(AxisSpec)
+  r.AddSpec(TimestampSpec)
+  r.AddSpec(ScancodeSpec)
+  r.AddSpec(JoystickSpec)
+  r.AddSpec(GamepadSpec)
   gospec.MainGoTest(r, t)
 }
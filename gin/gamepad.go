@@ -0,0 +1,493 @@
+package gin
+
+import (
+  "bufio"
+  "fmt"
+  "io"
+  "os"
+  "runtime"
+  "strconv"
+  "strings"
+)
+
+// The controls of a standard gamepad, laid out like an Xbox controller.  The
+// face buttons are named by position so that they mean the same thing on
+// every controller, South is A on an Xbox controller and Cross on a
+// PlayStation controller.
+type GamepadControl int
+
+const (
+  GamepadSouth GamepadControl = iota
+  GamepadEast
+  GamepadWest
+  GamepadNorth
+  GamepadBack
+  GamepadGuide
+  GamepadStart
+  GamepadLeftStick
+  GamepadRightStick
+  GamepadLeftShoulder
+  GamepadRightShoulder
+  GamepadDpadUp
+  GamepadDpadDown
+  GamepadDpadLeft
+  GamepadDpadRight
+
+  // Stick axes are in the range [-1, 1].  As with SDL, positive y is down.
+  GamepadLeftX
+  GamepadLeftY
+  GamepadRightX
+  GamepadRightY
+
+  // Triggers are in the range [0, 1], and are 0 when they are released.
+  GamepadLeftTrigger
+  GamepadRightTrigger
+
+  gamepad_num_controls
+)
+
+// The names that SDL mappings use for each control, in the same order as the
+// GamepadControl constants.
+var gamepad_sdl_names = [...]string{
+  "a", "b", "x", "y", "back", "guide", "start", "leftstick", "rightstick",
+  "leftshoulder", "rightshoulder", "dpup", "dpdown", "dpleft", "dpright",
+  "leftx", "lefty", "rightx", "righty", "lefttrigger", "righttrigger",
+}
+
+var gamepad_key_names = [...]string{
+  "South", "East", "West", "North", "Back", "Guide", "Start", "LeftStick",
+  "RightStick", "LeftShoulder", "RightShoulder", "DpadUp", "DpadDown",
+  "DpadLeft", "DpadRight", "LeftX", "LeftY", "RightX", "RightY",
+  "LeftTrigger", "RightTrigger",
+}
+
+func (c GamepadControl) isStick() bool {
+  return c >= GamepadLeftX && c <= GamepadRightY
+}
+
+func (c GamepadControl) isTrigger() bool {
+  return c == GamepadLeftTrigger || c == GamepadRightTrigger
+}
+
+// Gamepad keys for the joystick with index i are at
+// gamepad_key_base + i * gamepad_key_range + control.
+const (
+  gamepad_key_base  = 8000
+  gamepad_key_range = 32
+)
+
+// Returns the id of the key for a control on the joystick with the specified
+// index.  The key only exists if that joystick has a gamepad mapping.
+func GamepadKey(index int, control GamepadControl) KeyId {
+  return KeyId(gamepad_key_base + index*gamepad_key_range + int(control))
+}
+
+type gamepadSourceKind int
+
+const (
+  gamepadButtonSource gamepadSourceKind = iota
+  gamepadHatSource
+  gamepadAxisSource
+)
+
+// One side of a binding in an SDL mapping, such as b3, h0.4, -a1 or a2~.
+type gamepadSource struct {
+  kind  gamepadSourceKind
+  index int
+
+  // For hats, the directions that count, 1 is up, 2 is right, 4 is down and
+  // 8 is left.
+  hat_mask int
+
+  // For axes, 0 to use the whole axis, or +1 or -1 to use only that half.
+  half   int
+  invert bool
+}
+
+type gamepadBinding struct {
+  source  gamepadSource
+  control GamepadControl
+
+  // 0 if source drives the whole control, or +1 or -1 if it only drives that
+  // half of a stick axis.
+  half int
+}
+
+// A GamepadMapping says how the axes, buttons and hats of one model of
+// joystick make up a standard gamepad.
+type GamepadMapping struct {
+  Guid string
+  Name string
+
+  bindings []gamepadBinding
+}
+
+// A GamepadDb holds mappings in the format used by SDL's
+// gamecontrollerdb.txt, keyed by joystick guid.  Only mappings for the
+// current platform, or for no platform in particular, are kept.
+type GamepadDb struct {
+  mappings map[string]*GamepadMapping
+}
+
+func MakeGamepadDb() *GamepadDb {
+  return &GamepadDb{mappings: make(map[string]*GamepadMapping)}
+}
+
+// The name that SDL mappings use for the platform that we are running on.
+func sdlPlatform() string {
+  switch runtime.GOOS {
+  case "darwin":
+    return "Mac OS X"
+  case "windows":
+    return "Windows"
+  case "linux":
+    return "Linux"
+  }
+  return runtime.GOOS
+}
+
+// Reads the mapping file at path into a new GamepadDb.
+func LoadGamepadDb(path string) (*GamepadDb, error) {
+  f, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+  db := MakeGamepadDb()
+  if err := db.Read(f); err != nil {
+    return nil, fmt.Errorf("%s: %v", path, err)
+  }
+  return db, nil
+}
+
+// Reads mappings from r, one per line.  Blank lines and lines starting with
+// '#' are ignored.  Mappings replace any earlier mapping with the same guid.
+func (db *GamepadDb) Read(r io.Reader) error {
+  scanner := bufio.NewScanner(r)
+  line_num := 0
+  for scanner.Scan() {
+    line_num++
+    line := strings.TrimSpace(scanner.Text())
+    if line == "" || line[0] == '#' {
+      continue
+    }
+    if err := db.AddMapping(line); err != nil {
+      return fmt.Errorf("line %d: %v", line_num, err)
+    }
+  }
+  return scanner.Err()
+}
+
+// Parses a single mapping, such as
+// "030000005e0400008e02000014010000,Xbox 360 Controller,a:b0,b:b1,...,platform:Linux,"
+// and adds it to the database.  Fields that aren't bindings for a standard
+// control, such as misc1 or crc, are ignored.
+func (db *GamepadDb) AddMapping(line string) error {
+  fields := strings.Split(line, ",")
+  if len(fields) < 2 {
+    return fmt.Errorf("Mapping '%s' has no name.", line)
+  }
+  guid := strings.ToLower(strings.TrimSpace(fields[0]))
+  if len(guid) != 32 {
+    return fmt.Errorf("Mapping '%s' has an invalid guid.", line)
+  }
+  mapping := &GamepadMapping{
+    Guid: guid,
+    Name: strings.TrimSpace(fields[1]),
+  }
+  platform := ""
+  for _, field := range fields[2:] {
+    field = strings.TrimSpace(field)
+    if field == "" {
+      continue
+    }
+    colon := strings.Index(field, ":")
+    if colon == -1 {
+      return fmt.Errorf("Field '%s' of mapping '%s' is not of the form name:value.", field, mapping.Name)
+    }
+    target, value := field[:colon], field[colon+1:]
+    if target == "platform" {
+      platform = value
+      continue
+    }
+    binding, ok, err := parseGamepadBinding(target, value)
+    if err != nil {
+      return fmt.Errorf("Field '%s' of mapping '%s': %v", field, mapping.Name, err)
+    }
+    if ok {
+      mapping.bindings = append(mapping.bindings, binding)
+    }
+  }
+  if platform == "" || platform == sdlPlatform() {
+    db.mappings[guid] = mapping
+  }
+  return nil
+}
+
+// Returns ok == false if target isn't a standard control.
+func parseGamepadBinding(target, value string) (binding gamepadBinding, ok bool, err error) {
+  if strings.HasPrefix(target, "+") {
+    binding.half = 1
+    target = target[1:]
+  } else if strings.HasPrefix(target, "-") {
+    binding.half = -1
+    target = target[1:]
+  }
+  binding.control = -1
+  for i, name := range gamepad_sdl_names {
+    if name == target {
+      binding.control = GamepadControl(i)
+    }
+  }
+  if binding.control == -1 {
+    return binding, false, nil
+  }
+  if binding.half != 0 && !binding.control.isStick() {
+    return binding, false, fmt.Errorf("Only stick axes can be split in half.")
+  }
+
+  src := &binding.source
+  if strings.HasPrefix(value, "+") {
+    src.half = 1
+    value = value[1:]
+  } else if strings.HasPrefix(value, "-") {
+    src.half = -1
+    value = value[1:]
+  }
+  if strings.HasSuffix(value, "~") {
+    src.invert = true
+    value = value[:len(value)-1]
+  }
+  if len(value) < 2 {
+    return binding, false, fmt.Errorf("'%s' is not a valid input.", value)
+  }
+  switch value[0] {
+  case 'b':
+    src.kind = gamepadButtonSource
+    src.index, err = strconv.Atoi(value[1:])
+
+  case 'a':
+    src.kind = gamepadAxisSource
+    src.index, err = strconv.Atoi(value[1:])
+
+  case 'h':
+    src.kind = gamepadHatSource
+    parts := strings.Split(value[1:], ".")
+    if len(parts) != 2 {
+      return binding, false, fmt.Errorf("'%s' is not a valid hat.", value)
+    }
+    src.index, err = strconv.Atoi(parts[0])
+    if err == nil {
+      src.hat_mask, err = strconv.Atoi(parts[1])
+    }
+
+  default:
+    return binding, false, fmt.Errorf("'%s' is not a valid input.", value)
+  }
+  if err != nil {
+    return binding, false, fmt.Errorf("'%s' is not a valid input.", value)
+  }
+  if src.kind != gamepadAxisSource && (src.half != 0 || src.invert) {
+    return binding, false, fmt.Errorf("Only axes can be split in half or inverted.")
+  }
+  return binding, true, nil
+}
+
+// Zeroes the parts of an SDL guid that newer versions of SDL fill in and
+// older mapping files don't have, the name crc and the version.
+func looseGuid(guid string) string {
+  return guid[:4] + "0000" + guid[8:24] + "0000" + guid[28:]
+}
+
+// Returns the mapping for joysticks with the specified guid, or nil if there
+// isn't one.
+func (db *GamepadDb) Mapping(guid string) *GamepadMapping {
+  guid = strings.ToLower(guid)
+  if mapping, ok := db.mappings[guid]; ok {
+    return mapping
+  }
+  if len(guid) != 32 {
+    return nil
+  }
+  loose := looseGuid(guid)
+  for g, mapping := range db.mappings {
+    if looseGuid(g) == loose {
+      return mapping
+    }
+  }
+  return nil
+}
+
+// A joystick that is being treated as a gamepad.
+type gamepad struct {
+  mapping *GamepadMapping
+
+  // Map from the joystick's keys to the controls that depend on them.
+  deps map[KeyId][]GamepadControl
+}
+
+func (b gamepadBinding) sourceKeys(index int) []KeyId {
+  switch b.source.kind {
+  case gamepadButtonSource:
+    return []KeyId{JoystickButtonKey(index, b.source.index)}
+
+  case gamepadAxisSource:
+    return []KeyId{JoystickAxisKey(index, b.source.index)}
+  }
+  var ids []KeyId
+  dirs := [...]HatDirection{HatUp, HatRight, HatDown, HatLeft}
+  for bit, dir := range dirs {
+    if b.source.hat_mask&(1<<uint(bit)) != 0 {
+      ids = append(ids, JoystickHatKey(index, b.source.index, dir))
+    }
+  }
+  return ids
+}
+
+// Sets the database used to find gamepad mappings for joysticks, both those
+// that are already connected and those that connect later.  A nil database
+// turns the gamepad layer off.
+func (input *Input) SetGamepadDb(db *GamepadDb) {
+  input.gamepad_db = db
+  for _, j := range input.joysticks {
+    input.connectGamepad(j)
+  }
+}
+
+// Called whenever a joystick connects, registers keys for the standard
+// controls if there is a mapping for j.
+func (input *Input) connectGamepad(j Joystick) {
+  delete(input.gamepads, j.Index)
+  if input.gamepad_db == nil {
+    return
+  }
+  mapping := input.gamepad_db.Mapping(j.Guid)
+  if mapping == nil {
+    return
+  }
+  pad := &gamepad{
+    mapping: mapping,
+    deps:    make(map[KeyId][]GamepadControl),
+  }
+  for _, b := range mapping.bindings {
+    for _, id := range b.sourceKeys(j.Index) {
+      pad.deps[id] = append(pad.deps[id], b.control)
+    }
+  }
+  for c := GamepadControl(0); c < gamepad_num_controls; c++ {
+    id := GamepadKey(j.Index, c)
+    if _, ok := input.key_map[id]; !ok {
+      input.registerNaturalKey(id, fmt.Sprintf("Gamepad%d%s", j.Index, gamepad_key_names[c]))
+    }
+  }
+  input.gamepads[j.Index] = pad
+}
+
+// Returns the gamepad mapping being used for the joystick with the specified
+// index, or nil if that joystick isn't being treated as a gamepad.
+func (input *Input) GamepadMapping(index int) *GamepadMapping {
+  if pad, ok := input.gamepads[index]; ok {
+    return pad.mapping
+  }
+  return nil
+}
+
+func (input *Input) curPressAmt(id KeyId) float64 {
+  if key, ok := input.key_map[id]; ok {
+    return key.CurPressAmt()
+  }
+  return 0
+}
+
+// Returns how much b contributes to its control.
+func (input *Input) gamepadBindingValue(index int, b gamepadBinding) float64 {
+  var v float64
+  full := false
+  switch b.source.kind {
+  case gamepadButtonSource, gamepadHatSource:
+    for _, id := range b.sourceKeys(index) {
+      if input.curPressAmt(id) != 0 {
+        v = 1
+      }
+    }
+
+  case gamepadAxisSource:
+    v = input.curPressAmt(JoystickAxisKey(index, b.source.index))
+    if b.source.invert {
+      v = -v
+    }
+    switch b.source.half {
+    case 0:
+      full = true
+    case 1:
+      if v < 0 {
+        v = 0
+      }
+    case -1:
+      if v > 0 {
+        v = 0
+      }
+      v = -v
+    }
+  }
+
+  switch {
+  case b.control.isStick():
+    if b.half != 0 {
+      if full {
+        v = (v + 1) / 2
+      }
+      v *= float64(b.half)
+    }
+
+  case b.control.isTrigger():
+    // Triggers usually report on a whole axis that rests at -1
+    if full {
+      v = (v + 1) / 2
+    }
+
+  default:
+    threshold := 0.5
+    if full {
+      threshold = 0
+    }
+    if v > threshold {
+      v = 1
+    } else {
+      v = 0
+    }
+  }
+  return v
+}
+
+// Updates the gamepad controls that depend on the joystick key id, if it
+// belongs to a joystick that is being treated as a gamepad.
+func (input *Input) pressGamepadKeys(id KeyId, group *EventGroup) {
+  if id < joystick_key_base || id >= joystick_key_base+MaxJoysticks*joystick_key_range {
+    return
+  }
+  index := int(id-joystick_key_base) / joystick_key_range
+  pad, ok := input.gamepads[index]
+  if !ok {
+    return
+  }
+  for _, control := range pad.deps[id] {
+    var v float64
+    for _, b := range pad.mapping.bindings {
+      if b.control == control {
+        v += input.gamepadBindingValue(index, b)
+      }
+    }
+    min := -1.0
+    if !control.isStick() {
+      min = 0
+    }
+    if v < min {
+      v = min
+    }
+    if v > 1 {
+      v = 1
+    }
+    input.pressKey(input.key_map[GamepadKey(index, control)], v, Event{}, group)
+  }
+}
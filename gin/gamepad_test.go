@@ -0,0 +1,128 @@
+package gin_test
+
+import (
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+  "github.com/MobRulesGames/glop/gin"
+  "strings"
+)
+
+const pad_guid = "030000005e0400008e02000014010000"
+
+const pad_db = `
+# A made up controller
+030000005e0400008e02000014010000,Test Pad,a:b0,b:b1,x:b2,y:b3,leftx:a0,lefty:a1~,lefttrigger:a2,righttrigger:b5,dpup:h0.1,dpleft:h0.8,-rightx:b6,+rightx:b7,start:+a3,
+
+03000000000000000000000000000000,Other Platform,a:b1,platform:Android,
+`
+
+func GamepadSpec(c gospec.Context) {
+  input := gin.Make()
+  db := gin.MakeGamepadDb()
+  c.Assume(db.Read(strings.NewReader(pad_db)), IsNil)
+  input.SetGamepadDb(db)
+  input.ConnectJoystick(gin.Joystick{Index: 0, Guid: pad_guid, Num_axes: 4, Num_buttons: 8, Num_hats: 1})
+
+  think := func(t gin.Timestamp, id gin.KeyId, amt float64) {
+    input.Think(t+1, false, []gin.OsEvent{{KeyId: id, Press_amt: amt, Timestamp: t}})
+  }
+  pad := func(control gin.GamepadControl) gin.Key {
+    return input.GetKey(gin.GamepadKey(0, control))
+  }
+
+  c.Specify("Mappings are found by guid, and only for this platform.", func() {
+    c.Expect(db.Mapping(pad_guid).Name, Equals, "Test Pad")
+    c.Expect(db.Mapping(strings.ToUpper(pad_guid)).Name, Equals, "Test Pad")
+    c.Expect(db.Mapping("03000000000000000000000000000000") == nil, IsTrue)
+    c.Expect(input.GamepadMapping(0).Name, Equals, "Test Pad")
+  })
+
+  c.Specify("Guids from newer versions of SDL match without the crc and version.", func() {
+    c.Expect(db.Mapping("0300abcd5e0400008e02000099990000").Name, Equals, "Test Pad")
+  })
+
+  c.Specify("Gamepad keys are registered by name.", func() {
+    c.Expect(input.GetKeyByName("Gamepad0South"), Equals, pad(gin.GamepadSouth))
+    c.Expect(input.GetKeyByName("Gamepad0RightTrigger"), Equals, pad(gin.GamepadRightTrigger))
+  })
+
+  c.Specify("Buttons press gamepad buttons.", func() {
+    think(10, gin.JoystickButtonKey(0, 1), 1)
+    c.Expect(pad(gin.GamepadEast).FramePressCount(), Equals, 1)
+    c.Expect(pad(gin.GamepadSouth).FramePressCount(), Equals, 0)
+  })
+
+  c.Specify("Axes drive sticks, and can be inverted.", func() {
+    input.Think(20, false, []gin.OsEvent{
+      {KeyId: gin.JoystickAxisKey(0, 0), Press_amt: 0.25, Timestamp: 10},
+      {KeyId: gin.JoystickAxisKey(0, 1), Press_amt: 0.5, Timestamp: 10},
+    })
+    c.Expect(pad(gin.GamepadLeftX).FramePressAmt(), Equals, 0.25)
+    c.Expect(pad(gin.GamepadLeftY).FramePressAmt(), Equals, -0.5)
+  })
+
+  c.Specify("Trigger axes are mapped to [0, 1].", func() {
+    think(10, gin.JoystickAxisKey(0, 2), -1)
+    c.Expect(pad(gin.GamepadLeftTrigger).FramePressAmt(), Equals, 0.0)
+    think(20, gin.JoystickAxisKey(0, 2), 0.5)
+    c.Expect(pad(gin.GamepadLeftTrigger).FramePressAmt(), Equals, 0.75)
+    think(30, gin.JoystickButtonKey(0, 5), 1)
+    c.Expect(pad(gin.GamepadRightTrigger).FramePressAmt(), Equals, 1.0)
+  })
+
+  c.Specify("Hats press the dpad.", func() {
+    think(10, gin.JoystickHatKey(0, 0, gin.HatLeft), 1)
+    c.Expect(pad(gin.GamepadDpadLeft).FramePressCount(), Equals, 1)
+    c.Expect(pad(gin.GamepadDpadUp).FramePressCount(), Equals, 0)
+  })
+
+  c.Specify("Buttons can drive half of a stick axis.", func() {
+    think(10, gin.JoystickButtonKey(0, 6), 1)
+    c.Expect(pad(gin.GamepadRightX).FramePressAmt(), Equals, -1.0)
+    think(20, gin.JoystickButtonKey(0, 7), 1)
+    c.Expect(pad(gin.GamepadRightX).FramePressAmt(), Equals, 0.0)
+    think(30, gin.JoystickButtonKey(0, 6), 0)
+    c.Expect(pad(gin.GamepadRightX).FramePressAmt(), Equals, 1.0)
+  })
+
+  c.Specify("Half of an axis can drive a button.", func() {
+    think(10, gin.JoystickAxisKey(0, 3), -1)
+    c.Expect(pad(gin.GamepadStart).FramePressCount(), Equals, 0)
+    think(20, gin.JoystickAxisKey(0, 3), 0.75)
+    c.Expect(pad(gin.GamepadStart).FramePressCount(), Equals, 1)
+  })
+
+  c.Specify("Disconnecting a joystick releases everything on its gamepad.", func() {
+    think(10, gin.JoystickButtonKey(0, 0), 1)
+    think(20, gin.JoystickAxisKey(0, 2), 1)
+    c.Assume(pad(gin.GamepadSouth).IsDown(), IsTrue)
+    c.Assume(pad(gin.GamepadLeftTrigger).CurPressAmt(), Equals, 1.0)
+    input.DisconnectJoystick(0)
+    input.Think(30, false, nil)
+    c.Expect(input.GetKey(gin.JoystickButtonKey(0, 0)).IsDown(), IsFalse)
+    c.Expect(pad(gin.GamepadSouth).IsDown(), IsFalse)
+    c.Expect(pad(gin.GamepadSouth).FrameReleaseCount(), Equals, 1)
+    c.Expect(pad(gin.GamepadLeftTrigger).CurPressAmt(), Equals, 0.0)
+    c.Expect(input.GamepadMapping(0) == nil, IsTrue)
+  })
+
+  c.Specify("Releases from a joystick that was just disconnected still reach its gamepad.", func() {
+    think(10, gin.JoystickButtonKey(0, 0), 1)
+    input.DisconnectJoystick(0)
+    think(20, gin.JoystickButtonKey(0, 0), 0)
+    c.Expect(pad(gin.GamepadSouth).IsDown(), IsFalse)
+    c.Expect(pad(gin.GamepadSouth).FrameReleaseCount(), Equals, 1)
+  })
+
+  c.Specify("Joysticks without a mapping don't get gamepad keys.", func() {
+    input.ConnectJoystick(gin.Joystick{Index: 1, Guid: "05000000000000000000000000000000", Num_buttons: 2})
+    c.Expect(input.GamepadMapping(1) == nil, IsTrue)
+    c.Expect(input.GetKeyByName("Gamepad1South") == nil, IsTrue)
+  })
+
+  c.Specify("Malformed mappings are reported with their line number.", func() {
+    err := gin.MakeGamepadDb().Read(strings.NewReader("\n" + pad_guid + ",Bad,a:q7,\n"))
+    c.Expect(err, Not(IsNil))
+    c.Expect(strings.HasPrefix(err.Error(), "line 2:"), IsTrue)
+  })
+}
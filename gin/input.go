@@ -62,6 +62,35 @@ const (
   KeyEnd               = 193
   KeyPageUp            = 194
   KeyPageDown          = 195
+  Menu                 = 196
+  F13                  = 200
+  F14                  = 201
+  F15                  = 202
+  F16                  = 203
+  F17                  = 204
+  F18                  = 205
+  F19                  = 206
+  F20                  = 207
+  F21                  = 208
+  F22                  = 209
+  F23                  = 210
+  F24                  = 211
+  IntlBackslash        = 220
+  IntlRo               = 221
+  IntlYen              = 222
+  Convert              = 223
+  NonConvert           = 224
+  KanaMode             = 225
+  Hangul               = 226
+  Hanja                = 227
+  KeyPadComma          = 228
+  MediaPlayPause       = 230
+  MediaStop            = 231
+  MediaPrevious        = 232
+  MediaNext            = 233
+  VolumeMute           = 234
+  VolumeDown           = 235
+  VolumeUp             = 236
   MouseXAxis           = 300
   MouseYAxis           = 301
   MouseWheelVertical   = 302
@@ -69,6 +98,8 @@ const (
   MouseLButton         = 304
   MouseRButton         = 305
   MouseMButton         = 306
+  MouseBackButton      = 307
+  MouseForwardButton   = 308
 
   // standard derived keys start here
   EitherShift = 1000 + iota
@@ -110,9 +141,16 @@ type OsEvent struct {
   // meaningless
   X, Y int
 
-  Timestamp int64
+  // When the event happened, see Timestamp.
+  Timestamp Timestamp
   Num_lock  int
   Caps_lock int
+
+  // For keyboard events this is the physical key that was pressed, if the Os
+  // knows it, and it presses the key with id ScancodeKey(Scancode) as well as
+  // the key with id KeyId.  KeyId can be 0 if the key doesn't produce anything
+  // that gin has a key for, but Scancode is still known.
+  Scancode Scancode
 }
 
 // Everything 'global' is put inside a struct so that tests can be run without stepping
@@ -135,6 +173,17 @@ type Input struct {
   cursor_keys map[KeyId]*cursor
 
   cursors map[string]*cursor
+
+  // Joysticks that are currently connected, by index
+  joysticks map[int]Joystick
+
+  // Joysticks that have been disconnected whose keys haven't been released
+  // yet, by index
+  disconnected map[int]bool
+
+  // Joysticks that have a mapping in gamepad_db, by index
+  gamepad_db *GamepadDb
+  gamepads   map[int]*gamepad
 }
 
 // The standard input object
@@ -159,6 +208,9 @@ func Make() *Input {
   input.dep_map = make(map[KeyId][]Key, 16)
   input.cursor_keys = make(map[KeyId]*cursor, 512)
   input.cursors = make(map[string]*cursor, 2)
+  input.joysticks = make(map[int]Joystick)
+  input.disconnected = make(map[int]bool)
+  input.gamepads = make(map[int]*gamepad)
 
   for c := 'a'; c <= 'z'; c++ {
     input.registerNaturalKey(KeyId(c), fmt.Sprintf("%c", c))
@@ -227,14 +279,38 @@ func Make() *Input {
   input.registerNaturalKey(KeyEnd, "KeyEnd")
   input.registerNaturalKey(KeyPageUp, "KeyPageUp")
   input.registerNaturalKey(KeyPageDown, "KeyPageDown")
+  input.registerNaturalKey(Menu, "Menu")
+  for i := 0; i < 12; i++ {
+    input.registerNaturalKey(F13+KeyId(i), fmt.Sprintf("F%d", 13+i))
+  }
+  input.registerNaturalKey(IntlBackslash, "IntlBackslash")
+  input.registerNaturalKey(IntlRo, "IntlRo")
+  input.registerNaturalKey(IntlYen, "IntlYen")
+  input.registerNaturalKey(Convert, "Convert")
+  input.registerNaturalKey(NonConvert, "NonConvert")
+  input.registerNaturalKey(KanaMode, "KanaMode")
+  input.registerNaturalKey(Hangul, "Hangul")
+  input.registerNaturalKey(Hanja, "Hanja")
+  input.registerNaturalKey(KeyPadComma, "KeyPadComma")
+  input.registerNaturalKey(MediaPlayPause, "MediaPlayPause")
+  input.registerNaturalKey(MediaStop, "MediaStop")
+  input.registerNaturalKey(MediaPrevious, "MediaPrevious")
+  input.registerNaturalKey(MediaNext, "MediaNext")
+  input.registerNaturalKey(VolumeMute, "VolumeMute")
+  input.registerNaturalKey(VolumeDown, "VolumeDown")
+  input.registerNaturalKey(VolumeUp, "VolumeUp")
+  input.registerScancodeKeys()
 
   input.registerCursor("Mouse")
   input.registerCursorAxisKey(MouseXAxis, "MouseXAxis", "Mouse")
   input.registerCursorAxisKey(MouseYAxis, "MouseYAxis", "Mouse")
   input.registerCursorWheelKey(MouseWheelVertical, "MouseWheelVertical", "Mouse")
+  input.registerCursorWheelKey(MouseWheelHorizontal, "MouseWheelHorizontal", "Mouse")
   input.registerCursorKey(MouseLButton, "MouseLButton", "Mouse")
   input.registerCursorKey(MouseRButton, "MouseRButton", "Mouse")
   input.registerCursorKey(MouseMButton, "MouseMButton", "Mouse")
+  input.registerCursorKey(MouseBackButton, "MouseBackButton", "Mouse")
+  input.registerCursorKey(MouseForwardButton, "MouseForwardButton", "Mouse")
 
   input.bindDerivedKeyWithId("Shift", EitherShift, input.MakeBinding(LeftShift, nil, nil), input.MakeBinding(RightShift, nil, nil))
   input.bindDerivedKeyWithId("Control", EitherControl, input.MakeBinding(LeftControl, nil, nil), input.MakeBinding(RightControl, nil, nil))
@@ -269,7 +345,6 @@ func (event EventType) String() string {
   return ""
 }
 
-// TODO: Consider making a Timestamp type (int64)
 type Event struct {
   Key  Key
   Type EventType
@@ -288,7 +363,7 @@ func (e Event) String() string {
 // An EventGroup is a series of events that were all created by a single OsEvent.
 type EventGroup struct {
   Events    []Event
-  Timestamp int64
+  Timestamp Timestamp
 }
 
 // Returns a bool indicating whether an event corresponding to the given KeyId is present
@@ -393,7 +468,7 @@ type EventHandler interface {
 }
 type Listener interface {
   EventHandler
-  Think(int64)
+  Think(Timestamp)
 }
 type EventDispatcher interface {
   RegisterEventListener(Listener)
@@ -403,7 +478,7 @@ func (input *Input) RegisterEventListener(listener Listener) {
   input.listeners = append(input.listeners, listener)
 }
 
-func (input *Input) Think(t int64, lost_focus bool, os_events []OsEvent) []EventGroup {
+func (input *Input) Think(t Timestamp, lost_focus bool, os_events []OsEvent) []EventGroup {
   // If we have lost focus, clear all key state. Note that down_keys_frame_ is rebuilt every frame
   // regardless, so we do not need to worry about it here.
   if lost_focus {
@@ -417,11 +492,19 @@ func (input *Input) Think(t int64, lost_focus bool, os_events []OsEvent) []Event
     group := EventGroup{
       Timestamp: os_event.Timestamp,
     }
-    input.pressKey(
-      input.GetKey(os_event.KeyId),
-      os_event.Press_amt,
-      Event{},
-      &group)
+    if os_event.KeyId != 0 {
+      input.pressKey(
+        input.GetKey(os_event.KeyId),
+        os_event.Press_amt,
+        Event{},
+        &group)
+      input.pressGamepadKeys(os_event.KeyId, &group)
+    }
+    if os_event.Scancode != NoScancode {
+      if key, ok := input.key_map[ScancodeKey(os_event.Scancode)]; ok {
+        input.pressKey(key, os_event.Press_amt, Event{}, &group)
+      }
+    }
 
     // Sets the cursor position if this is a cursor based event.
     // TODO: Currently only the mouse is supported as a cursor, but if we want to support
@@ -445,6 +528,13 @@ func (input *Input) Think(t int64, lost_focus bool, os_events []OsEvent) []Event
     }
   }
 
+  for _, group := range input.releaseDisconnected(t) {
+    groups = append(groups, group)
+    for _, listener := range input.listeners {
+      listener.HandleEventGroup(group)
+    }
+  }
+
   for _, key := range input.all_keys {
     gen, amt := key.Think(t)
     if !gen {
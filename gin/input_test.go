@@ -7,7 +7,7 @@ import (
   "strings"
 )
 
-func injectEvent(events *[]gin.OsEvent, index gin.KeyId, amt float64, timestamp int64) {
+func injectEvent(events *[]gin.OsEvent, index gin.KeyId, amt float64, timestamp gin.Timestamp) {
   *events = append(*events,
     gin.OsEvent{
       KeyId:     index,
@@ -77,23 +77,39 @@ func NaturalKeySpec(c gospec.Context) {
   })
 
   c.Specify("Key.FramePressSum() works.", func() {
+    ms := gin.Millisecond
     events := make([]gin.OsEvent, 0)
-    injectEvent(&events, 'a', 1, 3)
-    input.Think(10, false, events)
-    injectEvent(&events, 'a', 0, 14)
-    injectEvent(&events, 'a', 1, 16)
-    input.Think(20, false, events)
+    injectEvent(&events, 'a', 1, 3*ms)
+    input.Think(10*ms, false, events)
+    injectEvent(&events, 'a', 0, 14*ms)
+    injectEvent(&events, 'a', 1, 16*ms)
+    input.Think(20*ms, false, events)
     c.Expect(keya.FramePressSum(), Equals, 8.0)
 
     events = events[0:0]
-    injectEvent(&events, 'b', 1, 22)
-    injectEvent(&events, 'b', 0, 24)
-    input.Think(30, false, events)
+    injectEvent(&events, 'b', 1, 22*ms)
+    injectEvent(&events, 'b', 0, 24*ms)
+    input.Think(30*ms, false, events)
     c.Expect(keyb.FramePressSum(), Equals, 2.0)
 
     events = events[0:0]
-    injectEvent(&events, 'b', 1, 35)
-    input.Think(40, false, events)
+    injectEvent(&events, 'b', 1, 35*ms)
+    input.Think(40*ms, false, events)
+    c.Expect(keyb.FramePressSum(), Equals, 5.0)
+  })
+
+  c.Specify("Press sums are in milliseconds.", func() {
+    events := make([]gin.OsEvent, 0)
+    injectEvent(&events, 'a', 1, gin.FromMs(100))
+    injectEvent(&events, 'a', 0, gin.FromMs(110))
+    input.Think(gin.FromMs(120), false, events)
+    c.Expect(keya.FramePressSum(), Equals, 10.0)
+    c.Expect(keya.FramePressAvg(), Equals, 10.0/120.0)
+
+    events = events[0:0]
+    injectEvent(&events, 'b', 1, gin.FromMs(125))
+    input.Think(gin.FromMs(130), false, events)
+    c.Expect(keyb.CurPressSum(), Equals, 0.0)
     c.Expect(keyb.FramePressSum(), Equals, 5.0)
   })
 
@@ -424,7 +440,7 @@ func (l *listener) HandleEventGroup(eg gin.EventGroup) {
   l.release_count = l.release_count[1:]
   l.press_amt = l.press_amt[1:]
 }
-func (l *listener) Think(ms int64) {
+func (l *listener) Think(t gin.Timestamp) {
   l.context.Expect(len(l.press_count), Equals, 0)
   l.context.Expect(len(l.release_count), Equals, 0)
   l.context.Expect(len(l.press_amt), Equals, 0)
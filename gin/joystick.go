@@ -0,0 +1,184 @@
+package gin
+
+import (
+  "fmt"
+  "sort"
+)
+
+// Limits on the number of joysticks that can be connected at once, and on the
+// number of axes, buttons and hats that gin has keys for on each of them.
+const (
+  MaxJoysticks       = 16
+  MaxJoystickAxes    = 64
+  MaxJoystickButtons = 128
+  MaxJoystickHats    = 4
+)
+
+// Each joystick gets a block of key ids starting at
+// joystick_key_base + index * joystick_key_range.  Within that block the axes
+// come first, then the buttons and then four keys for each hat.
+const (
+  joystick_key_base  = 3000
+  joystick_key_range = 256
+
+  joystick_button_offset = MaxJoystickAxes
+  joystick_hat_offset    = joystick_button_offset + MaxJoystickButtons
+)
+
+// Hats, also called d-pads or POV switches, are treated as four buttons, one
+// for each direction.  Pressing diagonally presses two of them.
+type HatDirection int
+
+const (
+  HatUp HatDirection = iota
+  HatRight
+  HatDown
+  HatLeft
+)
+
+// A Joystick is a joystick or gamepad that is connected to the system.
+type Joystick struct {
+  // Identifies the joystick for as long as it is connected, and determines
+  // which keys belong to it.
+  Index int
+
+  Name string
+
+  // Identifies the model of the device, in the same format as SDL uses, so
+  // that it can be looked up in a game controller database.
+  Guid string
+
+  Num_axes    int
+  Num_buttons int
+  Num_hats    int
+}
+
+// Returns the id of the key for an axis of the joystick with the specified
+// index.  Axes are absolute, their press amount is their position in the
+// range [-1, 1] and it stays there until the axis moves again.
+func JoystickAxisKey(index, axis int) KeyId {
+  return KeyId(joystick_key_base + index*joystick_key_range + axis)
+}
+
+// Returns the id of the key for a button of the joystick with the specified
+// index.
+func JoystickButtonKey(index, button int) KeyId {
+  return KeyId(joystick_key_base + index*joystick_key_range + joystick_button_offset + button)
+}
+
+// Returns the id of the key for one direction of a hat of the joystick with
+// the specified index.
+func JoystickHatKey(index, hat int, dir HatDirection) KeyId {
+  return KeyId(joystick_key_base + index*joystick_key_range + joystick_hat_offset + 4*hat + int(dir))
+}
+
+var hat_direction_names = [...]string{"Up", "Right", "Down", "Left"}
+
+// Registers keys for j, if they have not already been registered by a
+// previous joystick with the same index, and adds j to the list returned by
+// Joysticks().  Panics if j.Index is not in the range [0, MaxJoysticks).
+// Numbers of axes, buttons and hats beyond the maximums are ignored.  If the
+// gamepad database has a mapping for j then keys for the standard gamepad
+// controls are registered as well.
+func (input *Input) ConnectJoystick(j Joystick) {
+  if j.Index < 0 || j.Index >= MaxJoysticks {
+    panic(fmt.Sprintf("Cannot connect joystick '%s' with index %d, indices must be in the range [0, %d).", j.Name, j.Index, MaxJoysticks))
+  }
+  if j.Num_axes > MaxJoystickAxes {
+    j.Num_axes = MaxJoystickAxes
+  }
+  if j.Num_buttons > MaxJoystickButtons {
+    j.Num_buttons = MaxJoystickButtons
+  }
+  if j.Num_hats > MaxJoystickHats {
+    j.Num_hats = MaxJoystickHats
+  }
+  for i := 0; i < j.Num_axes; i++ {
+    id := JoystickAxisKey(j.Index, i)
+    if _, ok := input.key_map[id]; !ok {
+      input.registerNaturalKey(id, fmt.Sprintf("Joystick%dAxis%d", j.Index, i))
+    }
+  }
+  for i := 0; i < j.Num_buttons; i++ {
+    id := JoystickButtonKey(j.Index, i)
+    if _, ok := input.key_map[id]; !ok {
+      input.registerNaturalKey(id, fmt.Sprintf("Joystick%dButton%d", j.Index, i))
+    }
+  }
+  for i := 0; i < j.Num_hats; i++ {
+    for dir := HatUp; dir <= HatLeft; dir++ {
+      id := JoystickHatKey(j.Index, i, dir)
+      if _, ok := input.key_map[id]; !ok {
+        input.registerNaturalKey(id, fmt.Sprintf("Joystick%dHat%d%s", j.Index, i, hat_direction_names[dir]))
+      }
+    }
+  }
+  input.joysticks[j.Index] = j
+  delete(input.disconnected, j.Index)
+  input.connectGamepad(j)
+}
+
+// Removes the joystick with the specified index from the list returned by
+// Joysticks().  Its keys stay registered, so that they can be released and so
+// that they can be reused if another joystick connects with the same index.
+// Anything on the joystick, or on its gamepad, that is still pressed is
+// released at the end of the events passed to the next call to Think(), so
+// that release events that came from the device itself are handled first.
+func (input *Input) DisconnectJoystick(index int) {
+  if _, ok := input.joysticks[index]; !ok {
+    return
+  }
+  delete(input.joysticks, index)
+  input.disconnected[index] = true
+}
+
+// Releases every key, and every gamepad key, that is still pressed on the
+// joysticks that were disconnected since the last call, and then forgets
+// their gamepads.
+func (input *Input) releaseDisconnected(t Timestamp) []EventGroup {
+  var indices []int
+  for index := range input.disconnected {
+    indices = append(indices, index)
+  }
+  sort.Ints(indices)
+  var groups []EventGroup
+  for _, index := range indices {
+    group := EventGroup{Timestamp: t}
+    base := joystick_key_base + index*joystick_key_range
+    for id := KeyId(base); id < KeyId(base+joystick_key_range); id++ {
+      if key, ok := input.key_map[id]; ok && key.CurPressAmt() != 0 {
+        input.pressKey(key, 0, Event{}, &group)
+        input.pressGamepadKeys(id, &group)
+      }
+    }
+    if _, ok := input.gamepads[index]; ok {
+      for c := GamepadControl(0); c < gamepad_num_controls; c++ {
+        if key := input.key_map[GamepadKey(index, c)]; key.CurPressAmt() != 0 {
+          input.pressKey(key, 0, Event{}, &group)
+        }
+      }
+    }
+    delete(input.gamepads, index)
+    delete(input.disconnected, index)
+    if len(group.Events) > 0 {
+      groups = append(groups, group)
+    }
+  }
+  return groups
+}
+
+// Returns all of the joysticks that are connected, ordered by index.
+func (input *Input) Joysticks() []Joystick {
+  var joysticks []Joystick
+  for _, j := range input.joysticks {
+    joysticks = append(joysticks, j)
+  }
+  sort.Sort(joysticksByIndex(joysticks))
+  return joysticks
+}
+
+type joysticksByIndex []Joystick
+
+func (j joysticksByIndex) Len() int           { return len(j) }
+func (j joysticksByIndex) Less(a, b int) bool { return j[a].Index < j[b].Index }
+func (j joysticksByIndex) Swap(a, b int)      { j[a], j[b] = j[b], j[a] }
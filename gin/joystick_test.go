@@ -0,0 +1,46 @@
+package gin_test
+
+import (
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+  "github.com/MobRulesGames/glop/gin"
+)
+
+func JoystickSpec(c gospec.Context) {
+  input := gin.Make()
+  pad := gin.Joystick{Index: 1, Name: "Pad", Num_axes: 2, Num_buttons: 4, Num_hats: 1}
+  input.ConnectJoystick(pad)
+
+  c.Specify("Connecting a joystick registers keys for it.", func() {
+    c.Expect(input.GetKeyByName("Joystick1Axis1"), Equals, input.GetKey(gin.JoystickAxisKey(1, 1)))
+    c.Expect(input.GetKeyByName("Joystick1Button3"), Equals, input.GetKey(gin.JoystickButtonKey(1, 3)))
+    c.Expect(input.GetKeyByName("Joystick1Hat0Left"), Equals, input.GetKey(gin.JoystickHatKey(1, 0, gin.HatLeft)))
+    c.Expect(len(input.Joysticks()), Equals, 1)
+    c.Expect(input.Joysticks()[0].Name, Equals, "Pad")
+  })
+
+  c.Specify("Axes keep their position until they move again.", func() {
+    axis := input.GetKey(gin.JoystickAxisKey(1, 0))
+    input.Think(10, false, []gin.OsEvent{
+      {KeyId: gin.JoystickAxisKey(1, 0), Press_amt: -0.5, Timestamp: 5},
+    })
+    c.Expect(axis.FramePressAmt(), Equals, -0.5)
+    input.Think(20, false, nil)
+    c.Expect(axis.FramePressAmt(), Equals, -0.5)
+  })
+
+  c.Specify("Joysticks are listed in order and can be disconnected.", func() {
+    input.ConnectJoystick(gin.Joystick{Index: 0, Name: "Stick", Num_buttons: 1})
+    joysticks := input.Joysticks()
+    c.Assume(len(joysticks), Equals, 2)
+    c.Expect(joysticks[0].Name, Equals, "Stick")
+    c.Expect(joysticks[1].Name, Equals, "Pad")
+
+    input.DisconnectJoystick(1)
+    c.Expect(len(input.Joysticks()), Equals, 1)
+
+    // Reconnecting reuses the keys that are already registered
+    input.ConnectJoystick(pad)
+    c.Expect(len(input.Joysticks()), Equals, 2)
+  })
+}
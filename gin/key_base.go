@@ -16,7 +16,7 @@ type Key interface {
 
   // Sets the instantaneous press amount for this key at a specific time and returns the
   // event generated, if any
-  SetPressAmt(amt float64, ms int64, cause Event) Event
+  SetPressAmt(amt float64, t Timestamp, cause Event) Event
 
   // Returns the Cursor associated with this key, or nil if it has no such association.
   Cursor() Cursor
@@ -28,7 +28,7 @@ type Key interface {
 
   // A Key may return true, amt from Think() to indicate that a fake event
   // should be generated to set its press amount to amt
-  Think(ms int64) (bool, float64)
+  Think(t Timestamp) (bool, float64)
 
   subAggregator
 }
@@ -46,8 +46,8 @@ type subAggregator interface {
 }
 type aggregator interface {
   subAggregator
-  Think(ms int64) (bool, float64)
-  SetPressAmt(amt float64, ms int64, event_type EventType)
+  Think(t Timestamp) (bool, float64)
+  SetPressAmt(amt float64, t Timestamp, event_type EventType)
   SendAllNonZero() bool
 }
 
@@ -104,26 +104,27 @@ func (a *baseAggregator) SendAllNonZero() bool {
   return false
 }
 
-// the standardAggregator's sum is an integral of the press_amt over time
+// the standardAggregator's sum is an integral of the press_amt over time, in
+// milliseconds
 type standardAggregator struct {
   baseAggregator
-  last_press int64
-  last_think int64
+  last_press Timestamp
+  last_think Timestamp
 }
 
 func (sa *standardAggregator) IsDown() bool {
   return sa.this.press_amt != 0
 }
-func (sa *standardAggregator) SetPressAmt(amt float64, ms int64, event_type EventType) {
-  sa.this.press_sum += sa.this.press_amt * float64(ms-sa.last_press)
+func (sa *standardAggregator) SetPressAmt(amt float64, t Timestamp, event_type EventType) {
+  sa.this.press_sum += sa.this.press_amt * (t - sa.last_press).FloatMs()
   sa.this.press_amt = amt
-  sa.last_press = ms
+  sa.last_press = t
   sa.handleEventType(event_type)
 }
-func (sa *standardAggregator) Think(ms int64) (bool, float64) {
-  sa.this.press_sum += sa.this.press_amt * float64(ms-sa.last_press)
-  if ms != sa.last_think {
-    sa.this.press_avg = sa.this.press_sum / float64(ms-sa.last_think)
+func (sa *standardAggregator) Think(t Timestamp) (bool, float64) {
+  sa.this.press_sum += sa.this.press_amt * (t - sa.last_press).FloatMs()
+  if t != sa.last_think {
+    sa.this.press_avg = sa.this.press_sum / (t - sa.last_think).FloatMs()
   } else {
     sa.this.press_avg = 0
   }
@@ -131,8 +132,8 @@ func (sa *standardAggregator) Think(ms int64) (bool, float64) {
   sa.this = keyStats{
     press_amt: sa.prev.press_amt,
   }
-  sa.last_press = ms
-  sa.last_think = ms
+  sa.last_press = t
+  sa.last_think = t
   return false, 0
 }
 
@@ -146,7 +147,7 @@ type axisAggregator struct {
 func (aa *axisAggregator) IsDown() bool {
   return aa.is_down
 }
-func (aa *axisAggregator) SetPressAmt(amt float64, ms int64, event_type EventType) {
+func (aa *axisAggregator) SetPressAmt(amt float64, t Timestamp, event_type EventType) {
   aa.this.press_sum += amt
   aa.this.press_amt = amt
   if amt != 0 {
@@ -154,7 +155,7 @@ func (aa *axisAggregator) SetPressAmt(amt float64, ms int64, event_type EventTyp
   }
   aa.handleEventType(event_type)
 }
-func (aa *axisAggregator) Think(ms int64) (bool, float64) {
+func (aa *axisAggregator) Think(t Timestamp) (bool, float64) {
   was_down := aa.prev.press_amt != 0
   aa.prev = aa.this
   aa.this = keyStats{}
@@ -181,13 +182,13 @@ func (wa *wheelAggregator) SendAllNonZero() bool {
   return true
 }
 
-func (wa *wheelAggregator) SetPressAmt(amt float64, ms int64, event_type EventType) {
+func (wa *wheelAggregator) SetPressAmt(amt float64, t Timestamp, event_type EventType) {
   wa.event_received = wa.last_press < wa.last_think
-  wa.standardAggregator.SetPressAmt(amt, ms, event_type)
+  wa.standardAggregator.SetPressAmt(amt, t, event_type)
 }
 
-func (wa *wheelAggregator) Think(ms int64) (bool, float64) {
-  if b, _ := wa.standardAggregator.Think(ms); b {
+func (wa *wheelAggregator) Think(t Timestamp) (bool, float64) {
+  if b, _ := wa.standardAggregator.Think(t); b {
     panic("standardAggregator should not generate an event on Think()")
   }
   if wa.CurPressAmt() != 0 {
@@ -235,7 +236,7 @@ func (ks *keyState) Cursor() Cursor {
 // monotonically increasing.
 // If this press was caused by another event (as is the case with derived keys), then
 // cause is the event that made this happen.
-func (ks *keyState) SetPressAmt(amt float64, ms int64, cause Event) (event Event) {
+func (ks *keyState) SetPressAmt(amt float64, t Timestamp, cause Event) (event Event) {
   event.Type = NoEvent
   event.Key = ks
   if (ks.CurPressAmt() == 0) != (amt == 0) {
@@ -251,6 +252,6 @@ func (ks *keyState) SetPressAmt(amt float64, ms int64, cause Event) (event Event
       event.Type = Adjust
     }
   }
-  ks.aggregator.SetPressAmt(amt, ms, event.Type)
+  ks.aggregator.SetPressAmt(amt, t, event.Type)
   return
 }
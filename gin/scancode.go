@@ -0,0 +1,296 @@
+package gin
+
+// A Scancode identifies a physical key by where it is on the keyboard rather
+// than by what is printed on it, so a binding to ScancodeW is on the same key
+// on a US keyboard, where it is labeled W, as on a French keyboard, where it
+// is labeled Z.  The values are USB HID usage ids from the keyboard page and
+// the names are those of the keys on a US keyboard.
+type Scancode int
+
+const (
+  NoScancode Scancode = 0
+
+  ScancodeA              Scancode = 4
+  ScancodeB              Scancode = 5
+  ScancodeC              Scancode = 6
+  ScancodeD              Scancode = 7
+  ScancodeE              Scancode = 8
+  ScancodeF              Scancode = 9
+  ScancodeG              Scancode = 10
+  ScancodeH              Scancode = 11
+  ScancodeI              Scancode = 12
+  ScancodeJ              Scancode = 13
+  ScancodeK              Scancode = 14
+  ScancodeL              Scancode = 15
+  ScancodeM              Scancode = 16
+  ScancodeN              Scancode = 17
+  ScancodeO              Scancode = 18
+  ScancodeP              Scancode = 19
+  ScancodeQ              Scancode = 20
+  ScancodeR              Scancode = 21
+  ScancodeS              Scancode = 22
+  ScancodeT              Scancode = 23
+  ScancodeU              Scancode = 24
+  ScancodeV              Scancode = 25
+  ScancodeW              Scancode = 26
+  ScancodeX              Scancode = 27
+  ScancodeY              Scancode = 28
+  ScancodeZ              Scancode = 29
+  Scancode1              Scancode = 30
+  Scancode2              Scancode = 31
+  Scancode3              Scancode = 32
+  Scancode4              Scancode = 33
+  Scancode5              Scancode = 34
+  Scancode6              Scancode = 35
+  Scancode7              Scancode = 36
+  Scancode8              Scancode = 37
+  Scancode9              Scancode = 38
+  Scancode0              Scancode = 39
+  ScancodeReturn         Scancode = 40
+  ScancodeEscape         Scancode = 41
+  ScancodeBackspace      Scancode = 42
+  ScancodeTab            Scancode = 43
+  ScancodeSpace          Scancode = 44
+  ScancodeMinus          Scancode = 45
+  ScancodeEquals         Scancode = 46
+  ScancodeLeftBracket    Scancode = 47
+  ScancodeRightBracket   Scancode = 48
+  ScancodeBackslash      Scancode = 49
+  ScancodeSemicolon      Scancode = 51
+  ScancodeApostrophe     Scancode = 52
+  ScancodeGrave          Scancode = 53
+  ScancodeComma          Scancode = 54
+  ScancodePeriod         Scancode = 55
+  ScancodeSlash          Scancode = 56
+  ScancodeCapsLock       Scancode = 57
+  ScancodeF1             Scancode = 58
+  ScancodeF2             Scancode = 59
+  ScancodeF3             Scancode = 60
+  ScancodeF4             Scancode = 61
+  ScancodeF5             Scancode = 62
+  ScancodeF6             Scancode = 63
+  ScancodeF7             Scancode = 64
+  ScancodeF8             Scancode = 65
+  ScancodeF9             Scancode = 66
+  ScancodeF10            Scancode = 67
+  ScancodeF11            Scancode = 68
+  ScancodeF12            Scancode = 69
+  ScancodePrintScreen    Scancode = 70
+  ScancodeScrollLock     Scancode = 71
+  ScancodePause          Scancode = 72
+  ScancodeInsert         Scancode = 73
+  ScancodeHome           Scancode = 74
+  ScancodePageUp         Scancode = 75
+  ScancodeDelete         Scancode = 76
+  ScancodeEnd            Scancode = 77
+  ScancodePageDown       Scancode = 78
+  ScancodeRight          Scancode = 79
+  ScancodeLeft           Scancode = 80
+  ScancodeDown           Scancode = 81
+  ScancodeUp             Scancode = 82
+  ScancodeNumLock        Scancode = 83
+  ScancodeKeyPadDivide   Scancode = 84
+  ScancodeKeyPadMultiply Scancode = 85
+  ScancodeKeyPadSubtract Scancode = 86
+  ScancodeKeyPadAdd      Scancode = 87
+  ScancodeKeyPadEnter    Scancode = 88
+  ScancodeKeyPad1        Scancode = 89
+  ScancodeKeyPad2        Scancode = 90
+  ScancodeKeyPad3        Scancode = 91
+  ScancodeKeyPad4        Scancode = 92
+  ScancodeKeyPad5        Scancode = 93
+  ScancodeKeyPad6        Scancode = 94
+  ScancodeKeyPad7        Scancode = 95
+  ScancodeKeyPad8        Scancode = 96
+  ScancodeKeyPad9        Scancode = 97
+  ScancodeKeyPad0        Scancode = 98
+  ScancodeKeyPadDecimal  Scancode = 99
+  ScancodeIntlBackslash  Scancode = 100
+  ScancodeMenu           Scancode = 101
+  ScancodeKeyPadEquals   Scancode = 103
+  ScancodeF13            Scancode = 104
+  ScancodeF14            Scancode = 105
+  ScancodeF15            Scancode = 106
+  ScancodeF16            Scancode = 107
+  ScancodeF17            Scancode = 108
+  ScancodeF18            Scancode = 109
+  ScancodeF19            Scancode = 110
+  ScancodeF20            Scancode = 111
+  ScancodeF21            Scancode = 112
+  ScancodeF22            Scancode = 113
+  ScancodeF23            Scancode = 114
+  ScancodeF24            Scancode = 115
+  ScancodeVolumeMute     Scancode = 127
+  ScancodeVolumeUp       Scancode = 128
+  ScancodeVolumeDown     Scancode = 129
+  ScancodeKeyPadComma    Scancode = 133
+  ScancodeIntlRo         Scancode = 135
+  ScancodeKanaMode       Scancode = 136
+  ScancodeIntlYen        Scancode = 137
+  ScancodeConvert        Scancode = 138
+  ScancodeNonConvert     Scancode = 139
+  ScancodeHangul         Scancode = 144
+  ScancodeHanja          Scancode = 145
+  ScancodeLeftControl    Scancode = 224
+  ScancodeLeftShift      Scancode = 225
+  ScancodeLeftAlt        Scancode = 226
+  ScancodeLeftGui        Scancode = 227
+  ScancodeRightControl   Scancode = 228
+  ScancodeRightShift     Scancode = 229
+  ScancodeRightAlt       Scancode = 230
+  ScancodeRightGui       Scancode = 231
+)
+
+// Keys for physical positions on the keyboard have ids starting here, see
+// ScancodeKey().
+const scancode_key_base = 2000
+
+// Returns the id of the key that is pressed whenever the key at the physical
+// position sc is pressed, regardless of keyboard layout.  These keys are named
+// after the key at that position on a US keyboard, prefixed with "Scancode",
+// e.g. "ScancodeW".
+func ScancodeKey(sc Scancode) KeyId {
+  return KeyId(scancode_key_base + sc)
+}
+
+// Every Scancode that gin registers a key for.
+var scancode_keys = []struct {
+  sc   Scancode
+  name string
+}{
+  {ScancodeA, "A"},
+  {ScancodeB, "B"},
+  {ScancodeC, "C"},
+  {ScancodeD, "D"},
+  {ScancodeE, "E"},
+  {ScancodeF, "F"},
+  {ScancodeG, "G"},
+  {ScancodeH, "H"},
+  {ScancodeI, "I"},
+  {ScancodeJ, "J"},
+  {ScancodeK, "K"},
+  {ScancodeL, "L"},
+  {ScancodeM, "M"},
+  {ScancodeN, "N"},
+  {ScancodeO, "O"},
+  {ScancodeP, "P"},
+  {ScancodeQ, "Q"},
+  {ScancodeR, "R"},
+  {ScancodeS, "S"},
+  {ScancodeT, "T"},
+  {ScancodeU, "U"},
+  {ScancodeV, "V"},
+  {ScancodeW, "W"},
+  {ScancodeX, "X"},
+  {ScancodeY, "Y"},
+  {ScancodeZ, "Z"},
+  {Scancode1, "1"},
+  {Scancode2, "2"},
+  {Scancode3, "3"},
+  {Scancode4, "4"},
+  {Scancode5, "5"},
+  {Scancode6, "6"},
+  {Scancode7, "7"},
+  {Scancode8, "8"},
+  {Scancode9, "9"},
+  {Scancode0, "0"},
+  {ScancodeReturn, "Return"},
+  {ScancodeEscape, "Escape"},
+  {ScancodeBackspace, "Backspace"},
+  {ScancodeTab, "Tab"},
+  {ScancodeSpace, "Space"},
+  {ScancodeMinus, "Minus"},
+  {ScancodeEquals, "Equals"},
+  {ScancodeLeftBracket, "LeftBracket"},
+  {ScancodeRightBracket, "RightBracket"},
+  {ScancodeBackslash, "Backslash"},
+  {ScancodeSemicolon, "Semicolon"},
+  {ScancodeApostrophe, "Apostrophe"},
+  {ScancodeGrave, "Grave"},
+  {ScancodeComma, "Comma"},
+  {ScancodePeriod, "Period"},
+  {ScancodeSlash, "Slash"},
+  {ScancodeCapsLock, "CapsLock"},
+  {ScancodeF1, "F1"},
+  {ScancodeF2, "F2"},
+  {ScancodeF3, "F3"},
+  {ScancodeF4, "F4"},
+  {ScancodeF5, "F5"},
+  {ScancodeF6, "F6"},
+  {ScancodeF7, "F7"},
+  {ScancodeF8, "F8"},
+  {ScancodeF9, "F9"},
+  {ScancodeF10, "F10"},
+  {ScancodeF11, "F11"},
+  {ScancodeF12, "F12"},
+  {ScancodePrintScreen, "PrintScreen"},
+  {ScancodeScrollLock, "ScrollLock"},
+  {ScancodePause, "Pause"},
+  {ScancodeInsert, "Insert"},
+  {ScancodeHome, "Home"},
+  {ScancodePageUp, "PageUp"},
+  {ScancodeDelete, "Delete"},
+  {ScancodeEnd, "End"},
+  {ScancodePageDown, "PageDown"},
+  {ScancodeRight, "Right"},
+  {ScancodeLeft, "Left"},
+  {ScancodeDown, "Down"},
+  {ScancodeUp, "Up"},
+  {ScancodeNumLock, "NumLock"},
+  {ScancodeKeyPadDivide, "KeyPadDivide"},
+  {ScancodeKeyPadMultiply, "KeyPadMultiply"},
+  {ScancodeKeyPadSubtract, "KeyPadSubtract"},
+  {ScancodeKeyPadAdd, "KeyPadAdd"},
+  {ScancodeKeyPadEnter, "KeyPadEnter"},
+  {ScancodeKeyPad1, "KeyPad1"},
+  {ScancodeKeyPad2, "KeyPad2"},
+  {ScancodeKeyPad3, "KeyPad3"},
+  {ScancodeKeyPad4, "KeyPad4"},
+  {ScancodeKeyPad5, "KeyPad5"},
+  {ScancodeKeyPad6, "KeyPad6"},
+  {ScancodeKeyPad7, "KeyPad7"},
+  {ScancodeKeyPad8, "KeyPad8"},
+  {ScancodeKeyPad9, "KeyPad9"},
+  {ScancodeKeyPad0, "KeyPad0"},
+  {ScancodeKeyPadDecimal, "KeyPadDecimal"},
+  {ScancodeIntlBackslash, "IntlBackslash"},
+  {ScancodeMenu, "Menu"},
+  {ScancodeKeyPadEquals, "KeyPadEquals"},
+  {ScancodeF13, "F13"},
+  {ScancodeF14, "F14"},
+  {ScancodeF15, "F15"},
+  {ScancodeF16, "F16"},
+  {ScancodeF17, "F17"},
+  {ScancodeF18, "F18"},
+  {ScancodeF19, "F19"},
+  {ScancodeF20, "F20"},
+  {ScancodeF21, "F21"},
+  {ScancodeF22, "F22"},
+  {ScancodeF23, "F23"},
+  {ScancodeF24, "F24"},
+  {ScancodeVolumeMute, "VolumeMute"},
+  {ScancodeVolumeUp, "VolumeUp"},
+  {ScancodeVolumeDown, "VolumeDown"},
+  {ScancodeKeyPadComma, "KeyPadComma"},
+  {ScancodeIntlRo, "IntlRo"},
+  {ScancodeKanaMode, "KanaMode"},
+  {ScancodeIntlYen, "IntlYen"},
+  {ScancodeConvert, "Convert"},
+  {ScancodeNonConvert, "NonConvert"},
+  {ScancodeHangul, "Hangul"},
+  {ScancodeHanja, "Hanja"},
+  {ScancodeLeftControl, "LeftControl"},
+  {ScancodeLeftShift, "LeftShift"},
+  {ScancodeLeftAlt, "LeftAlt"},
+  {ScancodeLeftGui, "LeftGui"},
+  {ScancodeRightControl, "RightControl"},
+  {ScancodeRightShift, "RightShift"},
+  {ScancodeRightAlt, "RightAlt"},
+  {ScancodeRightGui, "RightGui"},
+}
+
+func (input *Input) registerScancodeKeys() {
+  for _, k := range scancode_keys {
+    input.registerNaturalKey(ScancodeKey(k.sc), "Scancode"+k.name)
+  }
+}
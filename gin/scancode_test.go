@@ -0,0 +1,52 @@
+package gin_test
+
+import (
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+  "github.com/MobRulesGames/glop/gin"
+)
+
+func ScancodeSpec(c gospec.Context) {
+  input := gin.Make()
+  keyz := input.GetKey('z')
+  keyw := input.GetKey(gin.ScancodeKey(gin.ScancodeW))
+  c.Specify("Scancode keys are registered by name.", func() {
+    c.Expect(input.GetKeyByName("ScancodeW"), Equals, keyw)
+  })
+
+  c.Specify("An event with a scancode presses the key and the scancode key together.", func() {
+    // Pressing the key labeled Z on a French keyboard
+    events := []gin.OsEvent{
+      {KeyId: 'z', Scancode: gin.ScancodeW, Press_amt: 1, Timestamp: 5},
+    }
+    groups := input.Think(10, false, events)
+    c.Expect(len(groups), Equals, 1)
+    c.Expect(len(groups[0].Events), Equals, 2)
+    c.Expect(keyz.FramePressCount(), Equals, 1)
+    c.Expect(keyw.FramePressCount(), Equals, 1)
+
+    events = []gin.OsEvent{
+      {KeyId: 'z', Scancode: gin.ScancodeW, Press_amt: 0, Timestamp: 15},
+    }
+    input.Think(20, false, events)
+    c.Expect(keyz.FrameReleaseCount(), Equals, 1)
+    c.Expect(keyw.FrameReleaseCount(), Equals, 1)
+  })
+
+  c.Specify("An event with only a scancode presses just the scancode key.", func() {
+    events := []gin.OsEvent{
+      {Scancode: gin.ScancodeSemicolon, Press_amt: 1, Timestamp: 5},
+    }
+    input.Think(10, false, events)
+    c.Expect(input.GetKey(gin.ScancodeKey(gin.ScancodeSemicolon)).FramePressCount(), Equals, 1)
+    c.Expect(input.GetKey(';').FramePressCount(), Equals, 0)
+  })
+
+  c.Specify("The horizontal mouse wheel is registered.", func() {
+    events := []gin.OsEvent{
+      {KeyId: gin.MouseWheelHorizontal, Press_amt: -1, Timestamp: 5},
+    }
+    input.Think(10, false, events)
+    c.Expect(input.GetKey(gin.MouseWheelHorizontal).FramePressCount(), Equals, 1)
+  })
+}
@@ -0,0 +1,53 @@
+package gin
+
+import (
+  "time"
+)
+
+// A Timestamp is a time in microseconds.  Timestamps that come from the system
+// package are measured on a monotonic clock and are relative to when the
+// system was started, so they never go backwards and can be compared and
+// subtracted freely.  A difference between two Timestamps is also a
+// Timestamp.
+type Timestamp int64
+
+const (
+  Microsecond Timestamp = 1
+  Millisecond           = 1000 * Microsecond
+  Second                = 1000 * Millisecond
+)
+
+// Converts a time in milliseconds, which is what glop used before it had a
+// Timestamp type, to a Timestamp.
+func FromMs(ms int64) Timestamp {
+  return Timestamp(ms) * Millisecond
+}
+
+func FromSeconds(seconds float64) Timestamp {
+  return Timestamp(seconds * float64(Second))
+}
+
+func FromDuration(d time.Duration) Timestamp {
+  return Timestamp(d / time.Microsecond)
+}
+
+// Returns t in whole milliseconds, rounded down.
+func (t Timestamp) Ms() int64 {
+  if t < 0 {
+    return -int64((-t + Millisecond - 1) / Millisecond)
+  }
+  return int64(t / Millisecond)
+}
+
+// Returns t in milliseconds, without any rounding.
+func (t Timestamp) FloatMs() float64 {
+  return float64(t) / float64(Millisecond)
+}
+
+func (t Timestamp) Seconds() float64 {
+  return float64(t) / float64(Second)
+}
+
+func (t Timestamp) Duration() time.Duration {
+  return time.Duration(t) * time.Microsecond
+}
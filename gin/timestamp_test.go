@@ -0,0 +1,30 @@
+package gin_test
+
+import (
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+  "github.com/MobRulesGames/glop/gin"
+  "time"
+)
+
+func TimestampSpec(c gospec.Context) {
+  c.Specify("Timestamps are in microseconds.", func() {
+    c.Expect(gin.Millisecond, Equals, gin.Timestamp(1000))
+    c.Expect(gin.Second, Equals, gin.Timestamp(1000000))
+  })
+
+  c.Specify("Timestamps convert to and from milliseconds.", func() {
+    c.Expect(gin.FromMs(16), Equals, gin.Timestamp(16000))
+    c.Expect(gin.FromMs(16).Ms(), Equals, int64(16))
+    c.Expect(gin.Timestamp(16999).Ms(), Equals, int64(16))
+    c.Expect(gin.Timestamp(-1).Ms(), Equals, int64(-1))
+    c.Expect(gin.Timestamp(1500).FloatMs(), Equals, 1.5)
+  })
+
+  c.Specify("Timestamps convert to and from seconds and durations.", func() {
+    c.Expect(gin.FromSeconds(0.25), Equals, 250*gin.Millisecond)
+    c.Expect((250 * gin.Millisecond).Seconds(), Equals, 0.25)
+    c.Expect(gin.FromDuration(3*time.Millisecond), Equals, 3*gin.Millisecond)
+    c.Expect((3 * gin.Millisecond).Duration(), Equals, 3*time.Millisecond)
+  })
+}
@@ -5,15 +5,22 @@ package gos
 import "C"
 
 import (
+  "errors"
   "github.com/MobRulesGames/glop/system"
   "github.com/MobRulesGames/glop/gin"
+  "image"
   "unsafe"
 )
 
 type osxSystemObject struct {
   window  uintptr // NSWindow*
   context uintptr // NSOpenGLContext*
-  horizon int64
+  horizon gin.Timestamp
+
+  clipboard string
+
+  // The context attributes that were requested
+  context_attributes system.ContextAttributes
 }
 
 var (
@@ -37,10 +44,24 @@ func (osx *osxSystemObject) Quit() {
   C.Quit()
 }
 
-func (osx *osxSystemObject) CreateWindow(x, y, width, height int) {
+// TODO: Support the rest of the window options and report the real context
+// attributes.
+func (osx *osxSystemObject) CreateWindow(options system.WindowOptions) {
   w := (*unsafe.Pointer)(unsafe.Pointer(&osx.window))
   c := (*unsafe.Pointer)(unsafe.Pointer(&osx.context))
-  C.CreateWindow(w, c, C.int(x), C.int(y), C.int(width), C.int(height))
+  C.CreateWindow(w, c, C.int(options.X), C.int(options.Y), C.int(options.Dx), C.int(options.Dy))
+  osx.SetWindowTitle(options.Title)
+  osx.context_attributes = options.Context
+}
+
+func (osx *osxSystemObject) SetWindowTitle(title string) {
+  ctitle := []byte(title)
+  ctitle = append(ctitle, 0)
+  C.SetWindowTitle(unsafe.Pointer(osx.window), (*C.char)(unsafe.Pointer(&ctitle[0])))
+}
+
+func (osx *osxSystemObject) GetContextAttributes() system.ContextAttributes {
+  return osx.context_attributes
 }
 
 func (osx *osxSystemObject) SwapBuffers() {
@@ -51,17 +72,15 @@ func (osx *osxSystemObject) Think() {
   C.Think()
 }
 
-// TODO: Make sure that events are given in sorted order (by timestamp)
-// TODO: Adjust timestamp on events so that the oldest timestamp is newer than the
-//       newest timestemp from the events from the previous call to GetInputEvents
-//       Actually that should be in system
-func (osx *osxSystemObject) GetInputEvents() ([]gin.OsEvent, int64) {
+// Timestamps are in microseconds, system sorts the events and keeps them
+// within the horizons.
+func (osx *osxSystemObject) GetInputEvents() ([]gin.OsEvent, gin.Timestamp) {
   var first_event *C.KeyEvent
   cp := (*unsafe.Pointer)(unsafe.Pointer(&first_event))
   var length C.int
   var horizon C.longlong
   C.GetInputEvents(cp, &length, &horizon)
-  osx.horizon = int64(horizon)
+  osx.horizon = gin.Timestamp(horizon)
   c_events := (*[1000]C.KeyEvent)(unsafe.Pointer(first_event))[:length]
   events := make([]gin.OsEvent, length)
   for i := range c_events {
@@ -69,7 +88,7 @@ func (osx *osxSystemObject) GetInputEvents() ([]gin.OsEvent, int64) {
     events[i] = gin.OsEvent{
       KeyId:     gin.KeyId(c_events[i].index),
       Press_amt: float64(c_events[i].press_amt),
-      Timestamp: int64(c_events[i].timestamp),
+      Timestamp: gin.Timestamp(c_events[i].timestamp),
       X:         wx,
       Y:         wy,
     }
@@ -111,3 +130,92 @@ func (osx *osxSystemObject) EnableVSync(enable bool) {
   }
   C.EnableVSync(unsafe.Pointer(osx.context), _enable)
 }
+
+// TODO: Use the system clipboard, for now this only lets text be copied and
+// pasted within the application.
+func (osx *osxSystemObject) GetClipboardText() string {
+  return osx.clipboard
+}
+
+func (osx *osxSystemObject) SetClipboardText(text string) {
+  osx.clipboard = text
+}
+
+// TODO: Implement the rest of the cursor functions
+func (osx *osxSystemObject) WarpCursor(x, y int) {
+}
+
+func (osx *osxSystemObject) ConfineCursor(confine bool) {
+}
+
+func (osx *osxSystemObject) SetCursorImage(img image.Image, hot_x, hot_y int) {
+}
+
+func (osx *osxSystemObject) SetSystemCursor(cursor system.SystemCursor) {
+}
+
+// TODO: Enumerate the real monitors and support full screen, for now the
+// window is reported as the only monitor and can only be windowed.
+func (osx *osxSystemObject) GetMonitors() []system.Monitor {
+  _, _, dx, dy := osx.GetWindowDims()
+  return []system.Monitor{
+    {
+      Name:    "default",
+      Dx:      dx,
+      Dy:      dy,
+      Primary: true,
+      Modes:   []system.DisplayMode{{Dx: dx, Dy: dy}},
+    },
+  }
+}
+
+func (osx *osxSystemObject) SetWindowMode(mode system.WindowMode, monitor int, display system.DisplayMode) error {
+  if mode != system.Windowed {
+    return errors.New("Full screen modes are not supported on this platform yet.")
+  }
+  return nil
+}
+
+func (osx *osxSystemObject) GetWindowMode() system.WindowMode {
+  return system.Windowed
+}
+
+// TODO: Track focus and minimization so that the frame rate can be throttled
+// in the background.
+func (osx *osxSystemObject) GetWindowState() system.WindowState {
+  return system.WindowState{Focused: true}
+}
+
+// TODO: Accept files dropped onto the window.
+func (osx *osxSystemObject) GetDropEvents() []system.DropEvent {
+  return nil
+}
+
+// TODO: Report text, including text from input methods.
+func (osx *osxSystemObject) GetTextEvents() []system.TextEvent {
+  return nil
+}
+
+func (osx *osxSystemObject) EnableTextInput(enable bool) bool {
+  return false
+}
+
+func (osx *osxSystemObject) SetTextInputPosition(x, y int) {
+}
+
+// TODO: Report joysticks and gamepads.
+func (osx *osxSystemObject) GetJoysticks() []gin.Joystick {
+  return nil
+}
+
+// TODO: Implement offscreen rendering with framebuffer objects.
+func (osx *osxSystemObject) BeginOffscreen(dx, dy int) error {
+  return errors.New("Offscreen rendering is not implemented yet.")
+}
+
+func (osx *osxSystemObject) EndOffscreen() {}
+
+// TODO: Implement this with glReadPixels.
+func (osx *osxSystemObject) ReadPixels(img *image.RGBA) error {
+  return errors.New("Reading pixels is not implemented yet.")
+}
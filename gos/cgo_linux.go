@@ -1,17 +1,26 @@
 package gos
 
-// #cgo LDFLAGS: -Llinux/lib -lglop -lX11 -lGL
+// #cgo LDFLAGS: -Llinux/lib -lglop -lX11 -lXrender -lXrandr -lXi -lGL
+// #include <stdlib.h>
 // #include "linux/include/glop.h"
 import "C"
 
 import (
+  "errors"
+  "fmt"
   "github.com/MobRulesGames/glop/system"
   "github.com/MobRulesGames/glop/gin"
+  "github.com/MobRulesGames/glop/gos/linux/evdev"
+  "image"
+  "image/draw"
+  "strings"
   "unsafe"
 )
 
 type linuxSystemObject struct {
-  horizon int64
+  horizon gin.Timestamp
+  window_mode system.WindowMode
+  joysticks *evdev.Manager
 }
 
 var (
@@ -21,6 +30,7 @@ var (
 // Call after runtime.LockOSThread(), *NOT* in an init function
 func (linux *linuxSystemObject) Startup() {
   C.GlopInit()
+  linux.joysticks = evdev.MakeManager("/dev/input")
 }
 
 func GetSystemInterface() system.Os {
@@ -35,30 +45,140 @@ func (linux *linuxSystemObject) Quit() {
   panic("Not implemented on linux")
 }
 
-func (linux *linuxSystemObject) CreateWindow(x,y,width,height int) {
-  C.GlopCreateWindow(unsafe.Pointer(&(([]byte("linux window"))[0])), C.int(x), C.int(y), C.int(width), C.int(height))
+func cBool(b bool) C.int {
+  if b {
+    return 1
+  }
+  return 0
+}
+
+func (linux *linuxSystemObject) CreateWindow(options system.WindowOptions) {
+  var c C.GlopWindowOptions
+  c.title = C.CString(options.Title)
+  defer C.free(unsafe.Pointer(c.title))
+  c.x = C.int(options.X)
+  c.y = C.int(options.Y)
+  c.width = C.int(options.Dx)
+  c.height = C.int(options.Dy)
+  c.resizable = cBool(options.Resizable)
+  c.decorated = cBool(options.Decorated)
+  c.always_on_top = cBool(options.Always_on_top)
+  c.min_width = C.int(options.Min_dx)
+  c.min_height = C.int(options.Min_dy)
+  c.max_width = C.int(options.Max_dx)
+  c.max_height = C.int(options.Max_dy)
+  c.offscreen = cBool(options.Offscreen)
+  c.raw_mouse_motion = cBool(options.Raw_mouse_motion)
+  c.smooth_scroll = cBool(options.Smooth_scroll)
+
+  // c is passed to C, so the icons can't live in Go memory
+  icons := packIcons(options.Icons)
+  if len(icons) > 0 {
+    size := C.size_t(len(icons)) * C.size_t(unsafe.Sizeof(icons[0]))
+    c.icons = (*C.ulong)(C.malloc(size))
+    defer C.free(unsafe.Pointer(c.icons))
+    copy((*[1 << 28]C.ulong)(unsafe.Pointer(c.icons))[:len(icons)], icons)
+    c.icons_length = C.int(len(icons))
+  }
+
+  c.context.major = C.int(options.Context.Major)
+  c.context.minor = C.int(options.Context.Minor)
+  c.context.core_profile = cBool(options.Context.Profile == system.CoreProfile)
+  c.context.depth_bits = C.int(options.Context.Depth_bits)
+  c.context.stencil_bits = C.int(options.Context.Stencil_bits)
+  c.context.samples = C.int(options.Context.Samples)
+  c.context.srgb = cBool(options.Context.Srgb)
+  C.GlopCreateWindow(&c)
+}
+
+// Packs icons in the format that _NET_WM_ICON uses, width, height and then
+// non-premultiplied ARGB pixels, for each icon.
+func packIcons(icons []image.Image) []C.ulong {
+  var packed []C.ulong
+  for _, icon := range icons {
+    b := icon.Bounds()
+    if b.Dx() == 0 || b.Dy() == 0 {
+      continue
+    }
+    nrgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+    draw.Draw(nrgba, nrgba.Bounds(), icon, b.Min, draw.Src)
+    packed = append(packed, C.ulong(b.Dx()), C.ulong(b.Dy()))
+    for i := 0; i < b.Dx()*b.Dy(); i++ {
+      p := nrgba.Pix[4*i : 4*i+4]
+      packed = append(packed, C.ulong(p[3])<<24|C.ulong(p[0])<<16|C.ulong(p[1])<<8|C.ulong(p[2]))
+    }
+  }
+  return packed
+}
+
+func (linux *linuxSystemObject) SetWindowTitle(title string) {
+  ctitle := C.CString(title)
+  defer C.free(unsafe.Pointer(ctitle))
+  C.GlopSetWindowTitle(ctitle)
+}
+
+func (linux *linuxSystemObject) GetContextAttributes() system.ContextAttributes {
+  var c C.GlopContextAttributes
+  C.GlopGetContextAttributes(&c)
+  attribs := system.ContextAttributes{
+    Major:        int(c.major),
+    Minor:        int(c.minor),
+    Depth_bits:   int(c.depth_bits),
+    Stencil_bits: int(c.stencil_bits),
+    Samples:      int(c.samples),
+    Srgb:         c.srgb != 0,
+  }
+  if c.core_profile != 0 {
+    attribs.Profile = system.CoreProfile
+  }
+  return attribs
 }
 
 func (linux *linuxSystemObject) SwapBuffers() {
   C.GlopSwapBuffers()
 }
 
-func (linux *linuxSystemObject) Think() bool {
+func (linux *linuxSystemObject) BeginOffscreen(dx, dy int) error {
+  if C.GlopBeginOffscreen(C.int(dx), C.int(dy)) != 0 {
+    return fmt.Errorf("Unable to create a %dx%d offscreen framebuffer.", dx, dy)
+  }
+  return nil
+}
+
+func (linux *linuxSystemObject) EndOffscreen() {
+  C.GlopEndOffscreen()
+}
+
+func (linux *linuxSystemObject) ReadPixels(img *image.RGBA) error {
+  dx, dy := img.Bounds().Dx(), img.Bounds().Dy()
+  if dx == 0 || dy == 0 {
+    return nil
+  }
+  pix := make([]byte, 4*dx*dy)
+  if C.GlopReadPixels((*C.uchar)(unsafe.Pointer(&pix[0])), C.int(dx), C.int(dy)) != 0 {
+    return errors.New("Unable to read pixels from the framebuffer.")
+  }
+  // OpenGl gives us the bottom row first
+  for y := 0; y < dy; y++ {
+    row := pix[4*dx*(dy-1-y) : 4*dx*(dy-y)]
+    copy(img.Pix[img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y+y):], row)
+  }
+  return nil
+}
+
+func (linux *linuxSystemObject) Think() {
   C.GlopThink()
-  return true
 }
 
-// TODO: Make sure that events are given in sorted order (by timestamp)
-// TODO: Adjust timestamp on events so that the oldest timestamp is newer than the
-//       newest timestemp from the events from the previous call to GetInputEvents
-//       Actually that should be in system
-func (linux *linuxSystemObject) GetInputEvents() ([]gin.OsEvent, int64) {
+// Timestamps are in microseconds, system sorts the events and keeps them
+// within the horizons.
+func (linux *linuxSystemObject) GetInputEvents() ([]gin.OsEvent, gin.Timestamp) {
   var first_event *C.GlopKeyEvent
   cp := (*unsafe.Pointer)(unsafe.Pointer(&first_event))
   var length C.int
   var horizon C.longlong
   C.GlopGetInputEvents(cp, unsafe.Pointer(&length), unsafe.Pointer(&horizon))
-  linux.horizon = int64(horizon)
+  linux.horizon = gin.Timestamp(horizon)
   c_events := (*[1000]C.GlopKeyEvent)(unsafe.Pointer(first_event))[:length]
   events := make([]gin.OsEvent, length)
   for i := range c_events {
@@ -66,15 +186,110 @@ func (linux *linuxSystemObject) GetInputEvents() ([]gin.OsEvent, int64) {
     events[i] = gin.OsEvent{
       KeyId     : gin.KeyId(c_events[i].index),
       Press_amt : float64(c_events[i].press_amt),
-      Timestamp : int64(c_events[i].timestamp),
+      Timestamp : gin.Timestamp(c_events[i].timestamp),
+      Scancode : gin.Scancode(c_events[i].scancode),
       X : wx,
       Y : wy,
     }
   }
+  // evdev stamps events with the same clock that we use, but a joystick can
+  // report events that X hasn't caught up with yet, system moves those to the
+  // horizon.
+  events = append(events, linux.joysticks.Poll()...)
   return events, linux.horizon
 }
 
+func (linux *linuxSystemObject) GetJoysticks() []gin.Joystick {
+  return linux.joysticks.Joysticks()
+}
+
+func (linux *linuxSystemObject) GetDropEvents() []system.DropEvent {
+  var cdrops unsafe.Pointer
+  var length C.int
+  C.GlopGetDropEvents(&cdrops, &length)
+  if length == 0 {
+    return nil
+  }
+  c_drops := (*[1 << 16]C.GlopDropEvent)(cdrops)[:length:length]
+  drops := make([]system.DropEvent, len(c_drops))
+  for i, cd := range c_drops {
+    paths := C.GoStringN(cd.paths, cd.paths_length)
+    drops[i].Paths = strings.Split(strings.TrimRight(paths, "\x00"), "\x00")
+    drops[i].X, drops[i].Y = linux.rawCursorToWindowCoords(int(cd.x), int(cd.y))
+    drops[i].Timestamp = gin.Timestamp(cd.timestamp)
+  }
+  return drops
+}
+
+func (linux *linuxSystemObject) GetTextEvents() []system.TextEvent {
+  var ctexts unsafe.Pointer
+  var length C.int
+  C.GlopGetTextEvents(&ctexts, &length)
+  if length == 0 {
+    return nil
+  }
+  c_texts := (*[1 << 16]C.GlopTextEvent)(ctexts)[:length:length]
+  texts := make([]system.TextEvent, len(c_texts))
+  for i, ct := range c_texts {
+    texts[i] = system.TextEvent{
+      Text:      C.GoStringN(ct.text, ct.text_length),
+      Preedit:   ct.preedit != 0,
+      Cursor:    int(ct.cursor),
+      Timestamp: gin.Timestamp(ct.timestamp),
+    }
+  }
+  return texts
+}
+
+func (linux *linuxSystemObject) EnableTextInput(enable bool) bool {
+  C.GlopEnableTextInput(cBool(enable))
+  return true
+}
+
+func (linux *linuxSystemObject) SetTextInputPosition(x, y int) {
+  _, _, _, wdy := linux.GetWindowDims()
+  C.GlopSetTextInputPosition(C.int(x), C.int(wdy-y))
+}
+
 func (linux *linuxSystemObject) HideCursor(hide bool) {
+  var _hide C.int
+  if hide {
+    _hide = 1
+  }
+  C.GlopHideCursor(_hide)
+}
+
+func (linux *linuxSystemObject) ConfineCursor(confine bool) {
+  var _confine C.int
+  if confine {
+    _confine = 1
+  }
+  C.GlopConfineCursor(_confine)
+}
+
+func (linux *linuxSystemObject) WarpCursor(x,y int) {
+  wx,wy,_,wdy := linux.GetWindowDims()
+  C.GlopWarpCursor(C.int(x + wx), C.int(wy + wdy - y))
+}
+
+func (linux *linuxSystemObject) SetCursorImage(img image.Image, hot_x,hot_y int) {
+  b := img.Bounds()
+  if b.Dx() == 0 || b.Dy() == 0 {
+    return
+  }
+  // image.RGBA is premultiplied, which is what X wants
+  rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+  draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+  argb := make([]C.uint, b.Dx() * b.Dy())
+  for i := range argb {
+    p := rgba.Pix[4*i : 4*i+4]
+    argb[i] = C.uint(p[3])<<24 | C.uint(p[0])<<16 | C.uint(p[1])<<8 | C.uint(p[2])
+  }
+  C.GlopSetCursorImage(&argb[0], C.int(b.Dx()), C.int(b.Dy()), C.int(hot_x), C.int(hot_y))
+}
+
+func (linux *linuxSystemObject) SetSystemCursor(cursor system.SystemCursor) {
+  C.GlopSetSystemCursor(C.int(cursor))
 }
 
 func (linux *linuxSystemObject) rawCursorToWindowCoords(x,y int) (int,int) {
@@ -94,6 +309,57 @@ func (linux *linuxSystemObject) GetWindowDims() (int,int,int,int) {
   return int(x), int(y), int(dx), int(dy)
 }
 
+func (linux *linuxSystemObject) GetMonitors() []system.Monitor {
+  var cmonitors, cmodes unsafe.Pointer
+  var num_monitors, num_modes C.int
+  C.GlopGetMonitors(&cmonitors, &num_monitors, &cmodes, &num_modes)
+  if num_monitors == 0 {
+    return nil
+  }
+  c_monitors := (*[1 << 16]C.GlopMonitor)(cmonitors)[:num_monitors:num_monitors]
+  var c_modes []C.GlopDisplayMode
+  if num_modes > 0 {
+    c_modes = (*[1 << 16]C.GlopDisplayMode)(cmodes)[:num_modes:num_modes]
+  }
+  monitors := make([]system.Monitor, len(c_monitors))
+  for i, cm := range c_monitors {
+    m := &monitors[i]
+    m.Name = C.GoString(&cm.name[0])
+    m.X, m.Y, m.Dx, m.Dy = int(cm.x), int(cm.y), int(cm.dx), int(cm.dy)
+    m.Refresh_rate = float64(cm.refresh_rate)
+    m.Primary = cm.primary != 0
+    for _, cmode := range c_modes[cm.first_mode : cm.first_mode+cm.num_modes] {
+      m.Modes = append(m.Modes, system.DisplayMode{
+        Dx:           int(cmode.dx),
+        Dy:           int(cmode.dy),
+        Refresh_rate: float64(cmode.refresh_rate),
+      })
+    }
+  }
+  return monitors
+}
+
+func (linux *linuxSystemObject) SetWindowMode(mode system.WindowMode, monitor int, display system.DisplayMode) error {
+  if C.GlopSetWindowMode(C.int(mode), C.int(monitor), C.int(display.Dx), C.int(display.Dy), C.float(display.Refresh_rate)) != 0 {
+    return errors.New("Unable to change the window mode.")
+  }
+  linux.window_mode = mode
+  return nil
+}
+
+func (linux *linuxSystemObject) GetWindowMode() system.WindowMode {
+  return linux.window_mode
+}
+
+func (linux *linuxSystemObject) GetWindowState() system.WindowState {
+  var focused, minimized C.int
+  C.GlopGetWindowState(&focused, &minimized)
+  return system.WindowState{
+    Focused:   focused != 0,
+    Minimized: minimized != 0,
+  }
+}
+
 func (linux *linuxSystemObject) EnableVSync(enable bool) {
   var _enable C.int
   if enable {
@@ -101,3 +367,26 @@ func (linux *linuxSystemObject) EnableVSync(enable bool) {
   }
   C.GlopEnableVSync(_enable)
 }
+
+func (linux *linuxSystemObject) GetClipboardText() string {
+  var text *C.char
+  var length C.int
+  C.GlopGetClipboardText(0, &text, &length)
+  return C.GoStringN(text, length)
+}
+
+// Returns the text on the PRIMARY selection, which is whatever was most
+// recently selected in another application.  GetClipboardText never falls
+// back to it, since that isn't what was copied.
+func (linux *linuxSystemObject) GetPrimarySelectionText() string {
+  var text *C.char
+  var length C.int
+  C.GlopGetClipboardText(1, &text, &length)
+  return C.GoStringN(text, length)
+}
+
+func (linux *linuxSystemObject) SetClipboardText(text string) {
+  ctext := C.CString(text)
+  defer C.free(unsafe.Pointer(ctext))
+  C.GlopSetClipboardText(ctext, C.int(len(text)))
+}
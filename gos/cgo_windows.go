@@ -5,14 +5,21 @@ package gos
 import "C"
 
 import (
+  "errors"
   "github.com/MobRulesGames/glop/system"
   "github.com/MobRulesGames/glop/gin"
+  "image"
   "unsafe"
 )
 
 type win32SystemObject struct {
-  horizon int64
+  horizon gin.Timestamp
   window  uintptr
+
+  clipboard string
+
+  // The context attributes that were requested
+  context system.ContextAttributes
 }
 var (
   win32_system_object win32SystemObject
@@ -35,12 +42,30 @@ func (win32 *win32SystemObject) Quit() {
 //  C.Quit()
 }
 
-func (win32 *win32SystemObject) CreateWindow(x,y,width,height int) {
-  title := []byte("Mob Rules")
+// TODO: Support the rest of the window options and report the real context
+// attributes.
+func (win32 *win32SystemObject) CreateWindow(options system.WindowOptions) {
+  title := []byte(options.Title)
   title = append(title, 0)
+  resizable := 0
+  if options.Resizable {
+    resizable = 1
+  }
   win32.window = uintptr(unsafe.Pointer(C.GlopCreateWindow(
     unsafe.Pointer(&title[0]),
-    C.int(x), C.int(y), C.int(width), C.int(height), 0, 8, 0)))
+    C.int(options.X), C.int(options.Y), C.int(options.Dx), C.int(options.Dy),
+    0, C.int(options.Context.Stencil_bits), C.int(resizable))))
+  win32.context = options.Context
+}
+
+func (win32 *win32SystemObject) SetWindowTitle(title string) {
+  ctitle := []byte(title)
+  ctitle = append(ctitle, 0)
+  C.GlopSetWindowTitle(unsafe.Pointer(win32.window), (*C.char)(unsafe.Pointer(&ctitle[0])))
+}
+
+func (win32 *win32SystemObject) GetContextAttributes() system.ContextAttributes {
+  return win32.context
 }
 
 func (win32 *win32SystemObject) SwapBuffers() {
@@ -51,17 +76,15 @@ func (win32 *win32SystemObject) Think() {
   C.GlopThink()
 }
 
-// TODO: Make sure that events are given in sorted order (by timestamp)
-// TODO: Adjust timestamp on events so that the oldest timestamp is newer than the
-//       newest timestemp from the events from the previous call to GetInputEvents
-//       Actually that should be in system
-func (win32 *win32SystemObject) GetInputEvents() ([]gin.OsEvent, int64) {
+// Timestamps are in microseconds, system sorts the events and keeps them
+// within the horizons.
+func (win32 *win32SystemObject) GetInputEvents() ([]gin.OsEvent, gin.Timestamp) {
   var first_event *C.GlopKeyEvent
   cp := (*unsafe.Pointer)(unsafe.Pointer(&first_event))
   var length C.int
   var horizon C.longlong
   C.GlopGetInputEvents(unsafe.Pointer(win32.window), cp, unsafe.Pointer(&length), unsafe.Pointer(&horizon))
-  win32.horizon = int64(horizon)
+  win32.horizon = gin.Timestamp(horizon)
   c_events := (*[10000]C.GlopKeyEvent)(unsafe.Pointer(first_event))[:length]
   events := make([]gin.OsEvent, length)
   for i := range c_events {
@@ -69,7 +92,7 @@ func (win32 *win32SystemObject) GetInputEvents() ([]gin.OsEvent, int64) {
     events[i] = gin.OsEvent{
       KeyId     : gin.KeyId(c_events[i].index),
       Press_amt : float64(c_events[i].press_amt),
-      Timestamp : int64(c_events[i].timestamp),
+      Timestamp : gin.Timestamp(c_events[i].timestamp),
       X : wx,
       Y : wy,
     }
@@ -104,3 +127,92 @@ func (win32 *win32SystemObject) EnableVSync(enable bool) {
 
 func (win32 *win32SystemObject) HideCursor(hide bool) {
 }
+
+// TODO: Use the system clipboard, for now this only lets text be copied and
+// pasted within the application.
+func (win32 *win32SystemObject) GetClipboardText() string {
+  return win32.clipboard
+}
+
+func (win32 *win32SystemObject) SetClipboardText(text string) {
+  win32.clipboard = text
+}
+
+// TODO: Implement the rest of the cursor functions
+func (win32 *win32SystemObject) WarpCursor(x, y int) {
+}
+
+func (win32 *win32SystemObject) ConfineCursor(confine bool) {
+}
+
+func (win32 *win32SystemObject) SetCursorImage(img image.Image, hot_x, hot_y int) {
+}
+
+func (win32 *win32SystemObject) SetSystemCursor(cursor system.SystemCursor) {
+}
+
+// TODO: Enumerate the real monitors and support full screen, for now the
+// window is reported as the only monitor and can only be windowed.
+func (win32 *win32SystemObject) GetMonitors() []system.Monitor {
+  _, _, dx, dy := win32.GetWindowDims()
+  return []system.Monitor{
+    {
+      Name:    "default",
+      Dx:      dx,
+      Dy:      dy,
+      Primary: true,
+      Modes:   []system.DisplayMode{{Dx: dx, Dy: dy}},
+    },
+  }
+}
+
+func (win32 *win32SystemObject) SetWindowMode(mode system.WindowMode, monitor int, display system.DisplayMode) error {
+  if mode != system.Windowed {
+    return errors.New("Full screen modes are not supported on this platform yet.")
+  }
+  return nil
+}
+
+func (win32 *win32SystemObject) GetWindowMode() system.WindowMode {
+  return system.Windowed
+}
+
+// TODO: Track focus and minimization so that the frame rate can be throttled
+// in the background.
+func (win32 *win32SystemObject) GetWindowState() system.WindowState {
+  return system.WindowState{Focused: true}
+}
+
+// TODO: Accept files dropped onto the window.
+func (win32 *win32SystemObject) GetDropEvents() []system.DropEvent {
+  return nil
+}
+
+// TODO: Report text, including text from input methods.
+func (win32 *win32SystemObject) GetTextEvents() []system.TextEvent {
+  return nil
+}
+
+func (win32 *win32SystemObject) EnableTextInput(enable bool) bool {
+  return false
+}
+
+func (win32 *win32SystemObject) SetTextInputPosition(x, y int) {
+}
+
+// TODO: Report joysticks and gamepads.
+func (win32 *win32SystemObject) GetJoysticks() []gin.Joystick {
+  return nil
+}
+
+// TODO: Implement offscreen rendering with framebuffer objects.
+func (win32 *win32SystemObject) BeginOffscreen(dx, dy int) error {
+  return errors.New("Offscreen rendering is not implemented yet.")
+}
+
+func (win32 *win32SystemObject) EndOffscreen() {}
+
+// TODO: Implement this with glReadPixels.
+func (win32 *win32SystemObject) ReadPixels(img *image.RGBA) error {
+  return errors.New("Reading pixels is not implemented yet.")
+}
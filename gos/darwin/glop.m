@@ -44,8 +44,12 @@ long long NSTimeIntervalToMS(NSTimeInterval t) {
   return (long long)((double)(t) * 1000.0 + 0.5);
 }
 
+long long NSTimeIntervalToUS(NSTimeInterval t) {
+  return (long long)((double)(t) * 1000000.0 + 0.5);
+}
+
 void ClearEvent(KeyEvent* event, NSEvent* ns_event) {
-  event->timestamp = NSTimeIntervalToMS([ns_event timestamp]);
+  event->timestamp = NSTimeIntervalToUS([ns_event timestamp]);
   event->press_amt = 0;
   event->cursor_x = inputState.mouse_x;
   event->cursor_y = inputState.mouse_y;
@@ -98,7 +102,7 @@ void GetEvents(KeyEvent** events, int* length, long long* horizon) {
   }
   current_event_buffer->length = 0;
 
-  *horizon = NSTimeIntervalToMS(osx_horizon);
+  *horizon = NSTimeIntervalToUS(osx_horizon);
   pthread_mutex_unlock(&event_group_mutex);
 }
 
@@ -399,6 +403,11 @@ void GetInputEvents(void** _key_events, int* length, long long* horizon) {
   GetEvents((KeyEvent**)_key_events, length, horizon);
 }
 
+void SetWindowTitle(void* _window, char* title) {
+  NSWindow* window = (NSWindow*)_window;
+  [window setTitle:[NSString stringWithUTF8String:title]];
+}
+
 void CreateWindow(void** _window, void** _context, int x, int y, int width, int height) {
   NSRect windowRect = NSMakeRect(x, y, width, height);
   NSWindow* window = [NSWindow alloc];
@@ -85,6 +85,7 @@
 
 void Init();
 void CreateWindow(void**, void**, int, int, int, int);
+void SetWindowTitle(void*, char*);
 
 
 typedef struct {
@@ -0,0 +1,12 @@
+package evdev_test
+
+import (
+  "github.com/orfjackal/gospec/src/gospec"
+  "testing"
+)
+
+func TestAllSpecs(t *testing.T) {
+  r := gospec.NewRunner()
+  r.AddSpec(DecoderSpec)
+  gospec.MainGoTest(r, t)
+}
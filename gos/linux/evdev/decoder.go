@@ -0,0 +1,447 @@
+// Package evdev reads joysticks and gamepads through the Linux evdev
+// interface, /dev/input/event*, and turns what they report into gin events.
+//
+// Decoding is kept separate from the devices themselves so that recorded
+// input_event streams can be fed through a Decoder in place of a real device.
+package evdev
+
+import (
+  "encoding/binary"
+  "github.com/MobRulesGames/glop/gin"
+  "sort"
+)
+
+// Event types and codes from linux/input-event-codes.h that we care about.
+const (
+  ev_syn = 0x00
+  ev_key = 0x01
+  ev_abs = 0x03
+
+  syn_report  = 0
+  syn_dropped = 3
+
+  abs_hat0x = 0x10
+  abs_hat3y = 0x17
+  abs_misc  = 0x28
+
+  btn_misc     = 0x100
+  btn_joystick = 0x120
+  btn_digi     = 0x140
+  key_max      = 0x2ff
+)
+
+// Size of a long, which is the size of each of the two fields of the struct
+// timeval at the start of a struct input_event.
+const long_size = 4 << (^uintptr(0) >> 63)
+
+// Size in bytes of a struct input_event on this machine.
+const EventSize = 2*long_size + 8
+
+// An Event is a decoded struct input_event.
+type Event struct {
+  // Devices are asked to stamp their events with CLOCK_MONOTONIC, which is
+  // the same clock that the rest of glop uses.
+  Time gin.Timestamp
+
+  Type  uint16
+  Code  uint16
+  Value int32
+}
+
+// Decodes all of the complete events in data.  Returns the events and the
+// number of bytes that they took up, anything after that is the start of an
+// event that hasn't been completely read yet.
+func ParseEvents(data []byte) ([]Event, int) {
+  n := len(data) / EventSize
+  events := make([]Event, n)
+  for i := range events {
+    b := data[i*EventSize : (i+1)*EventSize]
+    var sec, usec int64
+    if long_size == 8 {
+      sec = int64(binary.LittleEndian.Uint64(b[0:]))
+      usec = int64(binary.LittleEndian.Uint64(b[8:]))
+    } else {
+      sec = int64(int32(binary.LittleEndian.Uint32(b[0:])))
+      usec = int64(int32(binary.LittleEndian.Uint32(b[4:])))
+    }
+    b = b[2*long_size:]
+    events[i] = Event{
+      Time:  gin.Timestamp(sec)*gin.Second + gin.Timestamp(usec),
+      Type:  binary.LittleEndian.Uint16(b[0:]),
+      Code:  binary.LittleEndian.Uint16(b[2:]),
+      Value: int32(binary.LittleEndian.Uint32(b[4:])),
+    }
+  }
+  return events, n * EventSize
+}
+
+// Encodes events exactly as the kernel would, this is the inverse of
+// ParseEvents() and is useful for recording and replaying devices.
+func EncodeEvents(events []Event) []byte {
+  data := make([]byte, len(events)*EventSize)
+  for i, event := range events {
+    b := data[i*EventSize : (i+1)*EventSize]
+    sec := int64(event.Time / gin.Second)
+    usec := int64(event.Time % gin.Second)
+    if long_size == 8 {
+      binary.LittleEndian.PutUint64(b[0:], uint64(sec))
+      binary.LittleEndian.PutUint64(b[8:], uint64(usec))
+    } else {
+      binary.LittleEndian.PutUint32(b[0:], uint32(sec))
+      binary.LittleEndian.PutUint32(b[4:], uint32(usec))
+    }
+    b = b[2*long_size:]
+    binary.LittleEndian.PutUint16(b[0:], event.Type)
+    binary.LittleEndian.PutUint16(b[2:], event.Code)
+    binary.LittleEndian.PutUint32(b[4:], uint32(event.Value))
+  }
+  return data
+}
+
+// A struct input_absinfo, describing the range of an absolute axis.
+type AbsInfo struct {
+  Value      int32
+  Minimum    int32
+  Maximum    int32
+  Fuzz       int32
+  Flat       int32
+  Resolution int32
+}
+
+// Capabilities lists which codes a device can report.
+type Capabilities struct {
+  // EV_KEY codes
+  Keys []uint16
+
+  // EV_ABS codes and their ranges
+  Abs map[uint16]AbsInfo
+}
+
+// Returns true if the device looks like a joystick or gamepad: it has at
+// least one axis and it has joystick or gamepad buttons.  Tablets and
+// touchpads also have axes, but their buttons are in a different range, and
+// the motion sensors on some gamepads show up as separate devices without any
+// buttons.
+func (c *Capabilities) IsJoystick() bool {
+  if len(c.Abs) == 0 {
+    return false
+  }
+  for _, k := range c.Keys {
+    if k >= btn_joystick && k < btn_digi {
+      return true
+    }
+  }
+  return false
+}
+
+type codes []uint16
+
+func (c codes) Len() int           { return len(c) }
+func (c codes) Less(i, j int) bool { return c[i] < c[j] }
+func (c codes) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+// A Decoder turns the events from a single device into gin events for the
+// joystick with a particular index.  Axes, buttons and hats are numbered the
+// same way that SDL numbers them, so that game controller mappings written
+// for SDL apply to them.
+type Decoder struct {
+  index int
+
+  // Maps from evdev codes to axis and button numbers
+  axes    map[uint16]int
+  buttons map[uint16]int
+  abs     map[uint16]AbsInfo
+
+  num_axes, num_buttons, num_hats int
+
+  // Current state, so that only changes generate events and so that
+  // everything can be released when the device goes away.
+  axis_values  []float64
+  button_downs []bool
+  hat_values   [][2]int32
+
+  // Bytes of an incomplete event left over from the last call to Feed()
+  partial []byte
+
+  // Events are collected here until a SYN_REPORT says that the device's
+  // state is consistent, nothing is applied before then.
+  pending []Event
+
+  // gin events generated while applying changes
+  out []gin.OsEvent
+
+  // Set when the kernel dropped events, everything up to the next
+  // SYN_REPORT is discarded and the device needs to be resynced.
+  dropped    bool
+  needs_sync bool
+}
+
+// Makes a Decoder for a device with the specified capabilities, that will
+// report events for the joystick with the specified index.
+func MakeDecoder(index int, caps Capabilities) *Decoder {
+  d := &Decoder{
+    index:   index,
+    axes:    make(map[uint16]int),
+    buttons: make(map[uint16]int),
+    abs:     make(map[uint16]AbsInfo),
+  }
+
+  // SDL numbers the joystick and gamepad buttons first, then the rest of the
+  // buttons that come after them, and then the miscellaneous buttons before
+  // them.
+  keys := append(codes(nil), caps.Keys...)
+  sort.Sort(keys)
+  for _, k := range keys {
+    if k >= btn_joystick && k < key_max {
+      d.buttons[k] = len(d.buttons)
+    }
+  }
+  for _, k := range keys {
+    if k >= btn_misc && k < btn_joystick {
+      d.buttons[k] = len(d.buttons)
+    }
+  }
+  if len(d.buttons) > gin.MaxJoystickButtons {
+    for k, b := range d.buttons {
+      if b >= gin.MaxJoystickButtons {
+        delete(d.buttons, k)
+      }
+    }
+  }
+  d.num_buttons = len(d.buttons)
+
+  var abs codes
+  for code, info := range caps.Abs {
+    abs = append(abs, code)
+    d.abs[code] = info
+  }
+  sort.Sort(abs)
+  for _, code := range abs {
+    if code >= abs_hat0x && code <= abs_hat3y {
+      hat := int(code-abs_hat0x) / 2
+      if hat+1 > d.num_hats {
+        d.num_hats = hat + 1
+      }
+    } else if code < abs_misc && d.num_axes < gin.MaxJoystickAxes {
+      d.axes[code] = d.num_axes
+      d.num_axes++
+    }
+  }
+
+  d.axis_values = make([]float64, d.num_axes)
+  d.button_downs = make([]bool, d.num_buttons)
+  d.hat_values = make([][2]int32, d.num_hats)
+  return d
+}
+
+// Returns a description of the joystick that this Decoder reports events
+// for.
+func (d *Decoder) Joystick(name, guid string) gin.Joystick {
+  return gin.Joystick{
+    Index:       d.index,
+    Name:        name,
+    Guid:        guid,
+    Num_axes:    d.num_axes,
+    Num_buttons: d.num_buttons,
+    Num_hats:    d.num_hats,
+  }
+}
+
+// Feeds raw bytes read from the device through the Decoder and returns the
+// gin events for every report that was completed.
+func (d *Decoder) Feed(data []byte) []gin.OsEvent {
+  if len(d.partial) > 0 {
+    data = append(d.partial, data...)
+    d.partial = nil
+  }
+  events, n := ParseEvents(data)
+  if n < len(data) {
+    d.partial = append([]byte(nil), data[n:]...)
+  }
+  var os_events []gin.OsEvent
+  for _, event := range events {
+    os_events = append(os_events, d.Decode(event)...)
+  }
+  return os_events
+}
+
+// Decodes a single event.  Nothing is returned until a SYN_REPORT event
+// completes a report.
+func (d *Decoder) Decode(event Event) []gin.OsEvent {
+  if event.Type == ev_syn {
+    switch event.Code {
+    case syn_report:
+      if d.dropped {
+        d.dropped = false
+        d.needs_sync = true
+        return nil
+      }
+      for _, pending := range d.pending {
+        switch pending.Type {
+        case ev_key:
+          d.setButton(pending.Code, pending.Value != 0, pending.Time)
+
+        case ev_abs:
+          d.setAbs(pending.Code, pending.Value, pending.Time)
+        }
+      }
+      d.pending = nil
+      return d.flush()
+
+    case syn_dropped:
+      d.dropped = true
+      d.pending = nil
+    }
+    return nil
+  }
+  if !d.dropped && (event.Type == ev_key || event.Type == ev_abs) {
+    d.pending = append(d.pending, event)
+  }
+  return nil
+}
+
+func (d *Decoder) flush() []gin.OsEvent {
+  events := d.out
+  d.out = nil
+  return events
+}
+
+// Returns true if events were dropped, in which case the device's state has
+// to be read and passed to Sync().
+func (d *Decoder) NeedsSync() bool {
+  return d.needs_sync
+}
+
+// Brings the Decoder up to date with the state of the device, after events
+// were dropped.  keys lists the buttons that are down and abs has the values
+// of the absolute axes.  Returns events for anything that changed.
+func (d *Decoder) Sync(t gin.Timestamp, keys []uint16, abs map[uint16]int32) []gin.OsEvent {
+  d.needs_sync = false
+  d.pending = nil
+  down := make(map[uint16]bool)
+  for _, k := range keys {
+    down[k] = true
+  }
+  for code := range d.buttons {
+    d.setButton(code, down[code], t)
+  }
+  for code, value := range abs {
+    d.setAbs(code, value, t)
+  }
+  return d.flush()
+}
+
+// Returns events that release every button, center every axis and hat, and
+// forgets anything that was pending.  This is used when a device goes away.
+func (d *Decoder) Release(t gin.Timestamp) []gin.OsEvent {
+  d.pending = nil
+  for code := range d.buttons {
+    d.setButton(code, false, t)
+  }
+  for axis := range d.axis_values {
+    if d.axis_values[axis] != 0 {
+      d.axis_values[axis] = 0
+      d.emit(gin.JoystickAxisKey(d.index, axis), 0, t)
+    }
+  }
+  for hat := range d.hat_values {
+    d.setHat(hat, 0, 0, t)
+    d.setHat(hat, 1, 0, t)
+  }
+  return d.flush()
+}
+
+func (d *Decoder) emit(id gin.KeyId, amt float64, t gin.Timestamp) {
+  d.out = append(d.out, gin.OsEvent{
+    KeyId:     id,
+    Press_amt: amt,
+    Timestamp: t,
+  })
+}
+
+func (d *Decoder) setButton(code uint16, down bool, t gin.Timestamp) {
+  button, ok := d.buttons[code]
+  if !ok || d.button_downs[button] == down {
+    return
+  }
+  d.button_downs[button] = down
+  amt := 0.0
+  if down {
+    amt = 1
+  }
+  d.emit(gin.JoystickButtonKey(d.index, button), amt, t)
+}
+
+func (d *Decoder) setAbs(code uint16, value int32, t gin.Timestamp) {
+  if code >= abs_hat0x && code <= abs_hat3y {
+    hat := int(code-abs_hat0x) / 2
+    if hat < d.num_hats {
+      d.setHat(hat, int(code-abs_hat0x)%2, value, t)
+    }
+    return
+  }
+  axis, ok := d.axes[code]
+  if !ok {
+    return
+  }
+  amt := normalize(value, d.abs[code])
+  if d.axis_values[axis] == amt {
+    return
+  }
+  d.axis_values[axis] = amt
+  d.emit(gin.JoystickAxisKey(d.index, axis), amt, t)
+}
+
+// Sets one axis of a hat, 0 for x and 1 for y, and presses or releases the
+// keys for the directions that changed.
+func (d *Decoder) setHat(hat, axis int, value int32, t gin.Timestamp) {
+  if value < 0 {
+    value = -1
+  } else if value > 0 {
+    value = 1
+  }
+  old := d.hat_values[hat][axis]
+  if old == value {
+    return
+  }
+  d.hat_values[hat][axis] = value
+  neg, pos := gin.HatLeft, gin.HatRight
+  if axis == 1 {
+    neg, pos = gin.HatUp, gin.HatDown
+  }
+  if old < 0 {
+    d.emit(gin.JoystickHatKey(d.index, hat, neg), 0, t)
+  }
+  if old > 0 {
+    d.emit(gin.JoystickHatKey(d.index, hat, pos), 0, t)
+  }
+  if value < 0 {
+    d.emit(gin.JoystickHatKey(d.index, hat, neg), 1, t)
+  }
+  if value > 0 {
+    d.emit(gin.JoystickHatKey(d.index, hat, pos), 1, t)
+  }
+}
+
+// Maps value from the axis's range to [-1, 1].  Values within the axis's flat
+// region around the center map to exactly 0.  Like SDL, every axis is treated
+// this way, so triggers rest at -1.
+func normalize(value int32, info AbsInfo) float64 {
+  if info.Maximum <= info.Minimum {
+    return 0
+  }
+  center := (float64(info.Minimum) + float64(info.Maximum)) / 2
+  half := (float64(info.Maximum) - float64(info.Minimum)) / 2
+  offset := float64(value) - center
+  if offset >= -float64(info.Flat) && offset <= float64(info.Flat) {
+    return 0
+  }
+  amt := offset / half
+  if amt < -1 {
+    amt = -1
+  }
+  if amt > 1 {
+    amt = 1
+  }
+  return amt
+}
@@ -0,0 +1,180 @@
+package evdev_test
+
+import (
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+  "github.com/MobRulesGames/glop/gin"
+  "github.com/MobRulesGames/glop/gos/linux/evdev"
+)
+
+// Codes from linux/input-event-codes.h
+const (
+  ev_syn = 0x00
+  ev_key = 0x01
+  ev_abs = 0x03
+
+  syn_report  = 0
+  syn_dropped = 3
+
+  abs_x     = 0x00
+  abs_y     = 0x01
+  abs_hat0x = 0x10
+  abs_hat0y = 0x11
+
+  btn_south   = 0x130
+  btn_east    = 0x131
+  btn_trigger = 0x120
+  btn_0       = 0x100
+)
+
+func report(t gin.Timestamp) evdev.Event {
+  return evdev.Event{Time: t, Type: ev_syn, Code: syn_report}
+}
+
+// A gamepad with a stick, a d-pad and three buttons, one of which is a
+// miscellaneous button that SDL numbers last.
+func gamepadCaps() evdev.Capabilities {
+  stick := evdev.AbsInfo{Minimum: -32768, Maximum: 32767, Flat: 128}
+  hat := evdev.AbsInfo{Minimum: -1, Maximum: 1}
+  return evdev.Capabilities{
+    Keys: []uint16{btn_0, btn_east, btn_south},
+    Abs: map[uint16]evdev.AbsInfo{
+      abs_x:     stick,
+      abs_y:     stick,
+      abs_hat0x: hat,
+      abs_hat0y: hat,
+    },
+  }
+}
+
+func DecoderSpec(c gospec.Context) {
+  d := evdev.MakeDecoder(2, gamepadCaps())
+
+  c.Specify("The joystick describes the device.", func() {
+    j := d.Joystick("Pad", "guid")
+    c.Expect(j.Index, Equals, 2)
+    c.Expect(j.Num_axes, Equals, 2)
+    c.Expect(j.Num_buttons, Equals, 3)
+    c.Expect(j.Num_hats, Equals, 1)
+  })
+
+  c.Specify("Only devices with axes and joystick buttons are joysticks.", func() {
+    caps := gamepadCaps()
+    c.Expect(caps.IsJoystick(), Equals, true)
+    caps.Keys = []uint16{btn_0}
+    c.Expect(caps.IsJoystick(), Equals, false)
+    caps = gamepadCaps()
+    caps.Abs = nil
+    c.Expect(caps.IsJoystick(), Equals, false)
+  })
+
+  c.Specify("Buttons are numbered the way SDL numbers them.", func() {
+    data := evdev.EncodeEvents([]evdev.Event{
+      {Time: 10, Type: ev_key, Code: btn_0, Value: 1},
+      {Time: 10, Type: ev_key, Code: btn_east, Value: 1},
+      report(10),
+    })
+    events := d.Feed(data)
+    c.Assume(len(events), Equals, 2)
+    c.Expect(events[0].KeyId, Equals, gin.JoystickButtonKey(2, 2))
+    c.Expect(events[0].Press_amt, Equals, 1.0)
+    c.Expect(events[1].KeyId, Equals, gin.JoystickButtonKey(2, 1))
+  })
+
+  c.Specify("Events are held back until a report is complete.", func() {
+    events := d.Decode(evdev.Event{Time: 10, Type: ev_key, Code: btn_south, Value: 1})
+    c.Expect(len(events), Equals, 0)
+    events = d.Decode(report(10))
+    c.Assume(len(events), Equals, 1)
+    c.Expect(events[0].KeyId, Equals, gin.JoystickButtonKey(2, 0))
+    c.Expect(events[0].Timestamp, Equals, gin.Timestamp(10))
+  })
+
+  c.Specify("Timestamps come from the recorded events.", func() {
+    data := evdev.EncodeEvents([]evdev.Event{
+      {Time: 3*gin.Second + 250, Type: ev_key, Code: btn_south, Value: 1},
+      report(3*gin.Second + 250),
+    })
+    events := d.Feed(data)
+    c.Assume(len(events), Equals, 1)
+    c.Expect(events[0].Timestamp, Equals, 3*gin.Second+250)
+  })
+
+  c.Specify("Events split across reads are put back together.", func() {
+    data := evdev.EncodeEvents([]evdev.Event{
+      {Time: 10, Type: ev_abs, Code: abs_x, Value: 32767},
+      report(10),
+    })
+    split := evdev.EventSize + evdev.EventSize/2
+    c.Expect(len(d.Feed(data[:split])), Equals, 0)
+    events := d.Feed(data[split:])
+    c.Assume(len(events), Equals, 1)
+    c.Expect(events[0].KeyId, Equals, gin.JoystickAxisKey(2, 0))
+    c.Expect(events[0].Press_amt, IsWithin(1e-9), 1.0)
+  })
+
+  c.Specify("Axes are normalized and have a dead zone.", func() {
+    events := d.Feed(evdev.EncodeEvents([]evdev.Event{
+      {Time: 10, Type: ev_abs, Code: abs_y, Value: -32768},
+      report(10),
+      {Time: 20, Type: ev_abs, Code: abs_y, Value: 100},
+      report(20),
+    }))
+    c.Assume(len(events), Equals, 2)
+    c.Expect(events[0].KeyId, Equals, gin.JoystickAxisKey(2, 1))
+    c.Expect(events[0].Press_amt, IsWithin(1e-9), -1.0)
+    c.Expect(events[1].Press_amt, Equals, 0.0)
+  })
+
+  c.Specify("Hats press a key for each direction.", func() {
+    events := d.Feed(evdev.EncodeEvents([]evdev.Event{
+      {Time: 10, Type: ev_abs, Code: abs_hat0x, Value: 1},
+      {Time: 10, Type: ev_abs, Code: abs_hat0y, Value: -1},
+      report(10),
+      {Time: 20, Type: ev_abs, Code: abs_hat0x, Value: -1},
+      report(20),
+    }))
+    c.Assume(len(events), Equals, 4)
+    c.Expect(events[0].KeyId, Equals, gin.JoystickHatKey(2, 0, gin.HatRight))
+    c.Expect(events[1].KeyId, Equals, gin.JoystickHatKey(2, 0, gin.HatUp))
+    c.Expect(events[2].KeyId, Equals, gin.JoystickHatKey(2, 0, gin.HatRight))
+    c.Expect(events[2].Press_amt, Equals, 0.0)
+    c.Expect(events[3].KeyId, Equals, gin.JoystickHatKey(2, 0, gin.HatLeft))
+    c.Expect(events[3].Press_amt, Equals, 1.0)
+  })
+
+  c.Specify("Dropped events are discarded until the device is synced.", func() {
+    events := d.Feed(evdev.EncodeEvents([]evdev.Event{
+      {Time: 10, Type: ev_key, Code: btn_south, Value: 1},
+      {Time: 10, Type: ev_syn, Code: syn_dropped},
+      {Time: 20, Type: ev_key, Code: btn_east, Value: 1},
+      report(20),
+    }))
+    c.Expect(len(events), Equals, 0)
+    c.Expect(d.NeedsSync(), Equals, true)
+
+    events = d.Sync(30, []uint16{btn_east}, map[uint16]int32{abs_x: 0})
+    c.Expect(d.NeedsSync(), Equals, false)
+    c.Assume(len(events), Equals, 1)
+    c.Expect(events[0].KeyId, Equals, gin.JoystickButtonKey(2, 1))
+    c.Expect(events[0].Timestamp, Equals, gin.Timestamp(30))
+  })
+
+  c.Specify("Releasing a device releases everything on it.", func() {
+    d.Feed(evdev.EncodeEvents([]evdev.Event{
+      {Time: 10, Type: ev_key, Code: btn_south, Value: 1},
+      {Time: 10, Type: ev_abs, Code: abs_x, Value: 32767},
+      {Time: 10, Type: ev_abs, Code: abs_hat0y, Value: 1},
+      report(10),
+    }))
+    events := d.Release(20)
+    c.Assume(len(events), Equals, 3)
+    c.Expect(events[0].KeyId, Equals, gin.JoystickButtonKey(2, 0))
+    c.Expect(events[0].Press_amt, Equals, 0.0)
+    c.Expect(events[1].KeyId, Equals, gin.JoystickAxisKey(2, 0))
+    c.Expect(events[1].Press_amt, Equals, 0.0)
+    c.Expect(events[2].KeyId, Equals, gin.JoystickHatKey(2, 0, gin.HatDown))
+    c.Expect(events[2].Press_amt, Equals, 0.0)
+    c.Expect(len(d.Release(30)), Equals, 0)
+  })
+}
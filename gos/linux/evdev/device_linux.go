@@ -0,0 +1,200 @@
+package evdev
+
+import (
+  "errors"
+  "fmt"
+  "github.com/MobRulesGames/glop/gin"
+  "syscall"
+  "unsafe"
+)
+
+// ioctl numbers from linux/input.h
+const (
+  ioc_write = 1
+  ioc_read  = 2
+
+  clock_monotonic = 1
+)
+
+func ioc(dir, nr, size uintptr) uintptr {
+  return dir<<30 | size<<16 | 'E'<<8 | nr
+}
+
+func eviocgid() uintptr               { return ioc(ioc_read, 0x02, 8) }
+func eviocgname(size uintptr) uintptr { return ioc(ioc_read, 0x06, size) }
+func eviocgkey(size uintptr) uintptr  { return ioc(ioc_read, 0x18, size) }
+func eviocgbit(ev, size uintptr) uintptr {
+  return ioc(ioc_read, 0x20+ev, size)
+}
+func eviocgabs(abs uintptr) uintptr { return ioc(ioc_read, 0x40+abs, unsafe.Sizeof(AbsInfo{})) }
+func eviocsclockid() uintptr        { return ioc(ioc_write, 0xa0, 4) }
+
+func ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+  _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(arg))
+  if errno != 0 {
+    return errno
+  }
+  return nil
+}
+
+// Returns the current time on CLOCK_MONOTONIC, the clock that events are
+// stamped with.
+func monotonicNow() gin.Timestamp {
+  var ts syscall.Timespec
+  syscall.Syscall(syscall.SYS_CLOCK_GETTIME, clock_monotonic, uintptr(unsafe.Pointer(&ts)), 0)
+  return gin.Timestamp(ts.Sec)*gin.Second + gin.Timestamp(ts.Nsec/1000)
+}
+
+// Returns the codes whose bits are set in bits.
+func setBits(bits []byte) []uint16 {
+  var codes []uint16
+  for i, b := range bits {
+    for j := uint(0); j < 8; j++ {
+      if b&(1<<j) != 0 {
+        codes = append(codes, uint16(i*8)+uint16(j))
+      }
+    }
+  }
+  return codes
+}
+
+// A Device is an open evdev device that is a joystick.
+type Device struct {
+  fd       int
+  path     string
+  joystick gin.Joystick
+  decoder  *Decoder
+  buf      []byte
+}
+
+var errNotJoystick = errors.New("Not a joystick.")
+
+// Opens the evdev device at path as the joystick with the specified index.
+// Returns errNotJoystick if the device isn't a joystick.
+func Open(path string, index int) (*Device, error) {
+  fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+  if err != nil {
+    return nil, err
+  }
+  d := &Device{fd: fd, path: path}
+  caps, err := d.capabilities()
+  if err == nil && !caps.IsJoystick() {
+    err = errNotJoystick
+  }
+  if err != nil {
+    syscall.Close(fd)
+    return nil, err
+  }
+
+  // Without this events are stamped with the wall clock
+  clock := int32(clock_monotonic)
+  ioctl(fd, eviocsclockid(), unsafe.Pointer(&clock))
+
+  d.decoder = MakeDecoder(index, caps)
+  d.joystick = d.decoder.Joystick(d.name(), d.guid())
+  d.buf = make([]byte, 64*EventSize)
+  return d, nil
+}
+
+func (d *Device) capabilities() (Capabilities, error) {
+  var caps Capabilities
+  key_bits := make([]byte, key_max/8+1)
+  if err := ioctl(d.fd, eviocgbit(ev_key, uintptr(len(key_bits))), unsafe.Pointer(&key_bits[0])); err != nil {
+    return caps, err
+  }
+  caps.Keys = setBits(key_bits)
+  abs_bits := make([]byte, abs_misc/8+1)
+  if err := ioctl(d.fd, eviocgbit(ev_abs, uintptr(len(abs_bits))), unsafe.Pointer(&abs_bits[0])); err != nil {
+    return caps, err
+  }
+  caps.Abs = make(map[uint16]AbsInfo)
+  for _, code := range setBits(abs_bits) {
+    if code >= abs_misc {
+      continue
+    }
+    var info AbsInfo
+    if ioctl(d.fd, eviocgabs(uintptr(code)), unsafe.Pointer(&info)) == nil {
+      caps.Abs[code] = info
+    }
+  }
+  return caps, nil
+}
+
+func (d *Device) name() string {
+  buf := make([]byte, 256)
+  if ioctl(d.fd, eviocgname(uintptr(len(buf))), unsafe.Pointer(&buf[0])) != nil {
+    return ""
+  }
+  for i, b := range buf {
+    if b == 0 {
+      return string(buf[:i])
+    }
+  }
+  return string(buf)
+}
+
+// Builds the GUID that SDL uses for this device: the bus type, vendor,
+// product and version, each as a little endian 16 bit value followed by 16
+// bits of zeroes.
+func (d *Device) guid() string {
+  var id [4]uint16
+  if ioctl(d.fd, eviocgid(), unsafe.Pointer(&id[0])) != nil {
+    return ""
+  }
+  var guid [16]byte
+  for i, v := range id {
+    guid[4*i] = byte(v)
+    guid[4*i+1] = byte(v >> 8)
+  }
+  return fmt.Sprintf("%x", guid[:])
+}
+
+// Reads the state of the device from the kernel and brings the decoder up to
+// date with it.
+func (d *Device) sync() []gin.OsEvent {
+  key_bits := make([]byte, key_max/8+1)
+  ioctl(d.fd, eviocgkey(uintptr(len(key_bits))), unsafe.Pointer(&key_bits[0]))
+  abs := make(map[uint16]int32)
+  for code := range d.decoder.abs {
+    var info AbsInfo
+    if ioctl(d.fd, eviocgabs(uintptr(code)), unsafe.Pointer(&info)) == nil {
+      abs[code] = info.Value
+    }
+  }
+  return d.decoder.Sync(monotonicNow(), setBits(key_bits), abs)
+}
+
+// Returns the joystick that this device reports events for.
+func (d *Device) Joystick() gin.Joystick {
+  return d.joystick
+}
+
+// Reads everything that the device has reported since the last call, without
+// blocking.  An error means that the device is gone and should be closed.
+func (d *Device) Read() ([]gin.OsEvent, error) {
+  var events []gin.OsEvent
+  for {
+    n, err := syscall.Read(d.fd, d.buf)
+    if err == syscall.EAGAIN || err == syscall.EINTR {
+      break
+    }
+    if err != nil {
+      return events, err
+    }
+    if n <= 0 {
+      return events, syscall.ENODEV
+    }
+    events = append(events, d.decoder.Feed(d.buf[:n])...)
+    if d.decoder.NeedsSync() {
+      events = append(events, d.sync()...)
+    }
+  }
+  return events, nil
+}
+
+// Closes the device and returns events that release anything that was held
+// down on it.
+func (d *Device) Close() []gin.OsEvent {
+  syscall.Close(d.fd)
+  return d.decoder.Release(monotonicNow())
+}
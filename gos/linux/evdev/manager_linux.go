@@ -0,0 +1,141 @@
+package evdev
+
+import (
+  "github.com/MobRulesGames/glop/gin"
+  "path/filepath"
+  "sort"
+)
+
+// How often the device directory is rescanned for joysticks that were plugged
+// in or removed.
+const rescan_period = gin.Second
+
+// A Manager keeps track of every joystick in a directory of evdev devices,
+// opening them as they are plugged in and closing them when they go away.
+type Manager struct {
+  dir string
+
+  // Open joysticks, by index
+  devices [gin.MaxJoysticks]*Device
+
+  // Paths that are open, and paths that aren't joysticks.  Paths that could
+  // not be opened for any other reason, such as permissions that haven't been
+  // set up yet, are retried on every scan.
+  open    map[string]int
+  ignored map[string]bool
+
+  last_scan gin.Timestamp
+}
+
+// Makes a Manager for the devices in dir, normally /dev/input.  Devices are
+// not opened until the first call to Poll().
+func MakeManager(dir string) *Manager {
+  return &Manager{
+    dir:       dir,
+    open:      make(map[string]int),
+    ignored:   make(map[string]bool),
+    last_scan: -rescan_period,
+  }
+}
+
+// Reads events from every open joystick, and every so often checks for
+// joysticks that were added or removed.  A joystick that is removed has
+// everything on it released.
+func (m *Manager) Poll() []gin.OsEvent {
+  var events []gin.OsEvent
+  for index, d := range m.devices {
+    if d == nil {
+      continue
+    }
+    read, err := d.Read()
+    events = append(events, read...)
+    if err != nil {
+      events = append(events, m.remove(index)...)
+    }
+  }
+  if now := monotonicNow(); now-m.last_scan >= rescan_period {
+    m.last_scan = now
+    events = append(events, m.scan()...)
+  }
+  return events
+}
+
+func (m *Manager) remove(index int) []gin.OsEvent {
+  d := m.devices[index]
+  m.devices[index] = nil
+  delete(m.open, d.path)
+  return d.Close()
+}
+
+func (m *Manager) scan() []gin.OsEvent {
+  paths, _ := filepath.Glob(filepath.Join(m.dir, "event*"))
+  sort.Strings(paths)
+  present := make(map[string]bool)
+  for _, path := range paths {
+    present[path] = true
+  }
+
+  // udev can reuse a path for a different device, so anything that is no
+  // longer there is forgotten.
+  var events []gin.OsEvent
+  for path, index := range m.open {
+    if !present[path] {
+      events = append(events, m.remove(index)...)
+    }
+  }
+  for path := range m.ignored {
+    if !present[path] {
+      delete(m.ignored, path)
+    }
+  }
+
+  for _, path := range paths {
+    if _, ok := m.open[path]; ok || m.ignored[path] {
+      continue
+    }
+    index := m.freeIndex()
+    if index == -1 {
+      break
+    }
+    d, err := Open(path, index)
+    if err == errNotJoystick {
+      m.ignored[path] = true
+    }
+    if err != nil {
+      continue
+    }
+    m.devices[index] = d
+    m.open[path] = index
+    events = append(events, d.sync()...)
+  }
+  return events
+}
+
+func (m *Manager) freeIndex() int {
+  for index, d := range m.devices {
+    if d == nil {
+      return index
+    }
+  }
+  return -1
+}
+
+// Returns the joysticks that are currently open, ordered by index.
+func (m *Manager) Joysticks() []gin.Joystick {
+  var joysticks []gin.Joystick
+  for _, d := range m.devices {
+    if d != nil {
+      joysticks = append(joysticks, d.Joystick())
+    }
+  }
+  return joysticks
+}
+
+// Closes every joystick.
+func (m *Manager) Close() {
+  for index, d := range m.devices {
+    if d != nil {
+      m.remove(index)
+    }
+  }
+}
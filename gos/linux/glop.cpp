@@ -4,11 +4,26 @@
 #include <map>
 #include <algorithm>
 #include <cstdio>
+#include <cstring>
+#include <cmath>
+#include <climits>
+#include <clocale>
+#include <cstdlib>
 #include <stdio.h>
+#include <unistd.h>
 #include <sys/time.h>
+#include <sys/select.h>
+#include <time.h>
 
 #include <X11/Xlib.h>
+#include <X11/Xatom.h>
+#include <X11/XF86keysym.h>
+#include <X11/cursorfont.h>
+#include <X11/extensions/Xrender.h>
+#include <X11/extensions/Xrandr.h>
+#include <X11/extensions/XInput2.h>
 #include <GL/glx.h>
+#include <linux/input-event-codes.h>
 
 using namespace std;
 
@@ -21,31 +36,101 @@ typedef short GlopKey;
 Display *display = NULL;
 int screen = 0;
 XIM xim = NULL;
+
+// The input style that input contexts are created with, 0 if there is no
+// input method.
+XIMStyle xim_style = 0;
 Atom close_atom;
 
+// Atoms used for clipboard transfers
+Atom clipboard_atom;
+Atom targets_atom;
+Atom utf8_atom;
+Atom incr_atom;
+Atom glop_selection_atom;
+
+// Atoms used for XDND, the drag and drop protocol
+Atom xdnd_aware_atom;
+Atom xdnd_enter_atom;
+Atom xdnd_position_atom;
+Atom xdnd_status_atom;
+Atom xdnd_leave_atom;
+Atom xdnd_drop_atom;
+Atom xdnd_finished_atom;
+Atom xdnd_selection_atom;
+Atom xdnd_type_list_atom;
+Atom xdnd_action_copy_atom;
+Atom uri_list_atom;
+Atom glop_drop_atom;
+
+// Major opcode of the XInput extension, and whether it is at least 2.1
+int xi_opcode = -1;
+bool have_xi21 = false;
+
 Display *get_x_display() { return display; }
 int get_x_screen() { return screen; }
 
+// Monotonic time in microseconds, this is the clock that all event timestamps
+// are on.
 static long long gtm() {
-  struct timeval tv;
-  gettimeofday(&tv, NULL);
-  return (long long)tv.tv_sec * 1000000 + tv.tv_usec;
+  struct timespec ts;
+  clock_gettime(CLOCK_MONOTONIC, &ts);
+  return (long long)ts.tv_sec * 1000000 + ts.tv_nsec / 1000;
 }
 static int gt() {
   return gtm() / 1000;
 }
 
+// X event times are in milliseconds on the server's clock, which wraps every 49
+// days and might not be the same clock as ours, or even on the same machine.
+// The smallest difference that we have seen between our clock and the
+// server's is the best estimate we have of the offset between them, anything
+// more than that is the time it took the event to get to us.
+static bool have_server_offset = false;
+static long long server_offset = 0;
+static long long server_time_wraps = 0;
+static unsigned long last_server_time = 0;
+
+static long long ServerTimeToLocal(Time time) {
+  long long now = gtm();
+  if(time == CurrentTime)
+    return now;
+  unsigned long t = time & 0xffffffffUL;
+  if(have_server_offset && t < last_server_time && last_server_time - t > 0x80000000UL)
+    server_time_wraps++;
+  if(!have_server_offset || t > last_server_time || last_server_time - t > 0x80000000UL)
+    last_server_time = t;
+  long long server_us = ((server_time_wraps << 32) + t) * 1000;
+  if(!have_server_offset || now - server_us < server_offset) {
+    server_offset = now - server_us;
+    have_server_offset = true;
+  }
+  long long local = server_us + server_offset;
+  return local < now ? local : now;
+}
+
 struct OsWindowData {
-  OsWindowData() { window = (Window)NULL; }
+  OsWindowData() { window = (Window)NULL; pbuffer = None; }
   ~OsWindowData() {
     glXDestroyContext(display, context);
-    XDestroyIC(inputcontext);
+    if(pbuffer != None)
+      glXDestroyPbuffer(display, pbuffer);
+    if(inputcontext)
+      XDestroyIC(inputcontext);
     XDestroyWindow(display, window);
   }
   
   Window window;
   GLXContext context;
+  // NULL if there is no input method
   XIC inputcontext;
+
+  // Offscreen windows are never mapped, everything is rendered to this
+  // instead.
+  GLXPbuffer pbuffer;
+
+  // Where the context renders to, either window or pbuffer.
+  GLXDrawable drawable;
 };
 
 void GlopInit() {
@@ -54,23 +139,369 @@ void GlopInit() {
   
   screen = DefaultScreen(display);
   
+  // The input method is picked with the XMODIFIERS environment variable, and
+  // it talks to us in the encoding of the current locale.  If the one that
+  // was asked for isn't running we fall back to the built in one, which
+  // still does compose key sequences.
+  setlocale(LC_CTYPE, "");
+  if(XSupportsLocale())
+    XSetLocaleModifiers("");
   xim = XOpenIM(display, NULL, NULL, NULL);
-//  ASSERT(xim);
+  if(!xim) {
+    XSetLocaleModifiers("@im=none");
+    xim = XOpenIM(display, NULL, NULL, NULL);
+  }
+  if(xim) {
+    // In order of preference: we draw the composition, the input method draws
+    // it at the caret, or the input method draws it off to the side.
+    const XIMStyle preferred[] = {
+      XIMPreeditCallbacks | XIMStatusNothing,
+      XIMPreeditPosition | XIMStatusNothing,
+      XIMPreeditNothing | XIMStatusNothing,
+      XIMPreeditNone | XIMStatusNone,
+    };
+    XIMStyles* styles = NULL;
+    if(XGetIMValues(xim, XNQueryInputStyle, &styles, NULL) == NULL && styles) {
+      for(int i = 0; i < sizeof(preferred) / sizeof(preferred[0]) && xim_style == 0; i++) {
+        for(int j = 0; j < styles->count_styles; j++) {
+          if(styles->supported_styles[j] == preferred[i]) {
+            xim_style = preferred[i];
+            break;
+          }
+        }
+      }
+      XFree(styles);
+    }
+  }
   
   close_atom = XInternAtom(display, "WM_DELETE_WINDOW", false);
+
+  clipboard_atom = XInternAtom(display, "CLIPBOARD", false);
+  targets_atom = XInternAtom(display, "TARGETS", false);
+  utf8_atom = XInternAtom(display, "UTF8_STRING", false);
+  incr_atom = XInternAtom(display, "INCR", false);
+  glop_selection_atom = XInternAtom(display, "GLOP_SELECTION", false);
+
+  xdnd_aware_atom = XInternAtom(display, "XdndAware", false);
+  xdnd_enter_atom = XInternAtom(display, "XdndEnter", false);
+  xdnd_position_atom = XInternAtom(display, "XdndPosition", false);
+  xdnd_status_atom = XInternAtom(display, "XdndStatus", false);
+  xdnd_leave_atom = XInternAtom(display, "XdndLeave", false);
+  xdnd_drop_atom = XInternAtom(display, "XdndDrop", false);
+  xdnd_finished_atom = XInternAtom(display, "XdndFinished", false);
+  xdnd_selection_atom = XInternAtom(display, "XdndSelection", false);
+  xdnd_type_list_atom = XInternAtom(display, "XdndTypeList", false);
+  xdnd_action_copy_atom = XInternAtom(display, "XdndActionCopy", false);
+  uri_list_atom = XInternAtom(display, "text/uri-list", false);
+  glop_drop_atom = XInternAtom(display, "GLOP_DROP", false);
+
+  // Raw events that arrive while the pointer is grabbed, and scroll
+  // valuators, both need XInput 2.1.
+  int xi_event, xi_error;
+  if(XQueryExtension(display, "XInputExtension", &xi_opcode, &xi_event, &xi_error)) {
+    int major = 2;
+    int minor = 1;
+    have_xi21 = XIQueryVersion(display, &major, &minor) == Success && major == 2 && minor >= 1;
+  }
 }
 void glopShutDown() {
-  XCloseIM(xim);
+  if(xim)
+    XCloseIM(xim);
   XCloseDisplay(display);
 }
 
-vector<GlopKeyEvent> events;
-static bool SynthKey(const KeySym &sym, bool pushed, const XEvent &event, Window window, GlopKeyEvent *ev) {
-  // mostly ignored
+// Cursor state
+// ============
+
+// A hidden cursor is invisible, the pointer is grabbed, and it is warped back
+// to the center of the window every time it moves so that it never stops at
+// the edge of the screen.  As far as everyone else is concerned it stays at
+// locked_x, locked_y.
+bool cursor_hidden = false;
+int locked_x = 0;
+int locked_y = 0;
+
+// A confined cursor is visible, but the pointer is grabbed so that it can't
+// leave the window.
+bool cursor_confined = false;
+
+// The cursor to show when the cursor isn't hidden, None means the default
+// cursor.
+Cursor current_cursor = None;
+Cursor blank_cursor = None;
+
+// Root coordinates of the cursor as of the last motion event, used to turn
+// motion events into relative motion.
+bool have_last_mouse = false;
+int last_mouse_x = 0;
+int last_mouse_y = 0;
+
+// Set while we actually hold a grab on the pointer.
+bool pointer_grabbed = false;
+
+// XInput2
+// =======
+
+// If XInput 2.1 is available and the window asked for them, motion comes from
+// raw XI_RawMotion events rather than from the difference between core
+// motion events, and the wheel is read from scroll valuators rather than from
+// buttons 4 through 7.
+bool raw_motion = false;
+bool smooth_scroll = false;
+
+// A scroll valuator reports the total distance scrolled on one axis of one
+// device, so we keep the last value around to get the distance since then.
+struct ScrollValuator {
+  int device;
+  int number;
+  bool vertical;
+  double increment;
+  bool have_last;
+  double last;
+};
+vector<ScrollValuator> scroll_valuators;
+
+static void QueryScrollValuators() {
+  scroll_valuators.clear();
+  int num_devices;
+  XIDeviceInfo* devices = XIQueryDevice(display, XIAllDevices, &num_devices);
+  if(!devices) return;
+  for(int i = 0; i < num_devices; i++) {
+    if(devices[i].use != XISlavePointer)
+      continue;
+    for(int j = 0; j < devices[i].num_classes; j++) {
+      if(devices[i].classes[j]->type != XIScrollClass)
+        continue;
+      const XIScrollClassInfo* info = reinterpret_cast<const XIScrollClassInfo*>(devices[i].classes[j]);
+      if(info->increment == 0)
+        continue;
+      ScrollValuator valuator;
+      valuator.device = devices[i].deviceid;
+      valuator.number = info->number;
+      valuator.vertical = info->scroll_type == XIScrollTypeVertical;
+      valuator.increment = info->increment;
+      valuator.have_last = false;
+      valuator.last = 0;
+      scroll_valuators.push_back(valuator);
+    }
+  }
+  XIFreeDeviceInfo(devices);
+}
+
+// Scroll valuators keep counting while the pointer is in other windows, so
+// the first value we see after it comes back is only a starting point.
+static void ResetScrollValuators() {
+  for(int i = 0; i < scroll_valuators.size(); i++)
+    scroll_valuators[i].have_last = false;
+}
+
+// Finds the value of valuator number in a valuator mask and the packed array
+// of values that goes with it.
+static bool GetValuator(const unsigned char* mask, int mask_len, const double* values, int number, double* value) {
+  if(number >= mask_len * 8 || !XIMaskIsSet(mask, number))
+    return false;
+  for(int i = 0; i < number; i++) {
+    if(XIMaskIsSet(mask, i))
+      values++;
+  }
+  *value = *values;
+  return true;
+}
+
+static void SelectXInput2Events(Window window, const GlopWindowOptions& options) {
+  raw_motion = have_xi21 && options.raw_mouse_motion;
+  smooth_scroll = have_xi21 && options.smooth_scroll;
+  if(!raw_motion && !smooth_scroll)
+    return;
+
+  // Raw events are only ever sent to the root window
+  unsigned char root_master_bits[XIMaskLen(XI_LASTEVENT)] = {0};
+  unsigned char root_all_bits[XIMaskLen(XI_LASTEVENT)] = {0};
+  if(raw_motion)
+    XISetMask(root_master_bits, XI_RawMotion);
+  if(smooth_scroll)
+    XISetMask(root_all_bits, XI_HierarchyChanged);
+  XIEventMask root_masks[2] = {
+    { XIAllMasterDevices, sizeof(root_master_bits), root_master_bits },
+    { XIAllDevices, sizeof(root_all_bits), root_all_bits },
+  };
+  XISelectEvents(display, RootWindow(display, screen), root_masks, 2);
+
+  // XI_Motion replaces core motion events on the window, so they are turned
+  // back into core events and handled the same way.
+  if(smooth_scroll) {
+    unsigned char master_bits[XIMaskLen(XI_LASTEVENT)] = {0};
+    unsigned char all_bits[XIMaskLen(XI_LASTEVENT)] = {0};
+    XISetMask(master_bits, XI_Motion);
+    XISetMask(all_bits, XI_DeviceChanged);
+    XIEventMask masks[2] = {
+      { XIAllMasterDevices, sizeof(master_bits), master_bits },
+      { XIAllDevices, sizeof(all_bits), all_bits },
+    };
+    XISelectEvents(display, window, masks, 2);
+    QueryScrollValuators();
+  }
+}
+
+// Gets the position of the cursor in root coordinates.
+static void QueryCursor(Window window, int *x, int *y) {
+  if(cursor_hidden) {
+    *x = locked_x;
+    *y = locked_y;
+    return;
+  }
   Window root, child;
-  int x, y, winx, winy;
+  int winx, winy;
   unsigned int mask;
-  XQueryPointer(display, window, &root, &child, &x, &y, &winx, &winy, &mask);
+  XQueryPointer(display, window, &root, &child, x, y, &winx, &winy, &mask);
+}
+
+vector<GlopKeyEvent> events;
+// Turns an X keycode into the USB HID usage id of the physical key.  This
+// assumes that the server uses evdev keycodes, which are the kernel's key
+// codes offset by 8.  That has been true of every X server for years,
+// including Xwayland and Xvfb.  Returns 0 for keys that gin doesn't know.
+static int KeycodeToScancode(unsigned int keycode) {
+  if(keycode < 8)
+    return 0;
+  switch(keycode - 8) {
+    case KEY_A: return 4;
+    case KEY_B: return 5;
+    case KEY_C: return 6;
+    case KEY_D: return 7;
+    case KEY_E: return 8;
+    case KEY_F: return 9;
+    case KEY_G: return 10;
+    case KEY_H: return 11;
+    case KEY_I: return 12;
+    case KEY_J: return 13;
+    case KEY_K: return 14;
+    case KEY_L: return 15;
+    case KEY_M: return 16;
+    case KEY_N: return 17;
+    case KEY_O: return 18;
+    case KEY_P: return 19;
+    case KEY_Q: return 20;
+    case KEY_R: return 21;
+    case KEY_S: return 22;
+    case KEY_T: return 23;
+    case KEY_U: return 24;
+    case KEY_V: return 25;
+    case KEY_W: return 26;
+    case KEY_X: return 27;
+    case KEY_Y: return 28;
+    case KEY_Z: return 29;
+    case KEY_1: return 30;
+    case KEY_2: return 31;
+    case KEY_3: return 32;
+    case KEY_4: return 33;
+    case KEY_5: return 34;
+    case KEY_6: return 35;
+    case KEY_7: return 36;
+    case KEY_8: return 37;
+    case KEY_9: return 38;
+    case KEY_0: return 39;
+    case KEY_ENTER: return 40;
+    case KEY_ESC: return 41;
+    case KEY_BACKSPACE: return 42;
+    case KEY_TAB: return 43;
+    case KEY_SPACE: return 44;
+    case KEY_MINUS: return 45;
+    case KEY_EQUAL: return 46;
+    case KEY_LEFTBRACE: return 47;
+    case KEY_RIGHTBRACE: return 48;
+    case KEY_BACKSLASH: return 49;
+    case KEY_SEMICOLON: return 51;
+    case KEY_APOSTROPHE: return 52;
+    case KEY_GRAVE: return 53;
+    case KEY_COMMA: return 54;
+    case KEY_DOT: return 55;
+    case KEY_SLASH: return 56;
+    case KEY_CAPSLOCK: return 57;
+    case KEY_F1: return 58;
+    case KEY_F2: return 59;
+    case KEY_F3: return 60;
+    case KEY_F4: return 61;
+    case KEY_F5: return 62;
+    case KEY_F6: return 63;
+    case KEY_F7: return 64;
+    case KEY_F8: return 65;
+    case KEY_F9: return 66;
+    case KEY_F10: return 67;
+    case KEY_F11: return 68;
+    case KEY_F12: return 69;
+    case KEY_SYSRQ: return 70;
+    case KEY_SCROLLLOCK: return 71;
+    case KEY_PAUSE: return 72;
+    case KEY_INSERT: return 73;
+    case KEY_HOME: return 74;
+    case KEY_PAGEUP: return 75;
+    case KEY_DELETE: return 76;
+    case KEY_END: return 77;
+    case KEY_PAGEDOWN: return 78;
+    case KEY_RIGHT: return 79;
+    case KEY_LEFT: return 80;
+    case KEY_DOWN: return 81;
+    case KEY_UP: return 82;
+    case KEY_NUMLOCK: return 83;
+    case KEY_KPSLASH: return 84;
+    case KEY_KPASTERISK: return 85;
+    case KEY_KPMINUS: return 86;
+    case KEY_KPPLUS: return 87;
+    case KEY_KPENTER: return 88;
+    case KEY_KP1: return 89;
+    case KEY_KP2: return 90;
+    case KEY_KP3: return 91;
+    case KEY_KP4: return 92;
+    case KEY_KP5: return 93;
+    case KEY_KP6: return 94;
+    case KEY_KP7: return 95;
+    case KEY_KP8: return 96;
+    case KEY_KP9: return 97;
+    case KEY_KP0: return 98;
+    case KEY_KPDOT: return 99;
+    case KEY_102ND: return 100;
+    case KEY_COMPOSE: return 101;
+    case KEY_KPEQUAL: return 103;
+    case KEY_F13: return 104;
+    case KEY_F14: return 105;
+    case KEY_F15: return 106;
+    case KEY_F16: return 107;
+    case KEY_F17: return 108;
+    case KEY_F18: return 109;
+    case KEY_F19: return 110;
+    case KEY_F20: return 111;
+    case KEY_F21: return 112;
+    case KEY_F22: return 113;
+    case KEY_F23: return 114;
+    case KEY_F24: return 115;
+    case KEY_MUTE: return 127;
+    case KEY_VOLUMEUP: return 128;
+    case KEY_VOLUMEDOWN: return 129;
+    case KEY_KPCOMMA: return 133;
+    case KEY_RO: return 135;
+    case KEY_KATAKANAHIRAGANA: return 136;
+    case KEY_YEN: return 137;
+    case KEY_HENKAN: return 138;
+    case KEY_MUHENKAN: return 139;
+    case KEY_HANGEUL: return 144;
+    case KEY_HANJA: return 145;
+    case KEY_LEFTCTRL: return 224;
+    case KEY_LEFTSHIFT: return 225;
+    case KEY_LEFTALT: return 226;
+    case KEY_LEFTMETA: return 227;
+    case KEY_RIGHTCTRL: return 228;
+    case KEY_RIGHTSHIFT: return 229;
+    case KEY_RIGHTALT: return 230;
+    case KEY_RIGHTMETA: return 231;
+    case KEY_MENU: return 101;
+  }
+  return 0;
+}
+
+static bool SynthKey(const KeySym &sym, bool pushed, const XEvent &event, Window window, GlopKeyEvent *ev) {
+  int x, y;
+  QueryCursor(window, &x, &y);
   
   KeySym throwaway_lower, key;
   XConvertCase(sym, &throwaway_lower, &key);
@@ -164,6 +595,7 @@ static bool SynthKey(const KeySym &sym, bool pushed, const XEvent &event, Window
     case XK_KP_Subtract: ki = kKeyPadSubtract; break;
     case XK_KP_Add: ki = kKeyPadAdd; break;
     
+    case XK_grave: ki = '`'; break;
     case XK_dead_grave: ki = '`'; break;
     case XK_minus: ki = '-'; break;
     case XK_equal: ki = '='; break;
@@ -171,19 +603,101 @@ static bool SynthKey(const KeySym &sym, bool pushed, const XEvent &event, Window
     case XK_bracketright: ki = ']'; break;
     case XK_backslash: ki = '\\'; break;
     case XK_semicolon: ki = ';'; break;
+    case XK_apostrophe: ki = '\''; break;
     case XK_dead_acute: ki = '\''; break;
     case XK_comma: ki = ','; break;
     case XK_period: ki = '.'; break;
     case XK_slash: ki = '/'; break;
-    case XK_space: ki = '/'; break;
+    case XK_space: ki = ' '; break;
+
+    case XK_F13: ki = kKeyF13; break;
+    case XK_F14: ki = kKeyF13 + 1; break;
+    case XK_F15: ki = kKeyF13 + 2; break;
+    case XK_F16: ki = kKeyF13 + 3; break;
+    case XK_F17: ki = kKeyF13 + 4; break;
+    case XK_F18: ki = kKeyF13 + 5; break;
+    case XK_F19: ki = kKeyF13 + 6; break;
+    case XK_F20: ki = kKeyF13 + 7; break;
+    case XK_F21: ki = kKeyF13 + 8; break;
+    case XK_F22: ki = kKeyF13 + 9; break;
+    case XK_F23: ki = kKeyF13 + 10; break;
+    case XK_F24: ki = kKeyF13 + 11; break;
+
+    case XK_Caps_Lock: ki = kKeyCapsLock; break;
+    case XK_Num_Lock: ki = kKeyNumLock; break;
+    case XK_Scroll_Lock: ki = kKeyScrollLock; break;
+    case XK_Print: ki = kKeyPrintScreen; break;
+    case XK_Sys_Req: ki = kKeyPrintScreen; break;
+    case XK_Pause: ki = kKeyPause; break;
+    case XK_Break: ki = kKeyPause; break;
+    case XK_Menu: ki = kKeyMenu; break;
+
+    case XK_Delete: ki = kKeyDelete; break;
+    case XK_Home: ki = kKeyHome; break;
+    case XK_Insert: ki = kKeyInsert; break;
+    case XK_End: ki = kKeyEnd; break;
+    case XK_Prior: ki = kKeyPageUp; break;
+    case XK_Next: ki = kKeyPageDown; break;
+
+    // Without modifiers the keypad gives these whether or not num lock is on
+    case XK_KP_Insert: ki = kKeyPad0; break;
+    case XK_KP_End: ki = kKeyPad1; break;
+    case XK_KP_Down: ki = kKeyPad2; break;
+    case XK_KP_Next: ki = kKeyPad3; break;
+    case XK_KP_Left: ki = kKeyPad4; break;
+    case XK_KP_Begin: ki = kKeyPad5; break;
+    case XK_KP_Right: ki = kKeyPad6; break;
+    case XK_KP_Home: ki = kKeyPad7; break;
+    case XK_KP_Up: ki = kKeyPad8; break;
+    case XK_KP_Prior: ki = kKeyPad9; break;
+    case XK_KP_Delete: ki = kKeyPadDecimal; break;
+    case XK_KP_Decimal: ki = kKeyPadDecimal; break;
+    case XK_KP_Separator: ki = kKeyPadComma; break;
+    case XK_KP_Equal: ki = kKeyPadEquals; break;
+
+    case XK_ISO_Left_Tab: ki = kKeyTab; break;
+    case XK_Meta_L: ki = kKeyLeftAlt; break;
+    case XK_Meta_R: ki = kKeyRightAlt; break;
+    case XK_ISO_Level3_Shift: ki = kKeyRightAlt; break;
+    case XK_Mode_switch: ki = kKeyRightAlt; break;
+
+    // The 102nd key on ISO keyboards, between left shift and Z
+    case XK_less: ki = kKeyIntlBackslash; break;
+
+    case XK_yen: ki = kKeyIntlYen; break;
+    case XK_Henkan: ki = kKeyConvert; break;
+    case XK_Muhenkan: ki = kKeyNonConvert; break;
+    case XK_Hiragana_Katakana: ki = kKeyKanaMode; break;
+    case XK_Hiragana: ki = kKeyKanaMode; break;
+    case XK_Katakana: ki = kKeyKanaMode; break;
+    case XK_Hangul: ki = kKeyHangul; break;
+    case XK_Hangul_Hanja: ki = kKeyHanja; break;
+
+    case XF86XK_AudioPlay: ki = kKeyMediaPlayPause; break;
+    case XF86XK_AudioPause: ki = kKeyMediaPlayPause; break;
+    case XF86XK_AudioStop: ki = kKeyMediaStop; break;
+    case XF86XK_AudioPrev: ki = kKeyMediaPrevious; break;
+    case XF86XK_AudioNext: ki = kKeyMediaNext; break;
+    case XF86XK_AudioMute: ki = kKeyVolumeMute; break;
+    case XF86XK_AudioLowerVolume: ki = kKeyVolumeDown; break;
+    case XF86XK_AudioRaiseVolume: ki = kKeyVolumeUp; break;
   }
-  
-  if(ki == 0)
+
+  // On JIS keyboards the key left of right shift gives a backslash, just like
+  // the key above return does, the scancode tells them apart.
+  int scancode = KeycodeToScancode(event.xkey.keycode);
+  if(ki == '\\' && scancode == 135)
+    ki = kKeyIntlRo;
+
+  // Keys whose symbols gin doesn't know about, like the letters on many
+  // non-US layouts, are still reported by position.
+  if(ki == 0 && scancode == 0)
     return false;
 
   ev->index = ki;
+  ev->scancode = scancode;
   ev->press_amt = pushed ? 1.0 : 0.0;
-  ev->timestamp = gt();
+  ev->timestamp = ServerTimeToLocal(event.xkey.time);
   ev->cursor_x = x;
   ev->cursor_y = y;
   ev->num_lock = event.xkey.state & (1 << 4);
@@ -191,30 +705,41 @@ static bool SynthKey(const KeySym &sym, bool pushed, const XEvent &event, Window
   return true;
 }
 static bool SynthButton(int button, bool pushed, const XEvent &event, Window window, GlopKeyEvent *ev) {
-  // mostly ignored
-  Window root, child;
-  int x, y, winx, winy;
-  unsigned int mask;
-  XQueryPointer(display, window, &root, &child, &x, &y, &winx, &winy, &mask);
+  int x, y;
+  QueryCursor(window, &x, &y);
   
   GlopKey ki;
+  float press_amt = pushed ? 1.0 : 0.0;
   if(button == Button1)
     ki = kMouseLButton;
   else if(button == Button2)
     ki = kMouseMButton;
   else if(button == Button3)
     ki = kMouseRButton;
-  /*
-  else if(button == Button4)
-    ki = kMouseWheelUp;   // these might be inverted so they're disabled for now
-  else if(button == Button5)
-    ki = kMouseWheelDown;*/
+  else if(button >= 4 && button <= 7) {
+    // The wheel is buttons 4 through 7: up, down, left and right.  Each click
+    // is a press followed immediately by a release, and wheel keys release
+    // themselves, so only the press matters.  With smooth scrolling X
+    // emulates these from the scroll valuators, which we already read
+    // directly, except while the pointer is grabbed and XI_Motion events go
+    // to the grab instead.
+    if(!pushed)
+      return false;
+    if(smooth_scroll && !scroll_valuators.empty() && !pointer_grabbed)
+      return false;
+    ki = button <= 5 ? kMouseWheelVertical : kMouseWheelHorizontal;
+    press_amt = (button == 4 || button == 7) ? 1.0 : -1.0;
+  }
+  else if(button == 8)
+    ki = kMouseBackButton;
+  else if(button == 9)
+    ki = kMouseForwardButton;
   else
     return false;
     
   ev->index = ki;
-  ev->press_amt = pushed ? 1.0 : 0.0;
-  ev->timestamp = gt();
+  ev->press_amt = press_amt;
+  ev->timestamp = ServerTimeToLocal(event.xbutton.time);
   ev->cursor_x = x;
   ev->cursor_y = y;
   ev->num_lock = event.xkey.state & (1 << 4);
@@ -222,32 +747,599 @@ static bool SynthButton(int button, bool pushed, const XEvent &event, Window win
   return true;
 }
 
-static bool SynthMotion(int dx, int dy, const XEvent &event, Window window, GlopKeyEvent *ev, GlopKeyEvent *ev2) {
-  // mostly ignored
-  Window root, child;
-  int x, y, winx, winy;
-  unsigned int mask;
-  XQueryPointer(display, window, &root, &child, &x, &y, &winx, &winy, &mask);
-  
+// Turns a motion event into relative motion along the mouse axes.  If the
+// cursor is hidden this also warps it back to the center of the window.
+static bool SynthMotion(const XEvent &event, Window window, GlopKeyEvent *ev, GlopKeyEvent *ev2) {
+  int x = event.xmotion.x_root;
+  int y = event.xmotion.y_root;
+  if(!have_last_mouse) {
+    have_last_mouse = true;
+    last_mouse_x = x;
+    last_mouse_y = y;
+    return false;
+  }
+  int dx = x - last_mouse_x;
+  int dy = y - last_mouse_y;
+  last_mouse_x = x;
+  last_mouse_y = y;
+
+  if(cursor_hidden) {
+    XWindowAttributes attrs;
+    XGetWindowAttributes(display, window, &attrs);
+    int cx = attrs.width / 2;
+    int cy = attrs.height / 2;
+    if(event.xmotion.x != cx || event.xmotion.y != cy) {
+      XWarpPointer(display, None, window, 0, 0, 0, 0, cx, cy);
+      last_mouse_x = x - event.xmotion.x + cx;
+      last_mouse_y = y - event.xmotion.y + cy;
+    }
+  }
+
+  // The motion event generated by warping the cursor lands here
+  if(dx == 0 && dy == 0)
+    return false;
+
+  // Relative motion comes from XI_RawMotion instead
+  if(raw_motion)
+    return false;
+
+  int cursor_x = x;
+  int cursor_y = y;
+  if(cursor_hidden) {
+    cursor_x = locked_x;
+    cursor_y = locked_y;
+  }
+
   ev->index = kMouseXAxis;
   ev->press_amt = dx;
-  ev->timestamp = gt();
-  ev->cursor_x = x;
-  ev->cursor_y = y;
-  ev->num_lock = event.xkey.state & (1 << 4);
-  ev->caps_lock = event.xkey.state & LockMask;
+  ev->timestamp = ServerTimeToLocal(event.xmotion.time);
+  ev->cursor_x = cursor_x;
+  ev->cursor_y = cursor_y;
+  ev->num_lock = event.xmotion.state & (1 << 4);
+  ev->caps_lock = event.xmotion.state & LockMask;
 
   ev2->index = kMouseYAxis;
   ev2->press_amt = dy;
   ev2->timestamp = ev->timestamp;
-  ev2->cursor_x = x;
-  ev2->cursor_y = y;
-  ev2->num_lock = event.xkey.state & (1 << 4);
-  ev2->caps_lock = event.xkey.state & LockMask;
+  ev2->cursor_x = cursor_x;
+  ev2->cursor_y = cursor_y;
+  ev2->num_lock = event.xmotion.state & (1 << 4);
+  ev2->caps_lock = event.xmotion.state & LockMask;
 
   return true;
 }
 
+// Text that we are offering on the CLIPBOARD and PRIMARY selections.
+string clipboard_text;
+
+// Answers another client's request for the contents of one of our selections.
+static void HandleSelectionRequest(const XSelectionRequestEvent &request) {
+  XSelectionEvent reply;
+  reply.type = SelectionNotify;
+  reply.display = request.display;
+  reply.requestor = request.requestor;
+  reply.selection = request.selection;
+  reply.target = request.target;
+  reply.time = request.time;
+  reply.property = None;
+
+  // Obsolete clients don't specify a property, in which case we're supposed to
+  // use the target as the property.
+  Atom property = request.property;
+  if(property == None)
+    property = request.target;
+
+  if(request.target == targets_atom) {
+    Atom targets[] = { targets_atom, utf8_atom, XA_STRING };
+    XChangeProperty(display, request.requestor, property, XA_ATOM, 32, PropModeReplace, (const unsigned char*)targets, sizeof(targets) / sizeof(targets[0]));
+    reply.property = property;
+  } else if(request.target == utf8_atom || request.target == XA_STRING) {
+    XChangeProperty(display, request.requestor, property, request.target, 8, PropModeReplace, (const unsigned char*)clipboard_text.data(), clipboard_text.size());
+    reply.property = property;
+  }
+
+  XSendEvent(display, request.requestor, False, NoEventMask, (XEvent*)&reply);
+  XFlush(display);
+}
+
+
+// Drag and drop
+// =============
+
+// The version of XDND that we speak
+static const int kXdndVersion = 5;
+
+struct Drop {
+  // Paths separated by '\0'
+  string paths;
+  int x;
+  int y;
+  long long timestamp;
+};
+static vector<Drop> drops;
+
+// State of the drag that is currently over the window, if any
+static Window xdnd_source = None;
+static int xdnd_source_version = 0;
+static bool xdnd_accept = false;
+static int xdnd_x = 0;
+static int xdnd_y = 0;
+static long long xdnd_time = 0;
+
+static void SendXdndMessage(Window target, Atom type, long l1, long l2, long l3, long l4, Window window) {
+  XEvent reply;
+  memset(&reply, 0, sizeof(reply));
+  reply.xclient.type = ClientMessage;
+  reply.xclient.display = display;
+  reply.xclient.window = target;
+  reply.xclient.message_type = type;
+  reply.xclient.format = 32;
+  reply.xclient.data.l[0] = window;
+  reply.xclient.data.l[1] = l1;
+  reply.xclient.data.l[2] = l2;
+  reply.xclient.data.l[3] = l3;
+  reply.xclient.data.l[4] = l4;
+  XSendEvent(display, target, False, NoEventMask, &reply);
+  XFlush(display);
+}
+
+// Returns true if the source of a drag offers text/uri-list.  Sources with
+// more than three types list them in the XdndTypeList property.
+static bool XdndOffersUriList(const XClientMessageEvent &enter) {
+  if(!(enter.data.l[1] & 1)) {
+    for(int i = 2; i < 5; i++) {
+      if((Atom)enter.data.l[i] == uri_list_atom)
+        return true;
+    }
+    return false;
+  }
+  Atom type;
+  int format;
+  unsigned long count, remaining;
+  unsigned char* data = NULL;
+  XGetWindowProperty(display, enter.data.l[0], xdnd_type_list_atom, 0, LONG_MAX / 4, False, XA_ATOM, &type, &format, &count, &remaining, &data);
+  bool found = false;
+  if(data) {
+    Atom* types = (Atom*)data;
+    for(unsigned long i = 0; i < count; i++) {
+      if(types[i] == uri_list_atom)
+        found = true;
+    }
+    XFree(data);
+  }
+  return found;
+}
+
+static int HexValue(char c) {
+  if(c >= '0' && c <= '9') return c - '0';
+  if(c >= 'a' && c <= 'f') return c - 'a' + 10;
+  if(c >= 'A' && c <= 'F') return c - 'A' + 10;
+  return -1;
+}
+
+// Turns a text/uri-list into local paths separated by '\0'.  Anything that
+// isn't a file:// uri is skipped.
+static string ParseUriList(const string &list) {
+  string paths;
+  size_t pos = 0;
+  while(pos < list.size()) {
+    size_t end = list.find('\n', pos);
+    if(end == string::npos)
+      end = list.size();
+    string line = list.substr(pos, end - pos);
+    pos = end + 1;
+    if(!line.empty() && line[line.size() - 1] == '\r')
+      line.erase(line.size() - 1);
+    if(line.empty() || line[0] == '#' || line.compare(0, 7, "file://") != 0)
+      continue;
+
+    // Skip the host, if there is one
+    size_t start = line.find('/', 7);
+    if(start == string::npos)
+      continue;
+
+    string path;
+    for(size_t i = start; i < line.size(); i++) {
+      int hi, lo;
+      if(line[i] == '%' && i + 2 < line.size() && (hi = HexValue(line[i + 1])) >= 0 && (lo = HexValue(line[i + 2])) >= 0) {
+        path += (char)(hi * 16 + lo);
+        i += 2;
+      } else {
+        path += line[i];
+      }
+    }
+    paths += path;
+    paths += '\0';
+  }
+  return paths;
+}
+
+// Handles the XDND client messages, returns false if event isn't one.
+static bool HandleXdndMessage(const XClientMessageEvent &event, Window window) {
+  if(event.message_type == xdnd_enter_atom) {
+    xdnd_source = event.data.l[0];
+    xdnd_source_version = event.data.l[1] >> 24;
+    xdnd_accept = xdnd_source_version <= kXdndVersion && XdndOffersUriList(event);
+    return true;
+  }
+  if(event.message_type == xdnd_position_atom) {
+    if((Window)event.data.l[0] != xdnd_source)
+      return true;
+    xdnd_x = (event.data.l[2] >> 16) & 0xffff;
+    xdnd_y = event.data.l[2] & 0xffff;
+    // An empty rectangle asks the source to keep sending XdndPosition
+    SendXdndMessage(xdnd_source, xdnd_status_atom, xdnd_accept ? 1 : 0, 0, 0, xdnd_accept ? xdnd_action_copy_atom : None, window);
+    return true;
+  }
+  if(event.message_type == xdnd_leave_atom) {
+    xdnd_source = None;
+    return true;
+  }
+  if(event.message_type == xdnd_drop_atom) {
+    if((Window)event.data.l[0] != xdnd_source)
+      return true;
+    if(!xdnd_accept) {
+      SendXdndMessage(xdnd_source, xdnd_finished_atom, 0, None, 0, 0, window);
+      xdnd_source = None;
+      return true;
+    }
+    Time time = CurrentTime;
+    xdnd_time = gtm();
+    if(xdnd_source_version >= 1) {
+      time = event.data.l[2];
+      xdnd_time = ServerTimeToLocal(time);
+    }
+    // The drop is finished once the SelectionNotify shows up
+    XConvertSelection(display, xdnd_selection_atom, uri_list_atom, glop_drop_atom, window, time);
+    XFlush(display);
+    return true;
+  }
+  return false;
+}
+
+// Reads the paths that were dropped and tells the source that we're done.
+static void HandleXdndSelection(const XSelectionEvent &event, Window window) {
+  if(xdnd_source == None)
+    return;
+  bool success = false;
+  if(event.property != None) {
+    Atom type;
+    int format;
+    unsigned long count, remaining;
+    unsigned char* data = NULL;
+    XGetWindowProperty(display, window, glop_drop_atom, 0, LONG_MAX / 4, True, AnyPropertyType, &type, &format, &count, &remaining, &data);
+    if(data) {
+      Drop drop;
+      drop.paths = ParseUriList(string((const char*)data, count));
+      drop.x = xdnd_x;
+      drop.y = xdnd_y;
+      drop.timestamp = xdnd_time;
+      if(!drop.paths.empty()) {
+        drops.push_back(drop);
+        success = true;
+      }
+      XFree(data);
+    }
+  }
+  if(xdnd_source_version >= 2)
+    SendXdndMessage(xdnd_source, xdnd_finished_atom, success ? 1 : 0, success ? xdnd_action_copy_atom : None, 0, 0, window);
+  xdnd_source = None;
+}
+
+static void UpdateCursorGrab();
+
+static bool window_focused = true;
+static bool window_minimized = false;
+
+// Turns raw device motion into relative motion along the mouse axes.  This is
+// unaccelerated and fractional, and doesn't care where the cursor is.
+static void HandleRawMotion(const XIRawEvent& raw) {
+  if(!window_focused) return;
+  double dx = 0;
+  double dy = 0;
+  GetValuator(raw.valuators.mask, raw.valuators.mask_len, raw.raw_values, 0, &dx);
+  GetValuator(raw.valuators.mask, raw.valuators.mask_len, raw.raw_values, 1, &dy);
+  if(dx == 0 && dy == 0)
+    return;
+
+  int cursor_x = last_mouse_x;
+  int cursor_y = last_mouse_y;
+  if(cursor_hidden) {
+    cursor_x = locked_x;
+    cursor_y = locked_y;
+  }
+
+  GlopKeyEvent ev;
+  GlopClearKeyEvent(&ev);
+  ev.index = kMouseXAxis;
+  ev.press_amt = dx;
+  ev.timestamp = ServerTimeToLocal(raw.time);
+  ev.cursor_x = cursor_x;
+  ev.cursor_y = cursor_y;
+  events.push_back(ev);
+  ev.index = kMouseYAxis;
+  ev.press_amt = dy;
+  events.push_back(ev);
+}
+
+// Handles motion on the window when XI_Motion is selected.  Scroll valuators
+// that moved turn into fractional wheel events, where one increment is worth
+// one click of a wheel, and the rest is handled as core motion.
+static void HandleXIMotion(const XIDeviceEvent& motion, Window window) {
+  for(int i = 0; i < scroll_valuators.size(); i++) {
+    ScrollValuator& valuator = scroll_valuators[i];
+    double value;
+    if(valuator.device != motion.sourceid)
+      continue;
+    if(!GetValuator(motion.valuators.mask, motion.valuators.mask_len, motion.valuators.values, valuator.number, &value))
+      continue;
+    double delta = value - valuator.last;
+    bool have_last = valuator.have_last;
+    valuator.last = value;
+    valuator.have_last = true;
+    if(!have_last || delta == 0)
+      continue;
+
+    // Scroll valuators count down and to the right, the wheel keys count up
+    // and to the right.
+    GlopKeyEvent ev;
+    GlopClearKeyEvent(&ev);
+    ev.index = valuator.vertical ? kMouseWheelVertical : kMouseWheelHorizontal;
+    ev.press_amt = delta / valuator.increment;
+    if(valuator.vertical)
+      ev.press_amt = -ev.press_amt;
+    ev.timestamp = ServerTimeToLocal(motion.time);
+    ev.cursor_x = (int)motion.root_x;
+    ev.cursor_y = (int)motion.root_y;
+    ev.num_lock = motion.mods.effective & (1 << 4);
+    ev.caps_lock = motion.mods.effective & LockMask;
+    events.push_back(ev);
+  }
+
+  XEvent event;
+  memset(&event, 0, sizeof(event));
+  event.xmotion.type = MotionNotify;
+  event.xmotion.display = display;
+  event.xmotion.window = motion.event;
+  event.xmotion.root = motion.root;
+  event.xmotion.time = motion.time;
+  event.xmotion.x = (int)motion.event_x;
+  event.xmotion.y = (int)motion.event_y;
+  event.xmotion.x_root = (int)motion.root_x;
+  event.xmotion.y_root = (int)motion.root_y;
+  event.xmotion.state = motion.mods.effective;
+  GlopKeyEvent ev, ev2;
+  GlopClearKeyEvent(&ev);
+  GlopClearKeyEvent(&ev2);
+  if(SynthMotion(event, window, &ev, &ev2)) {
+    events.push_back(ev);
+    events.push_back(ev2);
+  }
+}
+
+static void HandleXInput2Event(const XGenericEventCookie& cookie, Window window) {
+  switch(cookie.evtype) {
+    case XI_RawMotion:
+      HandleRawMotion(*reinterpret_cast<const XIRawEvent*>(cookie.data));
+      break;
+
+    case XI_Motion:
+      HandleXIMotion(*reinterpret_cast<const XIDeviceEvent*>(cookie.data), window);
+      break;
+
+    case XI_DeviceChanged:
+    case XI_HierarchyChanged:
+      QueryScrollValuators();
+      break;
+  }
+}
+
+// Text input
+// ==========
+
+// While text input is enabled key presses go through the input method, and
+// whatever text they produce is reported as text events.
+static bool text_input_enabled = false;
+
+struct TextEvent {
+  string text;
+  bool preedit;
+  int cursor;
+  long long timestamp;
+};
+static vector<TextEvent> text_events;
+
+// The composition in progress, and the input method's caret within it, in
+// characters.
+static wstring preedit_text;
+static int preedit_caret = 0;
+
+// Where the input method was last told the caret is, in window coordinates
+// with the origin at the top left.
+static int text_spot_x = -1;
+static int text_spot_y = -1;
+
+static void AppendUtf8(unsigned int c, string* out) {
+  if(c < 0x80) {
+    *out += (char)c;
+  } else if(c < 0x800) {
+    *out += (char)(0xc0 | (c >> 6));
+    *out += (char)(0x80 | (c & 0x3f));
+  } else if(c < 0x10000) {
+    *out += (char)(0xe0 | (c >> 12));
+    *out += (char)(0x80 | ((c >> 6) & 0x3f));
+    *out += (char)(0x80 | (c & 0x3f));
+  } else {
+    *out += (char)(0xf0 | (c >> 18));
+    *out += (char)(0x80 | ((c >> 12) & 0x3f));
+    *out += (char)(0x80 | ((c >> 6) & 0x3f));
+    *out += (char)(0x80 | (c & 0x3f));
+  }
+}
+
+// Converts text in the encoding of the current locale to wide characters.
+static wstring MultiByteToWide(const char* text) {
+  size_t length = mbstowcs(NULL, text, 0);
+  if(length == (size_t)-1)
+    return wstring();
+  vector<wchar_t> wide(length + 1);
+  mbstowcs(&wide[0], text, length + 1);
+  return wstring(&wide[0], length);
+}
+
+static void PushPreedit() {
+  TextEvent event;
+  event.preedit = true;
+  event.cursor = 0;
+  for(int i = 0; i < preedit_text.size(); i++) {
+    if(i == preedit_caret)
+      event.cursor = event.text.size();
+    AppendUtf8(preedit_text[i], &event.text);
+  }
+  if(preedit_caret >= preedit_text.size())
+    event.cursor = event.text.size();
+  event.timestamp = gtm();
+  text_events.push_back(event);
+}
+
+static int PreeditStart(XIC ic, XPointer client_data, XPointer call_data) {
+  preedit_text.clear();
+  preedit_caret = 0;
+  // No limit on the length of the composition
+  return -1;
+}
+
+static void PreeditDone(XIC ic, XPointer client_data, XPointer call_data) {
+  preedit_text.clear();
+  preedit_caret = 0;
+  PushPreedit();
+}
+
+static void PreeditDraw(XIC ic, XPointer client_data, XPointer call_data) {
+  const XIMPreeditDrawCallbackStruct* draw = reinterpret_cast<const XIMPreeditDrawCallbackStruct*>(call_data);
+  wstring text;
+  if(draw->text) {
+    if(draw->text->encoding_is_wchar) {
+      if(draw->text->string.wide_char)
+        text.assign(draw->text->string.wide_char, draw->text->length);
+    } else if(draw->text->string.multi_byte) {
+      text = MultiByteToWide(draw->text->string.multi_byte);
+    }
+  }
+  int first = max(0, min<int>(draw->chg_first, preedit_text.size()));
+  int length = max(0, min<int>(draw->chg_length, preedit_text.size() - first));
+  preedit_text.replace(first, length, text);
+  preedit_caret = max(0, min<int>(draw->caret, preedit_text.size()));
+  PushPreedit();
+}
+
+static void PreeditCaret(XIC ic, XPointer client_data, XPointer call_data) {
+  XIMPreeditCaretCallbackStruct* caret = reinterpret_cast<XIMPreeditCaretCallbackStruct*>(call_data);
+  switch(caret->direction) {
+    case XIMAbsolutePosition:
+      preedit_caret = caret->position;
+      break;
+    case XIMForwardChar:
+      preedit_caret++;
+      break;
+    case XIMBackwardChar:
+      preedit_caret--;
+      break;
+    case XIMLineStart:
+      preedit_caret = 0;
+      break;
+    case XIMLineEnd:
+      preedit_caret = preedit_text.size();
+      break;
+    default:
+      break;
+  }
+  preedit_caret = max(0, min<int>(preedit_caret, preedit_text.size()));
+  caret->position = preedit_caret;
+  PushPreedit();
+}
+
+// Creates an input context for window with xim_style, and makes sure that the
+// window gets the events that the input method needs.
+static XIC CreateInputContext(Window window) {
+  if(!xim || xim_style == 0)
+    return NULL;
+  XIC ic = NULL;
+  if(xim_style & XIMPreeditCallbacks) {
+    static XIMCallback start = { NULL, (XIMProc)PreeditStart };
+    static XIMCallback done = { NULL, (XIMProc)PreeditDone };
+    static XIMCallback draw = { NULL, (XIMProc)PreeditDraw };
+    static XIMCallback caret = { NULL, (XIMProc)PreeditCaret };
+    XVaNestedList preedit = XVaCreateNestedList(0,
+        XNPreeditStartCallback, &start,
+        XNPreeditDoneCallback, &done,
+        XNPreeditDrawCallback, &draw,
+        XNPreeditCaretCallback, &caret,
+        NULL);
+    ic = XCreateIC(xim, XNInputStyle, xim_style, XNClientWindow, window, XNFocusWindow, window, XNPreeditAttributes, preedit, NULL);
+    XFree(preedit);
+  } else if(xim_style & XIMPreeditPosition) {
+    XPoint spot = { 0, 0 };
+    XVaNestedList preedit = XVaCreateNestedList(0, XNSpotLocation, &spot, NULL);
+    ic = XCreateIC(xim, XNInputStyle, xim_style, XNClientWindow, window, XNFocusWindow, window, XNPreeditAttributes, preedit, NULL);
+    XFree(preedit);
+  } else {
+    ic = XCreateIC(xim, XNInputStyle, xim_style, XNClientWindow, window, XNFocusWindow, window, NULL);
+  }
+  if(!ic)
+    return NULL;
+
+  long filter_events = 0;
+  if(XGetICValues(ic, XNFilterEvents, &filter_events, NULL) == NULL && filter_events) {
+    XWindowAttributes attrs;
+    XGetWindowAttributes(display, window, &attrs);
+    XSelectInput(display, window, attrs.your_event_mask | filter_events);
+  }
+  return ic;
+}
+
+// Reports the text that a key press produced, if any.  Key presses that the
+// input method committed text with come through here too.
+static void LookupText(XKeyEvent* key, XIC ic) {
+  char buffer[64];
+  vector<char> big_buffer;
+  char* text = buffer;
+  KeySym sym;
+  string utf8;
+  if(ic) {
+    Status status;
+    int length = Xutf8LookupString(ic, key, text, sizeof(buffer), &sym, &status);
+    if(status == XBufferOverflow) {
+      big_buffer.resize(length);
+      text = &big_buffer[0];
+      length = Xutf8LookupString(ic, key, text, length, &sym, &status);
+    }
+    if(status != XLookupChars && status != XLookupBoth)
+      return;
+    utf8.assign(text, length);
+  } else {
+    // Without an input method all we can get is Latin-1
+    int length = XLookupString(key, text, sizeof(buffer), &sym, NULL);
+    for(int i = 0; i < length; i++)
+      AppendUtf8((unsigned char)text[i], &utf8);
+  }
+
+  // Backspace, return and friends come through as control characters, but
+  // they are keys, not text.
+  TextEvent event;
+  for(int i = 0; i < utf8.size(); i++) {
+    unsigned char c = utf8[i];
+    if(c >= 0x20 && c != 0x7f)
+      event.text += c;
+  }
+  if(event.text.empty())
+    return;
+  event.preedit = false;
+  event.cursor = 0;
+  event.timestamp = ServerTimeToLocal(key->time);
+  text_events.push_back(event);
+}
+
 Bool EventTester(Display *display, XEvent *event, XPointer arg) {
   return true; // hurrr
 }
@@ -264,6 +1356,13 @@ void GlopThink() {
   int last_botched_release = -1;
   int last_botched_time = -1;
   while(XCheckIfEvent(display, &event, &EventTester, NULL)) {
+    // The input method gets first look at everything.  Keys only go to it
+    // while text input is enabled, so that they don't get composed into
+    // something else while someone is playing.
+    bool is_key = event.type == KeyPress || event.type == KeyRelease;
+    if((!is_key || text_input_enabled) && XFilterEvent(&event, None))
+      continue;
+
     if((event.type == KeyPress || event.type == KeyRelease) && event.xkey.keycode < 256) {
       // X is kind of a cock and likes to send us hardware repeat messages for people holding buttons down. Why do you do this, X? Why do you have to make me hate you?
       
@@ -280,6 +1379,10 @@ void GlopThink() {
             // ffffffffff
             last_botched_release = -1;
             last_botched_time = -1;
+            // The repeat isn't a new key press for gin, but held keys still
+            // repeat the text that they type
+            if(text_input_enabled)
+              LookupText(&event.xkey, data->inputcontext);
             continue;
           }
         }
@@ -293,23 +1396,19 @@ void GlopThink() {
     GlopClearKeyEvent(&ev);
     switch(event.type) {
       case KeyPress: {
-        char buf[2];
-        KeySym sym;
-        XComposeStatus status;
-        
-        XLookupString(&event.xkey, buf, sizeof(buf), &sym, &status);
+        // Keys are reported without modifiers applied, shift+1 is still 1
+        KeySym sym = XLookupKeysym(&event.xkey, 0);
         
         if(SynthKey(sym, true, event, data->window, &ev))
           events.push_back(ev);
+        if(text_input_enabled)
+          LookupText(&event.xkey, data->inputcontext);
         break;
       }
       
       case KeyRelease: {
-        char buf[2];
-        KeySym sym;
-        XComposeStatus status;
-        
-        XLookupString(&event.xkey, buf, sizeof(buf), &sym, &status);
+        // Keys are reported without modifiers applied, shift+1 is still 1
+        KeySym sym = XLookupKeysym(&event.xkey, 0);
         
         if(SynthKey(sym, false, event, data->window, &ev))
           events.push_back(ev);
@@ -329,20 +1428,57 @@ void GlopThink() {
       case MotionNotify:
         GlopKeyEvent ev2;
         GlopClearKeyEvent(&ev2);
-        if(SynthMotion(event.xmotion.x, event.xmotion.y, event, data->window, &ev, &ev2)) {
+        if(SynthMotion(event, data->window, &ev, &ev2)) {
           events.push_back(ev);
           events.push_back(ev2);
         }
         break;
       
+      case GenericEvent:
+        if(event.xcookie.extension == xi_opcode && XGetEventData(display, &event.xcookie)) {
+          HandleXInput2Event(event.xcookie, data->window);
+          XFreeEventData(display, &event.xcookie);
+        }
+        break;
+
+      case EnterNotify:
+        ResetScrollValuators();
+        break;
+
       case FocusIn:
-        XSetICFocus(data->inputcontext);
+        window_focused = true;
+        if(data->inputcontext && text_input_enabled)
+          XSetICFocus(data->inputcontext);
+        UpdateCursorGrab();
+        break;
+
+      case SelectionRequest:
+        HandleSelectionRequest(event.xselectionrequest);
+        break;
+
+      case SelectionNotify:
+        if(event.xselection.selection == xdnd_selection_atom)
+          HandleXdndSelection(event.xselection, data->window);
         break;
       
       case FocusOut:
-        XUnsetICFocus(data->inputcontext);
+        window_focused = false;
+        if(data->inputcontext)
+          XUnsetICFocus(data->inputcontext);
+        // Don't hold on to the pointer while another window has focus
+        XUngrabPointer(display, CurrentTime);
+        pointer_grabbed = false;
         break;
       
+      // Window managers unmap windows when they are minimized
+      case UnmapNotify:
+        window_minimized = true;
+        break;
+
+      case MapNotify:
+        window_minimized = false;
+        break;
+
       case DestroyNotify:
           // TODO: probably want to do something here
 //        WindowDashDestroy(); // ffffff
@@ -350,6 +1486,8 @@ void GlopThink() {
         return;
     
       case ClientMessage :
+        if(HandleXdndMessage(event.xclient, data->window))
+          break;
         if(event.xclient.format == 32 && event.xclient.data.l[0] == static_cast<long>(close_atom)) {
 //            WindowDashDestroy();
 //            LOGF("destroj\n");
@@ -361,33 +1499,180 @@ void GlopThink() {
 
 void GlopSetTitle(OsWindowData* data, const string& title) {
   XStoreName(display, data->window, title.c_str());
+
+  // XStoreName() is latin-1 only, window managers that understand
+  // _NET_WM_NAME will use this instead.
+  Atom net_wm_name = XInternAtom(display, "_NET_WM_NAME", false);
+  XChangeProperty(display, data->window, net_wm_name, utf8_atom, 8, PropModeReplace, (const unsigned char*)title.c_str(), title.size());
 }
 
 void glopSetCurrentContext(OsWindowData* data) {
-  glXMakeCurrent(display, data->window, data->context);
+  glXMakeContextCurrent(display, data->drawable, data->drawable, data->context);
+}
+
+void GlopSetWindowTitle(const char* title) {
+  if(!windowdata)
+    return;
+  GlopSetTitle(windowdata, string(title));
+  XFlush(display);
+}
+
+// The options that the current window was created with.  The title is not
+// valid after GlopCreateWindow() returns.
+static GlopWindowOptions window_options;
+
+// What we actually got when the context was created.
+static GlopContextAttributes context_attributes;
+
+void GlopGetContextAttributes(GlopContextAttributes* attribs) {
+  *attribs = context_attributes;
+}
+
+// Returns the best framebuffer config that satisfies want.  If nothing does
+// then sRGB and then multisampling are given up on, in that order.
+static bool ChooseFBConfig(const GlopContextAttributes& want, int drawable_type, GLXFBConfig* config) {
+  for(int attempt = 0; attempt < 3; attempt++) {
+    int attribs[32];
+    int n = 0;
+    attribs[n++] = GLX_X_RENDERABLE;  attribs[n++] = True;
+    attribs[n++] = GLX_DRAWABLE_TYPE; attribs[n++] = drawable_type;
+    attribs[n++] = GLX_RENDER_TYPE;   attribs[n++] = GLX_RGBA_BIT;
+    attribs[n++] = GLX_DOUBLEBUFFER;  attribs[n++] = True;
+    attribs[n++] = GLX_RED_SIZE;      attribs[n++] = 1;
+    attribs[n++] = GLX_GREEN_SIZE;    attribs[n++] = 1;
+    attribs[n++] = GLX_BLUE_SIZE;     attribs[n++] = 1;
+    attribs[n++] = GLX_DEPTH_SIZE;    attribs[n++] = want.depth_bits;
+    attribs[n++] = GLX_STENCIL_SIZE;  attribs[n++] = want.stencil_bits;
+    if(want.samples > 0 && attempt < 2) {
+      attribs[n++] = GLX_SAMPLE_BUFFERS; attribs[n++] = 1;
+      attribs[n++] = GLX_SAMPLES;        attribs[n++] = want.samples;
+    }
+    if(want.srgb && attempt < 1) {
+      attribs[n++] = GLX_FRAMEBUFFER_SRGB_CAPABLE_ARB; attribs[n++] = True;
+    }
+    attribs[n++] = None;
+
+    int count = 0;
+    GLXFBConfig* configs = glXChooseFBConfig(display, screen, attribs, &count);
+    if(configs && count > 0) {
+      *config = configs[0];
+      XFree(configs);
+      return true;
+    }
+    if(configs)
+      XFree(configs);
+  }
+  return false;
+}
+
+static int IgnoreXError(Display* display, XErrorEvent* error) {
+  return 0;
+}
+
+typedef GLXContext (*CreateContextAttribsProc)(Display*, GLXFBConfig, GLXContext, Bool, const int*);
+
+// Tries to make a context of the requested version and profile, and falls
+// back on a regular context if that isn't possible.
+static GLXContext CreateContext(GLXFBConfig config, const GlopContextAttributes& want) {
+  if(want.major > 0) {
+    CreateContextAttribsProc create = (CreateContextAttribsProc)glXGetProcAddressARB((const GLubyte*)"glXCreateContextAttribsARB");
+    if(create) {
+      int attribs[] = {
+        GLX_CONTEXT_MAJOR_VERSION_ARB, want.major,
+        GLX_CONTEXT_MINOR_VERSION_ARB, want.minor,
+        GLX_CONTEXT_PROFILE_MASK_ARB, want.core_profile ? GLX_CONTEXT_CORE_PROFILE_BIT_ARB : GLX_CONTEXT_COMPATIBILITY_PROFILE_BIT_ARB,
+        None
+      };
+      // An unsupported version is reported as an X error, which would
+      // otherwise kill the program.
+      XErrorHandler old_handler = XSetErrorHandler(IgnoreXError);
+      GLXContext context = create(display, config, NULL, True, attribs);
+      XSync(display, false);
+      XSetErrorHandler(old_handler);
+      if(context)
+        return context;
+    }
+  }
+  return glXCreateNewContext(display, config, GLX_RGBA_TYPE, NULL, True);
+}
+
+// Must be called with the new context current.
+static void QueryContextAttributes(GLXFBConfig config) {
+  GlopContextAttributes &a = context_attributes;
+  memset(&a, 0, sizeof(a));
+  const char* version = (const char*)glGetString(GL_VERSION);
+  if(version)
+    sscanf(version, "%d.%d", &a.major, &a.minor);
+  if(a.major > 3 || (a.major == 3 && a.minor >= 2)) {
+    GLint mask = 0;
+    glGetIntegerv(GL_CONTEXT_PROFILE_MASK, &mask);
+    a.core_profile = (mask & GL_CONTEXT_CORE_PROFILE_BIT) != 0;
+  }
+  glXGetFBConfigAttrib(display, config, GLX_DEPTH_SIZE, &a.depth_bits);
+  glXGetFBConfigAttrib(display, config, GLX_STENCIL_SIZE, &a.stencil_bits);
+  int sample_buffers = 0;
+  glXGetFBConfigAttrib(display, config, GLX_SAMPLE_BUFFERS, &sample_buffers);
+  if(sample_buffers)
+    glXGetFBConfigAttrib(display, config, GLX_SAMPLES, &a.samples);
+  int srgb = 0;
+  if(glXGetFBConfigAttrib(display, config, GLX_FRAMEBUFFER_SRGB_CAPABLE_ARB, &srgb) == Success)
+    a.srgb = srgb != 0;
+}
+
+// Sets the size hints for the window according to window_options.  A width of
+// 0 removes all restrictions, which is what we want while full screen.
+static void SetSizeHints(int width, int height) {
+  XSizeHints hints;
+  memset(&hints, 0, sizeof(hints));
+  if(width > 0 && !window_options.resizable) {
+    // This is a hack to force some windows managers to disable resizing
+    hints.flags = PMinSize | PMaxSize;
+    hints.min_width = hints.max_width = width;
+    hints.min_height = hints.max_height = height;
+  } else if(width > 0) {
+    if(window_options.min_width > 0 || window_options.min_height > 0) {
+      hints.flags |= PMinSize;
+      hints.min_width = window_options.min_width;
+      hints.min_height = window_options.min_height;
+    }
+    if(window_options.max_width > 0 || window_options.max_height > 0) {
+      hints.flags |= PMaxSize;
+      hints.max_width = window_options.max_width > 0 ? window_options.max_width : SHRT_MAX;
+      hints.max_height = window_options.max_height > 0 ? window_options.max_height : SHRT_MAX;
+    }
+  }
+  XSetWMNormalHints(display, windowdata->window, &hints);
 }
 
-void* GlopCreateWindow(void* title, int x, int y, int width, int height) {
+void* GlopCreateWindow(GlopWindowOptions* options) {
   OsWindowData *nw = new OsWindowData();
 //  ASSERT(!windowdata);
   windowdata = nw;
-     
+  window_options = *options;
+
+  int x = options->x;
+  int y = options->y;
+  int width = options->width;
+  int height = options->height;
+
   // this is bad
   if(x == -1) x = 100;
   if(y == -1) y = 100;
-  
-  
-  int glxcv_params[] = {
-    GLX_RGBA,
-    GLX_RED_SIZE, 1,
-    GLX_GREEN_SIZE, 1,
-    GLX_BLUE_SIZE, 1,
-    GLX_DOUBLEBUFFER,
-    GLX_DEPTH_SIZE, 1,
-    GLX_STENCIL_SIZE, 8,
-    None
-  };
-  XVisualInfo *vinfo = glXChooseVisual(display, screen, glxcv_params);
+
+  // Offscreen windows still get an X window, it just never gets mapped, so
+  // that everything that deals with the window keeps working.
+  int drawable_type = GLX_WINDOW_BIT;
+  if(options->offscreen)
+    drawable_type |= GLX_PBUFFER_BIT;
+
+  GLXFBConfig config;
+  if(!ChooseFBConfig(options->context, drawable_type, &config)) {
+    // Nothing matched, so take the depth and stencil buffers that we can get
+    GlopContextAttributes fallback;
+    memset(&fallback, 0, sizeof(fallback));
+    ChooseFBConfig(fallback, drawable_type, &config);
+  }
+  XVisualInfo *vinfo = glXGetVisualFromFBConfig(display, config);
 //  ASSERT(vinfo);
   
   // Define the window attributes
@@ -396,12 +1681,12 @@ void* GlopCreateWindow(void* title, int x, int y, int width, int height) {
   
   FocusChangeMask | ButtonPressMask | ButtonReleaseMask | ButtonMotionMask |
                                                     PointerMotionMask | KeyPressMask | KeyReleaseMask | StructureNotifyMask |
-                                                    EnterWindowMask | LeaveWindowMask;  
+                                                    EnterWindowMask | LeaveWindowMask | PropertyChangeMask;  
   attribs.colormap = XCreateColormap( display, RootWindow(display, screen), vinfo->visual, AllocNone);
   
 
   nw->window = XCreateWindow(display, RootWindow(display, screen), x, y, width, height, 0, vinfo->depth, InputOutput, vinfo->visual, CWColormap | CWEventMask, &attribs); // I don't know if I need anything further here
-  
+  XFree(vinfo);
 
   
   {
@@ -439,14 +1724,15 @@ void* GlopCreateWindow(void* title, int x, int y, int width, int height) {
       Hints.Decorations = 0;
       Hints.Functions   = 0;
 
-      if (true)
+      if (options->decorated)
       {
           Hints.Decorations |= MWM_DECOR_BORDER | MWM_DECOR_TITLE | MWM_DECOR_MINIMIZE /*| MWM_DECOR_MENU*/;
-          Hints.Functions   |= MWM_FUNC_MOVE | MWM_FUNC_MINIMIZE;
       }
-      if (false)
+      Hints.Functions   |= MWM_FUNC_MOVE | MWM_FUNC_MINIMIZE;
+      if (options->resizable)
       {
-          Hints.Decorations |= MWM_DECOR_MAXIMIZE | MWM_DECOR_RESIZEH;
+          if (options->decorated)
+              Hints.Decorations |= MWM_DECOR_MAXIMIZE | MWM_DECOR_RESIZEH;
           Hints.Functions   |= MWM_FUNC_MAXIMIZE | MWM_FUNC_RESIZE;
       }
       if (true)
@@ -458,32 +1744,55 @@ void* GlopCreateWindow(void* title, int x, int y, int width, int height) {
       const unsigned char* HintsPtr = reinterpret_cast<const unsigned char*>(&Hints);
       XChangeProperty(display, nw->window, WMHintsAtom, WMHintsAtom, 32, PropModeReplace, HintsPtr, 5);
     }
-    
-    // This is a hack to force some windows managers to disable resizing
-    if(true)
-    {
-        XSizeHints XSizeHints;
-        XSizeHints.flags      = PMinSize | PMaxSize;
-        XSizeHints.min_width  = XSizeHints.max_width  = width;
-        XSizeHints.min_height = XSizeHints.max_height = height;
-        XSetWMNormalHints(display, nw->window, &XSizeHints); 
-    }
+
+    SetSizeHints(width, height);
+  }
+
+  if(options->always_on_top) {
+    // Before the window is mapped we are allowed to set its state directly.
+    Atom wm_state = XInternAtom(display, "_NET_WM_STATE", false);
+    Atom wm_above = XInternAtom(display, "_NET_WM_STATE_ABOVE", false);
+    XChangeProperty(display, nw->window, wm_state, XA_ATOM, 32, PropModeReplace, (const unsigned char*)&wm_above, 1);
   }
 
-  GlopSetTitle(nw, string((char*)(title)));
+  if(options->icons_length > 0) {
+    Atom wm_icon = XInternAtom(display, "_NET_WM_ICON", false);
+    XChangeProperty(display, nw->window, wm_icon, XA_CARDINAL, 32, PropModeReplace, (const unsigned char*)options->icons, options->icons_length);
+  }
+
+  GlopSetTitle(nw, string(options->title));
+  window_options.title = NULL;
+  window_options.icons = NULL;
   
   XSetWMProtocols(display, nw->window, &close_atom, 1);
+  SelectXInput2Events(nw->window, *options);
+
+  // Let drag sources know that we accept drops
+  Atom xdnd_version = kXdndVersion;
+  XChangeProperty(display, nw->window, xdnd_aware_atom, XA_ATOM, 32, PropModeReplace, (const unsigned char*)&xdnd_version, 1);
   // I think in here is where we're meant to set window styles and stuff
   
-  nw->inputcontext = XCreateIC(xim, XNInputStyle, XIMPreeditNothing | XIMStatusNothing, XNClientWindow, nw->window, XNFocusWindow, nw->window, NULL);
-//  ASSERT(nw->inputcontext);
+  nw->inputcontext = CreateInputContext(nw->window);
   
-  XMapWindow(display, nw->window);
+  nw->drawable = nw->window;
+  if(options->offscreen) {
+    int pbuffer_attribs[] = {
+      GLX_PBUFFER_WIDTH, width,
+      GLX_PBUFFER_HEIGHT, height,
+      GLX_PRESERVED_CONTENTS, True,
+      None
+    };
+    nw->pbuffer = glXCreatePbuffer(display, config, pbuffer_attribs);
+    nw->drawable = nw->pbuffer;
+  } else {
+    XMapWindow(display, nw->window);
+  }
   
-  nw->context = glXCreateContext(display, vinfo, NULL, True);
+  nw->context = CreateContext(config, options->context);
 //  ASSERT(nw->context);
   
   glopSetCurrentContext(nw);
+  QueryContextAttributes(config);
   
   return nw;
 }
@@ -494,6 +1803,11 @@ void glopDestroyWindow(OsWindowData* data) {
   delete data;
 }
 
+void GlopGetWindowState(int* focused, int* minimized) {
+  *focused = window_focused;
+  *minimized = window_minimized;
+}
+
 void glopGetWindowFocusState(OsWindowData* data, bool* is_in_focus, bool* focus_changed) {
   *is_in_focus = true;
   *focus_changed = false;
@@ -539,7 +1853,7 @@ void GlopGetWindowDims(int* x, int* y, int* dx, int* dy) {
 static GlopKeyEvent* glop_event_buffer = 0;
 
 void GlopGetInputEvents(void** _events_ret, void* _num_events, void* _horizon) {
-  *((long long*)_horizon) = gt();
+  *((long long*)_horizon) = gtm();
   vector<GlopKeyEvent> ret; // weeeeeeeeeeee
   ret.swap(events);
 
@@ -555,9 +1869,136 @@ void GlopGetInputEvents(void** _events_ret, void* _num_events, void* _horizon) {
   }
 }
 
-void GlopGetMousePosition(int* x, int* y) { // TBI
-  *x = 0;
-  *y = 0;
+void GlopGetMousePosition(int* x, int* y) {
+  if(!windowdata) {
+    *x = 0;
+    *y = 0;
+    return;
+  }
+  QueryCursor(windowdata->window, x, y);
+}
+
+
+// Cursor functions
+// ================
+
+static Cursor GetBlankCursor() {
+  if(blank_cursor == None) {
+    static char data[1] = { 0 };
+    XColor black;
+    black.red = black.green = black.blue = 0;
+    Pixmap pixmap = XCreateBitmapFromData(display, windowdata->window, data, 1, 1);
+    blank_cursor = XCreatePixmapCursor(display, pixmap, pixmap, &black, &black, 0, 0);
+    XFreePixmap(display, pixmap);
+  }
+  return blank_cursor;
+}
+
+// Grabs or ungrabs the pointer and sets the cursor according to the current
+// cursor state.
+static void UpdateCursorGrab() {
+  if(!windowdata) return;
+  Window window = windowdata->window;
+  if(cursor_hidden || cursor_confined) {
+    // This can fail if the window isn't viewable yet, in which case we'll try
+    // again the next time we get focus.
+    pointer_grabbed = XGrabPointer(display, window, True, ButtonPressMask | ButtonReleaseMask | PointerMotionMask, GrabModeAsync, GrabModeAsync, window, None, CurrentTime) == GrabSuccess;
+  } else {
+    XUngrabPointer(display, CurrentTime);
+    pointer_grabbed = false;
+  }
+  if(cursor_hidden) {
+    XDefineCursor(display, window, GetBlankCursor());
+  } else if(current_cursor != None) {
+    XDefineCursor(display, window, current_cursor);
+  } else {
+    XUndefineCursor(display, window);
+  }
+  XFlush(display);
+}
+
+void GlopHideCursor(int hide) {
+  if(!windowdata) return;
+  Window window = windowdata->window;
+  if(hide && !cursor_hidden) {
+    QueryCursor(window, &locked_x, &locked_y);
+    cursor_hidden = true;
+    XWindowAttributes attrs;
+    XGetWindowAttributes(display, window, &attrs);
+    XWarpPointer(display, None, window, 0, 0, 0, 0, attrs.width / 2, attrs.height / 2);
+    have_last_mouse = false;
+  }
+  if(!hide && cursor_hidden) {
+    cursor_hidden = false;
+    // Put the cursor back where it was when it was hidden
+    XWarpPointer(display, None, RootWindow(display, screen), 0, 0, 0, 0, locked_x, locked_y);
+    have_last_mouse = false;
+  }
+  UpdateCursorGrab();
+}
+
+void GlopConfineCursor(int confine) {
+  cursor_confined = confine;
+  UpdateCursorGrab();
+}
+
+void GlopWarpCursor(int x, int y) {
+  if(cursor_hidden) {
+    locked_x = x;
+    locked_y = y;
+    return;
+  }
+  XWarpPointer(display, None, RootWindow(display, screen), 0, 0, 0, 0, x, y);
+  XFlush(display);
+}
+
+static void SetCursor(Cursor cursor) {
+  if(current_cursor != None) {
+    XFreeCursor(display, current_cursor);
+  }
+  current_cursor = cursor;
+  UpdateCursorGrab();
+}
+
+// argb is width * height pixels of premultiplied ARGB, one pixel per int, in
+// rows from top to bottom.
+void GlopSetCursorImage(unsigned int* argb, int width, int height, int hot_x, int hot_y) {
+  if(!windowdata) return;
+  Window window = windowdata->window;
+  XImage* image = XCreateImage(display, DefaultVisual(display, screen), 32, ZPixmap, 0, (char*)argb, width, height, 32, width * 4);
+  Pixmap pixmap = XCreatePixmap(display, window, width, height, 32);
+  GC gc = XCreateGC(display, pixmap, 0, NULL);
+  XPutImage(display, pixmap, gc, image, 0, 0, 0, 0, width, height);
+  XRenderPictFormat* format = XRenderFindStandardFormat(display, PictStandardARGB32);
+  Picture picture = XRenderCreatePicture(display, pixmap, format, 0, NULL);
+  Cursor cursor = XRenderCreateCursor(display, picture, hot_x, hot_y);
+  XRenderFreePicture(display, picture);
+  XFreeGC(display, gc);
+  XFreePixmap(display, pixmap);
+
+  // The pixels belong to the caller, so XDestroyImage shouldn't free them
+  image->data = NULL;
+  XDestroyImage(image);
+
+  SetCursor(cursor);
+}
+
+void GlopSetSystemCursor(int cursor) {
+  if(!windowdata) return;
+  unsigned int shape;
+  switch(cursor) {
+    case kCursorIBeam: shape = XC_xterm; break;
+    case kCursorCrosshair: shape = XC_crosshair; break;
+    case kCursorHand: shape = XC_hand2; break;
+    case kCursorResizeHorizontal: shape = XC_sb_h_double_arrow; break;
+    case kCursorResizeVertical: shape = XC_sb_v_double_arrow; break;
+    case kCursorWait: shape = XC_watch; break;
+    default:
+      // The default cursor is the arrow
+      SetCursor(None);
+      return;
+  }
+  SetCursor(XCreateFontCursor(display, shape));
 }
 
 
@@ -577,11 +2018,601 @@ long long glopGetTimeMicro() {
 
 
 void GlopSwapBuffers() {
-  glXSwapBuffers(display, windowdata->window);
+  glXSwapBuffers(display, windowdata->drawable);
 }
 
 void GlopEnableVSync(int enable) {
   // TODO: Implement
 }
 
+
+// Offscreen rendering
+// ===================
+
+// Framebuffer objects aren't part of GL 1.x, so these are looked up when they
+// are first needed.
+static PFNGLGENFRAMEBUFFERSPROC glop_glGenFramebuffers = NULL;
+static PFNGLDELETEFRAMEBUFFERSPROC glop_glDeleteFramebuffers = NULL;
+static PFNGLBINDFRAMEBUFFERPROC glop_glBindFramebuffer = NULL;
+static PFNGLCHECKFRAMEBUFFERSTATUSPROC glop_glCheckFramebufferStatus = NULL;
+static PFNGLGENRENDERBUFFERSPROC glop_glGenRenderbuffers = NULL;
+static PFNGLDELETERENDERBUFFERSPROC glop_glDeleteRenderbuffers = NULL;
+static PFNGLBINDRENDERBUFFERPROC glop_glBindRenderbuffer = NULL;
+static PFNGLRENDERBUFFERSTORAGEPROC glop_glRenderbufferStorage = NULL;
+static PFNGLFRAMEBUFFERRENDERBUFFERPROC glop_glFramebufferRenderbuffer = NULL;
+
+static bool LoadFramebufferFunctions() {
+  if(glop_glGenFramebuffers)
+    return true;
+  #define LOAD(name, type) glop_##name = (type)glXGetProcAddressARB((const GLubyte*)#name)
+  LOAD(glGenFramebuffers, PFNGLGENFRAMEBUFFERSPROC);
+  LOAD(glDeleteFramebuffers, PFNGLDELETEFRAMEBUFFERSPROC);
+  LOAD(glBindFramebuffer, PFNGLBINDFRAMEBUFFERPROC);
+  LOAD(glCheckFramebufferStatus, PFNGLCHECKFRAMEBUFFERSTATUSPROC);
+  LOAD(glGenRenderbuffers, PFNGLGENRENDERBUFFERSPROC);
+  LOAD(glDeleteRenderbuffers, PFNGLDELETERENDERBUFFERSPROC);
+  LOAD(glBindRenderbuffer, PFNGLBINDRENDERBUFFERPROC);
+  LOAD(glRenderbufferStorage, PFNGLRENDERBUFFERSTORAGEPROC);
+  LOAD(glFramebufferRenderbuffer, PFNGLFRAMEBUFFERRENDERBUFFERPROC);
+  #undef LOAD
+  if(!glop_glGenFramebuffers || !glop_glDeleteFramebuffers || !glop_glBindFramebuffer ||
+     !glop_glCheckFramebufferStatus || !glop_glGenRenderbuffers || !glop_glDeleteRenderbuffers ||
+     !glop_glBindRenderbuffer || !glop_glRenderbufferStorage || !glop_glFramebufferRenderbuffer) {
+    glop_glGenFramebuffers = NULL;
+    return false;
+  }
+  return true;
+}
+
+// The framebuffer that is bound between GlopBeginOffscreen() and
+// GlopEndOffscreen(), 0 when rendering to the window.
+static GLuint offscreen_fbo = 0;
+static GLuint offscreen_color = 0;
+static GLuint offscreen_depth = 0;
+static GLint offscreen_saved_viewport[4];
+
+void GlopEndOffscreen() {
+  if(!offscreen_fbo)
+    return;
+  glop_glBindFramebuffer(GL_FRAMEBUFFER, 0);
+  glop_glDeleteRenderbuffers(1, &offscreen_color);
+  glop_glDeleteRenderbuffers(1, &offscreen_depth);
+  glop_glDeleteFramebuffers(1, &offscreen_fbo);
+  offscreen_fbo = offscreen_color = offscreen_depth = 0;
+  glViewport(offscreen_saved_viewport[0], offscreen_saved_viewport[1], offscreen_saved_viewport[2], offscreen_saved_viewport[3]);
+}
+
+// Binds a new dx by dy framebuffer with color, depth and stencil buffers.
+// Returns 0 on success.
+int GlopBeginOffscreen(int dx, int dy) {
+  if(!windowdata || offscreen_fbo || dx <= 0 || dy <= 0)
+    return 1;
+  if(!LoadFramebufferFunctions())
+    return 2;
+  glGetIntegerv(GL_VIEWPORT, offscreen_saved_viewport);
+  glop_glGenFramebuffers(1, &offscreen_fbo);
+  glop_glBindFramebuffer(GL_FRAMEBUFFER, offscreen_fbo);
+  glop_glGenRenderbuffers(1, &offscreen_color);
+  glop_glBindRenderbuffer(GL_RENDERBUFFER, offscreen_color);
+  glop_glRenderbufferStorage(GL_RENDERBUFFER, GL_RGBA8, dx, dy);
+  glop_glFramebufferRenderbuffer(GL_FRAMEBUFFER, GL_COLOR_ATTACHMENT0, GL_RENDERBUFFER, offscreen_color);
+  glop_glGenRenderbuffers(1, &offscreen_depth);
+  glop_glBindRenderbuffer(GL_RENDERBUFFER, offscreen_depth);
+  glop_glRenderbufferStorage(GL_RENDERBUFFER, GL_DEPTH24_STENCIL8, dx, dy);
+  glop_glFramebufferRenderbuffer(GL_FRAMEBUFFER, GL_DEPTH_ATTACHMENT, GL_RENDERBUFFER, offscreen_depth);
+  glop_glFramebufferRenderbuffer(GL_FRAMEBUFFER, GL_STENCIL_ATTACHMENT, GL_RENDERBUFFER, offscreen_depth);
+  glop_glBindRenderbuffer(GL_RENDERBUFFER, 0);
+  if(glop_glCheckFramebufferStatus(GL_FRAMEBUFFER) != GL_FRAMEBUFFER_COMPLETE) {
+    GlopEndOffscreen();
+    return 3;
+  }
+  glViewport(0, 0, dx, dy);
+  return 0;
+}
+
+// Reads the dx by dy pixels at the bottom left of the current framebuffer,
+// bottom row first.  This is the offscreen framebuffer if there is one and
+// the window's back buffer otherwise.
+int GlopReadPixels(unsigned char* rgba, int dx, int dy) {
+  if(!windowdata)
+    return 1;
+  glFinish();
+  glReadBuffer(offscreen_fbo ? GL_COLOR_ATTACHMENT0 : GL_BACK);
+  glPixelStorei(GL_PACK_ALIGNMENT, 1);
+  glReadPixels(0, 0, dx, dy, GL_RGBA, GL_UNSIGNED_BYTE, rgba);
+  return glGetError() == GL_NO_ERROR ? 0 : 2;
+}
+
+
+// Clipboard functions
+// ===================
+
+void GlopSetClipboardText(const char* text, int length) {
+  clipboard_text.assign(text, length);
+  if(!windowdata) return;
+  XSetSelectionOwner(display, clipboard_atom, windowdata->window, CurrentTime);
+  XSetSelectionOwner(display, XA_PRIMARY, windowdata->window, CurrentTime);
+  XFlush(display);
+}
+
+// The longest that reading the clipboard waits for the owner of the
+// selection, in total, in microseconds.
+static const long long kClipboardTimeout = 500000;
+
+static Bool IsSelectionNotify(Display *display, XEvent *event, XPointer arg) {
+  return event->type == SelectionNotify && event->xselection.selection == *(Atom*)arg;
+}
+
+// Matches each new piece of an INCR transfer into our selection property.
+static Bool IsSelectionChunk(Display *display, XEvent *event, XPointer arg) {
+  return event->type == PropertyNotify &&
+         event->xproperty.window == windowdata->window &&
+         event->xproperty.atom == glop_selection_atom &&
+         event->xproperty.state == PropertyNewValue;
+}
+
+// Takes the first event that matches predicate off of the queue, waiting on
+// the connection until deadline, from gtm(), if there isn't one yet.  Returns
+// false if the deadline passes first.  Everything else, including drops, is
+// left on the queue for the next call to GlopThink().
+static bool WaitForEvent(XEvent* event, Bool (*predicate)(Display*, XEvent*, XPointer), XPointer arg, long long deadline) {
+  int fd = ConnectionNumber(display);
+  // XCheckIfEvent reads everything that has arrived on the connection, so
+  // select only wakes up for events that come after that
+  while(!XCheckIfEvent(display, event, predicate, arg)) {
+    long long left = deadline - gtm();
+    if(left <= 0)
+      return false;
+    fd_set fds;
+    FD_ZERO(&fds);
+    FD_SET(fd, &fds);
+    timeval timeout;
+    timeout.tv_sec = left / 1000000;
+    timeout.tv_usec = left % 1000000;
+    select(fd + 1, &fds, NULL, NULL, &timeout);
+  }
+  return true;
+}
+
+enum SelectionResult {
+  kSelectionRead,
+  kSelectionRefused,  // There is no owner, or it can't convert to the target
+  kSelectionFailed,   // The owner didn't finish before the deadline
+};
+
+// Asks the owner of selection to convert it to target and waits for the
+// result, until deadline at the latest.
+static SelectionResult ReadSelection(Atom selection, Atom target, long long deadline, string* text) {
+  Window window = windowdata->window;
+  Window owner = XGetSelectionOwner(display, selection);
+  if(owner == None)
+    return kSelectionRefused;
+  if(owner == window) {
+    *text = clipboard_text;
+    return kSelectionRead;
+  }
+
+  // Anything left over from a read that gave up would be mistaken for this
+  // one
+  XEvent event;
+  while(XCheckIfEvent(display, &event, &IsSelectionNotify, (XPointer)&selection)) {}
+  while(XCheckIfEvent(display, &event, &IsSelectionChunk, NULL)) {}
+
+  XConvertSelection(display, selection, target, glop_selection_atom, window, CurrentTime);
+  XFlush(display);
+  if(!WaitForEvent(&event, &IsSelectionNotify, (XPointer)&selection, deadline))
+    return kSelectionFailed;
+  if(event.xselection.property == None)
+    return kSelectionRefused;
+
+  // Reading the property deletes it, which also tells the owner of an INCR
+  // transfer to send the first piece
+  Atom type;
+  int format;
+  unsigned long count, remaining;
+  unsigned char* data = NULL;
+  XGetWindowProperty(display, window, glop_selection_atom, 0, LONG_MAX / 4, True, AnyPropertyType, &type, &format, &count, &remaining, &data);
+  if(type != incr_atom) {
+    text->clear();
+    if(data) {
+      text->assign((const char*)data, count);
+      XFree(data);
+    }
+    return kSelectionRead;
+  }
+  if(data) XFree(data);
+
+  // Every piece is another new value of the property, which is why the
+  // window selects PropertyChangeMask, and an empty one ends the transfer
+  text->clear();
+  while(true) {
+    if(!WaitForEvent(&event, &IsSelectionChunk, NULL, deadline))
+      return kSelectionFailed;
+    data = NULL;
+    XGetWindowProperty(display, window, glop_selection_atom, 0, LONG_MAX / 4, True, AnyPropertyType, &type, &format, &count, &remaining, &data);
+    if(type == None)
+      return kSelectionFailed;
+    if(data) {
+      text->append((const char*)data, count);
+      XFree(data);
+    }
+    if(count == 0)
+      return kSelectionRead;
+  }
+}
+
+static string clipboard_result;
+
+// Drops are handed to Go in these until the next call to GlopGetDropEvents()
+static vector<Drop> drops_result;
+static vector<GlopDropEvent> drop_events_result;
+
+static vector<TextEvent> text_events_result;
+static vector<GlopTextEvent> glop_text_events_result;
+void GlopGetTextEvents(void** glop_text_events, int* num_text_events) {
+  text_events_result.swap(text_events);
+  text_events.clear();
+  glop_text_events_result.resize(text_events_result.size());
+  for(int i = 0; i < text_events_result.size(); i++) {
+    GlopTextEvent &ev = glop_text_events_result[i];
+    ev.text = text_events_result[i].text.data();
+    ev.text_length = text_events_result[i].text.size();
+    ev.preedit = text_events_result[i].preedit;
+    ev.cursor = text_events_result[i].cursor;
+    ev.timestamp = text_events_result[i].timestamp;
+  }
+  *glop_text_events = glop_text_events_result.empty() ? NULL : &glop_text_events_result[0];
+  *num_text_events = glop_text_events_result.size();
+}
+
+void GlopEnableTextInput(int enable) {
+  text_input_enabled = enable;
+  if(!windowdata || !windowdata->inputcontext) return;
+  XIC ic = windowdata->inputcontext;
+  if(enable) {
+    if(window_focused)
+      XSetICFocus(ic);
+    return;
+  }
+  XUnsetICFocus(ic);
+  // Throw away any composition in progress
+  char* unused = Xutf8ResetIC(ic);
+  if(unused)
+    XFree(unused);
+  if(!preedit_text.empty()) {
+    preedit_text.clear();
+    preedit_caret = 0;
+    PushPreedit();
+  }
+}
+
+void GlopSetTextInputPosition(int x, int y) {
+  if(!windowdata || !windowdata->inputcontext) return;
+  if(!(xim_style & XIMPreeditPosition)) return;
+  if(x == text_spot_x && y == text_spot_y) return;
+  text_spot_x = x;
+  text_spot_y = y;
+  XPoint spot;
+  spot.x = x;
+  spot.y = y;
+  XVaNestedList preedit = XVaCreateNestedList(0, XNSpotLocation, &spot, NULL);
+  XSetICValues(windowdata->inputcontext, XNPreeditAttributes, preedit, NULL);
+  XFree(preedit);
+}
+
+void GlopGetDropEvents(void** drop_events, int* num_drop_events) {
+  drops_result.swap(drops);
+  drops.clear();
+  drop_events_result.resize(drops_result.size());
+  for(int i = 0; i < drops_result.size(); i++) {
+    GlopDropEvent &ev = drop_events_result[i];
+    ev.paths = drops_result[i].paths.data();
+    ev.paths_length = drops_result[i].paths.size();
+    ev.x = drops_result[i].x;
+    ev.y = drops_result[i].y;
+    ev.timestamp = drops_result[i].timestamp;
+  }
+  *drop_events = drop_events_result.empty() ? NULL : &drop_events_result[0];
+  *num_drop_events = drop_events_result.size();
+}
+
+// Reads the CLIPBOARD selection, or the PRIMARY selection if primary is set,
+// as UTF-8 if the owner can convert it to that and as a STRING otherwise.
+// This waits at most kClipboardTimeout for the owner.
+void GlopGetClipboardText(int primary, char** text, int* length) {
+  clipboard_result.clear();
+  if(windowdata) {
+    Atom selection = primary ? XA_PRIMARY : clipboard_atom;
+    long long deadline = gtm() + kClipboardTimeout;
+    SelectionResult result = ReadSelection(selection, utf8_atom, deadline, &clipboard_result);
+    // An owner that didn't answer in time won't answer for STRING either
+    if(result == kSelectionRefused)
+      result = ReadSelection(selection, XA_STRING, deadline, &clipboard_result);
+    if(result != kSelectionRead)
+      clipboard_result.clear();
+  }
+  *text = (char*)clipboard_result.data();
+  *length = clipboard_result.size();
+}
+
+
+
+// Monitor functions
+// =================
+
+static vector<GlopMonitor> monitors;
+static vector<GlopDisplayMode> monitor_modes;
+
+// The RandR output for each entry in monitors, or None if RandR isn't
+// available
+static vector<RROutput> monitor_outputs;
+
+static const XRRModeInfo* FindMode(const XRRScreenResources* res, RRMode id) {
+  for(int i = 0; i < res->nmode; i++) {
+    if(res->modes[i].id == id)
+      return &res->modes[i];
+  }
+  return NULL;
+}
+
+static float ModeRefreshRate(const XRRModeInfo* info) {
+  if(info->hTotal == 0 || info->vTotal == 0)
+    return 0;
+  double vtotal = info->vTotal;
+  if(info->modeFlags & RR_DoubleScan)
+    vtotal *= 2;
+  if(info->modeFlags & RR_Interlace)
+    vtotal /= 2;
+  return info->dotClock / (info->hTotal * vtotal);
+}
+
+static void EnumerateMonitors() {
+  monitors.clear();
+  monitor_modes.clear();
+  monitor_outputs.clear();
+
+  Window root = RootWindow(display, screen);
+  int event_base, error_base;
+  XRRScreenResources* res = NULL;
+  if(XRRQueryExtension(display, &event_base, &error_base))
+    res = XRRGetScreenResourcesCurrent(display, root);
+  if(!res) {
+    // Without RandR the best we can do is treat the whole screen as a monitor
+    GlopMonitor m;
+    memset(&m, 0, sizeof(m));
+    snprintf(m.name, sizeof(m.name), "default");
+    m.dx = DisplayWidth(display, screen);
+    m.dy = DisplayHeight(display, screen);
+    m.primary = 1;
+    monitors.push_back(m);
+    monitor_outputs.push_back(None);
+    return;
+  }
+
+  RROutput primary = XRRGetOutputPrimary(display, root);
+  for(int i = 0; i < res->noutput; i++) {
+    XRROutputInfo* output = XRRGetOutputInfo(display, res, res->outputs[i]);
+    if(!output)
+      continue;
+    if(output->connection != RR_Connected || output->crtc == None) {
+      XRRFreeOutputInfo(output);
+      continue;
+    }
+    XRRCrtcInfo* crtc = XRRGetCrtcInfo(display, res, output->crtc);
+
+    GlopMonitor m;
+    memset(&m, 0, sizeof(m));
+    snprintf(m.name, sizeof(m.name), "%s", output->name);
+    m.x = crtc->x;
+    m.y = crtc->y;
+    m.dx = crtc->width;
+    m.dy = crtc->height;
+    const XRRModeInfo* current = FindMode(res, crtc->mode);
+    if(current)
+      m.refresh_rate = ModeRefreshRate(current);
+    m.primary = res->outputs[i] == primary;
+    m.first_mode = monitor_modes.size();
+    for(int j = 0; j < output->nmode; j++) {
+      const XRRModeInfo* info = FindMode(res, output->modes[j]);
+      if(!info)
+        continue;
+      GlopDisplayMode mode;
+      mode.dx = info->width;
+      mode.dy = info->height;
+      mode.refresh_rate = ModeRefreshRate(info);
+      monitor_modes.push_back(mode);
+    }
+    m.num_modes = monitor_modes.size() - m.first_mode;
+    monitors.push_back(m);
+    monitor_outputs.push_back(res->outputs[i]);
+
+    XRRFreeCrtcInfo(crtc);
+    XRRFreeOutputInfo(output);
+  }
+  XRRFreeScreenResources(res);
+}
+
+void GlopGetMonitors(void** _monitors, int* num_monitors, void** _modes, int* num_modes) {
+  EnumerateMonitors();
+  *_monitors = monitors.empty() ? NULL : &monitors[0];
+  *num_monitors = monitors.size();
+  *_modes = monitor_modes.empty() ? NULL : &monitor_modes[0];
+  *num_modes = monitor_modes.size();
+}
+
+// If we changed the mode on a crtc this is what we need to put it back, and
+// the mode we changed it to.
+static bool display_mode_changed = false;
+static RRCrtc changed_crtc;
+static RRMode original_mode;
+static RRMode changed_mode;
+
+// Sets the mode of a crtc, leaving everything else about it alone.  Returns
+// false if that fails.
+static bool SetCrtcMode(RRCrtc crtc_id, RRMode mode) {
+  XRRScreenResources* res = XRRGetScreenResourcesCurrent(display, RootWindow(display, screen));
+  if(!res)
+    return false;
+  bool ok = false;
+  XRRCrtcInfo* crtc = XRRGetCrtcInfo(display, res, crtc_id);
+  if(crtc) {
+    Status status = XRRSetCrtcConfig(display, res, crtc_id, CurrentTime, crtc->x, crtc->y, mode, crtc->rotation, crtc->outputs, crtc->noutput);
+    ok = status == RRSetConfigSuccess;
+    XRRFreeCrtcInfo(crtc);
+  }
+  XRRFreeScreenResources(res);
+  return ok;
+}
+
+static void RestoreDisplayMode() {
+  if(!display_mode_changed)
+    return;
+  display_mode_changed = false;
+  SetCrtcMode(changed_crtc, original_mode);
+}
+
+// Switches the crtc driving output to the mode that is dx by dy and has the
+// refresh rate closest to refresh_rate, or the highest refresh rate if
+// refresh_rate is 0.  Returns false if no such mode exists or the switch
+// fails.
+static bool ChangeDisplayMode(RROutput output_id, int dx, int dy, float refresh_rate) {
+  XRRScreenResources* res = XRRGetScreenResourcesCurrent(display, RootWindow(display, screen));
+  if(!res)
+    return false;
+  XRROutputInfo* output = XRRGetOutputInfo(display, res, output_id);
+  if(!output || output->crtc == None) {
+    if(output) XRRFreeOutputInfo(output);
+    XRRFreeScreenResources(res);
+    return false;
+  }
+  XRRCrtcInfo* crtc = XRRGetCrtcInfo(display, res, output->crtc);
+
+  RRMode best = None;
+  float best_score = 0;
+  for(int i = 0; i < output->nmode; i++) {
+    const XRRModeInfo* info = FindMode(res, output->modes[i]);
+    if(!info || (int)info->width != dx || (int)info->height != dy)
+      continue;
+    float rate = ModeRefreshRate(info);
+    float score = refresh_rate > 0 ? -fabs(rate - refresh_rate) : rate;
+    if(best == None || score > best_score) {
+      best = info->id;
+      best_score = score;
+    }
+  }
+
+  bool ok = false;
+  if(best != None) {
+    RRMode previous = crtc->mode;
+    Status status = XRRSetCrtcConfig(display, res, output->crtc, CurrentTime, crtc->x, crtc->y, best, crtc->rotation, crtc->outputs, crtc->noutput);
+    ok = status == RRSetConfigSuccess;
+    if(ok && !display_mode_changed) {
+      display_mode_changed = true;
+      changed_crtc = output->crtc;
+      original_mode = previous;
+    }
+    if(ok)
+      changed_mode = best;
+  }
+
+  XRRFreeCrtcInfo(crtc);
+  XRRFreeOutputInfo(output);
+  XRRFreeScreenResources(res);
+  return ok;
+}
+
+static void SendWMStateMessage(Atom message_type, long l0, long l1, long l2, long l3, long l4) {
+  XEvent event;
+  memset(&event, 0, sizeof(event));
+  event.type = ClientMessage;
+  event.xclient.window = windowdata->window;
+  event.xclient.message_type = message_type;
+  event.xclient.format = 32;
+  event.xclient.data.l[0] = l0;
+  event.xclient.data.l[1] = l1;
+  event.xclient.data.l[2] = l2;
+  event.xclient.data.l[3] = l3;
+  event.xclient.data.l[4] = l4;
+  XSendEvent(display, RootWindow(display, screen), False, SubstructureRedirectMask | SubstructureNotifyMask, &event);
+}
+
+static int current_window_mode = kWindowed;
+static int windowed_x, windowed_y, windowed_width, windowed_height;
+
+// Returns 0 on success, on failure the window and the display mode are left
+// as they were, which is what HeadlessOs does too.  Things to check by hand
+// after changing this, since none of it can be tested without a display:
+// * Exclusive to borderless on the same monitor covers the monitor at its
+//   native size, not at the size of the exclusive mode
+// * A mode that the monitor doesn't have, while in exclusive fullscreen,
+//   fails and leaves the exclusive mode and the window alone
+int GlopSetWindowMode(int mode, int monitor, int dx, int dy, float refresh_rate) {
+  if(!windowdata)
+    return 1;
+  Window window = windowdata->window;
+  Atom wm_state = XInternAtom(display, "_NET_WM_STATE", False);
+  Atom wm_fullscreen = XInternAtom(display, "_NET_WM_STATE_FULLSCREEN", False);
+
+  if(mode == kWindowed) {
+    if(current_window_mode != kWindowed) {
+      SendWMStateMessage(wm_state, 0 /* _NET_WM_STATE_REMOVE */, wm_fullscreen, 0, 1, 0);
+      RestoreDisplayMode();
+      SetSizeHints(windowed_width, windowed_height);
+      XMoveResizeWindow(display, window, windowed_x, windowed_y, windowed_width, windowed_height);
+    }
+    current_window_mode = kWindowed;
+    XFlush(display);
+    return 0;
+  }
+
+  // Going from exclusive to borderless, or to a different monitor, puts back
+  // whatever mode we changed before.  That has to happen before the monitors
+  // are enumerated, otherwise the window is sized to the mode that is about
+  // to go away.  Nothing is done to the window until the new mode is set, so
+  // if anything fails putting back the mode we had is all it takes to leave
+  // things the way they were.
+  bool had_mode = display_mode_changed;
+  RRCrtc had_crtc = changed_crtc;
+  RRMode had_original = original_mode;
+  RRMode had_changed = changed_mode;
+  RestoreDisplayMode();
+  EnumerateMonitors();
+  bool ok = monitor >= 0 && monitor < (int)monitors.size();
+  if(ok && mode == kExclusiveFullscreen && dx > 0 && dy > 0) {
+    ok = monitor_outputs[monitor] != None && ChangeDisplayMode(monitor_outputs[monitor], dx, dy, refresh_rate);
+    if(ok)
+      EnumerateMonitors();
+  }
+  if(!ok) {
+    if(had_mode && SetCrtcMode(had_crtc, had_changed)) {
+      display_mode_changed = true;
+      changed_crtc = had_crtc;
+      original_mode = had_original;
+      changed_mode = had_changed;
+      EnumerateMonitors();
+    }
+    XFlush(display);
+    return 1;
+  }
+
+  if(current_window_mode == kWindowed) {
+    glopGetWindowPosition(windowdata, &windowed_x, &windowed_y);
+    glopGetWindowSize(windowdata, &windowed_width, &windowed_height);
+  }
+
+  const GlopMonitor &m = monitors[monitor];
+  SetSizeHints(0, 0);
+  XMoveResizeWindow(display, window, m.x, m.y, m.dx, m.dy);
+
+  // The indices here are supposed to be Xinerama indices, which match the
+  // order RandR reports monitors in on every system we've seen.
+  Atom wm_fullscreen_monitors = XInternAtom(display, "_NET_WM_FULLSCREEN_MONITORS", False);
+  SendWMStateMessage(wm_fullscreen_monitors, monitor, monitor, monitor, monitor, 1);
+  SendWMStateMessage(wm_state, 1 /* _NET_WM_STATE_ADD */, wm_fullscreen, 0, 1, 0);
+  XFlush(display);
+
+  current_window_mode = mode;
+  return 0;
+}
+
 } // extern "C"
\ No newline at end of file
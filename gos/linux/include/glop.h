@@ -71,14 +71,73 @@
 #define kKeyEnd  193
 #define kKeyPageUp  194
 #define kKeyPageDown  195
+#define kKeyMenu  196
+
+// F13 through F24 are kKeyF13 + 0 through 11
+#define kKeyF13  200
+
+#define kKeyIntlBackslash  220
+#define kKeyIntlRo  221
+#define kKeyIntlYen  222
+#define kKeyConvert  223
+#define kKeyNonConvert  224
+#define kKeyKanaMode  225
+#define kKeyHangul  226
+#define kKeyHanja  227
+#define kKeyPadComma  228
+
+#define kKeyMediaPlayPause  230
+#define kKeyMediaStop  231
+#define kKeyMediaPrevious  232
+#define kKeyMediaNext  233
+#define kKeyVolumeMute  234
+#define kKeyVolumeDown  235
+#define kKeyVolumeUp  236
 
 #define kMouseXAxis  300
 #define kMouseYAxis  301
-#define kMouseWheelUp  302
-#define kMouseWheelDown  303
+#define kMouseWheelVertical  302
+#define kMouseWheelHorizontal  303
 #define kMouseLButton  304
 #define kMouseRButton  305
 #define kMouseMButton  306
+#define kMouseBackButton  307
+#define kMouseForwardButton  308
+
+// These must match the order of the system.SystemCursor constants
+#define kCursorArrow             0
+#define kCursorIBeam             1
+#define kCursorCrosshair         2
+#define kCursorHand              3
+#define kCursorResizeHorizontal  4
+#define kCursorResizeVertical    5
+#define kCursorWait              6
+
+// These must match the order of the system.WindowMode constants
+#define kWindowed             0
+#define kBorderlessFullscreen 1
+#define kExclusiveFullscreen  2
+
+typedef struct {
+  char name[64];
+  int x;
+  int y;
+  int dx;
+  int dy;
+  float refresh_rate;
+  int primary;
+
+  // This monitor's modes are modes[first_mode] through
+  // modes[first_mode + num_modes - 1] in the array returned with it.
+  int first_mode;
+  int num_modes;
+} GlopMonitor;
+
+typedef struct {
+  int dx;
+  int dy;
+  float refresh_rate;
+} GlopDisplayMode;
 
 typedef struct {
   short index;
@@ -89,6 +148,9 @@ typedef struct {
   int cursor_y;
   int num_lock;
   int caps_lock;
+
+  // USB HID usage id of the physical key, 0 if it isn't a key or is unknown
+  int scancode;
 } GlopKeyEvent;
 void GlopClearKeyEvent(GlopKeyEvent* event) {
   event->index = 0;
@@ -99,23 +161,108 @@ void GlopClearKeyEvent(GlopKeyEvent* event) {
   event->cursor_y = 0;
   event->num_lock = 0;
   event->caps_lock = 0;
+  event->scancode = 0;
 }
 
+typedef struct {
+  // Paths of the files that were dropped, separated by '\0'
+  const char* paths;
+  int paths_length;
+
+  // Root coordinates of the drop
+  int x;
+  int y;
+  long long timestamp;
+} GlopDropEvent;
+
+typedef struct {
+  // UTF-8, not NUL terminated
+  const char* text;
+  int text_length;
+
+  // If set text is the composition in progress, and cursor is the byte
+  // offset of the input method's caret in it.
+  int preedit;
+  int cursor;
+  long long timestamp;
+} GlopTextEvent;
+
+typedef struct {
+  int major;
+  int minor;
+  int core_profile;
+  int depth_bits;
+  int stencil_bits;
+  int samples;
+  int srgb;
+} GlopContextAttributes;
+
+typedef struct {
+  const char* title;
+  int x;
+  int y;
+  int width;
+  int height;
+  int resizable;
+  int decorated;
+  int always_on_top;
+
+  // 0 means no limit
+  int min_width;
+  int min_height;
+  int max_width;
+  int max_height;
+
+  // Icons in the format used by _NET_WM_ICON: width, height, and then
+  // width * height ARGB pixels, repeated for each icon.
+  unsigned long* icons;
+  int icons_length;
+
+  // If set the window is never shown and the context renders to a pbuffer
+  // of the window's size instead.
+  int offscreen;
+
+  // Ask for raw, unaccelerated mouse motion and for smooth scrolling.  Both
+  // are ignored if the server doesn't have XInput 2.1.
+  int raw_mouse_motion;
+  int smooth_scroll;
+
+  GlopContextAttributes context;
+} GlopWindowOptions;
+
 void GlopInit();
-void* GlopCreateWindow(
-    void* title,
-    int x,
-    int y,
-    int width,
-    int height);
+void* GlopCreateWindow(GlopWindowOptions* options);
+void GlopSetWindowTitle(const char* title);
+void GlopGetContextAttributes(GlopContextAttributes* attribs);
 void GlopThink();
 void GlopSwapBuffers();
 
 void GlopGetMousePosition(int* x, int* y);
+void GlopHideCursor(int hide);
+void GlopConfineCursor(int confine);
+void GlopWarpCursor(int x, int y);
+void GlopSetCursorImage(unsigned int* argb, int width, int height, int hot_x, int hot_y);
+void GlopSetSystemCursor(int cursor);
 void GlopGetWindowDims(int* x, int* y, int* dx, int* dy);
+void GlopGetWindowState(int* focused, int* minimized);
+void GlopGetMonitors(void** monitors, int* num_monitors, void** modes, int* num_modes);
+int GlopSetWindowMode(int mode, int monitor, int dx, int dy, float refresh_rate);
 void GlopGetInputEvents(void** _events_ret, void* _num_events, void* _horizon);
 void GlopEnableVSync(int enable);
 
+void GlopGetClipboardText(int primary, char** text, int* length);
+void GlopSetClipboardText(const char* text, int length);
+
+void GlopGetDropEvents(void** drop_events, int* num_drop_events);
+
+void GlopGetTextEvents(void** text_events, int* num_text_events);
+void GlopEnableTextInput(int enable);
+void GlopSetTextInputPosition(int x, int y);
+
+int GlopBeginOffscreen(int dx, int dy);
+void GlopEndOffscreen();
+int GlopReadPixels(unsigned char* rgba, int dx, int dy);
+
 
 /*
 
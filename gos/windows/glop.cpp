@@ -318,7 +318,7 @@ class InputPollingThread: public Thread {
     }
     while (!IsStopRequested()) {
       window_->input_mutex.Acquire();
-      long long timestamp = GlopGetTime();
+      long long timestamp = GlopGetTimeMicro();
 
       // Read metastate
  	    POINT cursor_pos;
@@ -697,6 +697,10 @@ void GlopSetTitle(OsWindowData* window, char* title) {
   SetWindowText(window->window_handle, title);
 }
 
+void GlopSetWindowTitle(void* window, char* title) {
+  GlopSetTitle((OsWindowData*)window, title);
+}
+
 // Registers a new joystick with a window.
 BOOL CALLBACK GlopJoystickCallback(const DIDEVICEINSTANCE *device_instance, void *void_window) {
   OsWindowData *window = (OsWindowData*)void_window;
@@ -1026,7 +1030,7 @@ void GlopSetWindowSize(OsWindowData *window, int width, int height) {
 static GlopKeyEvent* glop_event_buffer = 0;
 
 void GlopGetInputEvents(void* _window, void** _events_ret, void* _num_events, void* _horizon) {
-  *((long long*)_horizon) = GlopGetTime();
+  *((long long*)_horizon) = GlopGetTimeMicro();
   OsWindowData* window = (OsWindowData*)_window;
   if (glop_event_buffer != 0) {
     free(glop_event_buffer);
@@ -94,6 +94,7 @@ void* GlopCreateWindow(
     int full_screen,
     int stencil_bits,
     int is_resizable);
+void GlopSetWindowTitle(void* window, char* title);
 
 void GlopSwapBuffers(void*);
 
@@ -0,0 +1,16 @@
+package gui_test
+
+import (
+  "github.com/MobRulesGames/glop/render"
+  "github.com/orfjackal/gospec/src/gospec"
+  "testing"
+)
+
+func TestAllSpecs(t *testing.T) {
+  render.Init()
+  render.SetRenderer(soft)
+  r := gospec.NewRunner()
+  r.AddSpec(WidgetGoldenSpec)
+  r.AddSpec(TextGoldenSpec)
+  gospec.MainGoTest(r, t)
+}
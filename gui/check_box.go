@@ -2,7 +2,7 @@ package gui
 
 import (
   "github.com/MobRulesGames/glop/gin"
-  "github.com/MobRulesGames/opengl/gl"
+  "github.com/MobRulesGames/glop/render"
   "reflect"
 )
 
@@ -46,30 +46,22 @@ func (cb *checkBox) Click() {
 }
 func (cb *checkBox) Draw(region Region) {
   cb.Render_region = region
+  r := render.Current()
   if cb.disabled {
-    gl.Color3d(0.6, 0.6, 0.6)
+    r.FillRect(region.Rect(), render.Color{R: 0.6, G: 0.6, B: 0.6, A: 1})
   } else {
-    gl.Color3d(1, 1, 1)
+    r.FillRect(region.Rect(), render.Color{R: 1, G: 1, B: 1, A: 1})
   }
-  gl.Begin(gl.QUADS)
-    gl.Vertex2i(region.X, region.Y)
-    gl.Vertex2i(region.X, region.Y + region.Dy)
-    gl.Vertex2i(region.X + region.Dx, region.Y + region.Dy)
-    gl.Vertex2i(region.X + region.Dx, region.Y)
-    if cb.selected == checkBoxUnknown || cb.selected == checkBoxUnselected {
-      if cb.selected == checkBoxUnknown {
-        gl.Color3d(0.4, 0.4, 0.4)
-      } else {
-        gl.Color3d(0, 0, 0)
-      }
-      if region.Dx >= 4 && region.Dy >= 4 {
-        gl.Vertex2i(region.X + 2, region.Y + 2)
-        gl.Vertex2i(region.X + 2, region.Y + region.Dy - 2)
-        gl.Vertex2i(region.X + region.Dx - 2, region.Y + region.Dy - 2)
-        gl.Vertex2i(region.X + region.Dx - 2, region.Y + 2)
-      }
+  if cb.selected == checkBoxUnknown || cb.selected == checkBoxUnselected {
+    c := render.Color{R: 0, G: 0, B: 0, A: 1}
+    if cb.selected == checkBoxUnknown {
+      c = render.Color{R: 0.4, G: 0.4, B: 0.4, A: 1}
     }
-  gl.End()
+    if region.Dx >= 4 && region.Dy >= 4 {
+      inner := Region{Point{region.X + 2, region.Y + 2}, Dims{region.Dx - 4, region.Dy - 4}}
+      r.FillRect(inner.Rect(), c)
+    }
+  }
 }
 
 type checkRow struct {
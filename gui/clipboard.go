@@ -0,0 +1,34 @@
+package gui
+
+// A Clipboard holds text that widgets can copy to and paste from.
+// system.System implements this interface, so normally the system's
+// clipboard should be passed to SetClipboard() after creating the window.
+type Clipboard interface {
+  GetClipboardText() string
+  SetClipboardText(string)
+}
+
+// Until SetClipboard() is called widgets use this, which means that text can
+// still be copied and pasted, but only within the gui.
+type localClipboard struct {
+  text string
+}
+
+func (c *localClipboard) GetClipboardText() string {
+  return c.text
+}
+func (c *localClipboard) SetClipboardText(text string) {
+  c.text = text
+}
+
+var clipboard Clipboard = &localClipboard{}
+
+// Sets the clipboard that all widgets will use for copy and paste.
+func SetClipboard(c Clipboard) {
+  clipboard = c
+}
+
+// Returns the clipboard that widgets use for copy and paste.
+func GetClipboard() Clipboard {
+  return clipboard
+}
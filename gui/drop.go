@@ -0,0 +1,43 @@
+package gui
+
+import (
+  "github.com/MobRulesGames/glop/system"
+)
+
+// A widget that implements DropTarget can accept files that are dropped onto
+// it from another application.
+type DropTarget interface {
+  // Returns true if the widget accepted the drop, in which case no other
+  // widget will see it.
+  DoDrop(drop system.DropEvent) bool
+}
+
+// Hands drop to the widget under the point where the files were dropped.  If
+// that widget isn't a DropTarget, or doesn't accept the drop, then its parent
+// gets a chance to, and so on up to the root.  Returns true if any widget
+// accepted the drop.
+func (g *Gui) HandleDrop(drop system.DropEvent) bool {
+  return dropOnWidget(&g.root, drop)
+}
+
+func dropOnWidget(w Widget, drop system.DropEvent) bool {
+  p := Point{drop.X, drop.Y}
+  if !p.Inside(w.Rendered()) {
+    return false
+  }
+  if parent, ok := w.(interface {
+    GetChildren() []Widget
+  }); ok {
+    // Later children are drawn on top, so they get the first look
+    kids := parent.GetChildren()
+    for i := len(kids) - 1; i >= 0; i-- {
+      if dropOnWidget(kids[i], drop) {
+        return true
+      }
+    }
+  }
+  if target, ok := w.(DropTarget); ok {
+    return target.DoDrop(drop)
+  }
+  return false
+}
@@ -2,12 +2,19 @@ package gui
 
 import (
   "fmt"
+  "github.com/MobRulesGames/glop/system"
   "time"
 )
 
+// Anything that can report frame statistics, system.System does this.
+type FrameStatsSource interface {
+  FrameStats() system.FrameStats
+}
+
 type FrameRateWidget struct {
   TextLine
   frame_times []int64
+  source      FrameStatsSource
 }
 
 func MakeFrameRateWidget() *FrameRateWidget {
@@ -17,7 +24,19 @@ func MakeFrameRateWidget() *FrameRateWidget {
   return &w
 }
 
+// If a source is set the widget displays the average frame rate that it
+// reports, otherwise the widget counts how often it is thought about.
+func (w *FrameRateWidget) SetFrameStatsSource(source FrameStatsSource) {
+  w.source = source
+  w.frame_times = nil
+}
+
 func (w *FrameRateWidget) DoThink(t int64, _ bool) {
+  if w.source != nil {
+    w.SetText(fmt.Sprintf("%.0f", w.source.FrameStats().Fps()))
+    w.TextLine.DoThink(t, false)
+    return
+  }
   now := time.Now().UnixNano()
   w.frame_times = append(w.frame_times, now)
   prev := now - 1e9
@@ -2,7 +2,7 @@ package gui
 
 import (
   "github.com/MobRulesGames/glop/gin"
-  "github.com/MobRulesGames/opengl/gl"
+  "github.com/MobRulesGames/glop/render"
 )
 
 type Point struct {
@@ -98,51 +98,18 @@ func (r Region) Size() int {
   return r.Dx * r.Dy
 }
 
-// Need a global stack of regions because opengl only handles pushing/popping
-// the state of the enable bits for each clip plane, not the planes themselves
-var clippers []Region
-
-// If we just declared this in setClipPlanes it would get allocated on the heap
-// because we have to take the address of it to pass it to opengl.  By having
-// it here we avoid that allocation - it amounts to a lot of someone is calling
-// this every frame.
-var eqs [4][4]float64
-
-func (r Region) setClipPlanes() {
-  eqs[0][0], eqs[0][1], eqs[0][2], eqs[0][3] = 1, 0, 0, -float64(r.X)
-  eqs[1][0], eqs[1][1], eqs[1][2], eqs[1][3] = -1, 0, 0, float64(r.X+r.Dx)
-  eqs[2][0], eqs[2][1], eqs[2][2], eqs[2][3] = 0, 1, 0, -float64(r.Y)
-  eqs[3][0], eqs[3][1], eqs[3][2], eqs[3][3] = 0, -1, 0, float64(r.Y+r.Dy)
-  gl.ClipPlane(gl.CLIP_PLANE0, &eqs[0][0])
-  gl.ClipPlane(gl.CLIP_PLANE1, &eqs[1][0])
-  gl.ClipPlane(gl.CLIP_PLANE2, &eqs[2][0])
-  gl.ClipPlane(gl.CLIP_PLANE3, &eqs[3][0])
+// Returns the region as a render.Rect.
+func (r Region) Rect() render.Rect {
+  return render.Rect{X: float64(r.X), Y: float64(r.Y), Dx: float64(r.Dx), Dy: float64(r.Dy)}
 }
 
+// Restricts drawing to the region, intersected with any regions that have
+// already been pushed, until the matching call to PopClipPlanes.
 func (r Region) PushClipPlanes() {
-  if len(clippers) == 0 {
-    gl.Enable(gl.CLIP_PLANE0)
-    gl.Enable(gl.CLIP_PLANE1)
-    gl.Enable(gl.CLIP_PLANE2)
-    gl.Enable(gl.CLIP_PLANE3)
-    r.setClipPlanes()
-    clippers = append(clippers, r)
-  } else {
-    cur := clippers[len(clippers)-1]
-    clippers = append(clippers, r.Isect(cur))
-    clippers[len(clippers)-1].setClipPlanes()
-  }
+  render.Current().PushClip(r.Rect())
 }
 func (r Region) PopClipPlanes() {
-  clippers = clippers[0 : len(clippers)-1]
-  if len(clippers) == 0 {
-    gl.Disable(gl.CLIP_PLANE0)
-    gl.Disable(gl.CLIP_PLANE1)
-    gl.Disable(gl.CLIP_PLANE2)
-    gl.Disable(gl.CLIP_PLANE3)
-  } else {
-    clippers[len(clippers)-1].setClipPlanes()
-  }
+  render.Current().PopClip()
 }
 
 //func (r Region) setViewport() {
@@ -303,7 +270,7 @@ type Clickable struct {
 func (c Clickable) DoRespond(event_group EventGroup) (bool, bool) {
   event := event_group.Events[0]
   if event.Type == gin.Press && event.Key.Id() == gin.MouseLButton {
-    c.on_click(event_group.Timestamp)
+    c.on_click(event_group.Timestamp.Ms())
     return true, false
   }
   return false, false
@@ -412,23 +379,19 @@ func Make(dispatcher gin.EventDispatcher, dims Dims, font_path string) (*Gui, er
 }
 
 func (g *Gui) Draw() {
-  gl.MatrixMode(gl.PROJECTION)
-  gl.LoadIdentity()
   region := g.root.Render_region
-  gl.Ortho(float64(region.X), float64(region.X+region.Dx), float64(region.Y), float64(region.Y+region.Dy), 1000, -1000)
-  gl.ClearColor(0, 0, 0, 1)
-  gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
-  gl.MatrixMode(gl.MODELVIEW)
-  gl.LoadIdentity()
+  render.Current().Begin(region.Rect(), render.Color{R: 0, G: 0, B: 0, A: 1})
   g.root.Draw(region)
   if g.FocusWidget() != nil {
     g.FocusWidget().DrawFocused(region)
   }
+  render.Flush()
 }
 
 // TODO: Shouldn't be exposing this
-func (g *Gui) Think(t int64) {
-  g.root.Think(g, t)
+// Widgets still think in milliseconds.
+func (g *Gui) Think(t gin.Timestamp) {
+  g.root.Think(g, t.Ms())
 }
 
 // TODO: Shouldn't be exposing this
@@ -458,10 +421,12 @@ func (g *Gui) TakeFocus(w Widget) {
     g.focus = append(g.focus, nil)
   }
   g.focus[len(g.focus)-1] = w
+  g.updateTextInput()
 }
 
 func (g *Gui) DropFocus() {
   g.focus = g.focus[0 : len(g.focus)-1]
+  g.updateTextInput()
 }
 
 func (g *Gui) FocusWidget() Widget {
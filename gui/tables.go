@@ -1,6 +1,6 @@
 package gui
 
-import "github.com/MobRulesGames/opengl/gl"
+import "github.com/MobRulesGames/glop/render"
 
 type TableParams struct {
   Spacing int
@@ -72,8 +72,6 @@ func (w *VerticalTable) DoThink(int64, bool) {
   w.Request_dims.Dy += w.params.Spacing * len(w.Children)
 }
 func (w *VerticalTable) Draw(region Region) {
-  gl.Enable(gl.BLEND)
-  gl.Disable(gl.TEXTURE_2D)
   dx := region.Dx
   if dx > w.Request_dims.Dx && !w.Ex {
     dx = w.Request_dims.Dx
@@ -82,35 +80,15 @@ func (w *VerticalTable) Draw(region Region) {
   if dy > w.Request_dims.Dy && !w.Ex {
     dy = w.Request_dims.Dy
   }
-  gl.Color4d(
-      w.params.Background.R,
-      w.params.Background.G,
-      w.params.Background.B,
-      w.params.Background.A)
-  gl.Begin(gl.QUADS)
-  gl.Vertex2i(region.X, region.Y+region.Dy-dy)
-  gl.Vertex2i(region.X, region.Y+region.Dy)
-  gl.Vertex2i(region.X+dx, region.Y+region.Dy)
-  gl.Vertex2i(region.X+dx, region.Y+region.Dy-dy)
-  gl.End()
-  gl.Color4d(
-      w.params.Border.R,
-      w.params.Border.G,
-      w.params.Border.B,
-      w.params.Border.A)
-  gl.Begin(gl.LINES)
-  gl.Vertex2i(region.X, region.Y+region.Dy-dy)
-  gl.Vertex2i(region.X, region.Y+region.Dy)
-
-  gl.Vertex2i(region.X, region.Y+region.Dy)
-  gl.Vertex2i(region.X+dx, region.Y+region.Dy)
-
-  gl.Vertex2i(region.X+dx, region.Y+region.Dy)
-  gl.Vertex2i(region.X+dx, region.Y+region.Dy-dy)
-
-  gl.Vertex2i(region.X+dx, region.Y+region.Dy-dy)
-  gl.Vertex2i(region.X, region.Y+region.Dy-dy)
-  gl.End()
+  r := render.Current()
+  x, y := float64(region.X), float64(region.Y+region.Dy-dy)
+  x2, y2 := float64(region.X+dx), float64(region.Y+region.Dy)
+  r.FillRect(render.Rect{X: x, Y: y, Dx: x2 - x, Dy: y2 - y}, render.Color(w.params.Background))
+  border := render.Color(w.params.Border)
+  r.Line(x, y, x, y2, border)
+  r.Line(x, y2, x2, y2, border)
+  r.Line(x2, y2, x2, y, border)
+  r.Line(x2, y, x, y, border)
 
   fill_available := region.Dy - w.Request_dims.Dy
   if fill_available < 0 {
@@ -188,8 +166,6 @@ func (w *HorizontalTable) DoThink(int64, bool) {
   w.Request_dims.Dx += w.params.Spacing * len(w.Children)
 }
 func (w *HorizontalTable) Draw(region Region) {
-  gl.Enable(gl.BLEND)
-  gl.Disable(gl.TEXTURE_2D)
   dx := region.Dx
   if dx > w.Request_dims.Dx && !w.Ex {
     dx = w.Request_dims.Dx
@@ -198,35 +174,15 @@ func (w *HorizontalTable) Draw(region Region) {
   if dy > w.Request_dims.Dy && !w.Ex {
     dy = w.Request_dims.Dy
   }
-  gl.Color4d(
-      w.params.Background.R,
-      w.params.Background.G,
-      w.params.Background.B,
-      w.params.Background.A)
-  gl.Begin(gl.QUADS)
-  gl.Vertex2i(region.X, region.Y)
-  gl.Vertex2i(region.X, region.Y+region.Dy)
-  gl.Vertex2i(region.X+dx, region.Y+region.Dy)
-  gl.Vertex2i(region.X+dx, region.Y)
-  gl.End()
-  gl.Color4d(
-      w.params.Border.R,
-      w.params.Border.G,
-      w.params.Border.B,
-      w.params.Border.A)
-  gl.Begin(gl.LINES)
-  gl.Vertex2i(region.X, region.Y)
-  gl.Vertex2i(region.X, region.Y+region.Dy)
-
-  gl.Vertex2i(region.X, region.Y+region.Dy)
-  gl.Vertex2i(region.X+dx, region.Y+region.Dy)
-
-  gl.Vertex2i(region.X+dx, region.Y+region.Dy)
-  gl.Vertex2i(region.X+dx, region.Y)
-
-  gl.Vertex2i(region.X+dx, region.Y+region.Dy-dy)
-  gl.Vertex2i(region.X, region.Y)
-  gl.End()
+  r := render.Current()
+  x, y := float64(region.X), float64(region.Y)
+  x2, y2 := float64(region.X+dx), float64(region.Y+region.Dy)
+  r.FillRect(render.Rect{X: x, Y: y, Dx: x2 - x, Dy: y2 - y}, render.Color(w.params.Background))
+  border := render.Color(w.params.Border)
+  r.Line(x, y, x, y2, border)
+  r.Line(x, y2, x2, y2, border)
+  r.Line(x2, y2, x2, y, border)
+  r.Line(x2, float64(region.Y+region.Dy-dy), x, y, border)
 
   fill_available := region.Dx - w.Request_dims.Dx
   if fill_available < 0 {
@@ -13,10 +13,8 @@ import (
   "io"
   "runtime"
   "sort"
-  "unsafe"
   // "github.com/MobRulesGames/opengl/gl"
   gl "github.com/MobRulesGames/gogl/gl21"
-  "github.com/MobRulesGames/opengl/glu"
 )
 
 type subImage struct {
@@ -232,24 +230,11 @@ type dictData struct {
 type Dictionary struct {
   data dictData
 
-  texture uint32
-
-  strs map[string]strBuffer
-  pars map[string]strBuffer
+  texture *render.Texture
+  color   render.Color
 
   dlists map[string]uint32
 }
-type strBuffer struct {
-  vbuffer uint32
-  vs      []dictVert
-
-  ibuffer uint32
-  is      []uint16
-}
-type dictVert struct {
-  x, y float32
-  u, v float32
-}
 
 func (d *Dictionary) getInfo(r rune) runeInfo {
   var info runeInfo
@@ -350,101 +335,43 @@ func (d *Dictionary) StringWidth(s string) float64 {
   return width
 }
 
+// Sets the color that strings are drawn in, white unless this is used.
+func (d *Dictionary) SetColor(c render.Color) {
+  d.color = c
+}
+
+// Draws s with the bottom of its line at y, scaled so that the line is
+// height tall, with the current Renderer.  Each rune is drawn as a quad so
+// that text is transformed, clipped and batched like everything else.  z
+// is ignored since nothing in glop uses depth testing.
 func (d *Dictionary) RenderString(s string, x, y, z, height float64, just Justification) {
   if len(s) == 0 {
     return
   }
-  strbuf, ok := d.strs[s]
-  if !ok {
-    defer d.RenderString(s, x, y, z, height, just)
-  }
-  size := unsafe.Sizeof(dictVert{})
-  scale := height / float64(d.data.Maxy-d.data.Miny)
-  width := float32(d.figureWidth(s) * scale)
-  x_pos := float32(x)
+  scale := height / d.MaxHeight()
+  x_pos := x
   switch just {
   case Center:
-    x_pos -= width / 2
+    x_pos -= d.figureWidth(s) * scale / 2
   case Right:
-    x_pos -= width
+    x_pos -= d.figureWidth(s) * scale
   }
-  if ok {
-    gl.PushMatrix()
-    defer gl.PopMatrix()
-    gl.Translated(gl.Double(x_pos), gl.Double(y), gl.Double(z))
-    gl.Scaled(gl.Double(scale), gl.Double(scale), 1)
-
-    gl.PushAttrib(gl.COLOR_BUFFER_BIT)
-    defer gl.PopAttrib()
-    gl.Enable(gl.BLEND)
-    gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
-
-    gl.Enable(gl.TEXTURE_2D)
-    gl.BindTexture(gl.TEXTURE_2D, gl.Uint(d.texture))
-
-    gl.BindBuffer(gl.ARRAY_BUFFER, gl.Uint(strbuf.vbuffer))
-
-    gl.EnableClientState(gl.VERTEX_ARRAY)
-    gl.VertexPointer(2, gl.FLOAT, gl.Sizei(size), nil)
-
-    gl.EnableClientState(gl.TEXTURE_COORD_ARRAY)
-    gl.TexCoordPointer(2, gl.FLOAT, gl.Sizei(size), gl.Pointer(unsafe.Offsetof(strbuf.vs[0].u)))
-
-    gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, gl.Uint(strbuf.ibuffer))
-    gl.DrawElements(gl.TRIANGLES, gl.Sizei(len(strbuf.is)), gl.UNSIGNED_SHORT, nil)
-
-    gl.DisableClientState(gl.VERTEX_ARRAY)
-    gl.DisableClientState(gl.TEXTURE_COORD_ARRAY)
-    return
-  }
-  x_pos = 0
-  for _, r := range s {
-    info := d.getInfo(r)
-    xleft := x_pos + float32(info.Bounds.Min.X)
-    xright := x_pos + float32(info.Bounds.Max.X)
-    ytop := float32(d.data.Maxy - info.Bounds.Min.Y)
-    ybot := float32(height) + float32(d.data.Miny-info.Bounds.Max.Y)
-    start := uint16(len(strbuf.vs))
-    strbuf.is = append(strbuf.is, start+0)
-    strbuf.is = append(strbuf.is, start+1)
-    strbuf.is = append(strbuf.is, start+2)
-    strbuf.is = append(strbuf.is, start+0)
-    strbuf.is = append(strbuf.is, start+2)
-    strbuf.is = append(strbuf.is, start+3)
-    strbuf.vs = append(strbuf.vs, dictVert{
-      x: xleft,
-      y: ybot,
-      u: float32(info.Pos.Min.X) / float32(d.data.Dx),
-      v: float32(info.Pos.Max.Y) / float32(d.data.Dy),
-    })
-    strbuf.vs = append(strbuf.vs, dictVert{
-      x: xleft,
-      y: ytop,
-      u: float32(info.Pos.Min.X) / float32(d.data.Dx),
-      v: float32(info.Pos.Min.Y) / float32(d.data.Dy),
-    })
-    strbuf.vs = append(strbuf.vs, dictVert{
-      x: xright,
-      y: ytop,
-      u: float32(info.Pos.Max.X) / float32(d.data.Dx),
-      v: float32(info.Pos.Min.Y) / float32(d.data.Dy),
-    })
-    strbuf.vs = append(strbuf.vs, dictVert{
-      x: xright,
-      y: ybot,
-      u: float32(info.Pos.Max.X) / float32(d.data.Dx),
-      v: float32(info.Pos.Max.Y) / float32(d.data.Dy),
-    })
-    x_pos += float32(info.Advance)
+  r := render.Current()
+  dx, dy := float64(d.data.Dx), float64(d.data.Dy)
+  for _, char := range s {
+    info := d.getInfo(char)
+    if b := info.Bounds; !b.Empty() {
+      rect := render.Rect{
+        X:  x_pos + float64(b.Min.X)*scale,
+        Y:  y + float64(d.data.Maxy-b.Max.Y)*scale,
+        Dx: float64(b.Dx()) * scale,
+        Dy: float64(b.Dy()) * scale,
+      }
+      pos := info.Pos
+      r.Quad(d.texture, rect, float64(pos.Min.X)/dx, float64(pos.Max.Y)/dy, float64(pos.Max.X)/dx, float64(pos.Min.Y)/dy, d.color)
+    }
+    x_pos += info.Advance * scale
   }
-  gl.GenBuffers(1, (*gl.Uint)(&strbuf.vbuffer))
-  gl.BindBuffer(gl.ARRAY_BUFFER, gl.Uint(strbuf.vbuffer))
-  gl.BufferData(gl.ARRAY_BUFFER, gl.Sizeiptr(int(size)*len(strbuf.vs)), gl.Pointer(&strbuf.vs[0].x), gl.STATIC_DRAW)
-
-  gl.GenBuffers(1, (*gl.Uint)(&strbuf.ibuffer))
-  gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, gl.Uint(strbuf.ibuffer))
-  gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, gl.Sizeiptr(int(unsafe.Sizeof(strbuf.is[0]))*len(strbuf.is)), gl.Pointer(&strbuf.is[0]), gl.STATIC_DRAW)
-  d.strs[s] = strbuf
 }
 
 func (d *Dictionary) Store(w io.Writer) error {
@@ -540,10 +467,10 @@ func MakeDictionary(font *truetype.Font, size int) *Dictionary {
 // all opengl data, and sets up finalizers for that data.
 func (d *Dictionary) setupGlStuff() {
   d.dlists = make(map[string]uint32)
-  d.strs = make(map[string]strBuffer)
-  d.pars = make(map[string]strBuffer)
+  d.color = render.Color{R: 1, G: 1, B: 1, A: 1}
   // TODO: This finalizer is untested
   runtime.SetFinalizer(d, func(d *Dictionary) {
+    d.texture.Release()
     render.Queue(func() {
       for _, v := range d.dlists {
         gl.DeleteLists(gl.Uint(v), 1)
@@ -551,16 +478,15 @@ func (d *Dictionary) setupGlStuff() {
     })
   })
 
-  render.Queue(func() {
-    gl.Enable(gl.TEXTURE_2D)
-    gl.GenTextures(1, (*gl.Uint)(&d.texture))
-    gl.BindTexture(gl.TEXTURE_2D, gl.Uint(d.texture))
-    gl.TexEnvf(gl.TEXTURE_ENV, gl.TEXTURE_ENV_MODE, gl.MODULATE)
-    gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
-    gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
-    gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
-    gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
-    glu.Build2DMipmaps(gl.TEXTURE_2D, 4, d.data.Dx, d.data.Dy, gl.RGBA, d.data.Pix)
-    gl.Disable(gl.TEXTURE_2D)
+  d.texture = render.Textures().LoadImage(&image.RGBA{
+    Pix:    d.data.Pix,
+    Stride: 4 * d.data.Dx,
+    Rect:   image.Rect(0, 0, d.data.Dx, d.data.Dy),
+  }, render.TextureOptions{
+    Filter:     render.Linear,
+    Mipmaps:    true,
+    No_padding: true,
+    Priority:   render.Frame,
+    Tag:        "font-upload",
   })
 }
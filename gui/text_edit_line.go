@@ -2,8 +2,12 @@ package gui
 
 import (
   "github.com/MobRulesGames/glop/gin"
+  "github.com/MobRulesGames/glop/render"
+  "github.com/MobRulesGames/glop/system"
   "code.google.com/p/freetype-go/freetype"
-  "github.com/MobRulesGames/opengl/gl"
+  "runtime"
+  "strings"
+  "unicode/utf8"
 )
 
 type cursor struct {
@@ -17,6 +21,12 @@ type cursor struct {
 type TextEditLine struct {
   TextLine
   cursor cursor
+
+  // The input method's composition in progress, and its caret within that,
+  // shown at the cursor until the composition is committed.
+  preedit        string
+  preedit_cursor int
+  preedit_line   *TextLine
 }
 
 var shift_mapping map[gin.KeyId]byte
@@ -43,23 +53,39 @@ func MakeTextEditLine(font_name, text string, width int, r, g, b, a float64) *Te
   w.cursor.index = len(w.text)
   w.cursor.pos = w.findOffsetAtIndex(w.cursor.index)
   w.cursor.period = 500 // half a second
+  // The text line that was copied has no texture yet, this one will
+  runtime.SetFinalizer(&w, (*TextEditLine).ReleaseTexture)
   return &w
 }
 
+// Releases the textures that the text and any composition in progress are
+// drawn with, they are made again if the text edit line is drawn after this.
+func (w *TextEditLine) ReleaseTexture() {
+  w.TextLine.ReleaseTexture()
+  if w.preedit_line != nil {
+    w.preedit_line.ReleaseTexture()
+  }
+}
+
+// Returns the index of the rune boundary closest to offset pixels from the
+// left hand side of the text.
 func (w *TextEditLine) findIndexAtOffset(offset int) int {
   low := 0
-  high := 1
-  var low_off, high_off float64
-  for high < len(w.text) && high_off < float64(offset) {
+  var low_off float64
+  for low < len(w.text) {
+    _, size := utf8.DecodeRuneInString(w.text[low:])
+    high := low + size
+    high_off := w.findOffsetAtIndex(high)
+    if high_off >= float64(offset) {
+      if float64(offset)-low_off < high_off-float64(offset) {
+        return low
+      }
+      return high
+    }
     low = high
     low_off = high_off
-    high++
-    high_off = w.findOffsetAtIndex(high)
-  }
-  if float64(offset)-low_off < high_off-float64(offset) {
-    return low
   }
-  return high
+  return low
 }
 
 func (w *TextEditLine) findOffsetAtIndex(index int) float64 {
@@ -106,6 +132,46 @@ func (w *TextEditLine) SetText(text string) {
   }
 }
 
+// Inserts text at the cursor.  Only the first line of text is used since a
+// TextEditLine can only hold a single line.
+func (w *TextEditLine) paste(text string) {
+  if i := strings.IndexAny(text, "\r\n"); i != -1 {
+    text = text[0:i]
+  }
+  w.SetText(w.text[0:w.cursor.index] + text + w.text[w.cursor.index:])
+  w.cursor.index += len(text)
+  w.cursor.moved = true
+}
+
+func (w *TextEditLine) DoTextEvent(event system.TextEvent) {
+  if event.Preedit {
+    w.preedit = event.Text
+    w.preedit_cursor = event.Cursor
+    return
+  }
+  w.preedit = ""
+  w.paste(event.Text)
+}
+
+// Handles the copy, cut and paste shortcuts.  Returns true if key_id was one
+// of them.
+func (w *TextEditLine) doClipboard(key_id gin.KeyId) bool {
+  switch key_id {
+  case 'c':
+    clipboard.SetClipboardText(w.GetText())
+  case 'x':
+    clipboard.SetClipboardText(w.GetText())
+    w.SetText("")
+    w.cursor.index = 0
+    w.cursor.moved = true
+  case 'v':
+    w.paste(clipboard.GetClipboardText())
+  default:
+    return false
+  }
+  return true
+}
+
 func characterFromEventGroup(event_group EventGroup) byte {
   for _, event := range event_group.Events {
     if v, ok := shift_mapping[event.Key.Id()]; ok {
@@ -133,20 +199,16 @@ func (w *TextEditLine) DoRespond(event_group EventGroup) (consume, change_focus
       change_focus = true
       return
     }
-    if found, _ := event_group.FindEvent(gin.Backspace); found {
-      if len(w.text) > 0 && w.cursor.index > 0 {
-        var pre, post string
-        if w.cursor.index > 0 {
-          pre = w.text[0 : w.cursor.index-1]
-        }
-        if w.cursor.index < len(w.text) {
-          post = w.text[w.cursor.index:]
-        }
-        w.SetText(pre + post)
-        w.cursor.index--
+    if gin.In().GetKey(gin.EitherControl).IsDown() && w.doClipboard(key_id) {
+      // Copied, cut or pasted
+    } else if found, _ := event_group.FindEvent(gin.Backspace); found {
+      if w.cursor.index > 0 {
+        _, size := utf8.DecodeLastRuneInString(w.text[:w.cursor.index])
+        w.SetText(w.text[:w.cursor.index-size] + w.text[w.cursor.index:])
+        w.cursor.index -= size
         w.cursor.moved = true
       }
-    } else if v := characterFromEventGroup(event_group); v != 0 {
+    } else if v := characterFromEventGroup(event_group); v != 0 && !text_input_active {
       w.SetText(w.text[0:w.cursor.index] + string([]byte{v}) + w.text[w.cursor.index:])
       w.cursor.index++
       w.cursor.moved = true
@@ -157,12 +219,14 @@ func (w *TextEditLine) DoRespond(event_group EventGroup) (consume, change_focus
       w.cursor.moved = true
     } else if found, _ := event_group.FindEvent(gin.Left); found {
       if w.cursor.index > 0 {
-        w.cursor.index--
+        _, size := utf8.DecodeLastRuneInString(w.text[:w.cursor.index])
+        w.cursor.index -= size
         w.cursor.moved = true
       }
     } else if found, _ := event_group.FindEvent(gin.Right); found {
       if w.cursor.index < len(w.text) {
-        w.cursor.index++
+        _, size := utf8.DecodeRuneInString(w.text[w.cursor.index:])
+        w.cursor.index += size
         w.cursor.moved = true
       }
     }
@@ -176,25 +240,49 @@ func (w *TextEditLine) DoRespond(event_group EventGroup) (consume, change_focus
 func (w *TextEditLine) Draw(region Region) {
   region.PushClipPlanes()
   defer region.PopClipPlanes()
-  gl.Disable(gl.TEXTURE_2D)
-  gl.Color4d(0.3, 0.3, 0.3, 0.9)
-  gl.Begin(gl.QUADS)
-  gl.Vertex2i(region.X+1, region.Y+1)
-  gl.Vertex2i(region.X+1, region.Y-1+region.Dy)
-  gl.Vertex2i(region.X-1+region.Dx, region.Y-1+region.Dy)
-  gl.Vertex2i(region.X-1+region.Dx, region.Y+1)
-  gl.End()
+  r := render.Current()
+  inner := Region{Point{region.X + 1, region.Y + 1}, Dims{region.Dx - 2, region.Dy - 2}}
+  r.FillRect(inner.Rect(), render.Color{R: 0.3, G: 0.3, B: 0.3, A: 0.9})
   w.TextLine.preDraw(region)
   w.TextLine.coreDraw(region)
-  gl.Disable(gl.TEXTURE_2D)
+  c := render.Color{R: 0.5, G: 0.3, B: 0, A: 1}
   if w.cursor.on {
-    gl.Color3d(1, 0.3, 0)
-  } else {
-    gl.Color3d(0.5, 0.3, 0)
+    c = render.Color{R: 1, G: 0.3, B: 0, A: 1}
+  }
+  caret := region.X + int(w.cursor.pos)
+  if w.preedit != "" {
+    caret = w.drawPreedit(region)
   }
-  gl.Begin(gl.LINES)
-  gl.Vertex2i(region.X+int(w.cursor.pos), region.Y)
-  gl.Vertex2i(region.X+int(w.cursor.pos), region.Y+region.Dy)
-  gl.End()
+  r.Line(float64(caret), float64(region.Y), float64(caret), float64(region.Y+region.Dy), c)
   w.TextLine.postDraw(region)
+  if text_input_active && w.IsBeingEdited() {
+    text_input.SetTextInputPosition(caret, region.Y)
+  }
+}
+
+// Draws the composition over the text at the cursor, underlined so that it
+// can be told apart from text that has been entered, and returns the x
+// coordinate of the input method's caret.
+func (w *TextEditLine) drawPreedit(region Region) int {
+  if w.preedit_line == nil {
+    w.preedit_line = makeTextLineWithFont(w.font, "", 0, 1, 1, 1, 1)
+    w.preedit_line.color = w.color
+    w.preedit_line.scale = 1.0
+  }
+  w.preedit_line.SetText(w.preedit)
+  x := region.X + int(w.cursor.pos)
+  sub := Region{Point{x, region.Y}, Dims{region.X + region.Dx - x, region.Dy}}
+  w.preedit_line.preDraw(sub)
+  w.preedit_line.coreDraw(sub)
+  w.preedit_line.postDraw(sub)
+
+  y := float64(region.Y + 2)
+  render.Current().Line(float64(x), y, float64(x+w.preedit_line.rdims.Dx), y, render.Color{R: 1, G: 1, B: 1, A: 1})
+
+  cursor := w.preedit_cursor
+  if cursor < 0 || cursor > len(w.preedit) {
+    cursor = len(w.preedit)
+  }
+  adv, _ := w.preedit_line.context.DrawString(w.preedit[:cursor], freetype.Pt(0, 0))
+  return x + int(float64(adv.X>>8)*w.preedit_line.scale)
 }
@@ -0,0 +1,58 @@
+package gui
+
+import (
+  "github.com/MobRulesGames/glop/system"
+)
+
+// A TextInput turns text input on and off and tells the input method where
+// the caret is.  system.System implements this interface, so normally the
+// system should be passed to SetTextInput() after creating the window, and
+// the text events that it returns should be passed to Gui.HandleTextEvent().
+type TextInput interface {
+  EnableTextInput(enable bool) bool
+  SetTextInputPosition(x, y int)
+}
+
+// Until SetTextInput() is called, or if the TextInput can't report text,
+// text fields work out what was typed from key events.
+var text_input TextInput
+var text_input_active bool
+
+// Sets the TextInput that the gui turns on whenever a widget that takes text
+// has focus.
+func SetTextInput(t TextInput) {
+  if text_input != nil {
+    text_input.EnableTextInput(false)
+  }
+  text_input = t
+  text_input_active = false
+}
+
+// A widget that implements TextInputTarget gets text events while it has
+// focus, and while it has focus text input is enabled.
+type TextInputTarget interface {
+  DoTextEvent(event system.TextEvent)
+}
+
+// Hands event to the widget with focus, if it takes text.  Returns true if it
+// did.
+func (g *Gui) HandleTextEvent(event system.TextEvent) bool {
+  if target, ok := g.FocusWidget().(TextInputTarget); ok {
+    target.DoTextEvent(event)
+    return true
+  }
+  return false
+}
+
+// Turns text input on if the widget with focus takes text, and off
+// otherwise.
+func (g *Gui) updateTextInput() {
+  if text_input == nil {
+    return
+  }
+  _, want := g.FocusWidget().(TextInputTarget)
+  if want == text_input_active {
+    return
+  }
+  text_input_active = text_input.EnableTextInput(want) && want
+}
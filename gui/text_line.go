@@ -8,9 +8,9 @@ import (
   "image/color"
   "code.google.com/p/freetype-go/freetype"
   "code.google.com/p/freetype-go/freetype/truetype"
-  "github.com/MobRulesGames/opengl/gl"
-  "github.com/MobRulesGames/opengl/glu"
+  "github.com/MobRulesGames/glop/render"
   "io/ioutil"
+  "runtime"
 )
 
 type guiError struct {
@@ -103,7 +103,7 @@ type TextLine struct {
   font      *truetype.Font
   context   *freetype.Context
   glyph_buf *truetype.GlyphBuf
-  texture   gl.Texture
+  texture   *render.Texture
   rgba      *image.RGBA
   color     color.Color
   scale     float64
@@ -113,39 +113,36 @@ func (w *TextLine) String() string {
   return "text line"
 }
 
-func nextPowerOf2(n uint32) uint32 {
-  if n == 0 {
-    return 1
-  }
-  for i := uint(0); i < 32; i++ {
-    p := uint32(1) << i
-    if n <= p {
-      return p
-    }
-  }
-  return 0
-}
-
 func (w *TextLine) figureDims() {
   // Always draw the text as white on a transparent background so that we can change
   // the color easily through opengl
   w.rdims.Dx, w.rdims.Dy = drawText(w.font, w.context, color.RGBA{255, 255, 255, 255}, image.NewRGBA(image.Rect(0, 0, 1, 1)), w.text)
   texture_dims := Dims{
-    Dx: int(nextPowerOf2(uint32(w.rdims.Dx))),
-    Dy: int(nextPowerOf2(uint32(w.rdims.Dy))),
+    Dx: int(render.NextPowerOf2(uint32(w.rdims.Dx))),
+    Dy: int(render.NextPowerOf2(uint32(w.rdims.Dy))),
   }
   w.rgba = image.NewRGBA(image.Rect(0, 0, texture_dims.Dx, texture_dims.Dy))
   drawText(w.font, w.context, color.RGBA{255, 255, 255, 255}, w.rgba, w.text)
 
-  gl.Enable(gl.TEXTURE_2D)
-  w.texture.Bind(gl.TEXTURE_2D)
-  gl.TexEnvf(gl.TEXTURE_ENV, gl.TEXTURE_ENV_MODE, gl.MODULATE)
-  gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
-  gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
-  gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
-  gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
-  glu.Build2DMipmaps(gl.TEXTURE_2D, 4, w.rgba.Bounds().Dx(), w.rgba.Bounds().Dy(), gl.RGBA, w.rgba.Pix)
-  gl.Disable(gl.TEXTURE_2D)
+  if w.texture == nil {
+    w.texture = render.Textures().LoadImage(w.rgba, render.TextureOptions{
+      Filter:  render.Nearest,
+      Mipmaps: true,
+    })
+  } else {
+    w.texture.Update(w.rgba)
+  }
+}
+
+// Releases the texture that the text is drawn with, it is made again if the
+// text line is drawn after this.  This is also done once the text line is
+// garbage collected.
+func (w *TextLine) ReleaseTexture() {
+  if w.texture != nil {
+    w.texture.Release()
+    w.texture = nil
+  }
+  w.initted = false
 }
 
 type Button struct {
@@ -162,12 +159,16 @@ func MakeButton(font_name, text string, width int, r, g, b, a float64, f func(in
 }
 
 func MakeTextLine(font_name, text string, width int, r, g, b, a float64) *TextLine {
-  var w TextLine
-  w.EmbeddedWidget = &BasicWidget{CoreWidget: &w}
   font, ok := basic_fonts[font_name]
   if !ok {
     panic(fmt.Sprintf("Unable to find a font registered as '%s'.", font_name))
   }
+  return makeTextLineWithFont(font, text, width, r, g, b, a)
+}
+
+func makeTextLineWithFont(font *truetype.Font, text string, width int, r, g, b, a float64) *TextLine {
+  var w TextLine
+  w.EmbeddedWidget = &BasicWidget{CoreWidget: &w}
   w.font = font
   w.glyph_buf = truetype.NewGlyphBuf()
   w.next_text = text
@@ -176,6 +177,7 @@ func MakeTextLine(font_name, text string, width int, r, g, b, a float64) *TextLi
   w.context.SetFontSize(12)
   w.SetColor(r, g, b, a)
   w.Request_dims = Dims{width, 35}
+  runtime.SetFinalizer(&w, (*TextLine).ReleaseTexture)
   return &w
 }
 
@@ -204,7 +206,6 @@ func (w *TextLine) DoThink(int64, bool) {
 func (w *TextLine) preDraw(region Region) {
   if !w.initted {
     w.initted = true
-    w.texture = gl.GenTexture()
     w.text = w.next_text
     w.figureDims()
   }
@@ -213,29 +214,13 @@ func (w *TextLine) preDraw(region Region) {
     w.figureDims()
   }
 
-  gl.PushMatrix()
-
-  gl.Color3d(0, 0, 0)
-  gl.Begin(gl.QUADS)
-    gl.Vertex2i(region.X, region.Y)
-    gl.Vertex2i(region.X, region.Y + region.Dy)
-    gl.Vertex2i(region.X + region.Dx, region.Y + region.Dy)
-    gl.Vertex2i(region.X + region.Dx, region.Y)
-  gl.End()
-
-  gl.PushAttrib(gl.TEXTURE_BIT)
-  gl.Enable(gl.TEXTURE_2D)
-  w.texture.Bind(gl.TEXTURE_2D)
-
-  gl.PushAttrib(gl.COLOR_BUFFER_BIT)
-  gl.Enable(gl.BLEND)
-  gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+  r := render.Current()
+  r.PushTransform()
+  r.FillRect(region.Rect(), render.Color{R: 0, G: 0, B: 0, A: 1})
 }
 
 func (w *TextLine) postDraw(region Region) {
-  gl.PopAttrib()
-  gl.PopAttrib()
-  gl.PopMatrix()
+  render.Current().PopTransform()
 }
 
 func (w *TextLine) Draw(region Region) {
@@ -248,8 +233,6 @@ func (w *TextLine) Draw(region Region) {
 
 func (w *TextLine) coreDraw(region Region) {
   if region.Size() == 0 { return }
-  gl.PolygonMode(gl.FRONT_AND_BACK, gl.FILL)
-  gl.Color4d(1.0, 1.0, 1.0, 1.0)
   req := w.Request_dims
   if req.Dx > region.Dx {
     req.Dx = region.Dx
@@ -267,18 +250,8 @@ func (w *TextLine) coreDraw(region Region) {
   tx := float64(w.rdims.Dx) / float64(w.rgba.Bounds().Dx())
   ty := float64(w.rdims.Dy) / float64(w.rgba.Bounds().Dy())
   //  w.scale = float64(w.Render_region.Dx) / float64(w.rdims.Dx)
-  {
-    r, g, b, a := w.color.RGBA()
-    gl.Color4d(float64(r)/65535, float64(g)/65535, float64(b)/65535, float64(a)/65535)
-  }
-  gl.Begin(gl.QUADS)
-  gl.TexCoord2d(0, 0)
-  gl.Vertex2i(region.X, region.Y)
-  gl.TexCoord2d(0, -ty)
-  gl.Vertex2i(region.X, region.Y+w.rdims.Dy)
-  gl.TexCoord2d(tx, -ty)
-  gl.Vertex2i(region.X+w.rdims.Dx, region.Y+w.rdims.Dy)
-  gl.TexCoord2d(tx, 0)
-  gl.Vertex2i(region.X+w.rdims.Dx, region.Y)
-  gl.End()
+  r, g, b, a := w.color.RGBA()
+  c := render.Color{R: float64(r) / 65535, G: float64(g) / 65535, B: float64(b) / 65535, A: float64(a) / 65535}
+  text := Region{region.Point, w.rdims}
+  render.Current().Quad(w.texture, text.Rect(), 0, 0, tx, -ty, c)
 }
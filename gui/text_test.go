@@ -0,0 +1,92 @@
+package gui_test
+
+import (
+  "bytes"
+  "encoding/gob"
+  "github.com/MobRulesGames/glop/gui"
+  "github.com/MobRulesGames/glop/render"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+  "image"
+  "image/color"
+)
+
+// Mirrors what a Dictionary stores, so that specs can make one without a
+// font.
+type runeInfo struct {
+  Pos     image.Rectangle
+  Bounds  image.Rectangle
+  Advance float64
+}
+type dictData struct {
+  Pix        []byte
+  Dx, Dy     int
+  Info       map[rune]runeInfo
+  Ascii_info []runeInfo
+  Baseline   int
+  Miny, Maxy int
+}
+
+// Makes a Dictionary with two runes, each three pixels wide and four tall.
+// 'a' sits on the baseline and 'g' hangs two pixels below it.  The top half
+// of each rune is opaque and the bottom half is half transparent, so that
+// it is obvious if they are drawn upside down.
+func makeTestDictionary() (*gui.Dictionary, error) {
+  img := image.NewRGBA(image.Rect(0, 0, 8, 4))
+  for _, x0 := range []int{0, 4} {
+    for y := 0; y < 4; y++ {
+      for x := x0; x < x0+3; x++ {
+        a := uint8(255)
+        if y >= 2 {
+          a = 128
+        }
+        img.Set(x, y, color.NRGBA{255, 255, 255, a})
+      }
+    }
+  }
+  data := dictData{
+    Pix:  img.Pix,
+    Dx:   8,
+    Dy:   4,
+    Info: make(map[rune]runeInfo),
+    Miny: -4,
+    Maxy: 2,
+  }
+  data.Info['a'] = runeInfo{Pos: image.Rect(0, 0, 3, 4), Bounds: image.Rect(0, -4, 3, 0), Advance: 4}
+  data.Info['g'] = runeInfo{Pos: image.Rect(4, 0, 7, 4), Bounds: image.Rect(0, -2, 3, 2), Advance: 4}
+  data.Ascii_info = make([]runeInfo, 256)
+  for r, info := range data.Info {
+    data.Ascii_info[r] = info
+  }
+  var buf bytes.Buffer
+  if err := gob.NewEncoder(&buf).Encode(data); err != nil {
+    return nil, err
+  }
+  return gui.LoadDictionary(&buf)
+}
+
+func TextGoldenSpec(c gospec.Context) {
+  d, err := makeTestDictionary()
+  c.Assume(err, Equals, nil)
+  d.SetColor(render.Color{R: 1, G: 0.5, B: 0, A: 1})
+  render.Purge()
+
+  c.Specify("Text is clipped and transformed like everything else when it is batched", func() {
+    soft_mutex.Lock()
+    b := render.MakeBatch(soft)
+    render.SetRenderer(b)
+    b.Begin(render.Rect{Dx: 16, Dy: 8}, render.Color{A: 1})
+    b.PushTransform()
+    b.Translate(1, 1)
+    b.PushClip(render.Rect{Dx: 6, Dy: 8})
+    d.RenderString("ag", 0, 0, 0, 6, gui.Left)
+    b.PopClip()
+    d.RenderString("a", 8, 0, 0, 12, gui.Left)
+    b.PopTransform()
+    b.Flush()
+    render.SetRenderer(soft)
+    c.Expect(render.CompareGolden(soft.Image(), "testdata/clipped_text.png"), Equals, nil)
+    soft_mutex.Unlock()
+    c.Expect(b.Stats(), Equals, render.BatchStats{Draw_calls: 1, Quads: 3})
+  })
+}
@@ -1,12 +1,10 @@
 package gui
 
 import (
-  "image"
   _ "image/png"
   _ "image/jpeg"
-  "os"
+  "github.com/MobRulesGames/glop/render"
   "github.com/MobRulesGames/opengl/gl"
-  "github.com/MobRulesGames/opengl/glu"
   "runtime"
 )
 
@@ -103,8 +101,10 @@ type ImageBox struct {
   BasicZone
   Childless
 
-  active     bool
-  texture    gl.Texture
+  // Either a texture that we hold a reference to, or one that someone else
+  // owns that was passed to SetImageByTexture
+  texture    *render.Texture
+  external   gl.Texture
   r, g, b, a float64
 }
 
@@ -122,78 +122,56 @@ func (w *ImageBox) SetShading(r, g, b, a float64) {
   w.r, w.g, w.b, w.a = r, g, b, a
 }
 func freeTexture(w *ImageBox) {
-  if w.active {
-    w.texture.Delete()
-    w.active = false
+  if w.texture != nil {
+    w.texture.Release()
+    w.texture = nil
   }
-  w.texture = 0
+  w.external = 0
 }
 
 // Does not take ownserhip of the texture, you must still free the texture
 // when you are done with it.
 func (w *ImageBox) SetImageByTexture(texture gl.Texture, dx, dy int) {
   w.UnsetImage()
-  w.texture = texture
+  w.external = texture
   w.Request_dims.Dx = dx
   w.Request_dims.Dy = dy
-  w.active = false
 }
 func (w *ImageBox) UnsetImage() {
   freeTexture(w)
 }
 func (w *ImageBox) SetImage(path string) {
   w.UnsetImage()
-  data, err := os.Open(path)
-  if err != nil {
-    // TODO: Log error
-    return
-  }
-
-  var img image.Image
-  img, _, err = image.Decode(data)
+  texture, err := render.Textures().Load(path, render.TextureOptions{
+    Filter:     render.Nearest,
+    Mipmaps:    true,
+    No_padding: true,
+  })
   if err != nil {
     // TODO: Log error
     return
   }
-
-  w.Request_dims.Dx = img.Bounds().Dx()
-  w.Request_dims.Dy = img.Bounds().Dy()
-  canvas := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
-  for y := 0; y < canvas.Bounds().Dy(); y++ {
-    for x := 0; x < canvas.Bounds().Dx(); x++ {
-      r, g, b, a := img.At(x, y).RGBA()
-      base := 4*x + canvas.Stride*y
-      canvas.Pix[base] = uint8(r)
-      canvas.Pix[base+1] = uint8(g)
-      canvas.Pix[base+2] = uint8(b)
-      canvas.Pix[base+3] = uint8(a)
-    }
-  }
-
-  w.texture = gl.GenTexture()
-  gl.Enable(gl.TEXTURE_2D)
-  w.texture.Bind(gl.TEXTURE_2D)
-  gl.TexEnvf(gl.TEXTURE_ENV, gl.TEXTURE_ENV_MODE, gl.MODULATE)
-  gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
-  gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
-  gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
-  gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
-  glu.Build2DMipmaps(gl.TEXTURE_2D, 4, img.Bounds().Dx(), img.Bounds().Dy(), gl.RGBA, canvas.Pix)
-
-  w.active = true
+  w.texture = texture
+  w.Request_dims.Dx, w.Request_dims.Dy = texture.Dims()
 }
 func (w *ImageBox) Draw(region Region) {
   w.Render_region = region
 
-  // We check texture == 0 and not active because active only indicates if we
-  // have a texture that we need to free later.  It's possible for us to have
-  // a texture that someone else owns.
-  if w.texture == 0 {
+  c := render.Color{R: w.r, G: w.g, B: w.b, A: w.a}
+  if w.texture != nil {
+    render.Current().Quad(w.texture, region.Rect(), 0, 0, 1, -1, c)
     return
   }
 
+  // Textures that someone else owns can only be drawn with OpenGL.  Flushing
+  // draws anything that is batched up under them and leaves OpenGL with the
+  // current transform and clip rect.
+  if w.external == 0 {
+    return
+  }
+  render.Flush()
   gl.Enable(gl.TEXTURE_2D)
-  w.texture.Bind(gl.TEXTURE_2D)
+  w.external.Bind(gl.TEXTURE_2D)
   gl.Enable(gl.BLEND)
   gl.Color4d(w.r, w.g, w.b, w.a)
   gl.Begin(gl.QUADS)
@@ -0,0 +1,163 @@
+package gui_test
+
+import (
+  "github.com/MobRulesGames/glop/gui"
+  "github.com/MobRulesGames/glop/render"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+  "image"
+  "image/color"
+  "image/png"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "reflect"
+  "sync"
+)
+
+// Widgets draw with the current renderer, so every spec draws into this one,
+// which TestAllSpecs makes current, and they take turns doing it.
+var (
+  soft       = render.MakeSoftRenderer()
+  soft_mutex sync.Mutex
+)
+
+// Writes a dx by dy image split into four quadrants of different colors, so
+// that it is obvious if it is drawn upside down or mirrored.
+func writeQuadrants(path string, dx, dy int) error {
+  img := image.NewRGBA(image.Rect(0, 0, dx, dy))
+  for y := 0; y < dy; y++ {
+    for x := 0; x < dx; x++ {
+      c := color.RGBA{0, 0, 0, 255}
+      if x < dx/2 {
+        c.R = 255
+      }
+      if y < dy/2 {
+        c.G = 255
+      } else {
+        c.B = 255
+      }
+      img.Set(x, y, c)
+    }
+  }
+  f, err := os.Create(path)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+  return png.Encode(f, img)
+}
+
+// Lays out w and draws it into a view of dx by dy pixels with a software
+// renderer.
+func drawWidget(r render.Renderer, w gui.Widget, dx, dy int) {
+  w.Think(&gui.Gui{}, 0)
+  region := gui.Region{Dims: gui.Dims{Dx: dx, Dy: dy}}
+  r.Begin(region.Rect(), render.Color{A: 1})
+  w.Draw(region)
+}
+
+func WidgetGoldenSpec(c gospec.Context) {
+  dir, err := ioutil.TempDir("", "glop-gui")
+  c.Assume(err, Equals, nil)
+  defer os.RemoveAll(dir)
+  path := filepath.Join(dir, "quadrants.png")
+  c.Assume(writeQuadrants(path, 8, 6), Equals, nil)
+
+  c.Specify("Image boxes draw their image upright", func() {
+    ib := gui.MakeImageBox()
+    ib.SetImage(path)
+    render.Purge()
+    soft_mutex.Lock()
+    drawWidget(soft, ib, 8, 6)
+    c.Expect(render.CompareGolden(soft.Image(), "testdata/image_box.png"), Equals, nil)
+    soft_mutex.Unlock()
+    ib.UnsetImage()
+    render.Purge()
+  })
+
+  c.Specify("Tables lay out their children", func() {
+    vt := gui.MakeVerticalTable()
+    vt.Params().Spacing = 2
+    ht := gui.MakeHorizontalTable()
+    var boxes []*gui.ImageBox
+    for i := 0; i < 4; i++ {
+      ib := gui.MakeImageBox()
+      ib.SetImage(path)
+      boxes = append(boxes, ib)
+    }
+    boxes[1].SetShading(1, 1, 1, 0.5)
+    ht.AddChild(boxes[0])
+    ht.AddChild(boxes[1])
+    vt.AddChild(ht)
+    vt.AddChild(boxes[2])
+    vt.AddChild(boxes[3])
+    render.Purge()
+    soft_mutex.Lock()
+    drawWidget(soft, vt, 32, 32)
+    c.Expect(render.CompareGolden(soft.Image(), "testdata/tables.png"), Equals, nil)
+    soft_mutex.Unlock()
+    for _, ib := range boxes {
+      ib.UnsetImage()
+    }
+    render.Purge()
+  })
+
+  c.Specify("Check boxes look the same when they are batched", func() {
+    target := map[int]bool{0: true, 1: false}
+    var options []gui.Widget
+    var indexes []reflect.Value
+    var boxes []*gui.ImageBox
+    for i := 0; i < 3; i++ {
+      ib := gui.MakeImageBox()
+      ib.SetImage(path)
+      boxes = append(boxes, ib)
+      options = append(options, ib)
+      indexes = append(indexes, reflect.ValueOf(i))
+    }
+    cb := gui.MakeCheckBoxes(options, indexes, 40, reflect.ValueOf(target))
+    render.Purge()
+    soft_mutex.Lock()
+    b := render.MakeBatch(soft)
+    render.SetRenderer(b)
+    drawWidget(b, cb, 48, 100)
+    b.Flush()
+    render.SetRenderer(soft)
+    c.Expect(render.CompareGolden(soft.Image(), "testdata/check_boxes.png"), Equals, nil)
+    soft_mutex.Unlock()
+    // Table borders touch the pixels next to them, so only some of the
+    // primitives can be drawn together
+    stats := b.Stats()
+    c.Expect(stats.Quads, Equals, 12)
+    c.Expect(stats.Lines, Equals, 16)
+    c.Expect(stats.Draw_calls, Equals, 12)
+    for _, ib := range boxes {
+      ib.UnsetImage()
+    }
+    render.Purge()
+  })
+
+  c.Specify("Check boxes show whether each option is selected", func() {
+    target := map[int]bool{0: true, 1: false}
+    var options []gui.Widget
+    var indexes []reflect.Value
+    var boxes []*gui.ImageBox
+    for i := 0; i < 3; i++ {
+      ib := gui.MakeImageBox()
+      ib.SetImage(path)
+      boxes = append(boxes, ib)
+      options = append(options, ib)
+      indexes = append(indexes, reflect.ValueOf(i))
+    }
+    cb := gui.MakeCheckBoxes(options, indexes, 40, reflect.ValueOf(target))
+    render.Purge()
+    soft_mutex.Lock()
+    drawWidget(soft, cb, 48, 100)
+    c.Expect(render.CompareGolden(soft.Image(), "testdata/check_boxes.png"), Equals, nil)
+    soft_mutex.Unlock()
+    for _, ib := range boxes {
+      ib.UnsetImage()
+    }
+    render.Purge()
+  })
+}
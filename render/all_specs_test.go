@@ -0,0 +1,18 @@
+package render_test
+
+import (
+  "github.com/orfjackal/gospec/src/gospec"
+  "testing"
+)
+
+func TestAllSpecs(t *testing.T) {
+  r := gospec.NewRunner()
+  r.AddSpec(SoftRendererSpec)
+  r.AddSpec(SetRendererSpec)
+  r.AddSpec(BatchSpec)
+  r.AddSpec(CallSpec)
+  r.AddSpec(HealthSpec)
+  r.AddSpec(LaneSpec)
+  r.AddSpec(StatsSpec)
+  gospec.MainGoTest(r, t)
+}
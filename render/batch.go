@@ -0,0 +1,367 @@
+package render
+
+import (
+  "image"
+  "math"
+  "sort"
+)
+
+// How a primitive is combined with what has already been drawn.
+type Blend int
+
+const (
+  // Source alpha over the destination, what everything else in glop uses
+  AlphaBlend Blend = iota
+
+  // Source color times its alpha added to the destination, for glows and
+  // particles
+  AdditiveBlend
+)
+
+type Primitive int
+
+const (
+  // Four vertices per quad, bottom left, top left, top right, bottom right
+  Quads Primitive = iota
+
+  // Two vertices per line
+  Lines
+)
+
+// Everything about a run of primitives other than their vertices.  A
+// Renderer can draw every primitive with the same BatchState in one call.
+type BatchState struct {
+  Texture   *Texture
+  Blend     Blend
+  Primitive Primitive
+
+  // Quads are clipped by Batch before they are drawn, lines are clipped to
+  // Clip by the Renderer if Clipped is set.
+  Clip    Rect
+  Clipped bool
+}
+
+// A vertex in view coordinates.  The layout matches what OpenGL expects in a
+// vertex buffer.
+type Vertex struct {
+  X, Y       float32
+  U, V       float32
+  R, G, B, A float32
+}
+
+// Verts[First:First+Count] are drawn with State.
+type BatchRun struct {
+  State BatchState
+  First int
+  Count int
+}
+
+// A BatchDrawer is a Renderer that can draw runs of primitives that all
+// share a vertex buffer.  A Batch takes anything it pushed onto the
+// transform and clip stacks off again before calling DrawBatch, so the
+// stacks are empty.
+type BatchDrawer interface {
+  Renderer
+  DrawBatch(verts []Vertex, runs []BatchRun)
+}
+
+// Counts of what a Batch has drawn.
+type BatchStats struct {
+  Draw_calls int
+  Quads      int
+  Lines      int
+}
+
+// Number of runs that a primitive may be moved in front of when looking for
+// a run with the same state to join.
+const max_lookback = 32
+
+type batchRun struct {
+  state  BatchState
+  verts  []Vertex
+  bounds Rect
+}
+
+type batchLayer struct {
+  runs []*batchRun
+}
+
+// A Batch is a Renderer that collects primitives and draws them with as few
+// calls to its target as it can.  Primitives are drawn in order of their z,
+// lowest first, then primitives with the same texture and state are drawn
+// together.  A primitive is only drawn ahead of primitives that were
+// submitted before it, at the same z, when it doesn't overlap them, so
+// anything that was drawn through a Renderer looks the same when drawn
+// through a Batch.
+// Transforms and clip rects are applied to quads as they are submitted, so
+// they don't split runs.
+// glop never installs a Batch itself, a program that wants the gui and its
+// sprites batched makes one around its Renderer and passes it to
+// SetRenderer.
+type Batch struct {
+  stacks
+  target BatchDrawer
+
+  z     float64
+  blend Blend
+
+  layers map[float64]*batchLayer
+  pool   []*batchRun
+
+  // Scratch space reused by every flush
+  verts []Vertex
+  runs  []BatchRun
+
+  stats BatchStats
+
+  // Whether the current transform, and the current clip rect, have been
+  // pushed onto the target by the last flush.
+  forwarded      bool
+  forwarded_clip bool
+}
+
+func MakeBatch(target BatchDrawer) *Batch {
+  b := &Batch{
+    target: target,
+    layers: make(map[float64]*batchLayer),
+  }
+  b.reset()
+  return b
+}
+
+// Sets the z that everything submitted afterwards is drawn at.  Begin resets
+// it to zero.
+func (b *Batch) SetZ(z float64) {
+  b.z = z
+}
+
+func (b *Batch) Z() float64 {
+  return b.z
+}
+
+// Sets the blending used for everything submitted afterwards.  Begin resets
+// it to AlphaBlend.
+func (b *Batch) SetBlend(blend Blend) {
+  b.blend = blend
+}
+
+// Returns what has been drawn since the last call to Begin.  Primitives are
+// only counted once they have been flushed.
+func (b *Batch) Stats() BatchStats {
+  return b.stats
+}
+
+func (b *Batch) Begin(view Rect, clear Color) {
+  b.discard()
+  b.forwarded = false
+  b.reset()
+  b.z = 0
+  b.blend = AlphaBlend
+  b.stats = BatchStats{}
+  b.target.Begin(view, clear)
+}
+
+func (b *Batch) PushTransform()         { b.pushTransform() }
+func (b *Batch) PopTransform()          { b.popTransform() }
+func (b *Batch) Translate(x, y float64) { b.translate(x, y) }
+func (b *Batch) Scale(x, y float64)     { b.scale(x, y) }
+func (b *Batch) PushClip(c Rect)        { b.pushClip(c) }
+func (b *Batch) PopClip()               { b.popClip() }
+
+func (b *Batch) wrapped() Renderer {
+  return b.target
+}
+
+func (b *Batch) UploadTexture(t *Texture, rgba *image.RGBA) {
+  b.target.UploadTexture(t, rgba)
+}
+
+func (b *Batch) DeleteTexture(t *Texture) {
+  b.target.DeleteTexture(t)
+}
+
+func (b *Batch) FillRect(r Rect, c Color) {
+  b.Quad(nil, r, 0, 0, 0, 0, c)
+}
+
+func lerp(a, b, f float64) float64 {
+  return a + (b-a)*f
+}
+
+func (b *Batch) Quad(t *Texture, r Rect, u, v, u2, v2 float64, c Color) {
+  tr := b.top()
+  if tr.sx < 0 {
+    u, u2 = u2, u
+  }
+  if tr.sy < 0 {
+    v, v2 = v2, v
+  }
+  view := tr.applyRect(r)
+  if view.Dx <= 0 || view.Dy <= 0 {
+    return
+  }
+  if len(b.clips) > 0 {
+    clipped := view.Isect(b.clips[len(b.clips)-1])
+    if clipped.Dx <= 0 || clipped.Dy <= 0 {
+      return
+    }
+    fx, fx2 := (clipped.X-view.X)/view.Dx, (clipped.X+clipped.Dx-view.X)/view.Dx
+    fy, fy2 := (clipped.Y-view.Y)/view.Dy, (clipped.Y+clipped.Dy-view.Y)/view.Dy
+    u, u2 = lerp(u, u2, fx), lerp(u, u2, fx2)
+    v, v2 = lerp(v, v2, fy), lerp(v, v2, fy2)
+    view = clipped
+  }
+  x, y := float32(view.X), float32(view.Y)
+  x2, y2 := float32(view.X+view.Dx), float32(view.Y+view.Dy)
+  cr, cg, cb, ca := float32(c.R), float32(c.G), float32(c.B), float32(c.A)
+  b.add(BatchState{Texture: t, Blend: b.blend, Primitive: Quads}, view,
+    Vertex{x, y, float32(u), float32(v), cr, cg, cb, ca},
+    Vertex{x, y2, float32(u), float32(v2), cr, cg, cb, ca},
+    Vertex{x2, y2, float32(u2), float32(v2), cr, cg, cb, ca},
+    Vertex{x2, y, float32(u2), float32(v), cr, cg, cb, ca})
+}
+
+// Lines can't be clipped exactly by moving their end points, so they keep
+// their clip rect as part of their state instead.
+func (b *Batch) Line(x, y, x2, y2 float64, c Color) {
+  state := BatchState{Blend: b.blend, Primitive: Lines}
+  if len(b.clips) > 0 {
+    state.Clip = b.clips[len(b.clips)-1]
+    state.Clipped = true
+  }
+  tr := b.top()
+  x, y = tr.apply(x, y)
+  x2, y2 = tr.apply(x2, y2)
+  // Lines touch the pixels around them, so their bounds are padded
+  bounds := Rect{math.Min(x, x2) - 1, math.Min(y, y2) - 1, math.Abs(x2-x) + 2, math.Abs(y2-y) + 2}
+  cr, cg, cb, ca := float32(c.R), float32(c.G), float32(c.B), float32(c.A)
+  b.add(state, bounds,
+    Vertex{float32(x), float32(y), 0, 0, cr, cg, cb, ca},
+    Vertex{float32(x2), float32(y2), 0, 0, cr, cg, cb, ca})
+}
+
+func overlaps(a, b Rect) bool {
+  return a.X < b.X+b.Dx && b.X < a.X+a.Dx && a.Y < b.Y+b.Dy && b.Y < a.Y+a.Dy
+}
+
+func union(a, b Rect) Rect {
+  x, y := math.Min(a.X, b.X), math.Min(a.Y, b.Y)
+  x2, y2 := math.Max(a.X+a.Dx, b.X+b.Dx), math.Max(a.Y+a.Dy, b.Y+b.Dy)
+  return Rect{x, y, x2 - x, y2 - y}
+}
+
+func (b *Batch) add(state BatchState, bounds Rect, verts ...Vertex) {
+  layer, ok := b.layers[b.z]
+  if !ok {
+    layer = &batchLayer{}
+    b.layers[b.z] = layer
+  }
+  runs := layer.runs
+  for i := len(runs) - 1; i >= 0 && i >= len(runs)-max_lookback; i-- {
+    run := runs[i]
+    if run.state == state {
+      run.verts = append(run.verts, verts...)
+      run.bounds = union(run.bounds, bounds)
+      return
+    }
+    if overlaps(run.bounds, bounds) {
+      break
+    }
+  }
+  var run *batchRun
+  if len(b.pool) > 0 {
+    run = b.pool[len(b.pool)-1]
+    b.pool = b.pool[:len(b.pool)-1]
+  } else {
+    run = &batchRun{}
+  }
+  run.state = state
+  run.verts = append(run.verts[:0], verts...)
+  run.bounds = bounds
+  layer.runs = append(layer.runs, run)
+}
+
+// Drops everything that hasn't been flushed, keeping the runs for reuse.
+func (b *Batch) discard() {
+  for z, layer := range b.layers {
+    for _, run := range layer.runs {
+      run.state = BatchState{}
+      b.pool = append(b.pool, run)
+    }
+    delete(b.layers, z)
+  }
+}
+
+// Draws everything that has been submitted since the last flush.  This must
+// be done before anything is drawn without going through the Batch, and
+// before the frame is shown.  Afterwards the target has the Batch's current
+// transform and clip rect, so anything drawn straight to the target, or
+// with OpenGL when the target is a GLRenderer, is placed and clipped just
+// like what was batched.
+func (b *Batch) Flush() {
+  b.unforward()
+  if len(b.layers) > 0 {
+    var zs []float64
+    for z := range b.layers {
+      zs = append(zs, z)
+    }
+    sort.Float64s(zs)
+    b.verts = b.verts[:0]
+    b.runs = b.runs[:0]
+    for _, z := range zs {
+      for _, run := range b.layers[z].runs {
+        b.runs = append(b.runs, BatchRun{State: run.state, First: len(b.verts), Count: len(run.verts)})
+        b.verts = append(b.verts, run.verts...)
+        if run.state.Primitive == Quads {
+          b.stats.Quads += len(run.verts) / 4
+        } else {
+          b.stats.Lines += len(run.verts) / 2
+        }
+      }
+    }
+    b.stats.Draw_calls += len(b.runs)
+    b.discard()
+    b.target.DrawBatch(b.verts, b.runs)
+  }
+  b.forward()
+}
+
+// Pushes the current transform and clip rect onto the target.  The clip
+// rect is already in view coordinates, so it is pushed before the
+// transform is applied.
+func (b *Batch) forward() {
+  tr := b.top()
+  if len(b.clips) == 0 && *tr == (transform{sx: 1, sy: 1}) {
+    return
+  }
+  b.target.PushTransform()
+  b.forwarded = true
+  b.forwarded_clip = len(b.clips) > 0
+  if b.forwarded_clip {
+    b.target.PushClip(b.clips[len(b.clips)-1])
+  }
+  b.target.Translate(tr.tx, tr.ty)
+  b.target.Scale(tr.sx, tr.sy)
+}
+
+func (b *Batch) unforward() {
+  if !b.forwarded {
+    return
+  }
+  if b.forwarded_clip {
+    b.target.PopClip()
+  }
+  b.target.PopTransform()
+  b.forwarded = false
+}
+
+type flusher interface {
+  Flush()
+}
+
+// Draws anything that the current Renderer has batched up, if it batches.
+func Flush() {
+  if f, ok := Current().(flusher); ok {
+    f.Flush()
+  }
+}
@@ -0,0 +1,132 @@
+package render_test
+
+import (
+  "github.com/MobRulesGames/glop/render"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+  "image"
+  "image/color"
+)
+
+// A 1x1 texture of a single color.
+func solid(m *render.TextureManager, c color.Color) *render.Texture {
+  img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+  img.Set(0, 0, c)
+  return m.LoadImage(img, render.TextureOptions{Filter: render.Nearest})
+}
+
+func BatchSpec(c gospec.Context) {
+  render.Init()
+  render_thread.RLock()
+  defer render_thread.RUnlock()
+  soft := render.MakeSoftRenderer()
+  m := render.MakeTextureManager(soft)
+  b := render.MakeBatch(soft)
+  tex := m.LoadImage(checker(), render.TextureOptions{Filter: render.Nearest})
+  red_tex := solid(m, color.RGBA{255, 0, 0, 255})
+  blue_tex := solid(m, color.RGBA{0, 0, 255, 255})
+  render.Purge()
+
+  c.Specify("Batched drawing looks the same as drawing directly", func() {
+    drawScene(b, tex)
+    b.Flush()
+    c.Expect(render.CompareGolden(soft.Image(), "testdata/scene.png"), Equals, nil)
+  })
+
+  c.Specify("Quads that don't overlap are drawn together by texture", func() {
+    b.Begin(render.Rect{Dx: 20, Dy: 2}, black)
+    for i := 0; i < 10; i++ {
+      t := red_tex
+      if i%2 == 1 {
+        t = blue_tex
+      }
+      b.Quad(t, render.Rect{X: float64(2 * i), Dx: 2, Dy: 2}, 0, 0, 1, 1, white)
+    }
+    b.Flush()
+    c.Expect(b.Stats(), Equals, render.BatchStats{Draw_calls: 2, Quads: 10})
+    c.Expect(pixel(soft, 0, 0), Equals, color.NRGBA{255, 0, 0, 255})
+    c.Expect(pixel(soft, 2, 0), Equals, color.NRGBA{0, 0, 255, 255})
+    c.Expect(pixel(soft, 19, 1), Equals, color.NRGBA{0, 0, 255, 255})
+  })
+
+  c.Specify("Quads that overlap are drawn in the order they were submitted", func() {
+    b.Begin(render.Rect{Dx: 4, Dy: 4}, black)
+    b.Quad(red_tex, render.Rect{Dx: 3, Dy: 3}, 0, 0, 1, 1, white)
+    b.Quad(blue_tex, render.Rect{X: 1, Y: 1, Dx: 3, Dy: 3}, 0, 0, 1, 1, white)
+    b.Quad(red_tex, render.Rect{X: 2, Y: 2, Dx: 1, Dy: 1}, 0, 0, 1, 1, white)
+    b.Flush()
+    c.Expect(b.Stats().Draw_calls, Equals, 3)
+    c.Expect(pixel(soft, 0, 0).R, Equals, uint8(255))
+    c.Expect(pixel(soft, 1, 1).B, Equals, uint8(255))
+    c.Expect(pixel(soft, 2, 2).R, Equals, uint8(255))
+  })
+
+  c.Specify("Higher z is drawn on top regardless of order", func() {
+    b.Begin(render.Rect{Dx: 4, Dy: 4}, black)
+    b.SetZ(1)
+    b.Quad(red_tex, render.Rect{Dx: 2, Dy: 2}, 0, 0, 1, 1, white)
+    b.SetZ(0)
+    b.Quad(blue_tex, render.Rect{Dx: 4, Dy: 4}, 0, 0, 1, 1, white)
+    b.Flush()
+    c.Expect(pixel(soft, 0, 0).R, Equals, uint8(255))
+    c.Expect(pixel(soft, 3, 3).B, Equals, uint8(255))
+  })
+
+  c.Specify("Additive blending adds to what is under it", func() {
+    b.Begin(render.Rect{Dx: 2, Dy: 2}, black)
+    b.FillRect(render.Rect{Dx: 2, Dy: 2}, render.Color{R: 0.5, A: 1})
+    b.SetBlend(render.AdditiveBlend)
+    b.FillRect(render.Rect{Dx: 1, Dy: 1}, render.Color{R: 1, G: 1, A: 0.5})
+    b.Flush()
+    c.Expect(pixel(soft, 0, 0), Equals, color.NRGBA{255, 128, 0, 255})
+    c.Expect(pixel(soft, 1, 1), Equals, color.NRGBA{128, 0, 0, 255})
+  })
+
+  c.Specify("Clipped quads and lines are drawn inside of their clip rect", func() {
+    b.Begin(render.Rect{Dx: 8, Dy: 8}, black)
+    b.PushClip(render.Rect{X: 2, Y: 2, Dx: 4, Dy: 4})
+    b.Quad(tex, render.Rect{Dx: 8, Dy: 8}, 0, 1, 1, 0, white)
+    b.Line(0, 0.5, 8, 0.5, red)
+    b.Line(0, 3.5, 8, 3.5, red)
+    b.PopClip()
+    b.Flush()
+    c.Expect(b.Stats(), Equals, render.BatchStats{Draw_calls: 2, Quads: 1, Lines: 2})
+    // The checker is white in the top left and bottom right quarters
+    c.Expect(pixel(soft, 2, 5).G, Equals, uint8(255))
+    c.Expect(pixel(soft, 1, 5).G, Equals, uint8(0))
+    c.Expect(pixel(soft, 5, 2).G, Equals, uint8(255))
+    c.Expect(pixel(soft, 6, 2).G, Equals, uint8(0))
+    c.Expect(pixel(soft, 5, 1).G, Equals, uint8(0))
+    c.Expect(pixel(soft, 3, 0).R, Equals, uint8(0))
+    c.Expect(pixel(soft, 1, 3).R, Equals, uint8(0))
+    c.Expect(pixel(soft, 3, 3), Equals, color.NRGBA{255, 0, 0, 255})
+    c.Expect(pixel(soft, 5, 3), Equals, color.NRGBA{255, 0, 0, 255})
+  })
+
+  c.Specify("Flushing leaves the target with the current transform and clip rect", func() {
+    b.Begin(render.Rect{Dx: 8, Dy: 8}, black)
+    b.PushTransform()
+    b.Translate(2, 2)
+    b.PushClip(render.Rect{Dx: 2, Dy: 2})
+    b.FillRect(render.Rect{Dx: 1, Dy: 1}, red)
+    b.Flush()
+    // As if drawn with OpenGL while the Batch is the current Renderer
+    soft.FillRect(render.Rect{Dx: 4, Dy: 4}, white)
+    b.PopClip()
+    b.PopTransform()
+    b.FillRect(render.Rect{Dx: 1, Dy: 1}, red)
+    b.Flush()
+    soft.FillRect(render.Rect{X: 7, Y: 7, Dx: 1, Dy: 1}, white)
+    c.Expect(pixel(soft, 0, 0), Equals, color.NRGBA{255, 0, 0, 255})
+    c.Expect(pixel(soft, 1, 1), Equals, color.NRGBA{0, 0, 0, 255})
+    c.Expect(pixel(soft, 2, 2), Equals, color.NRGBA{255, 255, 255, 255})
+    c.Expect(pixel(soft, 3, 3), Equals, color.NRGBA{255, 255, 255, 255})
+    c.Expect(pixel(soft, 4, 4), Equals, color.NRGBA{0, 0, 0, 255})
+    c.Expect(pixel(soft, 7, 7), Equals, color.NRGBA{255, 255, 255, 255})
+  })
+
+  tex.Release()
+  red_tex.Release()
+  blue_tex.Release()
+  render.Purge()
+}
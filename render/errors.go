@@ -0,0 +1,97 @@
+package render
+
+import (
+  "errors"
+  "fmt"
+  "os"
+  "runtime/debug"
+  "sync"
+)
+
+var (
+  ErrNotStarted = errors.New("The render thread has not been started.")
+  ErrShutdown   = errors.New("The render thread has been shut down.")
+)
+
+// A PanicError is reported when a function run on the render thread panics.
+type PanicError struct {
+  // The value that was passed to panic()
+  Value interface{}
+
+  // Stack trace of the render thread at the time of the panic
+  Stack []byte
+}
+
+func (e *PanicError) Error() string {
+  return fmt.Sprintf("Render function panicked: %v", e.Value)
+}
+
+var (
+  error_mutex   sync.Mutex
+  error_handler func(error) = printError
+  last_error    error
+)
+
+func printError(err error) {
+  if p, ok := err.(*PanicError); ok {
+    fmt.Fprintf(os.Stderr, "%v\n%s", p, p.Stack)
+  } else {
+    fmt.Fprintf(os.Stderr, "%v\n", err)
+  }
+}
+
+// Sets the function that errors on the render thread are reported to, such
+// as a *PanicError when a queued function panics.  The handler is called on
+// the render thread, so it must not wait on the render thread itself.  By
+// default errors are printed to stderr.  A nil handler ignores them.
+func SetErrorHandler(handler func(error)) {
+  error_mutex.Lock()
+  defer error_mutex.Unlock()
+  error_handler = handler
+}
+
+func reportError(err error) {
+  error_mutex.Lock()
+  last_error = err
+  handler := error_handler
+  error_mutex.Unlock()
+  if handler != nil {
+    handler(err)
+  }
+}
+
+// Runs f, turning a panic into a *PanicError that is sent to the error
+// handler so that the render thread keeps running.
+func run(f func()) {
+  defer func() {
+    if r := recover(); r != nil {
+      reportError(&PanicError{Value: r, Stack: debug.Stack()})
+    }
+  }()
+  f()
+}
+
+// Returns nil if the render thread is running and nothing has gone wrong on
+// it.  Otherwise returns ErrNotStarted, ErrShutdown, or the most recent error
+// that was reported on it.  Reported errors are sticky, reading them doesn't
+// clear them, so that anything checking on the render thread sees them.  Use
+// ResetHealth once an error has been dealt with.
+func Health() error {
+  if isStopped() {
+    return ErrShutdown
+  }
+  if !isStarted() {
+    return ErrNotStarted
+  }
+  error_mutex.Lock()
+  defer error_mutex.Unlock()
+  return last_error
+}
+
+// Forgets the errors that have been reported on the render thread, so that
+// Health returns nil again if the render thread is still running.
+func ResetHealth() {
+  error_mutex.Lock()
+  defer error_mutex.Unlock()
+  last_error = nil
+}
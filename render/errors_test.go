@@ -0,0 +1,51 @@
+package render_test
+
+import (
+  "github.com/MobRulesGames/glop/render"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+)
+
+func HealthSpec(c gospec.Context) {
+  render.Init()
+  render_thread.Lock()
+  defer render_thread.Unlock()
+  var reported []error
+  render.SetErrorHandler(func(err error) {
+    reported = append(reported, err)
+  })
+  defer render.SetErrorHandler(nil)
+  render.ResetHealth()
+
+  c.Specify("A running render thread is healthy", func() {
+    c.Expect(render.Health(), IsNil)
+  })
+
+  c.Specify("A panic is reported as a PanicError and the render thread keeps running", func() {
+    render.Queue(func() {
+      panic("oops")
+    })
+    render.Purge()
+    c.Assume(len(reported), Equals, 1)
+    p, ok := reported[0].(*render.PanicError)
+    c.Assume(ok, IsTrue)
+    c.Expect(p.Value, Equals, "oops")
+    c.Expect(len(p.Stack) > 0, IsTrue)
+    c.Expect(render.Health(), Equals, reported[0])
+    c.Expect(render.Health(), Equals, reported[0])
+
+    c.Expect(render.Call(func() int { return 1 }), Equals, 1)
+    render.ResetHealth()
+    c.Expect(render.Health(), IsNil)
+  })
+
+  c.Specify("A panic in Call returns the zero value", func() {
+    v := render.Call(func() string {
+      panic("oops")
+    })
+    c.Expect(v, Equals, "")
+    _, ok := render.Health().(*render.PanicError)
+    c.Expect(ok, IsTrue)
+    render.ResetHealth()
+  })
+}
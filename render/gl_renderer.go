@@ -0,0 +1,244 @@
+package render
+
+import (
+  "github.com/MobRulesGames/gogl/gl21"
+  "github.com/MobRulesGames/opengl/gl"
+  "github.com/MobRulesGames/opengl/glu"
+  "image"
+  "unsafe"
+)
+
+// A GLRenderer draws with the fixed function OpenGL pipeline.
+type GLRenderer struct {
+  stacks
+
+  // Clip plane equations.  This is kept here, rather than declared when the
+  // planes are set, so that it isn't allocated every time that happens.
+  eqs [4][4]float64
+
+  // Vertex buffer used by DrawBatch, made the first time it is needed
+  vbuffer gl21.Uint
+}
+
+func MakeGLRenderer() *GLRenderer {
+  var r GLRenderer
+  r.reset()
+  return &r
+}
+
+func (r *GLRenderer) Begin(view Rect, clear Color) {
+  r.reset()
+  gl.MatrixMode(gl.PROJECTION)
+  gl.LoadIdentity()
+  gl.Ortho(view.X, view.X+view.Dx, view.Y, view.Y+view.Dy, 1000, -1000)
+  gl.ClearColor(gl.GLclampf(clear.R), gl.GLclampf(clear.G), gl.GLclampf(clear.B), gl.GLclampf(clear.A))
+  gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+  gl.MatrixMode(gl.MODELVIEW)
+  gl.LoadIdentity()
+  r.enableClipPlanes(false)
+}
+
+func (r *GLRenderer) PushTransform() {
+  r.pushTransform()
+  gl.PushMatrix()
+}
+
+func (r *GLRenderer) PopTransform() {
+  r.popTransform()
+  gl.PopMatrix()
+}
+
+func (r *GLRenderer) Translate(x, y float64) {
+  r.translate(x, y)
+  gl.Translated(x, y, 0)
+}
+
+func (r *GLRenderer) Scale(x, y float64) {
+  r.scale(x, y)
+  gl.Scaled(x, y, 1)
+}
+
+func (r *GLRenderer) enableClipPlanes(enable bool) {
+  for _, plane := range []gl.GLenum{gl.CLIP_PLANE0, gl.CLIP_PLANE1, gl.CLIP_PLANE2, gl.CLIP_PLANE3} {
+    if enable {
+      gl.Enable(plane)
+    } else {
+      gl.Disable(plane)
+    }
+  }
+}
+
+// Clip rects are kept in view coordinates, so the planes are set with an
+// identity modelview matrix.
+func (r *GLRenderer) setClipPlanes(c Rect) {
+  r.eqs[0][0], r.eqs[0][1], r.eqs[0][2], r.eqs[0][3] = 1, 0, 0, -c.X
+  r.eqs[1][0], r.eqs[1][1], r.eqs[1][2], r.eqs[1][3] = -1, 0, 0, c.X+c.Dx
+  r.eqs[2][0], r.eqs[2][1], r.eqs[2][2], r.eqs[2][3] = 0, 1, 0, -c.Y
+  r.eqs[3][0], r.eqs[3][1], r.eqs[3][2], r.eqs[3][3] = 0, -1, 0, c.Y+c.Dy
+  gl.PushMatrix()
+  gl.LoadIdentity()
+  gl.ClipPlane(gl.CLIP_PLANE0, &r.eqs[0][0])
+  gl.ClipPlane(gl.CLIP_PLANE1, &r.eqs[1][0])
+  gl.ClipPlane(gl.CLIP_PLANE2, &r.eqs[2][0])
+  gl.ClipPlane(gl.CLIP_PLANE3, &r.eqs[3][0])
+  gl.PopMatrix()
+}
+
+func (r *GLRenderer) PushClip(c Rect) {
+  if len(r.clips) == 0 {
+    r.enableClipPlanes(true)
+  }
+  r.setClipPlanes(r.pushClip(c))
+}
+
+func (r *GLRenderer) PopClip() {
+  if c, ok := r.popClip(); ok {
+    r.setClipPlanes(c)
+  } else {
+    r.enableClipPlanes(false)
+  }
+}
+
+func setBlendMode(blend Blend) {
+  gl.Enable(gl.BLEND)
+  if blend == AdditiveBlend {
+    gl.BlendFunc(gl.SRC_ALPHA, gl.ONE)
+  } else {
+    gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+  }
+}
+
+func setBlend(c Color) {
+  setBlendMode(AlphaBlend)
+  gl.Color4d(c.R, c.G, c.B, c.A)
+}
+
+func (r *GLRenderer) FillRect(rect Rect, c Color) {
+  gl.Disable(gl.TEXTURE_2D)
+  setBlend(c)
+  gl.Begin(gl.QUADS)
+  gl.Vertex2d(rect.X, rect.Y)
+  gl.Vertex2d(rect.X, rect.Y+rect.Dy)
+  gl.Vertex2d(rect.X+rect.Dx, rect.Y+rect.Dy)
+  gl.Vertex2d(rect.X+rect.Dx, rect.Y)
+  gl.End()
+}
+
+func (r *GLRenderer) Line(x, y, x2, y2 float64, c Color) {
+  gl.Disable(gl.TEXTURE_2D)
+  setBlend(c)
+  gl.Begin(gl.LINES)
+  gl.Vertex2d(x, y)
+  gl.Vertex2d(x2, y2)
+  gl.End()
+}
+
+func (r *GLRenderer) Quad(t *Texture, rect Rect, u, v, u2, v2 float64, c Color) {
+  gl.Enable(gl.TEXTURE_2D)
+  t.Bind()
+  setBlend(c)
+  gl.Begin(gl.QUADS)
+  gl.TexCoord2d(u, v)
+  gl.Vertex2d(rect.X, rect.Y)
+  gl.TexCoord2d(u, v2)
+  gl.Vertex2d(rect.X, rect.Y+rect.Dy)
+  gl.TexCoord2d(u2, v2)
+  gl.Vertex2d(rect.X+rect.Dx, rect.Y+rect.Dy)
+  gl.TexCoord2d(u2, v)
+  gl.Vertex2d(rect.X+rect.Dx, rect.Y)
+  gl.End()
+  gl.Disable(gl.TEXTURE_2D)
+}
+
+// The *Pointer functions take an offset into the bound buffer disguised as a
+// pointer.  go vet reports converting a uintptr straight to a pointer, so
+// the offset is copied into one instead, only OpenGL ever looks at it.
+func bufferOffset(offset uintptr) gl21.Pointer {
+  return *(*gl21.Pointer)(unsafe.Pointer(&offset))
+}
+
+// Uploads every vertex into one buffer and draws each run with a single call.
+func (r *GLRenderer) DrawBatch(verts []Vertex, runs []BatchRun) {
+  if len(verts) == 0 {
+    return
+  }
+  if r.vbuffer == 0 {
+    gl21.GenBuffers(1, &r.vbuffer)
+  }
+  size := unsafe.Sizeof(Vertex{})
+  gl21.BindBuffer(gl21.ARRAY_BUFFER, r.vbuffer)
+  gl21.BufferData(gl21.ARRAY_BUFFER, gl21.Sizeiptr(int(size)*len(verts)), gl21.Pointer(&verts[0].X), gl21.STREAM_DRAW)
+
+  gl21.EnableClientState(gl21.VERTEX_ARRAY)
+  gl21.VertexPointer(2, gl21.FLOAT, gl21.Sizei(size), nil)
+  gl21.EnableClientState(gl21.TEXTURE_COORD_ARRAY)
+  gl21.TexCoordPointer(2, gl21.FLOAT, gl21.Sizei(size), bufferOffset(unsafe.Offsetof(verts[0].U)))
+  gl21.EnableClientState(gl21.COLOR_ARRAY)
+  gl21.ColorPointer(4, gl21.FLOAT, gl21.Sizei(size), bufferOffset(unsafe.Offsetof(verts[0].R)))
+
+  for _, run := range runs {
+    if run.State.Texture != nil {
+      gl.Enable(gl.TEXTURE_2D)
+      run.State.Texture.Bind()
+    } else {
+      gl.Disable(gl.TEXTURE_2D)
+    }
+    setBlendMode(run.State.Blend)
+    if run.State.Clipped {
+      r.PushClip(run.State.Clip)
+    }
+    mode := gl21.Enum(gl21.QUADS)
+    if run.State.Primitive == Lines {
+      mode = gl21.LINES
+    }
+    gl21.DrawArrays(mode, gl21.Int(run.First), gl21.Sizei(run.Count))
+    if run.State.Clipped {
+      r.PopClip()
+    }
+  }
+
+  gl21.DisableClientState(gl21.VERTEX_ARRAY)
+  gl21.DisableClientState(gl21.TEXTURE_COORD_ARRAY)
+  gl21.DisableClientState(gl21.COLOR_ARRAY)
+  gl21.BindBuffer(gl21.ARRAY_BUFFER, 0)
+  gl.Disable(gl.TEXTURE_2D)
+}
+
+func (r *GLRenderer) UploadTexture(t *Texture, rgba *image.RGBA) {
+  if t.id == 0 {
+    t.id = gl.GenTexture()
+  }
+  gl.Enable(gl.TEXTURE_2D)
+  t.id.Bind(gl.TEXTURE_2D)
+  gl.TexEnvf(gl.TEXTURE_ENV, gl.TEXTURE_ENV_MODE, gl.MODULATE)
+  min, mag := gl.LINEAR, gl.LINEAR
+  if t.opts.Filter == Nearest {
+    min, mag = gl.NEAREST, gl.NEAREST
+  }
+  if t.opts.Mipmaps {
+    min = gl.LINEAR_MIPMAP_LINEAR
+    if t.opts.Filter == Nearest {
+      min = gl.NEAREST_MIPMAP_NEAREST
+    }
+  }
+  gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, float32(min))
+  gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, float32(mag))
+  wrap := gl.REPEAT
+  if t.opts.Clamp {
+    wrap = gl.CLAMP_TO_EDGE
+  }
+  gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, float32(wrap))
+  gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, float32(wrap))
+  dx, dy := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+  if t.opts.Mipmaps {
+    glu.Build2DMipmaps(gl.TEXTURE_2D, 4, dx, dy, gl.RGBA, rgba.Pix)
+  } else {
+    gl.TexImage2D(gl.TEXTURE_2D, 0, 4, dx, dy, 0, gl.RGBA, gl.UNSIGNED_BYTE, rgba.Pix)
+  }
+  gl.Disable(gl.TEXTURE_2D)
+}
+
+func (r *GLRenderer) DeleteTexture(t *Texture) {
+  t.id.Delete()
+  t.id = 0
+}
@@ -0,0 +1,44 @@
+package render
+
+import (
+  "fmt"
+  "image"
+  "image/color"
+  "image/png"
+  "os"
+)
+
+// Compares img with the PNG at path, for golden image tests.  If the
+// environment variable GLOP_UPDATE_GOLDEN is set img is written to path
+// instead, which is how golden images are made in the first place.
+func CompareGolden(img *image.NRGBA, path string) error {
+  if os.Getenv("GLOP_UPDATE_GOLDEN") != "" {
+    f, err := os.Create(path)
+    if err != nil {
+      return err
+    }
+    defer f.Close()
+    return png.Encode(f, img)
+  }
+  f, err := os.Open(path)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+  golden, err := png.Decode(f)
+  if err != nil {
+    return err
+  }
+  if golden.Bounds() != img.Bounds() {
+    return fmt.Errorf("Image is %v but golden image %s is %v.", img.Bounds(), path, golden.Bounds())
+  }
+  b := img.Bounds()
+  for y := b.Min.Y; y < b.Max.Y; y++ {
+    for x := b.Min.X; x < b.Max.X; x++ {
+      if img.NRGBAAt(x, y) != color.NRGBAModel.Convert(golden.At(x, y)) {
+        return fmt.Errorf("Image differs from golden image %s at %d,%d.", path, x, y)
+      }
+    }
+  }
+  return nil
+}
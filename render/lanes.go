@@ -0,0 +1,275 @@
+package render
+
+import (
+  "errors"
+  "fmt"
+  "sync"
+  "time"
+)
+
+// Functions on the render thread are run in order of priority: everything
+// in the Immediate lane runs before anything in the Frame lane, which runs
+// before anything in the Background lane.  Within a lane functions run in the
+// order that they were queued.
+type Priority int
+
+const (
+  // For work that something is blocked on and that must not wait behind a
+  // frame, like a pixel readback.
+  Immediate Priority = iota
+
+  // For drawing and anything else that is part of the current frame.  This
+  // is the lane that Queue uses.
+  Frame
+
+  // For work that can be spread out over several frames, like texture
+  // uploads.  Background work is limited by the frame budget.
+  Background
+
+  num_priorities
+)
+
+func (p Priority) String() string {
+  switch p {
+  case Immediate:
+    return "immediate"
+  case Frame:
+    return "frame"
+  case Background:
+    return "background"
+  }
+  return fmt.Sprintf("priority %d", int(p))
+}
+
+var ErrQueueFull = errors.New("The render queue is full.")
+
+// Default number of functions that can be waiting in a lane before it is
+// considered full.
+const default_lane_limit = 1000
+
+// A function waiting to be run, along with what is needed to keep stats on
+// it.
+type item struct {
+  f      func()
+  tag    string
+  p      Priority
+  queued time.Time
+
+  // Set if something is blocked until f has run
+  waited bool
+}
+
+type lane struct {
+  items []item
+  limit int
+
+  // Set once the lane has gone over its limit, so that it is only reported
+  // once each time that happens.
+  full bool
+
+  // Number of items in the lane that something is waiting on
+  waiting int
+}
+
+var (
+  lanes_mutex sync.Mutex
+  lanes       [num_priorities]lane
+
+  // Signals the render thread that something was queued or that the frame
+  // budget was reset.
+  wake chan bool
+
+  // Time that background work is allowed to take each frame, zero for no
+  // limit, and the time that it has taken so far this frame.
+  frame_budget time.Duration
+  spent        time.Duration
+)
+
+func init() {
+  wake = make(chan bool, 1)
+  for i := range lanes {
+    lanes[i].limit = default_lane_limit
+  }
+}
+
+func signal() {
+  select {
+  case wake <- true:
+  default:
+  }
+}
+
+func validPriority(p Priority) {
+  if p < 0 || p >= num_priorities {
+    panic(fmt.Sprintf("Invalid render priority %d.", p))
+  }
+}
+
+// Adds f to the lane for p, tagged with tag.  Returns ErrShutdown if the
+// render thread has been shut down, and ErrQueueFull if the lane is over its
+// limit, in which case f is only added if force is true.
+func enqueue(p Priority, tag string, f func(), force bool) error {
+  return enqueueItem(item{f: f, tag: tag, p: p}, force)
+}
+
+// Like enqueue, but takes an item with everything but its queued time filled
+// in.
+func enqueueItem(it item, force bool) error {
+  p := it.p
+  validPriority(p)
+  if isStopped() {
+    return ErrShutdown
+  }
+  lanes_mutex.Lock()
+  l := &lanes[p]
+  var err error
+  if len(l.items) >= l.limit {
+    err = ErrQueueFull
+  }
+  if err == nil || force {
+    it.queued = time.Now()
+    l.items = append(l.items, it)
+    if it.waited {
+      l.waiting++
+    }
+  }
+  report := err != nil && force && !l.full
+  if err != nil {
+    l.full = true
+  }
+  lanes_mutex.Unlock()
+  signal()
+  if report {
+    reportError(ErrQueueFull)
+  }
+  return err
+}
+
+// Removes and returns the next function that should be run.  Returns false
+// if there isn't one.  Background work is only returned if there is budget
+// left this frame, unless ignore_budget is true or something is waiting on
+// it, or on background work queued after it.  Only lanes up to max are
+// considered.
+func next(max Priority, ignore_budget bool) (item, bool) {
+  lanes_mutex.Lock()
+  defer lanes_mutex.Unlock()
+  for p := Immediate; p <= max; p++ {
+    l := &lanes[p]
+    if len(l.items) == 0 {
+      continue
+    }
+    if p == Background && !ignore_budget && l.waiting == 0 && frame_budget > 0 && spent >= frame_budget {
+      return item{}, false
+    }
+    it := l.items[0]
+    l.items[0] = item{}
+    l.items = l.items[1:]
+    if it.waited {
+      l.waiting--
+    }
+    if len(l.items) < l.limit {
+      l.full = false
+    }
+    return it, true
+  }
+  return item{}, false
+}
+
+// Returns the number of functions waiting in every lane.
+func depth() int {
+  lanes_mutex.Lock()
+  defer lanes_mutex.Unlock()
+  total := 0
+  for i := range lanes {
+    total += len(lanes[i].items)
+  }
+  return total
+}
+
+// Runs it and records stats about it, charging the time it takes against the
+// frame budget if it is background work.
+func runItem(it item) {
+  start := time.Now()
+  run(it.f)
+  end := time.Now()
+  if it.p == Background {
+    lanes_mutex.Lock()
+    spent += end.Sub(start)
+    lanes_mutex.Unlock()
+  }
+  record(CallRecord{
+    Tag:      it.tag,
+    Priority: it.p,
+    Queued:   it.queued,
+    Start:    start,
+    Wait:     start.Sub(it.queued),
+    Run:      end.Sub(start),
+    Depth:    depth(),
+  })
+}
+
+// Runs queued functions up to priority max until there are none left that
+// can be run.
+func drainLanes(max Priority, ignore_budget bool) {
+  for {
+    it, ok := next(max, ignore_budget)
+    if !ok {
+      return
+    }
+    runItem(it)
+  }
+}
+
+// Sets how much time background work may take on the render thread each
+// frame.  Once the budget is used up the rest of the background work waits
+// for the next frame, which starts on every call to Purge or EndFrame.  Work
+// queued with QueueWaitAt isn't held back, since something is blocked on it.
+// A budget of zero, the default, means background work is not limited.
+func SetFrameBudget(budget time.Duration) {
+  lanes_mutex.Lock()
+  frame_budget = budget
+  lanes_mutex.Unlock()
+  signal()
+}
+
+// Marks the end of a frame, which resets the background budget.  Purge does
+// this as well, so this only needs to be called by code that doesn't purge
+// every frame.
+func EndFrame() {
+  lanes_mutex.Lock()
+  spent = 0
+  lanes_mutex.Unlock()
+  endFrameStats()
+  signal()
+}
+
+// Sets the number of functions that can be waiting in the lane for p before
+// it counts as full.
+func SetQueueLimit(p Priority, limit int) {
+  validPriority(p)
+  lanes_mutex.Lock()
+  lanes[p].limit = limit
+  lanes_mutex.Unlock()
+}
+
+// Returns the number of functions waiting in the lane for p.
+func Pending(p Priority) int {
+  validPriority(p)
+  lanes_mutex.Lock()
+  defer lanes_mutex.Unlock()
+  return len(lanes[p].items)
+}
+
+// Returns true if any lane is at or over its limit.  Code that queues a lot
+// of optional work, like preloading, can check this and hold off until the
+// render thread has caught up.
+func Backlogged() bool {
+  lanes_mutex.Lock()
+  defer lanes_mutex.Unlock()
+  for i := range lanes {
+    if len(lanes[i].items) >= lanes[i].limit {
+      return true
+    }
+  }
+  return false
+}
@@ -0,0 +1,125 @@
+package render_test
+
+import (
+  "github.com/MobRulesGames/glop/render"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+  "sync"
+  "time"
+)
+
+// Every spec shares the render thread.  Specs that change how it behaves,
+// by blocking it or by changing its limits, frame budget or error handler,
+// hold this for writing so that they run alone, and every other spec that
+// uses the render thread holds it for reading.
+var render_thread sync.RWMutex
+
+// Keeps the render thread busy until the returned channel is closed.
+func blockRenderThread() chan bool {
+  started := make(chan bool)
+  release := make(chan bool)
+  render.Queue(func() {
+    close(started)
+    <-release
+  })
+  <-started
+  return release
+}
+
+// Returns true if done is closed within a second.
+func finishes(done chan bool) bool {
+  select {
+  case <-done:
+    return true
+  case <-time.After(time.Second):
+    return false
+  }
+}
+
+func LaneSpec(c gospec.Context) {
+  render.Init()
+  render_thread.Lock()
+  defer render_thread.Unlock()
+  render.SetErrorHandler(nil)
+  defer render.ResetHealth()
+
+  c.Specify("Lanes run in order of priority, and in order within a lane", func() {
+    release := blockRenderThread()
+    var order []string
+    add := func(p render.Priority, name string) {
+      render.QueueAt(p, func() {
+        order = append(order, name)
+      })
+    }
+    add(render.Background, "background")
+    add(render.Frame, "frame 1")
+    add(render.Immediate, "immediate 1")
+    add(render.Frame, "frame 2")
+    add(render.Immediate, "immediate 2")
+    close(release)
+    render.Purge()
+    c.Expect(order, ContainsInOrder, []string{"immediate 1", "immediate 2", "frame 1", "frame 2", "background"})
+  })
+
+  c.Specify("TryQueue doesn't queue anything once a lane is full", func() {
+    release := blockRenderThread()
+    render.SetQueueLimit(render.Frame, 2)
+    defer render.SetQueueLimit(render.Frame, 1000) // The default
+    ran := 0
+    f := func() {
+      ran++
+    }
+    c.Expect(render.TryQueue(render.Frame, f), IsNil)
+    c.Expect(render.Backlogged(), IsFalse)
+    c.Expect(render.TryQueue(render.Frame, f), IsNil)
+    c.Expect(render.Backlogged(), IsTrue)
+    c.Expect(render.TryQueue(render.Frame, f), Equals, render.ErrQueueFull)
+    c.Expect(render.Pending(render.Frame), Equals, 2)
+    c.Expect(render.TryQueue(render.Immediate, f), IsNil)
+    close(release)
+    render.Purge()
+    c.Expect(ran, Equals, 3)
+    c.Expect(render.Backlogged(), IsFalse)
+  })
+
+  c.Specify("Background work over the frame budget waits for the next frame", func() {
+    render.SetFrameBudget(time.Millisecond)
+    defer render.SetFrameBudget(0)
+    render.EndFrame()
+    release := blockRenderThread()
+    first := make(chan bool)
+    second := make(chan bool)
+    render.QueueAt(render.Background, func() {
+      time.Sleep(2 * time.Millisecond)
+      close(first)
+    })
+    render.QueueAt(render.Background, func() {
+      close(second)
+    })
+    close(release)
+    c.Assume(finishes(first), IsTrue)
+    // The budget is charged before the render thread looks for more work
+    c.Expect(render.Call(func() int { return render.Pending(render.Background) }), Equals, 1)
+    render.EndFrame()
+    c.Expect(finishes(second), IsTrue)
+  })
+
+  c.Specify("Background work that is waited on isn't held back by the budget", func() {
+    render.SetFrameBudget(time.Millisecond)
+    defer render.SetFrameBudget(0)
+    render.EndFrame()
+    first := make(chan bool)
+    render.QueueAt(render.Background, func() {
+      time.Sleep(2 * time.Millisecond)
+      close(first)
+    })
+    c.Assume(finishes(first), IsTrue)
+    ran := make(chan bool)
+    render.QueueAt(render.Background, func() {})
+    go render.QueueWaitAt(render.Background, func() {
+      close(ran)
+    })
+    c.Expect(finishes(ran), IsTrue)
+    c.Expect(render.Pending(render.Background), Equals, 0)
+  })
+}
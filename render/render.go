@@ -3,51 +3,258 @@ package render
 import (
   "runtime"
   "sync"
+  "sync/atomic"
 )
 
 var (
-  render_funcs chan func()
   purge chan bool
+  shutdown chan bool
   init_once sync.Once
+
+  // Id of the OS thread that the render thread is locked to, zero until Init
+  // is called
+  render_thread uint64
+
+  // Closed once the render thread has stopped
+  stopped   chan bool
+  stop_once sync.Once
+
+  // Set when Shutdown is called from the render thread itself
+  stop_requested int32
 )
 
 func init() {
-  render_funcs = make(chan func(), 1000)
   purge = make(chan bool)
+  shutdown = make(chan bool)
+  stopped = make(chan bool)
+}
+
+func isStarted() bool {
+  return atomic.LoadUint64(&render_thread) != 0
 }
 
-// Queues a function to run on the render thread
+func isStopped() bool {
+  select {
+  case <-stopped:
+    return true
+  default:
+    return false
+  }
+}
+
+// Queues a function to run on the render thread in the Frame lane.
 func Queue(f func()) {
-  render_funcs <- f
+  QueueAt(Frame, f)
+}
+
+// Queues a function to run on the render thread in the lane for p.  This
+// never blocks.  If the lane is over its limit f is queued anyway and
+// ErrQueueFull is sent to the error handler, use TryQueue to avoid that.
+// Functions queued after Shutdown are dropped and ErrShutdown is sent to the
+// error handler.
+func QueueAt(p Priority, f func()) {
+  QueueNamedAt(p, "", f)
+}
+
+// Queues a function to run on the render thread in the Frame lane, tagged
+// with tag so that the time it takes shows up under that name in Stats and
+// traces.
+func QueueNamed(tag string, f func()) {
+  QueueNamedAt(Frame, tag, f)
+}
+
+// Like QueueNamed, but queues f in the lane for p.
+func QueueNamedAt(p Priority, tag string, f func()) {
+  if enqueue(p, tag, f, true) == ErrShutdown {
+    reportError(ErrShutdown)
+  }
+}
+
+// Queues a function to run on the render thread in the lane for p, unless
+// the lane is over its limit, in which case ErrQueueFull is returned and f is
+// not queued.  Returns ErrShutdown if the render thread has been shut down.
+func TryQueue(p Priority, f func()) error {
+  return enqueue(p, "", f, false)
+}
+
+// Returns true if the caller is running on the render thread.  The render
+// thread is locked to its OS thread, and no other goroutine runs on an OS
+// thread while it is locked, so the OS thread that the caller is on is
+// enough to tell.
+func OnRenderThread() bool {
+  id := atomic.LoadUint64(&render_thread)
+  return id != 0 && id == threadId()
+}
+
+// Runs f on the render thread and waits until it has finished.  If this is
+// called from the render thread f is run immediately, since waiting for it
+// would deadlock.
+func QueueWait(f func()) {
+  QueueWaitAt(Frame, f)
 }
 
-// Waits until all render thread functions have been run
+// Like QueueWait, but runs f in the lane for p.  Since the caller is blocked
+// until f has run, a Background f, along with the background work queued
+// ahead of it, is run even if the frame budget has been used up.
+func QueueWaitAt(p Priority, f func()) {
+  if OnRenderThread() {
+    f()
+    return
+  }
+  done := make(chan bool)
+  err := enqueueItem(item{
+    f: func() {
+      defer close(done)
+      f()
+    },
+    p:      p,
+    waited: true,
+  }, true)
+  if err == ErrShutdown {
+    return
+  }
+  // If the render thread is shut down f might never run
+  select {
+  case <-done:
+  case <-stopped:
+  }
+}
+
+// Runs f on the render thread and returns its result, for things like
+// generating a texture id or reading back pixels.  Like QueueWait this runs f
+// immediately when called from the render thread.  If f panics, or never
+// runs because the render thread was shut down, the zero value is returned.
+func Call[T any](f func() T) T {
+  var v T
+  QueueWait(func() {
+    v = f()
+  })
+  return v
+}
+
+// A Future holds the result of a function that was queued with Async.
+type Future[T any] struct {
+  done  chan bool
+  value T
+}
+
+// Queues f to run on the render thread in the Frame lane and returns a
+// Future for its result without waiting.  When called from the render thread
+// f is run immediately and the Future is already done.  If f panics, or
+// never runs because the render thread was shut down, the Future holds the
+// zero value.
+func Async[T any](f func() T) *Future[T] {
+  future := &Future[T]{done: make(chan bool)}
+  run := func() {
+    defer close(future.done)
+    future.value = f()
+  }
+  if OnRenderThread() {
+    run()
+  } else if enqueue(Frame, "", run, true) == ErrShutdown {
+    close(future.done)
+  }
+  return future
+}
+
+// Waits until the function has run on the render thread and returns its
+// result.
+func (f *Future[T]) Wait() T {
+  select {
+  case <-f.done:
+  case <-stopped:
+  }
+  return f.value
+}
+
+// Returns true if the function has already run, without blocking.
+func (f *Future[T]) Done() bool {
+  select {
+  case <-f.done:
+    return true
+  case <-stopped:
+    return true
+  default:
+    return false
+  }
+}
+
+// Runs everything in the Immediate and Frame lanes, and as much background
+// work as the frame budget allows, then starts a new frame.
+func purgeFrame() {
+  drainLanes(Background, false)
+  EndFrame()
+}
+
+// Waits until all Immediate and Frame functions have been run, along with as
+// much Background work as the frame budget allows, and then starts a new
+// frame.  Returns immediately if the render thread has been shut down, and
+// when called from the render thread runs the queued functions itself.
 func Purge() {
-  purge <- true
-  <-purge
+  if OnRenderThread() {
+    purgeFrame()
+    return
+  }
+  select {
+  case purge <- true:
+  case <-stopped:
+    return
+  }
+  select {
+  case <-purge:
+  case <-stopped:
+  }
+}
+
+// Runs everything that has been queued, regardless of the frame budget, and
+// then stops the render thread.
+// Anything queued afterwards is dropped.  When called from the render thread
+// the thread stops once the current function returns.
+func Shutdown() {
+  if !isStarted() {
+    stop_once.Do(func() { close(stopped) })
+    return
+  }
+  if OnRenderThread() {
+    atomic.StoreInt32(&stop_requested, 1)
+    return
+  }
+  select {
+  case shutdown <- true:
+  case <-stopped:
+  }
+  <-stopped
 }
 
+// Starts the render thread, and returns once it is running.
 func Init() {
   init_once.Do(func() {
+    if isStopped() {
+      return
+    }
+    started := make(chan bool)
     go func() {
       runtime.LockOSThread()
-      for {
+      atomic.StoreUint64(&render_thread, threadId())
+      close(started)
+      defer stop_once.Do(func() { close(stopped) })
+      for atomic.LoadInt32(&stop_requested) == 0 {
+        if it, ok := next(Background, false); ok {
+          runItem(it)
+          continue
+        }
         select {
-          case f := <-render_funcs:
-            f()
-          case <-purge:
-            for {
-              select {
-                case f := <-render_funcs:
-                  f()
-                default:
-                goto purged
-              }
-            }
-            purged:
-            purge <- true
+        case <-wake:
+        case <-purge:
+          purgeFrame()
+          purge <- true
+        case <-shutdown:
+          drainLanes(Background, true)
+          return
         }
       }
-    } ()
+      drainLanes(Background, true)
+    }()
+    <-started
   })
 }
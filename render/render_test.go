@@ -0,0 +1,51 @@
+package render_test
+
+import (
+  "github.com/MobRulesGames/glop/render"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+)
+
+func CallSpec(c gospec.Context) {
+  render.Init()
+  render_thread.RLock()
+  defer render_thread.RUnlock()
+
+  c.Specify("Call runs its function on the render thread and returns its result", func() {
+    c.Expect(render.OnRenderThread(), IsFalse)
+    on_thread := render.Call(func() bool {
+      return render.OnRenderThread()
+    })
+    c.Expect(on_thread, IsTrue)
+  })
+
+  c.Specify("Call can be nested without deadlocking", func() {
+    v := render.Call(func() int {
+      return render.Call(func() int {
+        return 3
+      }) + 1
+    })
+    c.Expect(v, Equals, 4)
+  })
+
+  c.Specify("Futures hold the result once the function has run", func() {
+    release := make(chan bool)
+    render.Queue(func() {
+      <-release
+    })
+    future := render.Async(func() int {
+      return 7
+    })
+    c.Expect(future.Done(), IsFalse)
+    close(release)
+    c.Expect(future.Wait(), Equals, 7)
+    c.Expect(future.Done(), IsTrue)
+  })
+
+  c.Specify("Async from the render thread is done right away", func() {
+    done := render.Call(func() bool {
+      return render.Async(func() int { return 1 }).Done()
+    })
+    c.Expect(done, IsTrue)
+  })
+}
@@ -0,0 +1,197 @@
+package render
+
+import (
+  "image"
+  "math"
+  "sync"
+)
+
+// A Rect is an axis aligned rectangle.  X and Y are its bottom left corner,
+// since y increases upwards.
+type Rect struct {
+  X, Y, Dx, Dy float64
+}
+
+// Returns the overlap of r and s, which has zero area if they don't
+// overlap.
+func (r Rect) Isect(s Rect) Rect {
+  x := math.Max(r.X, s.X)
+  y := math.Max(r.Y, s.Y)
+  x2 := math.Min(r.X+r.Dx, s.X+s.Dx)
+  y2 := math.Min(r.Y+r.Dy, s.Y+s.Dy)
+  if x2 < x {
+    x2 = x
+  }
+  if y2 < y {
+    y2 = y
+  }
+  return Rect{x, y, x2 - x, y2 - y}
+}
+
+// A Color with straight, not premultiplied, alpha.  Each component is in the
+// range [0, 1].
+type Color struct {
+  R, G, B, A float64
+}
+
+// A Renderer draws textured quads, rects and lines.  Everything is alpha
+// blended, and textures are modulated by the color they are drawn with.
+// Apart from a software renderer used for testing, Renderers must only be
+// used from the render thread.
+type Renderer interface {
+  // Starts a frame showing the area view, which covers the whole target,
+  // and clears it to clear.  This resets the transform and clip stacks.
+  Begin(view Rect, clear Color)
+
+  // Saves and restores the current transform.  Translate and Scale apply to
+  // everything drawn afterwards, including clip rects.
+  PushTransform()
+  PopTransform()
+  Translate(x, y float64)
+  Scale(x, y float64)
+
+  // Restricts drawing to r, intersected with the current clip rect, until
+  // the matching PopClip.
+  PushClip(r Rect)
+  PopClip()
+
+  FillRect(r Rect, c Color)
+
+  // Draws a one pixel wide line from x,y to x2,y2.
+  Line(x, y, x2, y2 float64, c Color)
+
+  // Draws t over r.  u,v are the texture coordinates at the bottom left
+  // corner of r and u2,v2 are the ones at the top right.
+  Quad(t *Texture, r Rect, u, v, u2, v2 float64, c Color)
+
+  // Called by the texture manager to give a texture its pixels, or to get
+  // rid of them once the texture has been released.  rgba belongs to the
+  // caller and may be reused as soon as UploadTexture returns, so anything
+  // that keeps the pixels around has to copy them.
+  UploadTexture(t *Texture, rgba *image.RGBA)
+  DeleteTexture(t *Texture)
+}
+
+var (
+  renderer_mutex   sync.RWMutex
+  current_renderer Renderer = MakeGLRenderer()
+)
+
+// Returns the Renderer that everything in glop draws with, normally the
+// OpenGL one.
+func Current() Renderer {
+  renderer_mutex.RLock()
+  defer renderer_mutex.RUnlock()
+  return current_renderer
+}
+
+// Makes r the renderer that everything draws with.  If r draws somewhere
+// else than the old renderer did every texture is deleted from the old one
+// and uploaded to r, so this should be done before anything is drawn, for
+// example a test can switch to a SoftRenderer before making any widgets.
+// Switching to or from a Batch that wraps the current renderer moves
+// nothing.
+func SetRenderer(r Renderer) {
+  renderer_mutex.Lock()
+  old := current_renderer
+  current_renderer = r
+  renderer_mutex.Unlock()
+  if underlying(old) != underlying(r) {
+    Textures().reload(old)
+  }
+}
+
+// Renderers that only pass what they draw on to another renderer, like
+// Batch, implement this so that SetRenderer can tell where things end up.
+type wrapper interface {
+  wrapped() Renderer
+}
+
+// Returns the renderer that r finally draws into.
+func underlying(r Renderer) Renderer {
+  for {
+    w, ok := r.(wrapper)
+    if !ok {
+      return r
+    }
+    r = w.wrapped()
+  }
+}
+
+// An affine transform that only translates and scales, which is all that
+// Renderer supports.
+type transform struct {
+  sx, sy, tx, ty float64
+}
+
+func (t transform) apply(x, y float64) (float64, float64) {
+  return x*t.sx + t.tx, y*t.sy + t.ty
+}
+
+func (t transform) applyRect(r Rect) Rect {
+  x, y := t.apply(r.X, r.Y)
+  x2, y2 := t.apply(r.X+r.Dx, r.Y+r.Dy)
+  return Rect{math.Min(x, x2), math.Min(y, y2), math.Abs(x2 - x), math.Abs(y2 - y)}
+}
+
+// The transform and clip stacks, kept in view coordinates, that every
+// Renderer needs.
+type stacks struct {
+  transforms []transform
+  clips      []Rect
+}
+
+func (s *stacks) reset() {
+  s.transforms = append(s.transforms[:0], transform{sx: 1, sy: 1})
+  s.clips = s.clips[:0]
+}
+
+func (s *stacks) top() *transform {
+  return &s.transforms[len(s.transforms)-1]
+}
+
+func (s *stacks) pushTransform() {
+  s.transforms = append(s.transforms, *s.top())
+}
+
+func (s *stacks) popTransform() {
+  if len(s.transforms) <= 1 {
+    panic("Popped more transforms than were pushed.")
+  }
+  s.transforms = s.transforms[:len(s.transforms)-1]
+}
+
+func (s *stacks) translate(x, y float64) {
+  t := s.top()
+  t.tx += x * t.sx
+  t.ty += y * t.sy
+}
+
+func (s *stacks) scale(x, y float64) {
+  t := s.top()
+  t.sx *= x
+  t.sy *= y
+}
+
+// Pushes r, transformed and intersected with the current clip rect, and
+// returns it.
+func (s *stacks) pushClip(r Rect) Rect {
+  r = s.top().applyRect(r)
+  if len(s.clips) > 0 {
+    r = r.Isect(s.clips[len(s.clips)-1])
+  }
+  s.clips = append(s.clips, r)
+  return r
+}
+
+// Pops the current clip rect and returns the one under it, if there is one.
+func (s *stacks) popClip() (Rect, bool) {
+  if len(s.clips) == 0 {
+    panic("Popped more clip rects than were pushed.")
+  }
+  s.clips = s.clips[:len(s.clips)-1]
+  if len(s.clips) == 0 {
+    return Rect{}, false
+  }
+  return s.clips[len(s.clips)-1], true
+}
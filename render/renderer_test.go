@@ -0,0 +1,208 @@
+package render_test
+
+import (
+  "github.com/MobRulesGames/glop/render"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+  "image"
+  "image/color"
+  "sync"
+)
+
+// Specs that change the current renderer hold this so that they don't
+// switch it out from under each other.
+var current_mutex sync.Mutex
+
+var (
+  black = render.Color{A: 1}
+  red   = render.Color{R: 1, A: 1}
+  white = render.Color{R: 1, G: 1, B: 1, A: 1}
+)
+
+// Returns the color of the pixel at x,y counting from the bottom left, the
+// way that everything passed to a Renderer does.
+func pixel(r *render.SoftRenderer, x, y int) color.NRGBA {
+  img := r.Image()
+  return img.NRGBAAt(x, img.Bounds().Dy()-1-y)
+}
+
+// A 2x2 checkerboard, white in the top left and bottom right.
+func checker() image.Image {
+  img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+  img.Set(0, 0, color.White)
+  img.Set(1, 1, color.White)
+  img.Set(1, 0, color.Black)
+  img.Set(0, 1, color.Black)
+  return img
+}
+
+// Draws a scene that uses clipping, transforms, blending, lines and a
+// repeated texture, which is compared with testdata/scene.png.
+func drawScene(r render.Renderer, tex *render.Texture) {
+  r.Begin(render.Rect{Dx: 32, Dy: 24}, render.Color{B: 0.25, A: 1})
+  r.PushClip(render.Rect{X: 2, Y: 2, Dx: 28, Dy: 20})
+  r.FillRect(render.Rect{X: 0, Y: 0, Dx: 16, Dy: 12}, render.Color{G: 0.5, A: 1})
+  r.PushTransform()
+  r.Translate(8, 6)
+  r.Scale(3, 3)
+  r.Quad(tex, render.Rect{Dx: 4, Dy: 4}, 0, 2, 2, 0, render.Color{R: 1, G: 1, A: 0.75})
+  r.PopTransform()
+  r.Line(0, 20.5, 32, 3.5, red)
+  r.PopClip()
+}
+
+func SoftRendererSpec(c gospec.Context) {
+  render.Init()
+  render_thread.RLock()
+  defer render_thread.RUnlock()
+  r := render.MakeSoftRenderer()
+  m := render.MakeTextureManager(r)
+  tex := m.LoadImage(checker(), render.TextureOptions{Filter: render.Nearest})
+  render.Purge()
+
+  c.Specify("FillRect covers pixels whose centers are inside the rect", func() {
+    r.Begin(render.Rect{Dx: 10, Dy: 10}, black)
+    r.FillRect(render.Rect{X: 2, Y: 3, Dx: 4, Dy: 2}, red)
+    c.Expect(pixel(r, 2, 3), Equals, color.NRGBA{255, 0, 0, 255})
+    c.Expect(pixel(r, 5, 4), Equals, color.NRGBA{255, 0, 0, 255})
+    c.Expect(pixel(r, 1, 3), Equals, color.NRGBA{0, 0, 0, 255})
+    c.Expect(pixel(r, 6, 4), Equals, color.NRGBA{0, 0, 0, 255})
+    c.Expect(pixel(r, 2, 5), Equals, color.NRGBA{0, 0, 0, 255})
+  })
+
+  c.Specify("Colors are blended with source alpha", func() {
+    r.Begin(render.Rect{Dx: 4, Dy: 4}, black)
+    r.FillRect(render.Rect{Dx: 4, Dy: 4}, render.Color{R: 1, G: 1, B: 1, A: 0.5})
+    c.Expect(pixel(r, 0, 0).R, Equals, uint8(128))
+  })
+
+  c.Specify("The view offsets everything that is drawn", func() {
+    r.Begin(render.Rect{X: 100, Y: 50, Dx: 10, Dy: 10}, black)
+    r.FillRect(render.Rect{X: 100, Y: 50, Dx: 1, Dy: 1}, red)
+    c.Expect(pixel(r, 0, 0).R, Equals, uint8(255))
+    c.Expect(pixel(r, 1, 1).R, Equals, uint8(0))
+  })
+
+  c.Specify("Clip rects restrict drawing and nest", func() {
+    r.Begin(render.Rect{Dx: 10, Dy: 10}, black)
+    r.PushClip(render.Rect{X: 2, Y: 2, Dx: 6, Dy: 6})
+    r.PushClip(render.Rect{X: 4, Y: 0, Dx: 10, Dy: 10})
+    r.FillRect(render.Rect{Dx: 10, Dy: 10}, red)
+    r.PopClip()
+    c.Expect(pixel(r, 3, 3).R, Equals, uint8(0))
+    c.Expect(pixel(r, 4, 3).R, Equals, uint8(255))
+    c.Expect(pixel(r, 7, 7).R, Equals, uint8(255))
+    c.Expect(pixel(r, 8, 7).R, Equals, uint8(0))
+    r.FillRect(render.Rect{Dx: 10, Dy: 10}, white)
+    r.PopClip()
+    c.Expect(pixel(r, 2, 2).G, Equals, uint8(255))
+    c.Expect(pixel(r, 1, 1).G, Equals, uint8(0))
+  })
+
+  c.Specify("Transforms apply to rects and clip rects", func() {
+    r.Begin(render.Rect{Dx: 10, Dy: 10}, black)
+    r.PushTransform()
+    r.Translate(2, 2)
+    r.Scale(2, 2)
+    r.PushClip(render.Rect{Dx: 2, Dy: 1})
+    r.FillRect(render.Rect{Dx: 3, Dy: 3}, red)
+    r.PopClip()
+    r.PopTransform()
+    r.FillRect(render.Rect{Dx: 1, Dy: 1}, white)
+    c.Expect(pixel(r, 2, 2).R, Equals, uint8(255))
+    c.Expect(pixel(r, 5, 3).R, Equals, uint8(255))
+    c.Expect(pixel(r, 6, 3).R, Equals, uint8(0))
+    c.Expect(pixel(r, 5, 4).R, Equals, uint8(0))
+    c.Expect(pixel(r, 0, 0).G, Equals, uint8(255))
+  })
+
+  c.Specify("Lines leave off their last pixel", func() {
+    r.Begin(render.Rect{Dx: 10, Dy: 10}, black)
+    r.Line(1, 1.5, 5, 1.5, red)
+    c.Expect(pixel(r, 0, 1).R, Equals, uint8(0))
+    c.Expect(pixel(r, 1, 1).R, Equals, uint8(255))
+    c.Expect(pixel(r, 4, 1).R, Equals, uint8(255))
+    c.Expect(pixel(r, 5, 1).R, Equals, uint8(0))
+  })
+
+  c.Specify("Quads sample the nearest texel and are modulated by their color", func() {
+    r.Begin(render.Rect{Dx: 4, Dy: 4}, black)
+    // v runs from 1 at the bottom to 0 at the top so that the texture is
+    // upright
+    r.Quad(tex, render.Rect{Dx: 4, Dy: 4}, 0, 1, 1, 0, white)
+    c.Expect(pixel(r, 0, 3).R, Equals, uint8(255))
+    c.Expect(pixel(r, 1, 2).R, Equals, uint8(255))
+    c.Expect(pixel(r, 2, 3).R, Equals, uint8(0))
+    c.Expect(pixel(r, 0, 0).R, Equals, uint8(0))
+    c.Expect(pixel(r, 3, 0).R, Equals, uint8(255))
+    r.Quad(tex, render.Rect{Dx: 4, Dy: 4}, 0, 1, 1, 0, red)
+    c.Expect(pixel(r, 0, 3), Equals, color.NRGBA{255, 0, 0, 255})
+  })
+
+  c.Specify("Textures repeat unless they are clamped", func() {
+    r.Begin(render.Rect{Dx: 4, Dy: 1}, black)
+    r.Quad(tex, render.Rect{Dx: 4, Dy: 1}, 0, 0.75, 2, 0.75, white)
+    c.Expect(pixel(r, 0, 0).R, Equals, uint8(0))
+    c.Expect(pixel(r, 1, 0).R, Equals, uint8(255))
+    c.Expect(pixel(r, 2, 0).R, Equals, uint8(0))
+    c.Expect(pixel(r, 3, 0).R, Equals, uint8(255))
+    clamped := m.LoadImage(checker(), render.TextureOptions{Filter: render.Nearest, Clamp: true})
+    render.Purge()
+    r.Quad(clamped, render.Rect{Dx: 4, Dy: 1}, 0, 0.75, 2, 0.75, white)
+    c.Expect(pixel(r, 2, 0).R, Equals, uint8(255))
+    c.Expect(pixel(r, 3, 0).R, Equals, uint8(255))
+    clamped.Release()
+    render.Purge()
+  })
+
+  c.Specify("A scene matches its golden image", func() {
+    drawScene(r, tex)
+    c.Expect(render.CompareGolden(r.Image(), "testdata/scene.png"), Equals, nil)
+  })
+
+  tex.Release()
+  render.Purge()
+}
+
+func SetRendererSpec(c gospec.Context) {
+  render.Init()
+  render_thread.RLock()
+  defer render_thread.RUnlock()
+  current_mutex.Lock()
+  defer current_mutex.Unlock()
+  old := render.Current()
+  soft := render.MakeSoftRenderer()
+  render.SetRenderer(soft)
+  loads := 0
+  tex, _ := render.Textures().LoadFunc("", func() (image.Image, error) {
+    loads++
+    return checker(), nil
+  }, render.TextureOptions{Filter: render.Nearest})
+  render.Purge()
+
+  c.Specify("Wrapping the current renderer in a Batch moves no textures", func() {
+    render.SetRenderer(render.MakeBatch(soft))
+    render.SetRenderer(soft)
+    render.Purge()
+    c.Expect(loads, Equals, 1)
+  })
+
+  c.Specify("Switching to another renderer moves every texture into it", func() {
+    other := render.MakeSoftRenderer()
+    render.SetRenderer(other)
+    render.Purge()
+    c.Expect(loads, Equals, 2)
+    other.Begin(render.Rect{Dx: 2, Dy: 2}, black)
+    other.Quad(tex, render.Rect{Dx: 2, Dy: 2}, 0, 1, 1, 0, white)
+    c.Expect(pixel(other, 1, 1).R, Equals, uint8(0))
+
+    // Without its texture the quad is drawn in its color
+    soft.Begin(render.Rect{Dx: 2, Dy: 2}, black)
+    soft.Quad(tex, render.Rect{Dx: 2, Dy: 2}, 0, 1, 1, 0, white)
+    c.Expect(pixel(soft, 1, 1).R, Equals, uint8(255))
+  })
+
+  tex.Release()
+  render.Purge()
+  render.SetRenderer(old)
+}
@@ -0,0 +1,69 @@
+package render_test
+
+import (
+  "github.com/MobRulesGames/glop/render"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+  "os"
+  "os/exec"
+  "testing"
+)
+
+const shutdown_env = "GLOP_RENDER_SHUTDOWN_SPECS"
+
+// Shutting down the render thread can't be undone, so ShutdownSpec is run
+// in a copy of the test binary that runs nothing else.
+func TestShutdownSpecs(t *testing.T) {
+  if os.Getenv(shutdown_env) == "" {
+    cmd := exec.Command(os.Args[0], "-test.run=^TestShutdownSpecs$")
+    cmd.Env = append(os.Environ(), shutdown_env+"=1")
+    if out, err := cmd.CombinedOutput(); err != nil {
+      t.Fatalf("%v\n%s", err, out)
+    }
+    return
+  }
+  r := gospec.NewRunner()
+  r.AddSpec(ShutdownSpec)
+  gospec.MainGoTest(r, t)
+}
+
+func ShutdownSpec(c gospec.Context) {
+  c.Specify("Shutdown runs everything that was queued and then stops the render thread", func() {
+    var reported []error
+    render.SetErrorHandler(func(err error) {
+      reported = append(reported, err)
+    })
+    c.Expect(render.Health(), Equals, render.ErrNotStarted)
+    render.Init()
+    c.Expect(render.Health(), IsNil)
+
+    release := make(chan bool)
+    render.Queue(func() {
+      <-release
+    })
+    ran := 0
+    for _, p := range []render.Priority{render.Immediate, render.Frame, render.Background} {
+      render.QueueAt(p, func() {
+        ran++
+      })
+    }
+    render.SetFrameBudget(1)
+    close(release)
+    render.Shutdown()
+    c.Expect(ran, Equals, 3)
+    c.Expect(render.Health(), Equals, render.ErrShutdown)
+
+    render.Queue(func() {
+      ran++
+    })
+    c.Expect(render.TryQueue(render.Frame, func() { ran++ }), Equals, render.ErrShutdown)
+    c.Expect(reported, ContainsExactly, []error{render.ErrShutdown})
+
+    // Nothing waits on a render thread that has stopped
+    render.Purge()
+    render.QueueWait(func() { ran++ })
+    c.Expect(render.Call(func() int { return 1 }), Equals, 0)
+    c.Expect(render.Async(func() int { return 1 }).Wait(), Equals, 0)
+    c.Expect(ran, Equals, 3)
+  })
+}
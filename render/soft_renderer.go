@@ -0,0 +1,252 @@
+package render
+
+import (
+  "image"
+  "image/draw"
+  "math"
+  "sync"
+)
+
+// A SoftRenderer is a pure Go Renderer that draws into an image.NRGBA, so
+// that drawing code can be tested without an OpenGL context.  It follows
+// OpenGL's rules closely enough for golden image tests: a pixel is covered
+// when its center is, textures are sampled with the nearest texel and
+// repeat unless they are clamped, and blending uses source alpha.  Unlike
+// the GL renderer it can be used from any goroutine, though only from one at
+// a time.
+// It draws into an image.NRGBA rather than an image.RGBA because that is
+// what blending with source alpha produces: the color channels of a pixel
+// that isn't opaque are not premultiplied, just as they aren't in a GL
+// framebuffer, and reading them as an image.RGBA would get them wrong.
+type SoftRenderer struct {
+  stacks
+  view   Rect
+  target *image.NRGBA
+
+  // Only changed while drawing a batch
+  mode Blend
+
+  // Pixels for every texture that has been uploaded.  Uploads happen on the
+  // render thread, so this needs its own lock.
+  mutex    sync.Mutex
+  textures map[*Texture]*image.RGBA
+}
+
+func MakeSoftRenderer() *SoftRenderer {
+  r := &SoftRenderer{textures: make(map[*Texture]*image.RGBA)}
+  r.reset()
+  return r
+}
+
+// Returns the image that the current frame is being drawn into.  The top row
+// of the image is the top of the view.
+func (r *SoftRenderer) Image() *image.NRGBA {
+  return r.target
+}
+
+func (r *SoftRenderer) Begin(view Rect, clear Color) {
+  r.reset()
+  r.view = view
+  bounds := image.Rect(0, 0, int(view.Dx), int(view.Dy))
+  if r.target == nil || r.target.Bounds() != bounds {
+    r.target = image.NewNRGBA(bounds)
+  }
+  c := [4]uint8{toByte(clear.R), toByte(clear.G), toByte(clear.B), toByte(clear.A)}
+  for i := 0; i < len(r.target.Pix); i += 4 {
+    copy(r.target.Pix[i:i+4], c[:])
+  }
+}
+
+func (r *SoftRenderer) PushTransform()         { r.pushTransform() }
+func (r *SoftRenderer) PopTransform()          { r.popTransform() }
+func (r *SoftRenderer) Translate(x, y float64) { r.translate(x, y) }
+func (r *SoftRenderer) Scale(x, y float64)     { r.scale(x, y) }
+func (r *SoftRenderer) PushClip(c Rect)        { r.pushClip(c) }
+func (r *SoftRenderer) PopClip()               { r.popClip() }
+
+func toByte(f float64) uint8 {
+  if f <= 0 {
+    return 0
+  }
+  if f >= 1 {
+    return 255
+  }
+  return uint8(f*255 + 0.5)
+}
+
+// Returns the range of pixel columns and rows, counting rows from the bottom
+// of the view, whose centers are inside of rect, a rect in view coordinates,
+// and inside of the current clip rect.
+func (r *SoftRenderer) pixels(rect Rect) (x, y, x2, y2 int) {
+  if len(r.clips) > 0 {
+    rect = rect.Isect(r.clips[len(r.clips)-1])
+  }
+  rect.X -= r.view.X
+  rect.Y -= r.view.Y
+  x = int(math.Max(0, math.Ceil(rect.X-0.5)))
+  y = int(math.Max(0, math.Ceil(rect.Y-0.5)))
+  x2 = int(math.Min(r.view.Dx, math.Ceil(rect.X+rect.Dx-0.5)))
+  y2 = int(math.Min(r.view.Dy, math.Ceil(rect.Y+rect.Dy-0.5)))
+  return
+}
+
+// Blends c over the pixel in column x and row y, counting from the bottom.
+func (r *SoftRenderer) blend(x, y int, c Color) {
+  if c.A <= 0 {
+    return
+  }
+  i := r.target.PixOffset(x, r.target.Rect.Dy()-1-y)
+  p := r.target.Pix[i : i+4]
+  if r.mode == AdditiveBlend {
+    p[0] = toByte(c.R*c.A + float64(p[0])/255)
+    p[1] = toByte(c.G*c.A + float64(p[1])/255)
+    p[2] = toByte(c.B*c.A + float64(p[2])/255)
+    p[3] = toByte(c.A*c.A + float64(p[3])/255)
+    return
+  }
+  p[0] = toByte(c.R*c.A + float64(p[0])/255*(1-c.A))
+  p[1] = toByte(c.G*c.A + float64(p[1])/255*(1-c.A))
+  p[2] = toByte(c.B*c.A + float64(p[2])/255*(1-c.A))
+  p[3] = toByte(c.A*c.A + float64(p[3])/255*(1-c.A))
+}
+
+func (r *SoftRenderer) FillRect(rect Rect, c Color) {
+  x, y, x2, y2 := r.pixels(r.top().applyRect(rect))
+  for py := y; py < y2; py++ {
+    for px := x; px < x2; px++ {
+      r.blend(px, py, c)
+    }
+  }
+}
+
+// Lines are stepped along their major axis one pixel at a time, leaving off
+// the last pixel the way OpenGL does.
+func (r *SoftRenderer) Line(x, y, x2, y2 float64, c Color) {
+  t := r.top()
+  x, y = t.apply(x, y)
+  x2, y2 = t.apply(x2, y2)
+  x, y = x-r.view.X, y-r.view.Y
+  x2, y2 = x2-r.view.X, y2-r.view.Y
+  steps := int(math.Max(math.Abs(x2-x), math.Abs(y2-y)) + 0.5)
+  clip := Rect{0, 0, r.view.Dx, r.view.Dy}
+  if len(r.clips) > 0 {
+    cur := r.clips[len(r.clips)-1]
+    clip = clip.Isect(Rect{cur.X - r.view.X, cur.Y - r.view.Y, cur.Dx, cur.Dy})
+  }
+  for i := 0; i < steps; i++ {
+    f := (float64(i) + 0.5) / float64(steps)
+    px := math.Floor(x + f*(x2-x))
+    py := math.Floor(y + f*(y2-y))
+    cx, cy := px+0.5, py+0.5
+    if cx < clip.X || cx >= clip.X+clip.Dx || cy < clip.Y || cy >= clip.Y+clip.Dy {
+      continue
+    }
+    r.blend(int(px), int(py), c)
+  }
+}
+
+// Maps a texture coordinate to a texel index.
+func texel(s float64, n int, clamp bool) int {
+  i := int(math.Floor(s * float64(n)))
+  if clamp {
+    if i < 0 {
+      return 0
+    }
+    if i >= n {
+      return n - 1
+    }
+    return i
+  }
+  i %= n
+  if i < 0 {
+    i += n
+  }
+  return i
+}
+
+func (r *SoftRenderer) Quad(t *Texture, rect Rect, u, v, u2, v2 float64, c Color) {
+  r.mutex.Lock()
+  pix := r.textures[t]
+  r.mutex.Unlock()
+  if pix == nil {
+    // Just like OpenGL with an incomplete texture, the quad is drawn in its
+    // color
+    r.FillRect(rect, c)
+    return
+  }
+  tr := r.top()
+  view := tr.applyRect(rect)
+  // A negative scale flips the quad, and the texture along with it
+  if tr.sx < 0 {
+    u, u2 = u2, u
+  }
+  if tr.sy < 0 {
+    v, v2 = v2, v
+  }
+  x, y, x2, y2 := r.pixels(view)
+  dx, dy := pix.Rect.Dx(), pix.Rect.Dy()
+  for py := y; py < y2; py++ {
+    fy := (float64(py) + 0.5 + r.view.Y - view.Y) / view.Dy
+    ty := texel(v+fy*(v2-v), dy, t.opts.Clamp)
+    for px := x; px < x2; px++ {
+      fx := (float64(px) + 0.5 + r.view.X - view.X) / view.Dx
+      tx := texel(u+fx*(u2-u), dx, t.opts.Clamp)
+      i := pix.PixOffset(tx, ty)
+      r.blend(px, py, Color{
+        R: c.R * float64(pix.Pix[i]) / 255,
+        G: c.G * float64(pix.Pix[i+1]) / 255,
+        B: c.B * float64(pix.Pix[i+2]) / 255,
+        A: c.A * float64(pix.Pix[i+3]) / 255,
+      })
+    }
+  }
+}
+
+// Draws each run one primitive at a time.
+func (r *SoftRenderer) DrawBatch(verts []Vertex, runs []BatchRun) {
+  defer func() { r.mode = AlphaBlend }()
+  for _, run := range runs {
+    r.mode = run.State.Blend
+    if run.State.Clipped {
+      r.PushClip(run.State.Clip)
+    }
+    vs := verts[run.First : run.First+run.Count]
+    switch run.State.Primitive {
+    case Quads:
+      for i := 0; i+3 < len(vs); i += 4 {
+        a, b := vs[i], vs[i+2]
+        rect := Rect{float64(a.X), float64(a.Y), float64(b.X - a.X), float64(b.Y - a.Y)}
+        c := Color{float64(a.R), float64(a.G), float64(a.B), float64(a.A)}
+        if run.State.Texture == nil {
+          r.FillRect(rect, c)
+        } else {
+          r.Quad(run.State.Texture, rect, float64(a.U), float64(a.V), float64(b.U), float64(b.V), c)
+        }
+      }
+    case Lines:
+      for i := 0; i+1 < len(vs); i += 2 {
+        a, b := vs[i], vs[i+1]
+        c := Color{float64(a.R), float64(a.G), float64(a.B), float64(a.A)}
+        r.Line(float64(a.X), float64(a.Y), float64(b.X), float64(b.Y), c)
+      }
+    }
+    if run.State.Clipped {
+      r.PopClip()
+    }
+  }
+}
+
+func (r *SoftRenderer) UploadTexture(t *Texture, rgba *image.RGBA) {
+  b := rgba.Bounds()
+  pix := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+  draw.Draw(pix, pix.Bounds(), rgba, b.Min, draw.Src)
+  r.mutex.Lock()
+  defer r.mutex.Unlock()
+  r.textures[t] = pix
+}
+
+func (r *SoftRenderer) DeleteTexture(t *Texture) {
+  r.mutex.Lock()
+  defer r.mutex.Unlock()
+  delete(r.textures, t)
+}
@@ -0,0 +1,291 @@
+package render
+
+import (
+  "encoding/json"
+  "io"
+  "sort"
+  "sync"
+  "time"
+)
+
+// Number of frames that rolling stats are kept over.
+const rolling_frames = 60
+
+// Number of the longest calls that are kept.
+const num_longest = 10
+
+// Functions that were queued without a tag are reported under this name.
+const Untagged = "untagged"
+
+// A CallRecord describes one function that was run on the render thread.
+type CallRecord struct {
+  Tag      string
+  Priority Priority
+
+  // When the function was queued, and when it started running
+  Queued time.Time
+  Start  time.Time
+
+  // How long the function waited in its lane, and how long it took to run
+  Wait time.Duration
+  Run  time.Duration
+
+  // Number of functions that were still waiting, in every lane, once this
+  // one finished
+  Depth int
+}
+
+// Stats about all of the calls made with the same tag.
+type TagStats struct {
+  Calls int
+
+  // Total and longest times spent waiting in the queue
+  Wait     time.Duration
+  Max_wait time.Duration
+
+  // Total and longest times spent running
+  Run     time.Duration
+  Max_run time.Duration
+}
+
+func (s *TagStats) add(c CallRecord) {
+  s.Calls++
+  s.Wait += c.Wait
+  s.Run += c.Run
+  if c.Wait > s.Max_wait {
+    s.Max_wait = c.Wait
+  }
+  if c.Run > s.Max_run {
+    s.Max_run = c.Run
+  }
+}
+
+func (s *TagStats) merge(t TagStats) {
+  s.Calls += t.Calls
+  s.Wait += t.Wait
+  s.Run += t.Run
+  if t.Max_wait > s.Max_wait {
+    s.Max_wait = t.Max_wait
+  }
+  if t.Max_run > s.Max_run {
+    s.Max_run = t.Max_run
+  }
+}
+
+// Average time that a call spent waiting in the queue.
+func (s TagStats) AvgWait() time.Duration {
+  if s.Calls == 0 {
+    return 0
+  }
+  return s.Wait / time.Duration(s.Calls)
+}
+
+// Average time that a call took to run.
+func (s TagStats) AvgRun() time.Duration {
+  if s.Calls == 0 {
+    return 0
+  }
+  return s.Run / time.Duration(s.Calls)
+}
+
+// A snapshot of what the render thread has been doing.
+type QueueStats struct {
+  // Stats for each tag over the most recently completed frame, and over the
+  // last rolling_frames frames, including that one.
+  Frame   map[string]TagStats
+  Rolling map[string]TagStats
+
+  // The longest calls over the last rolling_frames frames, longest first
+  Longest []CallRecord
+
+  // Number of functions currently waiting in each lane, indexed by Priority
+  Depth []int
+}
+
+type frameStats struct {
+  tags    map[string]TagStats
+  longest []CallRecord
+}
+
+func makeFrameStats() frameStats {
+  return frameStats{tags: make(map[string]TagStats)}
+}
+
+var (
+  stats_mutex sync.Mutex
+
+  // Stats for the frame in progress, and a ring of completed frames
+  current     frameStats
+  history     [rolling_frames]frameStats
+  history_pos int
+  history_len int
+
+  tracing     bool
+  trace       []CallRecord
+  trace_start time.Time
+)
+
+func init() {
+  current = makeFrameStats()
+}
+
+// Adds c to longest if it is one of the num_longest longest calls, keeping
+// longest sorted from longest to shortest.
+func addLongest(longest []CallRecord, c CallRecord) []CallRecord {
+  i := sort.Search(len(longest), func(i int) bool {
+    return longest[i].Run < c.Run
+  })
+  if i >= num_longest {
+    return longest
+  }
+  if len(longest) < num_longest {
+    longest = append(longest, CallRecord{})
+  }
+  copy(longest[i+1:], longest[i:])
+  longest[i] = c
+  return longest
+}
+
+func record(c CallRecord) {
+  if c.Tag == "" {
+    c.Tag = Untagged
+  }
+  stats_mutex.Lock()
+  defer stats_mutex.Unlock()
+  s := current.tags[c.Tag]
+  s.add(c)
+  current.tags[c.Tag] = s
+  current.longest = addLongest(current.longest, c)
+  if tracing {
+    trace = append(trace, c)
+  }
+}
+
+func endFrameStats() {
+  stats_mutex.Lock()
+  defer stats_mutex.Unlock()
+  history[history_pos] = current
+  history_pos = (history_pos + 1) % rolling_frames
+  if history_len < rolling_frames {
+    history_len++
+  }
+  current = makeFrameStats()
+}
+
+// Returns stats about the functions that have been run on the render thread.
+// Frames end on every call to Purge or EndFrame.
+func Stats() QueueStats {
+  var stats QueueStats
+  stats.Frame = make(map[string]TagStats)
+  stats.Rolling = make(map[string]TagStats)
+  stats_mutex.Lock()
+  for i := 0; i < history_len; i++ {
+    frame := history[(history_pos-1-i+rolling_frames)%rolling_frames]
+    for tag, s := range frame.tags {
+      if i == 0 {
+        stats.Frame[tag] = s
+      }
+      r := stats.Rolling[tag]
+      r.merge(s)
+      stats.Rolling[tag] = r
+    }
+    for _, c := range frame.longest {
+      stats.Longest = addLongest(stats.Longest, c)
+    }
+  }
+  stats_mutex.Unlock()
+  for p := Immediate; p < num_priorities; p++ {
+    stats.Depth = append(stats.Depth, Pending(p))
+  }
+  return stats
+}
+
+// Starts recording every call made on the render thread so that it can be
+// written out with WriteTrace.  Anything recorded by an earlier trace is
+// discarded.  Every call is kept until StopTrace is called, so this is meant
+// for capturing a few seconds at a time.
+func StartTrace() {
+  stats_mutex.Lock()
+  defer stats_mutex.Unlock()
+  tracing = true
+  trace = nil
+  trace_start = time.Now()
+}
+
+// Stops recording calls.  What has been recorded so far is kept for
+// WriteTrace.
+func StopTrace() {
+  stats_mutex.Lock()
+  defer stats_mutex.Unlock()
+  tracing = false
+}
+
+// An event in the Chrome trace event format, see
+// https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type traceEvent struct {
+  Name string                 `json:"name"`
+  Cat  string                 `json:"cat,omitempty"`
+  Ph   string                 `json:"ph"`
+  Ts   float64                `json:"ts"`
+  Dur  float64                `json:"dur,omitempty"`
+  Pid  int                    `json:"pid"`
+  Tid  int                    `json:"tid"`
+  Args map[string]interface{} `json:"args,omitempty"`
+}
+
+func micros(d time.Duration) float64 {
+  return float64(d) / float64(time.Microsecond)
+}
+
+// Writes the calls recorded since StartTrace as a Chrome trace JSON file,
+// which can be loaded in chrome://tracing or Perfetto.  Calls are shown on a
+// render thread track, the time each one spent waiting is shown on a track
+// for its lane, and the queue depth is shown as a counter.
+func WriteTrace(w io.Writer) error {
+  stats_mutex.Lock()
+  calls := make([]CallRecord, len(trace))
+  copy(calls, trace)
+  start := trace_start
+  stats_mutex.Unlock()
+
+  // Thread 0 is the render thread, the lanes follow it
+  events := []traceEvent{
+    {Name: "thread_name", Ph: "M", Args: map[string]interface{}{"name": "render thread"}},
+  }
+  for p := Immediate; p < num_priorities; p++ {
+    events = append(events, traceEvent{
+      Name: "thread_name",
+      Ph:   "M",
+      Tid:  1 + int(p),
+      Args: map[string]interface{}{"name": p.String() + " lane"},
+    })
+  }
+  for _, c := range calls {
+    events = append(events, traceEvent{
+      Name: c.Tag,
+      Cat:  c.Priority.String(),
+      Ph:   "X",
+      Ts:   micros(c.Start.Sub(start)),
+      Dur:  micros(c.Run),
+      Args: map[string]interface{}{"wait_us": micros(c.Wait)},
+    })
+    events = append(events, traceEvent{
+      Name: c.Tag,
+      Cat:  "wait",
+      Ph:   "X",
+      Ts:   micros(c.Queued.Sub(start)),
+      Dur:  micros(c.Wait),
+      Tid:  1 + int(c.Priority),
+    })
+    events = append(events, traceEvent{
+      Name: "queue depth",
+      Ph:   "C",
+      Ts:   micros(c.Start.Add(c.Run).Sub(start)),
+      Args: map[string]interface{}{"depth": c.Depth},
+    })
+  }
+  return json.NewEncoder(w).Encode(map[string]interface{}{
+    "traceEvents":     events,
+    "displayTimeUnit": "ms",
+  })
+}
@@ -0,0 +1,82 @@
+package render_test
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "github.com/MobRulesGames/glop/render"
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+  "time"
+)
+
+func StatsSpec(c gospec.Context) {
+  render.Init()
+  render_thread.RLock()
+  defer render_thread.RUnlock()
+  render.Purge()
+
+  c.Specify("Calls are counted by tag for each frame and over recent frames", func() {
+    // Rolling stats outlive the spec, so the tag has to be new each time
+    tag := fmt.Sprintf("stats spec %d", time.Now().UnixNano())
+    for i := 0; i < 2; i++ {
+      render.QueueNamed(tag, func() {
+        time.Sleep(time.Millisecond)
+      })
+    }
+    render.Purge()
+    stats := render.Stats()
+    frame := stats.Frame[tag]
+    c.Expect(frame.Calls, Equals, 2)
+    c.Expect(frame.Max_run >= time.Millisecond, IsTrue)
+    c.Expect(frame.AvgRun() >= time.Millisecond, IsTrue)
+    c.Expect(frame.Run >= frame.Max_run, IsTrue)
+    c.Expect(len(stats.Depth), Equals, 3)
+    c.Assume(len(stats.Longest) > 0, IsTrue)
+    for i := 1; i < len(stats.Longest); i++ {
+      c.Expect(stats.Longest[i-1].Run >= stats.Longest[i].Run, IsTrue)
+    }
+
+    render.Purge()
+    stats = render.Stats()
+    _, ok := stats.Frame[tag]
+    c.Expect(ok, IsFalse)
+    c.Expect(stats.Rolling[tag].Calls, Equals, 2)
+  })
+
+  c.Specify("Untagged calls are counted as untagged", func() {
+    render.Queue(func() {})
+    render.Purge()
+    c.Expect(render.Stats().Frame[render.Untagged].Calls >= 1, IsTrue)
+  })
+
+  c.Specify("Traces have the calls made while tracing, and how long they waited", func() {
+    render.StartTrace()
+    render.QueueNamed("traced", func() {})
+    render.Purge()
+    render.StopTrace()
+    render.QueueNamed("traced", func() {})
+    render.Purge()
+
+    var buf bytes.Buffer
+    c.Assume(render.WriteTrace(&buf), IsNil)
+    var trace struct {
+      TraceEvents []struct {
+        Name string
+        Cat  string
+        Ph   string
+        Tid  int
+      }
+    }
+    c.Assume(json.Unmarshal(buf.Bytes(), &trace), IsNil)
+    var tids []int
+    for _, event := range trace.TraceEvents {
+      if event.Name == "traced" {
+        c.Expect(event.Ph, Equals, "X")
+        tids = append(tids, event.Tid)
+      }
+    }
+    // The call on the render thread, and its wait in the Frame lane
+    c.Expect(tids, ContainsExactly, []int{0, 1 + int(render.Frame)})
+  })
+}
@@ -0,0 +1,382 @@
+package render
+
+import (
+  "fmt"
+  "github.com/MobRulesGames/opengl/gl"
+  "image"
+  "image/draw"
+  "os"
+  "sync"
+)
+
+// Returns the smallest power of two that is at least n.
+func NextPowerOf2(n uint32) uint32 {
+  if n == 0 {
+    return 1
+  }
+  for i := uint(0); i < 32; i++ {
+    p := uint32(1) << i
+    if n <= p {
+      return p
+    }
+  }
+  return 0
+}
+
+type Filter int
+
+const (
+  Linear Filter = iota
+  Nearest
+)
+
+type TextureOptions struct {
+  // Filtering used when the texture is magnified or minified
+  Filter Filter
+
+  // If set mipmaps are built for the texture
+  Mipmaps bool
+
+  // If set texture coordinates outside of [0, 1] are clamped rather than
+  // repeated
+  Clamp bool
+
+  // Textures are normally padded on the right and bottom so that their
+  // dimensions are powers of two, this turns that off.
+  No_padding bool
+
+  // Lane and tag used when the texture has to be queued for uploading.
+  // Textures that are loaded on the render thread are uploaded immediately.
+  // The tag defaults to "texture".
+  Priority Priority
+  Tag      string
+}
+
+// A Texture is a reference counted texture owned by a TextureManager, and
+// uploaded with the current Renderer.  Apart from Bind, which must be called
+// on the render thread, its methods can be called from any goroutine.
+type Texture struct {
+  manager *TextureManager
+  name    string
+  key     string
+  opts    TextureOptions
+
+  // Returns the pixels for the texture, called when it is first loaded and
+  // again whenever it is reloaded.
+  source func() (image.Image, error)
+
+  // Used by the GL renderer, and only touched on the render thread
+  id gl.Texture
+
+  // Dimensions of the source image, and of the texture after padding
+  dx, dy   int
+  tdx, tdy int
+
+  refs int
+}
+
+// Binds the texture to TEXTURE_2D, for code that draws with OpenGL directly
+// rather than through a Renderer.  A nil texture, or one that hasn't been
+// uploaded yet, unbinds whatever texture is bound.
+func (t *Texture) Bind() {
+  if t == nil {
+    gl.Texture(0).Bind(gl.TEXTURE_2D)
+    return
+  }
+  t.id.Bind(gl.TEXTURE_2D)
+}
+
+// Returns the dimensions of the image the texture was made from.
+func (t *Texture) Dims() (dx, dy int) {
+  t.manager.mutex.Lock()
+  defer t.manager.mutex.Unlock()
+  return t.dx, t.dy
+}
+
+// Returns the dimensions of the texture, including any padding.
+func (t *Texture) TextureDims() (dx, dy int) {
+  t.manager.mutex.Lock()
+  defer t.manager.mutex.Unlock()
+  return t.tdx, t.tdy
+}
+
+// Returns the texture coordinates of the bottom right corner of the source
+// image, which are less than one if the texture was padded.
+func (t *Texture) Coords() (u, v float64) {
+  t.manager.mutex.Lock()
+  defer t.manager.mutex.Unlock()
+  return float64(t.dx) / float64(t.tdx), float64(t.dy) / float64(t.tdy)
+}
+
+// Number of bytes of texture memory the texture uses.
+func (t *Texture) size() int64 {
+  size := int64(4 * t.tdx * t.tdy)
+  if t.opts.Mipmaps {
+    size = size * 4 / 3
+  }
+  return size
+}
+
+// Adds a reference to the texture.  Each reference must be matched by a
+// call to Release.
+func (t *Texture) Acquire() {
+  t.manager.mutex.Lock()
+  defer t.manager.mutex.Unlock()
+  if t.refs == 0 {
+    panic("Tried to acquire a texture that has already been released.")
+  }
+  t.refs++
+}
+
+// Drops a reference to the texture.  The texture is deleted as soon as its
+// last reference is released.
+func (t *Texture) Release() {
+  m := t.manager
+  m.mutex.Lock()
+  if t.refs == 0 {
+    m.mutex.Unlock()
+    panic("Tried to release a texture more times than it was loaded.")
+  }
+  t.refs--
+  if t.refs > 0 {
+    m.mutex.Unlock()
+    return
+  }
+  if m.cached[t.key] == t {
+    delete(m.cached, t.key)
+  }
+  delete(m.textures, t)
+  m.bytes -= t.size()
+  m.mutex.Unlock()
+  t.onRenderThread(func() {
+    m.renderer().DeleteTexture(t)
+  })
+}
+
+// Replaces the contents of a texture that was made by LoadImage.  img must
+// not be modified afterwards, since it may be used to reload the texture.
+func (t *Texture) Update(img image.Image) {
+  t.manager.mutex.Lock()
+  t.source = func() (image.Image, error) { return img, nil }
+  t.manager.mutex.Unlock()
+  t.upload(t.resize(img))
+}
+
+// Converts img to what will be uploaded for t, and updates t's dimensions to
+// match it.
+func (t *Texture) resize(img image.Image) *image.RGBA {
+  rgba := toRGBA(img, !t.opts.No_padding)
+  m := t.manager
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  if m.textures[t] {
+    m.bytes -= t.size()
+  }
+  t.dx, t.dy = img.Bounds().Dx(), img.Bounds().Dy()
+  t.tdx, t.tdy = rgba.Bounds().Dx(), rgba.Bounds().Dy()
+  if m.textures[t] {
+    m.bytes += t.size()
+  }
+  return rgba
+}
+
+// Runs f now if this is the render thread, otherwise queues it in the
+// texture's lane.
+func (t *Texture) onRenderThread(f func()) {
+  if OnRenderThread() {
+    f()
+    return
+  }
+  tag := t.opts.Tag
+  if tag == "" {
+    tag = "texture"
+  }
+  QueueNamedAt(t.opts.Priority, tag, f)
+}
+
+func (t *Texture) upload(rgba *image.RGBA) {
+  t.onRenderThread(func() {
+    t.manager.renderer().UploadTexture(t, rgba)
+  })
+}
+
+// Converts img to an *image.RGBA with its origin at zero, padded to powers
+// of two if pad is set.  img is returned as is if it is already like that.
+func toRGBA(img image.Image, pad bool) *image.RGBA {
+  b := img.Bounds()
+  dx, dy := b.Dx(), b.Dy()
+  if pad {
+    dx = int(NextPowerOf2(uint32(dx)))
+    dy = int(NextPowerOf2(uint32(dy)))
+  }
+  if rgba, ok := img.(*image.RGBA); ok && b.Min == (image.Point{}) && b.Dx() == dx && b.Dy() == dy && rgba.Stride == 4*dx {
+    return rgba
+  }
+  rgba := image.NewRGBA(image.Rect(0, 0, dx, dy))
+  draw.Draw(rgba, b.Sub(b.Min), img, b.Min, draw.Src)
+  return rgba
+}
+
+// A TextureManager loads textures, shares textures that were loaded from
+// the same path, and keeps track of how much memory they use.
+type TextureManager struct {
+  mutex sync.Mutex
+
+  // Textures that can be shared, by key, and every live texture
+  cached   map[string]*Texture
+  textures map[*Texture]bool
+
+  bytes int64
+
+  // What textures are uploaded to, the current Renderer if this is nil
+  target Renderer
+}
+
+// Makes a TextureManager that uploads its textures to r instead of to the
+// current Renderer, so that a test can draw into a renderer of its own
+// without switching the one that the rest of glop uses.
+func MakeTextureManager(r Renderer) *TextureManager {
+  m := makeTextureManager()
+  m.target = r
+  return m
+}
+
+func makeTextureManager() *TextureManager {
+  return &TextureManager{
+    cached:   make(map[string]*Texture),
+    textures: make(map[*Texture]bool),
+  }
+}
+
+var the_textures = makeTextureManager()
+
+// Returns the TextureManager that is shared by the rest of glop, whose
+// textures are uploaded to the current Renderer.
+func Textures() *TextureManager {
+  return the_textures
+}
+
+func decodeFile(path string) (image.Image, error) {
+  f, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+  img, _, err := image.Decode(f)
+  return img, err
+}
+
+// Loads the image at path as a texture.  Loading the same path with the same
+// options again returns the same texture with another reference added to it.
+// The image decoders for the formats being used must be registered.
+func (m *TextureManager) Load(path string, opts TextureOptions) (*Texture, error) {
+  return m.LoadFunc(path, func() (image.Image, error) {
+    return decodeFile(path)
+  }, opts)
+}
+
+// Makes a texture from img.  img must not be modified afterwards, since it is
+// kept so that the texture can be reloaded, use Texture.Update to change it.
+// Textures made from images are never shared.
+func (m *TextureManager) LoadImage(img image.Image, opts TextureOptions) *Texture {
+  t, _ := m.LoadFunc("", func() (image.Image, error) { return img, nil }, opts)
+  return t
+}
+
+// Makes a texture from the image returned by source.  source is called
+// again whenever the texture needs to be reloaded, so nothing needs to be
+// kept in memory.  If name is not empty the texture is shared by every load
+// with the same name and options.
+func (m *TextureManager) LoadFunc(name string, source func() (image.Image, error), opts TextureOptions) (*Texture, error) {
+  key := ""
+  if name != "" {
+    key = fmt.Sprintf("%s %v", name, opts)
+    m.mutex.Lock()
+    if t, ok := m.cached[key]; ok {
+      t.refs++
+      m.mutex.Unlock()
+      return t, nil
+    }
+    m.mutex.Unlock()
+  }
+  img, err := source()
+  if err != nil {
+    return nil, err
+  }
+  t := &Texture{
+    manager: m,
+    name:    name,
+    key:     key,
+    opts:    opts,
+    source:  source,
+    refs:    1,
+  }
+  rgba := t.resize(img)
+  m.mutex.Lock()
+  if key != "" {
+    // Someone else may have loaded it while we were reading it
+    if other, ok := m.cached[key]; ok {
+      other.refs++
+      m.mutex.Unlock()
+      return other, nil
+    }
+    m.cached[key] = t
+  }
+  m.textures[t] = true
+  m.bytes += t.size()
+  m.mutex.Unlock()
+  t.upload(rgba)
+  return t, nil
+}
+
+func (m *TextureManager) renderer() Renderer {
+  if m.target != nil {
+    return m.target
+  }
+  return Current()
+}
+
+// Returns the number of live textures and the number of bytes of texture
+// memory that they use, including padding and mipmaps.
+func (m *TextureManager) Memory() (textures int, bytes int64) {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  return len(m.textures), m.bytes
+}
+
+// Uploads every texture again.  This must be called after the OpenGL
+// context has been recreated, since the old texture ids are no longer valid.
+// Textures whose source can no longer be read are left empty and the error
+// is sent to the render error handler.
+func (m *TextureManager) Reload() {
+  m.reload(nil)
+}
+
+// Uploads every texture again, first deleting it from old unless old is nil,
+// which means that whatever held the textures is already gone.
+func (m *TextureManager) reload(old Renderer) {
+  m.mutex.Lock()
+  var textures []*Texture
+  for t := range m.textures {
+    textures = append(textures, t)
+  }
+  m.mutex.Unlock()
+  for _, t := range textures {
+    t.onRenderThread(func() {
+      if old != nil {
+        old.DeleteTexture(t)
+      }
+      // Any id the texture still has belonged to the old context
+      t.id = 0
+    })
+    m.mutex.Lock()
+    source := t.source
+    m.mutex.Unlock()
+    img, err := source()
+    if err != nil {
+      reportError(fmt.Errorf("Unable to reload texture '%s': %v", t.name, err))
+      continue
+    }
+    t.upload(t.resize(img))
+  }
+}
@@ -0,0 +1,15 @@
+package render
+
+// #include <pthread.h>
+// #include <stdint.h>
+// static uint64_t glopThreadId() {
+//   uint64_t id;
+//   pthread_threadid_np(NULL, &id);
+//   return id;
+// }
+import "C"
+
+// Returns the id of the OS thread that the caller is running on.
+func threadId() uint64 {
+  return uint64(C.glopThreadId())
+}
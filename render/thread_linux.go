@@ -0,0 +1,10 @@
+package render
+
+import (
+  "syscall"
+)
+
+// Returns the id of the OS thread that the caller is running on.
+func threadId() uint64 {
+  return uint64(syscall.Gettid())
+}
@@ -0,0 +1,13 @@
+package render
+
+import (
+  "syscall"
+)
+
+var get_current_thread_id = syscall.NewLazyDLL("kernel32.dll").NewProc("GetCurrentThreadId")
+
+// Returns the id of the OS thread that the caller is running on.
+func threadId() uint64 {
+  id, _, _ := get_current_thread_id.Call()
+  return uint64(id)
+}
@@ -1,14 +1,34 @@
 package sprite_test
 
 import (
+  "github.com/MobRulesGames/glop/render"
+  "github.com/MobRulesGames/glop/sprite"
   "github.com/orfjackal/gospec/src/gospec"
+  "io/ioutil"
+  "os"
   "testing"
 )
 
 func TestAllSpecs(t *testing.T) {
+  // Sheets composed by the specs go in a cache of their own rather than in
+  // the user's cache directory
+  dir, err := ioutil.TempDir("", "glop-sprite-cache")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+  sprite.SetCacheDir(dir)
+  render.Init()
+  render.SetRenderer(soft)
+
   r := gospec.NewRunner()
   r.AddSpec(LoadSpriteSpec)
   r.AddSpec(CommandNSpec)
   r.AddSpec(SyncSpec)
+  r.AddSpec(HeadlessSpec)
+  r.AddSpec(DrawGoldenSpec)
+  r.AddSpec(LintSpec)
+  r.AddSpec(GraphsTogetherSpec)
+  r.AddSpec(CacheSpec)
   gospec.MainGoTest(r, t)
 }
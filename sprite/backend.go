@@ -0,0 +1,76 @@
+package sprite
+
+import (
+  "github.com/MobRulesGames/glop/render"
+  "image"
+  "image/color"
+  "sync"
+)
+
+// A backend turns sprite sheets into something that can be drawn.  Sprite
+// logic, the state and anim graphs and the layout of the sheets, doesn't
+// depend on it, so a sprite can run with no backend at all.
+type backend interface {
+  // Called once for each sprite loaded by a manager.
+  setup()
+
+  // Called when a sheet gets its first reference, and when it loses its
+  // last one.  These are called from the sheet's own goroutine, in order.
+  load(s *sheet)
+  unload(s *sheet)
+}
+
+// Composes sheets from their frames and uploads them as textures with the
+// render package.
+type renderBackend struct{}
+
+var error_texture *render.Texture
+var gen_tex_once sync.Once
+
+func (renderBackend) setup() {
+  // We can't run this during an init() function because it will get queued to
+  // run before the opengl context is created, so we just check here and run
+  // it if we haven't run it before.
+  gen_tex_once.Do(func() {
+    render.Queue(func() {
+      pink := image.NewRGBA(image.Rect(0, 0, 1, 1))
+      pink.Set(0, 0, color.RGBA{255, 0, 255, 255})
+      error_texture = render.Textures().LoadImage(pink, render.TextureOptions{
+        Filter:  render.Linear,
+        Mipmaps: true,
+      })
+    })
+  })
+}
+
+func (renderBackend) load(s *sheet) {
+  if s.ready == nil {
+    s.ready = make(chan bool, 1)
+  }
+  pixer := make(chan []byte)
+  go s.compose(pixer)
+  go func() {
+    render.QueueNamedAt(render.Background, "sprite-upload", func() {
+      s.makeTexture(pixer)
+      s.ready <- true
+    })
+  }()
+}
+
+func (renderBackend) unload(s *sheet) {
+  go func() {
+    <-s.ready
+    render.Queue(func() {
+      s.texture.Release()
+      s.texture = nil
+    })
+  }()
+}
+
+// Never touches the frames' pixels, so sprites can be simulated on a server
+// or in a test without an OpenGL context.
+type headlessBackend struct{}
+
+func (headlessBackend) setup()          {}
+func (headlessBackend) load(s *sheet)   {}
+func (headlessBackend) unload(s *sheet) {}
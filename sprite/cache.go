@@ -0,0 +1,268 @@
+package sprite
+
+import (
+  "bytes"
+  "crypto/sha1"
+  "encoding/binary"
+  "fmt"
+  "github.com/MobRulesGames/memory"
+  "hash/crc32"
+  "io"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+)
+
+// Bump this whenever the way sheets are composed or stored changes, so that
+// sheets cached by older versions are never used.
+const cache_version = 1
+
+var cache_magic = [8]byte{'g', 'l', 'o', 'p', 's', 'h', 't', 0}
+
+const cache_ext = ".sheet"
+
+// Every cached sheet starts with this, followed by the pixels.
+type cacheHeader struct {
+  Magic   [8]byte
+  Version uint32
+  Dx, Dy  uint32
+  Length  uint32
+  Crc     uint32
+}
+
+// Composed sheets are stored in dir, named by a hash of their layout and of
+// the contents and mtimes of their frames, so editing a frame always gives
+// its sheets a new name.  Names start with a hash of just the layout, which
+// is how older sheets for the same layout are found and removed.  Caching is
+// disabled if dir is "".
+type sheetCache struct {
+  dir string
+}
+
+// Returns the directory that sprite sheets are cached in unless SetCacheDir
+// is used.  This is $GLOP_SPRITE_CACHE if it is set, otherwise it is in the
+// user's cache directory.
+func DefaultCacheDir() string {
+  if dir := os.Getenv("GLOP_SPRITE_CACHE"); dir != "" {
+    return dir
+  }
+  base, err := os.UserCacheDir()
+  if err != nil {
+    base = os.TempDir()
+  }
+  return filepath.Join(base, "glop", "sprites")
+}
+
+// The contents of a frame's image file, data is nil if it doesn't exist.
+type frameFile struct {
+  data []byte
+  info os.FileInfo
+}
+
+func (s *sheet) sortedFids() []frameId {
+  var fids []frameId
+  for fid := range s.rects {
+    fids = append(fids, fid)
+  }
+  sort.Sort(frameIdArray(fids))
+  return fids
+}
+
+func (s *sheet) readFrames() map[frameId]frameFile {
+  frames := make(map[frameId]frameFile)
+  for fid := range s.rects {
+    name := s.anim.Node(fid.node).Line(0) + ".png"
+    filename := filepath.Join(s.path, fmt.Sprintf("%d", fid.facing), name)
+    var frame frameFile
+    if info, err := os.Stat(filename); err == nil {
+      if data, err := ioutil.ReadFile(filename); err == nil {
+        frame = frameFile{data, info}
+      }
+    }
+    frames[fid] = frame
+  }
+  return frames
+}
+
+// Returns a hash of where the sheet's frames come from, which stays the same
+// when the frames are edited.
+func (s *sheet) layoutName() string {
+  h := sha1.New()
+  path, err := filepath.Abs(s.path)
+  if err != nil {
+    path = s.path
+  }
+  fmt.Fprintf(h, "%q\n", path)
+  for _, fid := range s.sortedFids() {
+    fmt.Fprintf(h, "%d %q\n", fid.facing, s.anim.Node(fid.node).Line(0))
+  }
+  return fmt.Sprintf("%x", h.Sum(nil)[:8])
+}
+
+// Returns the name that the sheet is cached under given what is in its
+// frames right now.
+func (s *sheet) cacheName(frames map[frameId]frameFile) string {
+  h := sha1.New()
+  fmt.Fprintf(h, "%d %d %d\n", cache_version, s.dx, s.dy)
+  for _, fid := range s.sortedFids() {
+    rect := s.rects[fid]
+    frame := frames[fid]
+    fmt.Fprintf(h, "%d %q %d %d %d %d", fid.facing, s.anim.Node(fid.node).Line(0), rect.X, rect.Y, rect.X2, rect.Y2)
+    if frame.data != nil {
+      fmt.Fprintf(h, " %d %d\n", frame.info.Size(), frame.info.ModTime().UnixNano())
+      h.Write(frame.data)
+    } else {
+      fmt.Fprintf(h, " missing\n")
+    }
+  }
+  return fmt.Sprintf("%s-%x%s", s.layoutName(), h.Sum(nil), cache_ext)
+}
+
+// Returns the cached pixels of a dx by dy sheet, in a block from the memory
+// package, or nil if they aren't cached.  Anything that doesn't look exactly
+// like a sheet written by this version is removed so that it gets rebuilt.
+func (c sheetCache) read(name string, dx, dy int) []byte {
+  if c.dir == "" {
+    return nil
+  }
+  filename := filepath.Join(c.dir, name)
+  f, err := os.Open(filename)
+  if err != nil {
+    return nil
+  }
+  defer f.Close()
+  var header cacheHeader
+  if binary.Read(f, binary.LittleEndian, &header) == nil &&
+    header.Magic == cache_magic &&
+    header.Version == cache_version &&
+    int(header.Dx) == dx && int(header.Dy) == dy &&
+    int(header.Length) == 4*dx*dy {
+    pix := memory.GetBlock(int(header.Length))
+    if _, err := io.ReadFull(f, pix); err == nil && crc32.ChecksumIEEE(pix) == header.Crc {
+      return pix
+    }
+    memory.FreeBlock(pix)
+  }
+  os.Remove(filename)
+  return nil
+}
+
+// Stores pix under name and removes the older sheets for the same layout.
+// Sheets are written to a temporary file first so that nothing ever reads a
+// partly written sheet.  Failures are ignored, the sheet will just be
+// composed again next time.
+func (c sheetCache) write(name string, dx, dy int, pix []byte) {
+  if c.dir == "" {
+    return
+  }
+  if err := os.MkdirAll(c.dir, 0755); err != nil {
+    return
+  }
+  f, err := ioutil.TempFile(c.dir, "tmp-")
+  if err != nil {
+    return
+  }
+  header := cacheHeader{
+    Magic:   cache_magic,
+    Version: cache_version,
+    Dx:      uint32(dx),
+    Dy:      uint32(dy),
+    Length:  uint32(len(pix)),
+    Crc:     crc32.ChecksumIEEE(pix),
+  }
+  var buf bytes.Buffer
+  binary.Write(&buf, binary.LittleEndian, header)
+  err = f.Chmod(0644)
+  if err == nil {
+    _, err = f.Write(buf.Bytes())
+  }
+  if err == nil {
+    _, err = f.Write(pix)
+  }
+  if cerr := f.Close(); err == nil {
+    err = cerr
+  }
+  if err == nil {
+    err = os.Rename(f.Name(), filepath.Join(c.dir, name))
+  }
+  if err != nil {
+    os.Remove(f.Name())
+    return
+  }
+  c.removeOthers(name)
+}
+
+// Removes every sheet other than name that has the same layout, since they
+// were composed from frames that have changed since.
+func (c sheetCache) removeOthers(name string) {
+  layout := name[:strings.Index(name, "-")+1]
+  infos, err := ioutil.ReadDir(c.dir)
+  if err != nil {
+    return
+  }
+  for _, info := range infos {
+    other := info.Name()
+    if other != name && strings.HasPrefix(other, layout) && strings.HasSuffix(other, cache_ext) {
+      os.Remove(filepath.Join(c.dir, other))
+    }
+  }
+}
+
+// Removes every cached sheet from dir, along with anything left over from
+// writes that never finished, and returns how many files were removed.
+// Nothing else in dir is touched.
+func ClearCache(dir string) (int, error) {
+  infos, err := ioutil.ReadDir(dir)
+  if os.IsNotExist(err) {
+    return 0, nil
+  }
+  if err != nil {
+    return 0, err
+  }
+  removed := 0
+  for _, info := range infos {
+    name := info.Name()
+    if info.IsDir() || !(strings.HasSuffix(name, cache_ext) || strings.HasPrefix(name, "tmp-")) {
+      continue
+    }
+    if err := os.Remove(filepath.Join(dir, name)); err != nil {
+      return removed, err
+    }
+    removed++
+  }
+  return removed, nil
+}
+
+// Sets the directory that this manager caches composed sprite sheets in, ""
+// turns caching off.  This only affects sprites loaded afterwards.
+func (m *Manager) SetCacheDir(dir string) {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  m.cache = sheetCache{dir}
+}
+
+// Sets the cache directory of the Manager used by LoadSprite.
+func SetCacheDir(dir string) {
+  the_manager.SetCacheDir(dir)
+}
+
+// Composes every sheet of the sprite at path and stores them in this
+// manager's cache, so that the sprite loads quickly the first time it is
+// used.  Sheets that are already cached are only read back to check them.
+func (m *Manager) PrewarmCache(path string) error {
+  path = filepath.Clean(path)
+  if err := m.loadSharedSprite(path); err != nil {
+    return err
+  }
+  m.mutex.Lock()
+  ss := m.shared[path]
+  m.mutex.Unlock()
+  for _, s := range append([]*sheet{ss.connector}, ss.facings...) {
+    pixer := make(chan []byte, 1)
+    s.compose(pixer)
+    memory.FreeBlock(<-pixer)
+  }
+  return nil
+}
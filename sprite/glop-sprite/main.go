@@ -0,0 +1,136 @@
+// glop-sprite checks sprite directories for problems before they are
+// committed, and manages the cache of composed sprite sheets.
+//
+// Usage:
+//
+//   glop-sprite lint [-json] [-q] <dir>...
+//   glop-sprite cache clear [-dir cache]
+//   glop-sprite cache prewarm [-dir cache] <dir>...
+//
+// lint lists every problem found in each directory, as text or as a JSON
+// array.  The exit status is 1 if any errors were found, warnings alone
+// don't affect it.
+//
+// cache clear removes every cached sheet, and cache prewarm composes and
+// caches every sheet of each sprite so that they load quickly the first
+// time.  Both use the same cache directory as the game, unless -dir is
+// given.
+package main
+
+import (
+  "encoding/json"
+  "flag"
+  "fmt"
+  "github.com/MobRulesGames/glop/sprite"
+  "os"
+)
+
+func usage() {
+  fmt.Fprintf(os.Stderr, "usage: glop-sprite lint [-json] [-q] <dir>...\n")
+  fmt.Fprintf(os.Stderr, "       glop-sprite cache clear [-dir cache]\n")
+  fmt.Fprintf(os.Stderr, "       glop-sprite cache prewarm [-dir cache] <dir>...\n")
+  os.Exit(2)
+}
+
+func lint(args []string) int {
+  flags := flag.NewFlagSet("lint", flag.ExitOnError)
+  as_json := flags.Bool("json", false, "write problems as a JSON array")
+  quiet := flags.Bool("q", false, "only report errors, not warnings")
+  flags.Parse(args)
+  if flags.NArg() == 0 {
+    usage()
+  }
+
+  // Warnings are counted even when they aren't reported
+  problems := []sprite.Problem{}
+  errors, warnings := 0, 0
+  for _, dir := range flags.Args() {
+    for _, p := range sprite.Lint(dir) {
+      if p.Severity == sprite.Error {
+        errors++
+      } else {
+        warnings++
+        if *quiet {
+          continue
+        }
+      }
+      problems = append(problems, p)
+    }
+  }
+
+  if *as_json {
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    if err := enc.Encode(problems); err != nil {
+      fmt.Fprintf(os.Stderr, "Unable to write problems: %v\n", err)
+      return 2
+    }
+  } else {
+    for _, p := range problems {
+      fmt.Println(p)
+    }
+    fmt.Printf("%d errors, %d warnings\n", errors, warnings)
+  }
+  if errors > 0 {
+    return 1
+  }
+  return 0
+}
+
+func cache(args []string) int {
+  if len(args) == 0 {
+    usage()
+  }
+  flags := flag.NewFlagSet("cache "+args[0], flag.ExitOnError)
+  dir := flags.String("dir", sprite.DefaultCacheDir(), "the cache directory")
+  flags.Parse(args[1:])
+
+  switch args[0] {
+  case "clear":
+    if flags.NArg() != 0 {
+      usage()
+    }
+    removed, err := sprite.ClearCache(*dir)
+    if err != nil {
+      fmt.Fprintf(os.Stderr, "Unable to clear %s: %v\n", *dir, err)
+      return 1
+    }
+    fmt.Printf("Removed %d sheets from %s\n", removed, *dir)
+
+  case "prewarm":
+    if flags.NArg() == 0 {
+      usage()
+    }
+    m := sprite.MakeHeadlessManager()
+    m.SetCacheDir(*dir)
+    failed := 0
+    for _, path := range flags.Args() {
+      if err := m.PrewarmCache(path); err != nil {
+        fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+        failed++
+      }
+    }
+    fmt.Printf("Cached %d sprites in %s\n", flags.NArg()-failed, *dir)
+    if failed > 0 {
+      return 1
+    }
+
+  default:
+    usage()
+  }
+  return 0
+}
+
+func main() {
+  if len(os.Args) < 2 {
+    usage()
+  }
+  switch os.Args[1] {
+  case "lint":
+    os.Exit(lint(os.Args[2:]))
+  case "cache":
+    os.Exit(cache(os.Args[2:]))
+  default:
+    usage()
+  }
+}
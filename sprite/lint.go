@@ -0,0 +1,639 @@
+package sprite
+
+import (
+  "fmt"
+  "github.com/MobRulesGames/yedparse"
+  "image"
+  "os"
+  "path/filepath"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+type Severity int
+
+const (
+  // Something that is probably a mistake but that the sprite can be loaded
+  // with anyway
+  Warning Severity = iota
+
+  // Something that LoadSprite will refuse to load
+  Error
+)
+
+func (s Severity) String() string {
+  if s == Error {
+    return "error"
+  }
+  return "warning"
+}
+
+// Severities are written as "error" and "warning" in JSON.
+func (s Severity) MarshalText() ([]byte, error) {
+  return []byte(s.String()), nil
+}
+
+// A Problem is something wrong with a sprite, as found by Lint.
+type Problem struct {
+  Severity Severity `json:"severity"`
+
+  // The file or directory that the problem is in
+  File string `json:"file"`
+
+  // Labels of the node and edge that the problem is with, if it is with a
+  // node or an edge.  Edges are described as "src -> dst", followed by
+  // their label in brackets if they have one.
+  Node string `json:"node,omitempty"`
+  Edge string `json:"edge,omitempty"`
+
+  Message string `json:"message"`
+
+  // Prefixed to the message when the problem is returned as an error by
+  // LoadSprite
+  context string
+}
+
+func (p Problem) String() string {
+  s := fmt.Sprintf("%s: %v: ", p.File, p.Severity)
+  if p.Node != "" {
+    s += fmt.Sprintf("node '%s': ", p.Node)
+  }
+  if p.Edge != "" {
+    s += fmt.Sprintf("edge '%s': ", p.Edge)
+  }
+  return s + p.Message
+}
+
+func describeNode(n *yed.Node) string {
+  if n.NumLines() == 0 {
+    return fmt.Sprintf("#%d", n.Id())
+  }
+  return n.Line(0)
+}
+
+func describeEdge(e *yed.Edge) string {
+  s := fmt.Sprintf("%s -> %s", describeNode(e.Src()), describeNode(e.Dst()))
+  if e.NumLines() > 0 {
+    s += fmt.Sprintf(" (%s)", e.Line(0))
+  }
+  return s
+}
+
+// Collects problems as a sprite is verified.  Problems are added against
+// file, and if they end up being returned by LoadSprite they are prefixed
+// with context.
+type problems struct {
+  list    []Problem
+  file    string
+  context string
+}
+
+func (p *problems) add(severity Severity, node *yed.Node, edge *yed.Edge, format string, args ...interface{}) {
+  prob := Problem{
+    Severity: severity,
+    File:     p.file,
+    Message:  fmt.Sprintf(format, args...),
+    context:  p.context,
+  }
+  if node != nil {
+    prob.Node = describeNode(node)
+  }
+  if edge != nil {
+    prob.Edge = describeEdge(edge)
+  }
+  p.list = append(p.list, prob)
+}
+
+func (p *problems) addFile(severity Severity, file string, format string, args ...interface{}) {
+  p.list = append(p.list, Problem{
+    Severity: severity,
+    File:     file,
+    Message:  fmt.Sprintf(format, args...),
+    context:  p.context,
+  })
+}
+
+// Returns the first error that has been found, if any.
+func (p *problems) err() error {
+  for _, prob := range p.list {
+    if prob.Severity == Error {
+      return &spriteError{prob.context + prob.Message}
+    }
+  }
+  return nil
+}
+
+// Valid state and anim graphs have the following properties:
+// * All nodes are labeled
+// * It has exactly one node that has the tag "mark" : "start"
+// * All nodes in the graph can be reached by starting at the start node
+// * All nodes and edges have only the specified tags
+func verifyAnyGraph(graph *yed.Graph, node_tags, edge_tags []string, p *problems) {
+  valid_node_tags := make(map[string]bool)
+  for _, tag := range node_tags {
+    valid_node_tags[tag] = true
+  }
+
+  valid_edge_tags := make(map[string]bool)
+  for _, tag := range edge_tags {
+    valid_edge_tags[tag] = true
+  }
+
+  // Check that all nodes have labels
+  for i := 0; i < graph.NumNodes(); i++ {
+    node := graph.Node(i)
+    if node.NumLines() == 0 || strings.Contains(node.Line(0), ":") {
+      p.add(Error, node, nil, "contains an unlabeled node")
+    }
+  }
+
+  // Check that there is exactly one start node
+  var start *yed.Node
+  for i := 0; i < graph.NumNodes(); i++ {
+    if graph.Node(i).Tag("mark") == "start" {
+      if start == nil {
+        start = graph.Node(i)
+      } else {
+        p.add(Error, graph.Node(i), nil, "more than one node is marked as the start node")
+      }
+    }
+  }
+  if start == nil {
+    p.add(Error, nil, nil, "no start node was found")
+  }
+
+  // Check that all nodes can be reached by the start node
+  if start != nil {
+    used := make(map[*yed.Node]bool)
+    next := make(map[*yed.Node]bool)
+    next[start] = true
+    for len(next) > 0 {
+      var nodes []*yed.Node
+      for node := range next {
+        nodes = append(nodes, node)
+      }
+      for _, node := range nodes {
+        delete(next, node)
+        used[node] = true
+      }
+      for _, node := range nodes {
+        // Traverse the parent
+        if node.Group() != nil && !used[node.Group()] {
+          next[node.Group()] = true
+        }
+        // Traverse all the children
+        for i := 0; i < node.NumChildren(); i++ {
+          if !used[node.Child(i)] {
+            next[node.Child(i)] = true
+          }
+        }
+        // Traverse all outputs
+        for i := 0; i < node.NumOutputs(); i++ {
+          adj := node.Output(i).Dst()
+          if !used[adj] {
+            next[adj] = true
+          }
+        }
+      }
+    }
+    for i := 0; i < graph.NumNodes(); i++ {
+      if !used[graph.Node(i)] {
+        p.add(Error, graph.Node(i), nil, "not all nodes are reachable from the start node")
+      }
+    }
+  }
+
+  // Check that nodes only have the specified tags
+  for i := 0; i < graph.NumNodes(); i++ {
+    node := graph.Node(i)
+    for _, tag := range node.TagKeys() {
+      if !(valid_node_tags[tag] || (node == start && tag == "mark")) {
+        p.add(Error, node, nil, "a node has an unknown tag (%s)", tag)
+      }
+    }
+  }
+
+  // Check that edges only have the specified tags
+  for i := 0; i < graph.NumEdges(); i++ {
+    edge := graph.Edge(i)
+    for _, tag := range edge.TagKeys() {
+      if !valid_edge_tags[tag] {
+        p.add(Error, nil, edge, "an edge has an unknown tag (%s)", tag)
+      }
+    }
+  }
+}
+
+// A valid state graph has the following properties in addition to those
+// specified in verifyAnyGraph():
+// * All output edges from the start node have labels
+// * No node has more than one unlabeled output edge
+// * There are no tags on any nodes except for the start node
+// * There are no groups
+func verifyStateGraph(graph *yed.Graph, p *problems) {
+  p.context = "State graph: "
+  verifyAnyGraph(graph, []string{}, []string{"facing"}, p)
+
+  // Check that all output edges from the start node have labels
+  if start := getStartNode(graph); start != nil {
+    for i := 0; i < start.NumOutputs(); i++ {
+      edge := start.Output(i)
+      if edge.NumLines() == 0 || strings.Contains(edge.Line(0), ":") {
+        p.add(Error, nil, edge, "The start node has an unlabeled output edge")
+      }
+    }
+  }
+
+  // Check that no node has more than one unlabeled output edge
+  for i := 0; i < graph.NumNodes(); i++ {
+    node := graph.Node(i)
+    num_labels := 0
+    for j := 0; j < node.NumOutputs(); j++ {
+      edge := node.Output(j)
+      if edge.NumLines() > 0 && !strings.Contains(edge.Line(0), ":") {
+        num_labels++
+      }
+    }
+    if num_labels < node.NumOutputs()-1 {
+      p.add(Error, node, nil, "Found more than one unlabeled output edge on node '%s'", describeNode(node))
+    }
+  }
+
+  // Check that no nodes are groups
+  for i := 0; i < graph.NumNodes(); i++ {
+    node := graph.Node(i)
+    if node.NumChildren() > 0 {
+      p.add(Error, node, nil, "cannot contain groups")
+    }
+  }
+}
+
+// A valid anim graph has the properties specified in verifyAnyGraph()
+func verifyAnimGraph(graph *yed.Graph, p *problems) {
+  p.context = "Anim graph: "
+  verifyAnyGraph(graph, []string{"time", "sync", "func", "state"}, []string{"facing", "weight"}, p)
+}
+
+// Returns the command that an edge responds to, the same way that process()
+// does.
+func edgeCmd(edge *yed.Edge) string {
+  if edge.NumLines() == 0 || strings.Contains(edge.Line(0), ":") {
+    return ""
+  }
+  return edge.Line(0)
+}
+
+func edgeFacing(edge *yed.Edge) int {
+  f, _ := strconv.Atoi(edge.Tag("facing"))
+  return f
+}
+
+// Returns all of the nodes that can be reached from node without any
+// commands, including node.
+func animClosure(node *yed.Node) []*yed.Node {
+  used := map[*yed.Node]bool{node: true}
+  nodes := []*yed.Node{node}
+  for i := 0; i < len(nodes); i++ {
+    for j := 0; j < nodes[i].NumGroupOutputs(); j++ {
+      edge := nodes[i].GroupOutput(j)
+      if edgeCmd(edge) == "" && !used[edge.Dst()] {
+        used[edge.Dst()] = true
+        nodes = append(nodes, edge.Dst())
+      }
+    }
+  }
+  return nodes
+}
+
+// Returns the edges responding to cmd that can be reached from node, the
+// same way that findPathForCmd would look for them.
+func findCmdEdges(node *yed.Node, cmd string) []*yed.Edge {
+  var edges []*yed.Edge
+  used := map[*yed.Node]bool{node: true}
+  nodes := []*yed.Node{node}
+  for i := 0; i < len(nodes); i++ {
+    for j := 0; j < nodes[i].NumGroupOutputs(); j++ {
+      edge := nodes[i].GroupOutput(j)
+      switch edgeCmd(edge) {
+      case cmd:
+        edges = append(edges, edge)
+      case "":
+        if !used[edge.Dst()] {
+          used[edge.Dst()] = true
+          nodes = append(nodes, edge.Dst())
+        }
+      }
+    }
+  }
+  return edges
+}
+
+// Follows unlabeled edges from node until there are none left, the same way
+// that baseCommand does after a command.
+func settleState(node *yed.Node) *yed.Node {
+  used := make(map[*yed.Node]bool)
+  for !used[node] {
+    used[node] = true
+    var next *yed.Node
+    for i := 0; i < node.NumOutputs(); i++ {
+      if edgeCmd(node.Output(i)) == "" {
+        next = node.Output(i).Dst()
+      }
+    }
+    if next == nil {
+      break
+    }
+    node = next
+  }
+  return node
+}
+
+// Walks the state and anim graphs together, starting from their start nodes,
+// and checks the following things:
+// * Every command in the state graph can be followed in the anim graph from
+//   every anim frame that the sprite could be on when the command is given
+// * The anim edges that a command follows change the facing by the same
+//   amount that the state edge does
+// * Anim edges without a command don't change the facing, since the state
+//   graph couldn't follow them
+// * Every sync tag that can be reached after a command can be reached after
+//   it no matter which anim edge was taken, so that CommandSync can always
+//   find it
+func verifyGraphsTogether(path string, state, anim *yed.Graph, p *problems) {
+  p.context = ""
+  state_start := getStartNode(state)
+  anim_start := getStartNode(anim)
+  if state_start == nil || anim_start == nil {
+    return
+  }
+
+  p.file = filepath.Join(path, "anim.xgml")
+  for i := 0; i < anim.NumEdges(); i++ {
+    edge := anim.Edge(i)
+    if edgeCmd(edge) == "" && edgeFacing(edge) != 0 {
+      p.add(Error, nil, edge, "An edge without a command changes the facing")
+    }
+  }
+
+  // Every problem is with a state and command pair, only report each kind
+  // of problem once per pair even if several anim frames have it.
+  p.file = filepath.Join(path, "state.xgml")
+  type reportKey struct {
+    edge   *yed.Edge
+    format string
+  }
+  reported := make(map[reportKey]bool)
+  report := func(node *yed.Node, edge *yed.Edge, format string, args ...interface{}) {
+    key := reportKey{edge, format}
+    if reported[key] {
+      return
+    }
+    reported[key] = true
+    msg := fmt.Sprintf("State '%s', command '%s': ", describeNode(node), edgeCmd(edge))
+    p.add(Error, node, edge, "%s", msg+fmt.Sprintf(format, args...))
+  }
+
+  type pair struct {
+    state, anim *yed.Node
+  }
+  used := map[pair]bool{pair{state_start, anim_start}: true}
+  pairs := []pair{{state_start, anim_start}}
+  for i := 0; i < len(pairs); i++ {
+    cur := pairs[i]
+    frames := animClosure(cur.anim)
+    for j := 0; j < cur.state.NumOutputs(); j++ {
+      state_edge := cur.state.Output(j)
+      cmd := edgeCmd(state_edge)
+      if cmd == "" {
+        continue
+      }
+      next_state := settleState(state_edge.Dst())
+      var dsts []*yed.Node
+      for _, frame := range frames {
+        edges := findCmdEdges(frame, cmd)
+        if len(edges) == 0 {
+          report(cur.state, state_edge, "no path in the anim graph from frame '%s'", describeNode(frame))
+        }
+        for _, edge := range edges {
+          if edgeFacing(edge) != edgeFacing(state_edge) {
+            report(cur.state, state_edge, "anim edge '%s' changes the facing by %d instead of %d", describeEdge(edge), edgeFacing(edge), edgeFacing(state_edge))
+          }
+          dsts = append(dsts, edge.Dst())
+          next := pair{next_state, edge.Dst()}
+          if !used[next] {
+            used[next] = true
+            pairs = append(pairs, next)
+          }
+        }
+      }
+
+      // Check that every sync tag is reachable after every edge
+      tags := make(map[*yed.Node]map[string]bool)
+      all_tags := make(map[string]bool)
+      for _, dst := range dsts {
+        if tags[dst] != nil {
+          continue
+        }
+        tags[dst] = make(map[string]bool)
+        for _, node := range animClosure(dst) {
+          if tag := node.Tag("sync"); tag != "" {
+            tags[dst][tag] = true
+            all_tags[tag] = true
+          }
+        }
+      }
+      var sorted []string
+      for tag := range all_tags {
+        sorted = append(sorted, tag)
+      }
+      sort.Strings(sorted)
+      for _, dst := range dsts {
+        for _, tag := range sorted {
+          if !tags[dst][tag] {
+            report(cur.state, state_edge, "sync tag '%s' can't be reached from frame '%s'", tag, describeNode(dst))
+          }
+        }
+      }
+    }
+  }
+}
+
+// Traverse the directory and do the following things:
+// * There are n > 0 directories
+// * There is at most 1 other file immediately within path - a thumb.png
+// * All of the directories have names that are integers 0 - (n-1)
+// * No image is present in any facing that isn't present in the anim graph
+// If graph is nil the images aren't checked against it.
+func verifyDirectoryStructure(path string, graph *yed.Graph, p *problems) (num_facings int, filenames []string) {
+  p.context = ""
+  var dirs []string
+  filepath.Walk(path, func(cpath string, info os.FileInfo, err error) error {
+    if err != nil {
+      p.addFile(Error, cpath, "%v", err)
+      return nil
+    }
+    if cpath == path {
+      return nil
+    }
+
+    // skip hidden files
+    if _, file := filepath.Split(cpath); file[0] == '.' {
+      if info.IsDir() {
+        return filepath.SkipDir
+      }
+      return nil
+    }
+
+    if info.IsDir() {
+      num_facings++
+      dirs = append(dirs, cpath)
+      return filepath.SkipDir
+    } else {
+      switch {
+      case info.Name() == "anim.xgml":
+      case info.Name() == "state.xgml":
+      case info.Name() == "thumb.png":
+      case strings.HasSuffix(info.Name(), ".gob"):
+        p.addFile(Warning, cpath, "Found a sheet cached by an older version of glop, it can be deleted: %s", tryRelPath(path, cpath))
+      default:
+        p.addFile(Error, cpath, "Unexpected file found in sprite directory, %s", tryRelPath(path, cpath))
+      }
+    }
+    return nil
+  })
+  if num_facings == 0 {
+    p.addFile(Error, path, "Found no facings in the sprite directory")
+    return
+  }
+  for _, dir := range dirs {
+    facing, err := strconv.Atoi(filepath.Base(dir))
+    if err != nil || facing < 0 || facing >= num_facings {
+      p.addFile(Error, dir, "Facing directories must be named 0 to %d, found %s", num_facings-1, tryRelPath(path, dir))
+    }
+  }
+
+  // Create a set of valid png filenames.  If a .png shows up that is not in
+  // this set then we raise an error.  Non-png files are allowed and are
+  // ignored.
+  valid_names := make(map[string]bool)
+  if graph != nil {
+    for i := 0; i < graph.NumNodes(); i++ {
+      // Unlabeled nodes have already been reported
+      if graph.Node(i).NumLines() > 0 {
+        valid_names[graph.Node(i).Line(0)+".png"] = true
+      }
+    }
+  }
+
+  filenames_map := make(map[string]bool)
+  for facing := 0; facing < num_facings; facing++ {
+    cur := filepath.Join(path, fmt.Sprintf("%d", facing))
+    filepath.Walk(cur, func(cpath string, info os.FileInfo, err error) error {
+      if err != nil {
+        p.addFile(Error, cpath, "%v", err)
+        return nil
+      }
+      if cpath == cur {
+        return nil
+      }
+
+      // skip hidden files
+      if _, file := filepath.Split(cpath); file[0] == '.' {
+        if info.IsDir() {
+          return filepath.SkipDir
+        }
+        return nil
+      }
+
+      if info.IsDir() {
+        p.addFile(Error, cpath, "Found a directory inside facing directory %d, %s", facing, tryRelPath(path, cpath))
+        return filepath.SkipDir
+      }
+      if filepath.Ext(cpath) == ".png" {
+        base := filepath.Base(cpath)
+        if valid_names[base] || graph == nil {
+          filenames_map[base] = true
+        } else {
+          p.addFile(Error, cpath, "Found an unused .png file: %s", tryRelPath(path, cpath))
+        }
+      }
+      return nil
+    })
+  }
+
+  for filename := range filenames_map {
+    filenames = append(filenames, filename)
+  }
+  sort.Strings(filenames)
+
+  return
+}
+
+// Checks that every frame in the anim graph has an image that can be read in
+// every facing.  Missing images are allowed, they are just drawn with the
+// error texture, so those are only warnings.
+func verifyFrames(path string, graph *yed.Graph, num_facings int, p *problems) {
+  p.context = ""
+  for facing := 0; facing < num_facings; facing++ {
+    for i := 0; i < graph.NumNodes(); i++ {
+      node := graph.Node(i)
+      // Groups don't have frames of their own
+      if node.NumChildren() > 0 || node.NumLines() == 0 {
+        continue
+      }
+      name := filepath.Join(path, fmt.Sprintf("%d", facing), node.Line(0)+".png")
+      file, err := os.Open(name)
+      if err != nil {
+        p.addFile(Warning, name, "No image for frame '%s' in facing %d", node.Line(0), facing)
+        continue
+      }
+      _, _, err = image.DecodeConfig(file)
+      file.Close()
+      if err != nil {
+        p.addFile(Error, name, "Unable to read image: %v", err)
+      }
+    }
+  }
+}
+
+// Checks everything about the sprite in the directory at path that
+// LoadSprite would, and a few things that it lets slide, and returns every
+// problem that it finds rather than stopping at the first one.
+func Lint(path string) []Problem {
+  path = filepath.Clean(path)
+  var p problems
+
+  p.file = filepath.Join(path, "state.xgml")
+  var state_graph *yed.Graph
+  state, err := yed.ParseFromFile(p.file)
+  if err != nil {
+    p.add(Error, nil, nil, "Unable to parse: %v", err)
+  } else {
+    state_graph = &state.Graph
+    verifyStateGraph(state_graph, &p)
+  }
+
+  p.file = filepath.Join(path, "anim.xgml")
+  var anim_graph *yed.Graph
+  anim, err := yed.ParseFromFile(p.file)
+  if err != nil {
+    p.add(Error, nil, nil, "Unable to parse: %v", err)
+  } else {
+    anim_graph = &anim.Graph
+    verifyAnimGraph(anim_graph, &p)
+  }
+
+  // Like LoadSprite, the graphs are only checked against each other once
+  // they are valid on their own
+  if state_graph != nil && anim_graph != nil && p.err() == nil {
+    verifyGraphsTogether(path, state_graph, anim_graph, &p)
+  }
+
+  p.file = path
+  num_facings, _ := verifyDirectoryStructure(path, anim_graph, &p)
+  if anim_graph != nil {
+    verifyFrames(path, anim_graph, num_facings, &p)
+  }
+  return p.list
+}
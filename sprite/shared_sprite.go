@@ -29,32 +29,39 @@ type sharedSprite struct {
   manager *Manager
 }
 
-func loadSharedSprite(path string) (*sharedSprite, error) {
-  state, err := yed.ParseFromFile(filepath.Join(path, "state.xgml"))
+func loadSharedSprite(path string, b backend, cache sheetCache) (*sharedSprite, error) {
+  // Only the first error found is reported, use Lint to find all of them
+  var p problems
+  p.file = filepath.Join(path, "state.xgml")
+  state, err := yed.ParseFromFile(p.file)
   if err != nil {
     return nil, err
   }
 
-  err = verifyStateGraph(&state.Graph)
-  if err != nil {
+  verifyStateGraph(&state.Graph, &p)
+  if err := p.err(); err != nil {
     return nil, err
   }
 
-  anim, err := yed.ParseFromFile(filepath.Join(path, "anim.xgml"))
+  p.file = filepath.Join(path, "anim.xgml")
+  anim, err := yed.ParseFromFile(p.file)
   if err != nil {
     return nil, err
   }
 
-  err = verifyAnimGraph(&anim.Graph)
-  if err != nil {
+  verifyAnimGraph(&anim.Graph, &p)
+  if err := p.err(); err != nil {
     return nil, err
   }
 
-  // TODO: Verify both graphs at the same time - they both need to respond to
-  // the same commands in the same way.
+  verifyGraphsTogether(path, &state.Graph, &anim.Graph, &p)
+  if err := p.err(); err != nil {
+    return nil, err
+  }
 
-  num_facings, filenames, err := verifyDirectoryStructure(path, &anim.Graph)
-  if err != nil {
+  p.file = path
+  num_facings, filenames := verifyDirectoryStructure(path, &anim.Graph, &p)
+  if err := p.err(); err != nil {
     return nil, err
   }
 
@@ -103,7 +110,7 @@ func loadSharedSprite(path string) (*sharedSprite, error) {
     }
   }
   sort.Sort(frameIdArray(fids))
-  ss.connector, err = makeSheet(path, &anim.Graph, fids)
+  ss.connector, err = makeSheet(path, &anim.Graph, fids, b, cache)
   if err != nil {
     return nil, err
   }
@@ -123,7 +130,7 @@ func loadSharedSprite(path string) (*sharedSprite, error) {
       }
     }
     sort.Sort(frameIdArray(facing_fids))
-    sh, err := makeSheet(path, &anim.Graph, facing_fids)
+    sh, err := makeSheet(path, &anim.Graph, facing_fids, b, cache)
     if err != nil {
       return nil, err
     }
@@ -1,14 +1,11 @@
 package sprite
 
 import (
-  "encoding/binary"
+  "bytes"
   "fmt"
   "github.com/MobRulesGames/glop/render"
   "github.com/MobRulesGames/memory"
-  "github.com/MobRulesGames/opengl/gl"
-  "github.com/MobRulesGames/opengl/glu"
   "github.com/MobRulesGames/yedparse"
-  "hash/fnv"
   "image"
   "image/draw"
   "os"
@@ -43,14 +40,17 @@ type sheet struct {
   path   string
   anim   *yed.Graph
 
-  // Unique name that is based on the path of the sprite and the list of
-  // frameIds used to generate this sheet.  This name is used to store the
-  // sheet on disk when not in use.
-  name string
+  // Where the composed sheet is stored on disk when not in use
+  cache sheetCache
 
   reference_chan chan int
   load_chan      chan bool
-  texture        gl.Texture
+  backend        backend
+
+  // Only used by the render backend.  ready gets a value once the texture
+  // has been made, so that it isn't released before then.
+  ready   chan bool
+  texture *render.Texture
 }
 
 func (s *sheet) Load() {
@@ -61,104 +61,74 @@ func (s *sheet) Unload() {
   s.reference_chan <- -1
 }
 
+// Sends the pixels of the sheet along pixer, from the cache if they are
+// there, and caches them if they weren't.
 func (s *sheet) compose(pixer chan<- []byte) {
-  filename := filepath.Join(s.path, s.name)
-  f, err := os.Open(filename)
-  if err == nil {
-    var length int32
-    err := binary.Read(f, binary.LittleEndian, &length)
-    if err != nil {
-      f.Close()
-    } else {
-      b := memory.GetBlock(int(length))
-      // b := make([]byte, length)
-      _, err := f.Read(b)
-      f.Close()
-      if err == nil {
-        pixer <- b
-        return
-      }
-    }
+  // The frames are read once, both to name the sheet and to compose it
+  frames := s.readFrames()
+  name := s.cacheName(frames)
+  if pix := s.cache.read(name, s.dx, s.dy); pix != nil {
+    pixer <- pix
+    return
   }
   rect := image.Rect(0, 0, s.dx, s.dy)
   canvas := &image.RGBA{memory.GetBlock(4 * s.dx * s.dy), 4 * s.dx, rect}
+  // Blocks get reused, and the parts of the sheet that no frame covers are
+  // cached along with the rest of it
+  for i := range canvas.Pix {
+    canvas.Pix[i] = 0
+  }
   for fid, rect := range s.rects {
-    name := s.anim.Node(fid.node).Line(0) + ".png"
-    file, err := os.Open(filepath.Join(s.path, fmt.Sprintf("%d", fid.facing), name))
     // if a file isn't there that's ok
-    if err != nil {
+    if frames[fid].data == nil {
       continue
     }
 
-    im, _, err := image.Decode(file)
-    file.Close()
+    im, _, err := image.Decode(bytes.NewReader(frames[fid].data))
     // if a file can't be read that is *not* ok, TODO: Log an error or something
     if err != nil {
       continue
     }
     draw.Draw(canvas, image.Rect(rect.X, s.dy-rect.Y, rect.X2, s.dy-rect.Y2), im, image.Point{}, draw.Src)
   }
-  f, err = os.Create(filename)
-  if err == nil {
-    binary.Write(f, binary.LittleEndian, int32(len(canvas.Pix)))
-    _, err := f.Write(canvas.Pix)
-    f.Close()
-    if err != nil {
-      os.Remove(filename)
-    }
-  }
+  s.cache.write(name, s.dx, s.dy, canvas.Pix)
   pixer <- canvas.Pix
 }
 
-// TODO: This was copied from the gui package, probably should just have some basic
-// texture loading utils that do this common stuff
-func nextPowerOf2(n uint32) uint32 {
-  if n == 0 {
-    return 1
-  }
-  for i := uint(0); i < 32; i++ {
-    p := uint32(1) << i
-    if n <= p {
-      return p
-    }
-  }
-  return 0
-}
-
+// Must be called on the render thread.  The pixels from pixer are used for
+// the first upload, if the texture has to be reloaded the sheet is composed
+// again.
 func (s *sheet) makeTexture(pixer <-chan []byte) {
-  gl.Enable(gl.TEXTURE_2D)
-  s.texture = gl.GenTexture()
-  s.texture.Bind(gl.TEXTURE_2D)
-  gl.TexEnvf(gl.TEXTURE_ENV, gl.TEXTURE_ENV_MODE, gl.MODULATE)
-  gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
-  gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
-  gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
-  gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
   data := <-pixer
-  glu.Build2DMipmaps(gl.TEXTURE_2D, 4, s.dx, s.dy, gl.RGBA, data)
+  first := data
+  s.texture, _ = render.Textures().LoadFunc("", func() (image.Image, error) {
+    pix := first
+    first = nil
+    if pix == nil {
+      // A reload might not be uploaded until later, and nothing says when,
+      // so the pixels are copied out of the block so that it can be freed
+      again := make(chan []byte, 1)
+      s.compose(again)
+      block := <-again
+      pix = make([]byte, len(block))
+      copy(pix, block)
+      memory.FreeBlock(block)
+    }
+    return &image.RGBA{Pix: pix, Stride: 4 * s.dx, Rect: image.Rect(0, 0, s.dx, s.dy)}, nil
+  }, render.TextureOptions{
+    Filter:  render.Linear,
+    Mipmaps: true,
+  })
+  // Textures are uploaded immediately on the render thread
   memory.FreeBlock(data)
 }
 
 func (s *sheet) loadRoutine() {
-  ready := make(chan bool, 1)
-  pixer := make(chan []byte)
   for load := range s.load_chan {
     if load {
-      go s.compose(pixer)
-      go func() {
-        render.Queue(func() {
-          s.makeTexture(pixer)
-          ready <- true
-        })
-      }()
+      s.backend.load(s)
     } else {
-      go func() {
-        <-ready
-        render.Queue(func() {
-          s.texture.Delete()
-          s.texture = 0
-        })
-      }()
+      s.backend.unload(s)
     }
   }
 }
@@ -171,7 +141,7 @@ func (s *sheet) routine() {
   for load := range s.reference_chan {
     if load < 0 {
       if references == 0 {
-        panic(fmt.Sprintf("Tried to unload a sprite (%s/%s) sheet more times than it was loaded.", s.name, s.path))
+        panic(fmt.Sprintf("Tried to unload a sprite (%s) sheet more times than it was loaded.", s.path))
       }
       references--
       if references == 0 {
@@ -188,19 +158,8 @@ func (s *sheet) routine() {
   }
 }
 
-func uniqueName(fids []frameId) string {
-  var b []byte
-  for i := range fids {
-    b = append(b, byte(fids[i].facing))
-    b = append(b, byte(fids[i].node))
-  }
-  h := fnv.New64()
-  h.Write(b)
-  return fmt.Sprintf("%x.gob", h.Sum64())
-}
-
-func makeSheet(path string, anim *yed.Graph, fids []frameId) (*sheet, error) {
-  s := sheet{path: path, anim: anim, name: uniqueName(fids)}
+func makeSheet(path string, anim *yed.Graph, fids []frameId, b backend, cache sheetCache) (*sheet, error) {
+  s := sheet{path: path, anim: anim, backend: b, cache: cache}
   s.rects = make(map[frameId]FrameRect)
   cy := 0
   cx := 0
@@ -236,8 +195,8 @@ func makeSheet(path string, anim *yed.Graph, fids []frameId) (*sheet, error) {
       tdx = cx
     }
   }
-  s.dx = int(nextPowerOf2(uint32(tdx)))
-  s.dy = int(nextPowerOf2(uint32(cy + cdy)))
+  s.dx = int(render.NextPowerOf2(uint32(tdx)))
+  s.dy = int(render.NextPowerOf2(uint32(cy + cdy)))
   s.load_chan = make(chan bool)
   s.reference_chan = make(chan int)
   go s.routine()
@@ -4,18 +4,12 @@ import (
   "bytes"
   "encoding/gob"
   "errors"
-  "fmt"
   "github.com/MobRulesGames/glop/render"
   "github.com/MobRulesGames/glop/util/algorithm"
-  "github.com/MobRulesGames/opengl/gl"
-  "github.com/MobRulesGames/opengl/glu"
   "github.com/MobRulesGames/yedparse"
   "math/rand"
-  "os"
   "path/filepath"
-  "sort"
   "strconv"
-  "strings"
   "sync"
 )
 
@@ -50,257 +44,6 @@ func getStartNode(g *yed.Graph) *yed.Node {
   return nil
 }
 
-// Valid state and anim graphs have the following properties:
-// * All nodes are labeled
-// * It has exactly one node that has the tag "mark" : "start"
-// * All nodes in the graph can be reached by starting at the start node
-// * All nodes and edges have only the specified tags
-func verifyAnyGraph(graph *yed.Graph, node_tags, edge_tags []string) error {
-  valid_node_tags := make(map[string]bool)
-  for _, tag := range node_tags {
-    valid_node_tags[tag] = true
-  }
-
-  valid_edge_tags := make(map[string]bool)
-  for _, tag := range edge_tags {
-    valid_edge_tags[tag] = true
-  }
-
-  // Check that all nodes have labels
-  for i := 0; i < graph.NumNodes(); i++ {
-    node := graph.Node(i)
-    if node.NumLines() == 0 || strings.Contains(node.Line(0), ":") {
-      return &spriteError{"contains an unlabeled node"}
-    }
-  }
-
-  // Check that there is exactly one start node
-  var start *yed.Node
-  for i := 0; i < graph.NumNodes(); i++ {
-    if graph.Node(i).Tag("mark") == "start" {
-      if start == nil {
-        start = graph.Node(i)
-      } else {
-        return &spriteError{"more than one node is marked as the start node"}
-      }
-    }
-  }
-  if start == nil {
-    return &spriteError{"no start node was found"}
-  }
-
-  // Check that all nodes can be reached by the start node
-  used := make(map[*yed.Node]bool)
-  next := make(map[*yed.Node]bool)
-  next[start] = true
-  for len(next) > 0 {
-    var nodes []*yed.Node
-    for node := range next {
-      nodes = append(nodes, node)
-    }
-    for _, node := range nodes {
-      delete(next, node)
-      used[node] = true
-    }
-    for _, node := range nodes {
-      // Traverse the parent
-      if node.Group() != nil && !used[node.Group()] {
-        next[node.Group()] = true
-      }
-      // Traverse all the children
-      for i := 0; i < node.NumChildren(); i++ {
-        if !used[node.Child(i)] {
-          next[node.Child(i)] = true
-        }
-      }
-      // Traverse all outputs
-      for i := 0; i < node.NumOutputs(); i++ {
-        adj := node.Output(i).Dst()
-        if !used[adj] {
-          next[adj] = true
-        }
-      }
-    }
-  }
-  if len(used) != graph.NumNodes() {
-    return &spriteError{"not all nodes are reachable from the start node"}
-  }
-
-  // Check that nodes only have the specified tags
-  for i := 0; i < graph.NumNodes(); i++ {
-    node := graph.Node(i)
-    for _, tag := range node.TagKeys() {
-      if !(valid_node_tags[tag] || (node == start && tag == "mark")) {
-        return &spriteError{fmt.Sprintf("a node has an unknown tag (%s)", tag)}
-      }
-    }
-  }
-
-  // Check that edges only have the specified tags
-  for i := 0; i < graph.NumEdges(); i++ {
-    edge := graph.Edge(i)
-    for _, tag := range edge.TagKeys() {
-      if !valid_edge_tags[tag] {
-        return &spriteError{fmt.Sprintf("an edge has an unknown tag (%s)", tag)}
-      }
-    }
-  }
-
-  return nil
-}
-
-// A valid state graph has the following properties in addition to those
-// specified in verifyAnyGraph():
-// * All output edges from the start node have labels
-// * No node has more than one unlabeled output edge
-// * There are no tags on any nodes except for the start node
-// * There are no groups
-func verifyStateGraph(graph *yed.Graph) error {
-  err := verifyAnyGraph(graph, []string{}, []string{"facing"})
-  if err != nil {
-    return &spriteError{fmt.Sprintf("State graph: %v", err)}
-  }
-
-  start := getStartNode(graph)
-
-  // Check that all output edges from the start node have labels
-  for i := 0; i < start.NumOutputs(); i++ {
-    edge := start.Output(i)
-    if edge.NumLines() == 0 || strings.Contains(edge.Line(0), ":") {
-      return &spriteError{"State graph: The start node has an unlabeled output edge"}
-    }
-  }
-
-  // Check that no node has more than one unlabeled output edge
-  for i := 0; i < graph.NumNodes(); i++ {
-    node := graph.Node(i)
-    num_labels := 0
-    for j := 0; j < node.NumOutputs(); j++ {
-      edge := node.Output(j)
-      if edge.NumLines() > 0 && !strings.Contains(edge.Line(0), ":") {
-        num_labels++
-      }
-    }
-    if num_labels < node.NumOutputs()-1 {
-      return &spriteError{fmt.Sprintf("State graph: Found more than one unlabeled output edge on node '%s'", node.Line(0))}
-    }
-  }
-
-  // Check that no nodes are groups
-  for i := 0; i < graph.NumNodes(); i++ {
-    node := graph.Node(i)
-    if node.NumChildren() > 0 {
-      return &spriteError{"State graph: cannot contain groups"}
-    }
-  }
-
-  return nil
-}
-
-// A valid anim graph has the properties specified in verifyAnyGraph()
-func verifyAnimGraph(graph *yed.Graph) error {
-  err := verifyAnyGraph(graph, []string{"time", "sync", "func", "state"}, []string{"facing", "weight"})
-  if err != nil {
-    return &spriteError{fmt.Sprintf("Anim graph: %v", err)}
-  }
-
-  return nil
-}
-
-// Traverse the directory and do the following things:
-// * There are n > 0 directories
-// * There is at most 1 other file immediately within path - a thumb.png
-// * All of the directories have names that are integers 0 - (n-1)
-// * No image is present in any facing that isn't present in the anim graph
-func verifyDirectoryStructure(path string, graph *yed.Graph) (num_facings int, filenames []string, err error) {
-  filepath.Walk(path, func(cpath string, info os.FileInfo, _err error) error {
-    if _err != nil {
-      err = _err
-      return err
-    }
-    if cpath == path {
-      return nil
-    }
-
-    // skip hidden files
-    if _, file := filepath.Split(cpath); file[0] == '.' {
-      return nil
-    }
-
-    if info.IsDir() {
-      num_facings++
-      return filepath.SkipDir
-    } else {
-      switch {
-      case info.Name() == "anim.xgml":
-      case info.Name() == "state.xgml":
-      case info.Name() == "thumb.png":
-      case strings.HasSuffix(info.Name(), ".gob"):
-      default:
-        err = &spriteError{fmt.Sprintf("Unexpected file found in sprite directory, %s", tryRelPath(path, cpath))}
-        return err
-      }
-    }
-    return nil
-  })
-  if err != nil {
-    return
-  }
-  if num_facings == 0 {
-    err = &spriteError{"Found no facings in the sprite directory"}
-    return
-  }
-
-  // Create a set of valid png filenames.  If a .png shows up that is not in
-  // this set then we raise an error.  Non-png files are allowed and are
-  // ignored.
-  valid_names := make(map[string]bool)
-  for i := 0; i < graph.NumNodes(); i++ {
-    valid_names[graph.Node(i).Line(0)+".png"] = true
-  }
-
-  filenames_map := make(map[string]bool)
-  for facing := 0; facing < num_facings; facing++ {
-    cur := filepath.Join(path, fmt.Sprintf("%d", facing))
-    filepath.Walk(cur, func(cpath string, info os.FileInfo, _err error) error {
-      if _err != nil {
-        err = _err
-        return err
-      }
-      if cpath == cur {
-        return nil
-      }
-
-      // skip hidden files
-      if _, file := filepath.Split(cpath); file[0] == '.' {
-        return nil
-      }
-
-      if info.IsDir() {
-        err = &spriteError{fmt.Sprintf("Found a directory inside facing directory %d, %s", facing, tryRelPath(path, cpath))}
-        return err
-      }
-      if filepath.Ext(cpath) == ".png" {
-        base := filepath.Base(cpath)
-        if valid_names[base] {
-          filenames_map[base] = true
-        } else {
-          err = &spriteError{fmt.Sprintf("Found an unused .png file: %s", tryRelPath(path, cpath))}
-        }
-        return err
-      }
-      return nil
-    })
-  }
-
-  for filename := range filenames_map {
-    filenames = append(filenames, filename)
-  }
-  sort.Strings(filenames)
-
-  return
-}
-
 // Used to determine what frames to keep permanently in texture memory, and
 // which ones to unload when not needed
 type animAlgoGraph struct {
@@ -714,45 +457,72 @@ func (s *Sprite) applyPath(path []*yed.Node) {
   }
 }
 
-func (s *Sprite) Dims() (dx, dy int) {
-  var rect FrameRect
-  var ok bool
+// Returns the sheet that the current frame is on and where it is on it.
+func (s *Sprite) frame() (sh *sheet, rect FrameRect, ok bool) {
   fid := frameId{facing: s.facing, node: s.anim_node.Id()}
-  rect, ok = s.shared.connector.rects[fid]
+  if rect, ok = s.shared.connector.rects[fid]; ok {
+    return s.shared.connector, rect, true
+  }
+  if rect, ok = s.shared.facings[s.facing].rects[fid]; ok {
+    return s.shared.facings[s.facing], rect, true
+  }
+  return nil, FrameRect{}, false
+}
+
+// Returns the rectangle, in pixels, that the current frame occupies on its
+// sprite sheet.  ok is false if the frame has no image.  This doesn't need
+// any textures, so it works for sprites loaded by a headless Manager.
+func (s *Sprite) FrameRect() (rect FrameRect, ok bool) {
+  _, rect, ok = s.frame()
+  return
+}
+
+func (s *Sprite) Dims() (dx, dy int) {
+  _, rect, ok := s.frame()
   if !ok {
-    rect, ok = s.shared.facings[s.facing].rects[fid]
-    if !ok {
-      return 0, 0
-    }
+    return 0, 0
   }
   dx = rect.X2 - rect.X
   dy = rect.Y2 - rect.Y
   return
 }
 
+// Binds the texture that the current frame is on and returns the texture
+// coordinates of the frame.
 func (s *Sprite) Bind() (x, y, x2, y2 float64) {
-  var rect FrameRect
-  var sh *sheet
-  var ok bool
-  fid := frameId{facing: s.facing, node: s.anim_node.Id()}
-  var dx, dy float64
-  if rect, ok = s.shared.connector.rects[fid]; ok {
-    sh = s.shared.connector
-  } else if rect, ok = s.shared.facings[s.facing].rects[fid]; ok {
-    sh = s.shared.facings[s.facing]
-  } else {
-    error_texture.Bind(gl.TEXTURE_2D)
+  var t *render.Texture
+  t, x, y, x2, y2 = s.Texture()
+  t.Bind()
+  return
+}
+
+// Returns the texture that the current frame is on and the texture
+// coordinates of the frame, so that it can be drawn with a render.Renderer.
+// The texture is nil until the sheet holding the frame has been loaded.
+func (s *Sprite) Texture() (t *render.Texture, x, y, x2, y2 float64) {
+  sh, rect, ok := s.frame()
+  if !ok {
+    t = error_texture
     return
   }
-  sh.texture.Bind(gl.TEXTURE_2D)
-  dx = float64(sh.dx)
-  dy = float64(sh.dy)
+  t = sh.texture
+  dx := float64(sh.dx)
+  dy := float64(sh.dy)
   x = float64(rect.X) / dx
   y = float64(rect.Y) / dy
   x2 = float64(rect.X2) / dx
   y2 = float64(rect.Y2) / dy
   return
 }
+
+// Draws the current frame stretched over rect with r, which may be a
+// render.Batch.  Sheets are stored upside down, so the frame is drawn with
+// its texture coordinates negated and the texture wrapping around.
+func (s *Sprite) Draw(r render.Renderer, rect render.Rect, c render.Color) {
+  t, x, y, x2, y2 := s.Texture()
+  r.Quad(t, rect, x, -y, x2, -y2, c)
+}
+
 func (s *Sprite) Facing() int {
   return s.facing
 }
@@ -955,19 +725,32 @@ type FrameRect struct {
 type TriggerFunc func(*Sprite, string)
 
 type Manager struct {
-  shared map[string]*sharedSprite
-  mutex  sync.Mutex
+  shared  map[string]*sharedSprite
+  mutex   sync.Mutex
+  backend backend
+  cache   sheetCache
 }
 
+// Makes a Manager that caches composed sprite sheets in DefaultCacheDir().
 func MakeManager() *Manager {
   var m Manager
   m.shared = make(map[string]*sharedSprite)
+  m.backend = renderBackend{}
+  m.cache = sheetCache{DefaultCacheDir()}
   return &m
 }
 
+// Makes a Manager whose sprites never load any textures, so they can be
+// simulated without an OpenGL context.  Everything other than drawing works
+// as usual, including FrameRect and Dims, which only need the headers of the
+// frames' images.
+func MakeHeadlessManager() *Manager {
+  m := MakeManager()
+  m.backend = headlessBackend{}
+  return m
+}
+
 var the_manager *Manager
-var error_texture gl.Texture
-var gen_tex_once sync.Once
 
 func init() {
   the_manager = MakeManager()
@@ -982,7 +765,7 @@ func (m *Manager) loadSharedSprite(path string) error {
     return nil
   }
 
-  ss, err := loadSharedSprite(path)
+  ss, err := loadSharedSprite(path, m.backend, m.cache)
   if err != nil {
     return err
   }
@@ -992,23 +775,7 @@ func (m *Manager) loadSharedSprite(path string) error {
 }
 
 func (m *Manager) LoadSprite(path string) (*Sprite, error) {
-  // We can't run this during an init() function because it will get queued to
-  // run before the opengl context is created, so we just check here and run
-  // it if we haven't run it before.
-  gen_tex_once.Do(func() {
-    render.Queue(func() {
-      gl.Enable(gl.TEXTURE_2D)
-      error_texture = gl.GenTexture()
-      error_texture.Bind(gl.TEXTURE_2D)
-      gl.TexEnvf(gl.TEXTURE_ENV, gl.TEXTURE_ENV_MODE, gl.MODULATE)
-      gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
-      gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
-      gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
-      gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
-      pink := []byte{255, 0, 255, 255}
-      glu.Build2DMipmaps(gl.TEXTURE_2D, 4, 1, 1, gl.RGBA, pink)
-    })
-  })
+  m.backend.setup()
 
   path = filepath.Clean(path)
   err := m.loadSharedSprite(path)
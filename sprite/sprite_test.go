@@ -1,9 +1,15 @@
 package sprite_test
 
 import (
+  "github.com/MobRulesGames/glop/render"
   "github.com/MobRulesGames/glop/sprite"
   . "github.com/orfjackal/gospec/src/gospec"
   "github.com/orfjackal/gospec/src/gospec"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "time"
 )
 
 func LoadSpriteSpec(c gospec.Context) {
@@ -88,3 +94,361 @@ func SyncSpec(c gospec.Context) {
     c.Expect(hit, Equals, true)
   })
 }
+
+func HeadlessSpec(c gospec.Context) {
+  m := sprite.MakeHeadlessManager()
+  s, err := m.LoadSprite("test_sprite")
+  c.Assume(err, Equals, nil)
+
+  c.Specify("Headless sprites report their frames without textures", func() {
+    s.Think(50)
+    rect, ok := s.FrameRect()
+    c.Expect(ok, Equals, true)
+    c.Expect(rect.X2-rect.X, Equals, 100)
+    c.Expect(rect.Y2-rect.Y, Equals, 150)
+    dx, dy := s.Dims()
+    c.Expect(dx, Equals, 100)
+    c.Expect(dy, Equals, 150)
+    t, _, _, _, _ := s.Texture()
+    c.Expect(t == nil, Equals, true)
+  })
+
+  c.Specify("Headless sprites follow commands", func() {
+    s.Think(50)
+    s.Command("turn_right")
+    for i := 0; i < 100; i++ {
+      s.Think(50)
+    }
+    c.Expect(s.Facing(), Equals, 1)
+    c.Expect(s.StateFacing(), Equals, 1)
+
+    done := make(chan bool, 1)
+    go func() {
+      s.Wait([]string{"defending"})
+      done <- true
+    }()
+    s.Command("defend")
+    waited := false
+    // Give the waiter a moment to start waiting after each think
+    for i := 0; i < 1000 && !waited; i++ {
+      s.Think(50)
+      select {
+      case <-done:
+        waited = true
+      case <-time.After(time.Millisecond):
+      }
+    }
+    c.Expect(waited, Equals, true)
+    c.Expect(s.AnimState(), Equals, "defending")
+  })
+
+  c.Specify("Headless sprites can sync commands", func() {
+    s2, err := m.LoadSprite("test_sprite")
+    c.Assume(err, Equals, nil)
+    sprite.CommandSync([]*sprite.Sprite{s, s2}, [][]string{[]string{"melee"}, []string{"defend", "damaged"}}, "hit")
+    hit := false
+    for i := 0; i < 20; i++ {
+      s.Think(50)
+      s2.Think(50)
+      if s.Anim() == "melee_01" && s2.Anim() == "damaged_01" {
+        hit = true
+      }
+    }
+    c.Expect(hit, Equals, true)
+  })
+}
+
+// Sheets are uploaded to the current renderer, which TestAllSpecs makes this
+// one.
+var soft = render.MakeSoftRenderer()
+
+func DrawGoldenSpec(c gospec.Context) {
+  s, err := sprite.LoadSprite("test_sprite")
+  c.Assume(err, Equals, nil)
+  s.Think(0)
+
+  c.Specify("Sprites draw their current frame upright", func() {
+    // The sheet is uploaded on the render thread, which is also the only
+    // place that its texture can be looked at
+    loaded := false
+    for i := 0; i < 1000 && !loaded; i++ {
+      render.QueueWait(func() {
+        t, _, _, _, _ := s.Texture()
+        loaded = t != nil
+      })
+      if !loaded {
+        time.Sleep(time.Millisecond)
+      }
+    }
+    c.Assume(loaded, Equals, true)
+    dx, dy := s.Dims()
+    render.QueueWait(func() {
+      soft.Begin(render.Rect{Dx: float64(dx), Dy: float64(dy)}, render.Color{A: 1})
+      s.Draw(soft, render.Rect{Dx: float64(dx), Dy: float64(dy)}, render.Color{R: 1, G: 1, B: 1, A: 1})
+    })
+    c.Expect(render.CompareGolden(soft.Image(), "testdata/sprite.png"), Equals, nil)
+  })
+}
+
+// Copies the sprite in src into a new temporary directory, skipping any
+// cached sheets, and returns the directory.
+func copySprite(src string) (string, error) {
+  dst, err := ioutil.TempDir("", "glop-sprite")
+  if err != nil {
+    return "", err
+  }
+  err = filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+    if err != nil {
+      return err
+    }
+    rel, _ := filepath.Rel(src, path)
+    if info.IsDir() {
+      return os.MkdirAll(filepath.Join(dst, rel), 0755)
+    }
+    if filepath.Ext(path) == ".gob" {
+      return nil
+    }
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+      return err
+    }
+    return ioutil.WriteFile(filepath.Join(dst, rel), data, 0644)
+  })
+  return dst, err
+}
+
+// Replaces the first occurrence of old in the file at path with new.
+func replaceInFile(path, old, new string) error {
+  data, err := ioutil.ReadFile(path)
+  if err != nil {
+    return err
+  }
+  return ioutil.WriteFile(path, []byte(strings.Replace(string(data), old, new, 1)), 0644)
+}
+
+// Adds a line to the label of the node labeled label in an xgml file.
+func addNodeLine(path, label, line string) error {
+  old := `<attribute key="label" type="String">` + label + `</attribute>`
+  return replaceInFile(path, old, `<attribute key="label" type="String">`+label+"\n"+line+`</attribute>`)
+}
+
+func LintSpec(c gospec.Context) {
+  c.Specify("The sample sprite has no problems", func() {
+    c.Expect(len(sprite.Lint("test_sprite")), Equals, 0)
+  })
+
+  c.Specify("Every problem in a sprite is found", func() {
+    dir, err := copySprite("test_sprite")
+    c.Assume(err, Equals, nil)
+    defer os.RemoveAll(dir)
+    c.Assume(addNodeLine(filepath.Join(dir, "state.xgml"), "defending", "foo:1"), Equals, nil)
+    c.Assume(addNodeLine(filepath.Join(dir, "anim.xgml"), "walk_01", "speed:3"), Equals, nil)
+    c.Assume(ioutil.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644), Equals, nil)
+    c.Assume(os.Remove(filepath.Join(dir, "1", "walk_02.png")), Equals, nil)
+
+    problems := sprite.Lint(dir)
+    c.Expect(len(problems), Equals, 4)
+    if len(problems) != 4 {
+      return
+    }
+    c.Expect(problems[0].Severity, Equals, sprite.Error)
+    c.Expect(problems[0].File, Equals, filepath.Join(dir, "state.xgml"))
+    c.Expect(problems[0].Node, Equals, "defending")
+    c.Expect(problems[0].Message, Equals, "a node has an unknown tag (foo)")
+    c.Expect(problems[1].File, Equals, filepath.Join(dir, "anim.xgml"))
+    c.Expect(problems[1].Node, Equals, "walk_01")
+    c.Expect(problems[2].File, Equals, filepath.Join(dir, "notes.txt"))
+    c.Expect(problems[2].Severity, Equals, sprite.Error)
+    c.Expect(problems[3].File, Equals, filepath.Join(dir, "1", "walk_02.png"))
+    c.Expect(problems[3].Severity, Equals, sprite.Warning)
+
+    // Loading stops at the first error
+    _, err = sprite.MakeHeadlessManager().LoadSprite(dir)
+    c.Expect(err.Error(), Equals, "State graph: a node has an unknown tag (foo)")
+  })
+
+  c.Specify("Unlabeled nodes are found", func() {
+    dir, err := copySprite("test_sprite")
+    c.Assume(err, Equals, nil)
+    defer os.RemoveAll(dir)
+    label := `<attribute key="label" type="String">`
+    c.Assume(replaceInFile(filepath.Join(dir, "anim.xgml"), label+"walk_02<", label+"<"), Equals, nil)
+
+    problems := sprite.Lint(dir)
+    c.Assume(len(problems) > 0, IsTrue)
+    c.Expect(problems[0].File, Equals, filepath.Join(dir, "anim.xgml"))
+    c.Expect(problems[0].Message, Equals, "contains an unlabeled node")
+    // Its images no longer belong to any frame
+    var unused []string
+    for _, prob := range problems[1:] {
+      unused = append(unused, prob.File)
+    }
+    c.Expect(unused, ContainsExactly, []string{
+      filepath.Join(dir, "0", "walk_02.png"),
+      filepath.Join(dir, "1", "walk_02.png"),
+    })
+  })
+}
+
+func GraphsTogetherSpec(c gospec.Context) {
+  // Each case breaks the anim graph of the sample sprite in one way
+  cases := []struct {
+    name     string
+    old, new string
+    edge     string
+    err      string
+  }{
+    {
+      "A command that the anim graph doesn't respond to",
+      "\t<attribute key=\"label\" type=\"String\">melee</attribute>",
+      "\t<attribute key=\"label\" type=\"String\">lunge</attribute>",
+      "ready -> melee (melee)",
+      "State 'ready', command 'melee': no path in the anim graph from frame 'ready_01'",
+    },
+    {
+      "A command that changes facing by a different amount",
+      "turn_left\nfacing:-1</attribute>",
+      "turn_left\nfacing:-2</attribute>",
+      "ready -> ready (turn_left)",
+      "State 'ready', command 'turn_left': anim edge 'ready_01 -> turn_left (turn_left)' changes the facing by -2 instead of -1",
+    },
+    {
+      "A command that can only sometimes reach a sync tag",
+      "type=\"int\">1</attribute>\n\t\t\t<attribute key=\"target\" type=\"int\">24</attribute>",
+      "type=\"int\">1</attribute>\n\t\t\t<attribute key=\"target\" type=\"int\">27</attribute>",
+      "walk -> ready (stop)",
+      "State 'walk', command 'stop': sync tag 'hit' can't be reached from frame 'ready_01'",
+    },
+  }
+  for _, test := range cases {
+    test := test
+    c.Specify(test.name+" is found", func() {
+      dir, err := copySprite("test_sprite")
+      c.Assume(err, Equals, nil)
+      defer os.RemoveAll(dir)
+      c.Assume(replaceInFile(filepath.Join(dir, "anim.xgml"), test.old, test.new), Equals, nil)
+
+      problems := sprite.Lint(dir)
+      c.Expect(len(problems), Equals, 1)
+      if len(problems) != 1 {
+        return
+      }
+      c.Expect(problems[0].File, Equals, filepath.Join(dir, "state.xgml"))
+      c.Expect(problems[0].Edge, Equals, test.edge)
+      c.Expect(problems[0].Message, Equals, test.err)
+
+      _, err = sprite.MakeHeadlessManager().LoadSprite(dir)
+      c.Expect(err.Error(), Equals, test.err)
+    })
+  }
+
+  c.Specify("An anim edge without a command can't change the facing", func() {
+    dir, err := copySprite("test_sprite")
+    c.Assume(err, Equals, nil)
+    defer os.RemoveAll(dir)
+    edge := "type=\"int\">3</attribute>\n\t\t\t<attribute key=\"target\" type=\"int\">1</attribute>"
+    facing := "\n\t\t\t<attribute key=\"label\" type=\"String\">facing:1</attribute>"
+    c.Assume(replaceInFile(filepath.Join(dir, "anim.xgml"), edge, edge+facing), Equals, nil)
+
+    problems := sprite.Lint(dir)
+    c.Expect(len(problems), Equals, 1)
+    if len(problems) != 1 {
+      return
+    }
+    c.Expect(problems[0].File, Equals, filepath.Join(dir, "anim.xgml"))
+    c.Expect(problems[0].Edge, Equals, "walk_01 -> walk_02 (facing:1)")
+
+    _, err = sprite.MakeHeadlessManager().LoadSprite(dir)
+    c.Expect(err.Error(), Equals, "An edge without a command changes the facing")
+  })
+
+  c.Specify("Graphs aren't checked together unless each of them is valid", func() {
+    dir, err := copySprite("test_sprite")
+    c.Assume(err, Equals, nil)
+    defer os.RemoveAll(dir)
+    // The walk state is left unlabeled, and it would also break the sync tag
+    // check against the anim graph
+    label := `<attribute key="label" type="String">`
+    c.Assume(replaceInFile(filepath.Join(dir, "state.xgml"), label+"walk<", label+"<"), Equals, nil)
+    sync := "type=\"int\">1</attribute>\n\t\t\t<attribute key=\"target\" type=\"int\">"
+    c.Assume(replaceInFile(filepath.Join(dir, "anim.xgml"), sync+"24<", sync+"27<"), Equals, nil)
+
+    problems := sprite.Lint(dir)
+    c.Expect(len(problems), Equals, 1)
+    if len(problems) != 1 {
+      return
+    }
+    c.Expect(problems[0].File, Equals, filepath.Join(dir, "state.xgml"))
+    c.Expect(problems[0].Message, Equals, "contains an unlabeled node")
+  })
+}
+
+// Returns the names of the cached sheets in dir.
+func cachedSheets(dir string) []string {
+  names, _ := filepath.Glob(filepath.Join(dir, "*.sheet"))
+  return names
+}
+
+func CacheSpec(c gospec.Context) {
+  sprite_dir, err := copySprite("test_sprite")
+  c.Assume(err, Equals, nil)
+  defer os.RemoveAll(sprite_dir)
+  dir, err := ioutil.TempDir("", "glop-cache")
+  c.Assume(err, Equals, nil)
+  defer os.RemoveAll(dir)
+  m := sprite.MakeHeadlessManager()
+  m.SetCacheDir(dir)
+  c.Assume(m.PrewarmCache(sprite_dir), Equals, nil)
+  sheets := cachedSheets(dir)
+
+  c.Specify("Every sheet of a sprite is cached", func() {
+    c.Expect(len(sheets), Equals, 3)
+  })
+
+  c.Specify("Cached sheets are reused", func() {
+    c.Expect(m.PrewarmCache(sprite_dir), Equals, nil)
+    c.Expect(cachedSheets(dir), ContainsExactly, sheets)
+  })
+
+  c.Specify("Corrupt sheets are rebuilt", func() {
+    good, err := ioutil.ReadFile(sheets[0])
+    c.Assume(err, Equals, nil)
+    bad := append([]byte{}, good...)
+    bad[len(bad)/2]++
+    for _, data := range [][]byte{bad, good[:len(good)/2], []byte("not a sheet")} {
+      c.Assume(ioutil.WriteFile(sheets[0], data, 0644), Equals, nil)
+      c.Expect(m.PrewarmCache(sprite_dir), Equals, nil)
+      data, err := ioutil.ReadFile(sheets[0])
+      c.Assume(err, Equals, nil)
+      c.Expect(string(data) == string(good), IsTrue)
+    }
+  })
+
+  c.Specify("Changing a frame replaces its sheet", func() {
+    then := time.Now().Add(-time.Hour)
+    c.Assume(os.Chtimes(filepath.Join(sprite_dir, "0", "walk_01.png"), then, then), Equals, nil)
+    c.Expect(m.PrewarmCache(sprite_dir), Equals, nil)
+    changed := cachedSheets(dir)
+    c.Expect(len(changed), Equals, 3)
+    kept := 0
+    for _, sheet := range changed {
+      for _, old := range sheets {
+        if sheet == old {
+          kept++
+        }
+      }
+    }
+    c.Expect(kept, Equals, 2)
+  })
+
+  c.Specify("Clearing the cache only removes sheets", func() {
+    other := filepath.Join(dir, "notes.txt")
+    c.Assume(ioutil.WriteFile(other, nil, 0644), Equals, nil)
+    removed, err := sprite.ClearCache(dir)
+    c.Expect(err, Equals, nil)
+    c.Expect(removed, Equals, 3)
+    c.Expect(len(cachedSheets(dir)), Equals, 0)
+    _, err = os.Stat(other)
+    c.Expect(err, Equals, nil)
+  })
+}
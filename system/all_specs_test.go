@@ -0,0 +1,15 @@
+package system_test
+
+import (
+  "github.com/orfjackal/gospec/src/gospec"
+  "testing"
+)
+
+func TestAllSpecs(t *testing.T) {
+  r := gospec.NewRunner()
+  r.AddSpec(FixedLoopSpec)
+  r.AddSpec(WindowModeSpec)
+  r.AddSpec(FramePacingSpec)
+  r.AddSpec(EventOrderSpec)
+  gospec.MainGoTest(r, t)
+}
@@ -0,0 +1,100 @@
+package system
+
+import (
+  "github.com/MobRulesGames/glop/gin"
+  "sort"
+)
+
+// A DropEvent happens when files are dragged from another application and
+// dropped onto the window.
+type DropEvent struct {
+  // Paths of the files that were dropped
+  Paths []string
+
+  // Where they were dropped, in window coordinates with the origin at the
+  // bottom left corner of the window
+  X, Y int
+
+  Timestamp gin.Timestamp
+}
+
+// A TextEvent carries text typed on the keyboard, including text composed
+// with an input method or a compose key.
+type TextEvent struct {
+  // If Preedit is false then Text was entered and belongs at the caret.  If
+  // Preedit is true then Text is the composition that the input method has in
+  // progress, which replaces any earlier composition and should be shown at
+  // the caret without becoming part of the text yet.  An empty composition
+  // means that composing has finished or been abandoned.
+  Text    string
+  Preedit bool
+
+  // For a composition, the byte offset in Text of the input method's caret.
+  Cursor int
+
+  Timestamp gin.Timestamp
+}
+
+type eventsByTimestamp []gin.OsEvent
+
+func (e eventsByTimestamp) Len() int {
+  return len(e)
+}
+func (e eventsByTimestamp) Less(i, j int) bool {
+  return e[i].Timestamp < e[j].Timestamp
+}
+func (e eventsByTimestamp) Swap(i, j int) {
+  e[i], e[j] = e[j], e[i]
+}
+
+// Sorts events by timestamp and clamps them to the range [last_horizon,
+// horizon] so that gin never sees time go backwards.  An Os whose events are
+// stamped by a different clock than its horizon, X server time for instance,
+// can otherwise hand us events from before the previous horizon or from after
+// the current one.  Events with the same timestamp keep the order that the Os
+// gave them in.
+func orderEvents(events []gin.OsEvent, last_horizon, horizon gin.Timestamp) []gin.OsEvent {
+  if horizon < last_horizon {
+    horizon = last_horizon
+  }
+  for i := range events {
+    events[i].Timestamp = clampTimestamp(events[i].Timestamp, last_horizon, horizon)
+  }
+  sort.Stable(eventsByTimestamp(events))
+  return events
+}
+
+// Clamps drops to the range [last_horizon, horizon], the same way that
+// orderEvents() does for input events.
+func orderDrops(drops []DropEvent, last_horizon, horizon gin.Timestamp) []DropEvent {
+  if horizon < last_horizon {
+    horizon = last_horizon
+  }
+  for i := range drops {
+    drops[i].Timestamp = clampTimestamp(drops[i].Timestamp, last_horizon, horizon)
+  }
+  return drops
+}
+
+// Clamps text events to the range [last_horizon, horizon], the same way that
+// orderEvents() does for input events.  Their order matters, so it is left
+// alone.
+func orderTexts(texts []TextEvent, last_horizon, horizon gin.Timestamp) []TextEvent {
+  if horizon < last_horizon {
+    horizon = last_horizon
+  }
+  for i := range texts {
+    texts[i].Timestamp = clampTimestamp(texts[i].Timestamp, last_horizon, horizon)
+  }
+  return texts
+}
+
+func clampTimestamp(t, min, max gin.Timestamp) gin.Timestamp {
+  if t < min {
+    return min
+  }
+  if t > max {
+    return max
+  }
+  return t
+}
@@ -0,0 +1,72 @@
+package system_test
+
+import (
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+  "github.com/MobRulesGames/glop/gin"
+  "github.com/MobRulesGames/glop/system"
+)
+
+func EventOrderSpec(c gospec.Context) {
+  // Os timestamps are relative to whenever the Os started, System's are
+  // relative to Startup()
+  h := system.MakeHeadlessOs()
+  h.Advance(1000)
+  start := h.Now()
+  sys := system.MakeWithInput(h, gin.Make())
+  sys.Startup()
+  h.Advance(10)
+  sys.Think()
+  h.Advance(10)
+
+  c.Specify("Events are sorted and clamped to the time since the last horizon.", func() {
+    h.InjectEventAt('x', 1, start+gin.FromMs(15))
+    h.InjectEventAt('y', 1, start+gin.FromMs(5))
+    h.InjectEventAt('z', 1, start+gin.FromMs(30))
+    h.InjectEventAt('w', 1, start+gin.FromMs(2))
+    sys.Think()
+    c.Expect(sys.Horizon(), Equals, gin.FromMs(20))
+
+    var ids []gin.KeyId
+    var times []gin.Timestamp
+    for _, group := range sys.GetInputEvents() {
+      for _, event := range group.Events {
+        ids = append(ids, event.Key.Id())
+        times = append(times, group.Timestamp)
+      }
+    }
+    // Events clamped to the same time keep the order the Os gave them in
+    c.Expect(ids, ContainsInOrder, []gin.KeyId{'y', 'w', 'x', 'z'})
+    c.Expect(times, ContainsInOrder, []gin.Timestamp{gin.FromMs(10), gin.FromMs(10), gin.FromMs(15), gin.FromMs(20)})
+
+    for _, id := range ids {
+      h.InjectEvent(id, 0)
+    }
+    sys.Think()
+  })
+
+  c.Specify("Drops are clamped the same way and keep their order.", func() {
+    h.InjectDropAt([]string{"b.png"}, 3, 4, start+gin.FromMs(50))
+    h.InjectDropAt([]string{"a.png"}, 1, 2, start+gin.FromMs(5))
+    sys.Think()
+    drops := sys.GetDropEvents()
+    c.Assume(len(drops), Equals, 2)
+    c.Expect(drops[0].Paths, ContainsExactly, []string{"b.png"})
+    c.Expect(drops[0].Timestamp, Equals, gin.FromMs(20))
+    c.Expect(drops[1].Paths, ContainsExactly, []string{"a.png"})
+    c.Expect(drops[1].Timestamp, Equals, gin.FromMs(10))
+  })
+
+  c.Specify("Drops and text are only returned until the next Think().", func() {
+    h.EnableTextInput(true)
+    h.InjectDrop([]string{"a.png"}, 0, 0)
+    h.InjectText("hi")
+    sys.Think()
+    c.Expect(len(sys.GetDropEvents()), Equals, 1)
+    c.Expect(len(sys.GetTextEvents()), Equals, 1)
+    c.Expect(sys.GetTextEvents()[0].Timestamp, Equals, gin.FromMs(20))
+    sys.Think()
+    c.Expect(len(sys.GetDropEvents()), Equals, 0)
+    c.Expect(len(sys.GetTextEvents()), Equals, 0)
+  })
+}
@@ -0,0 +1,195 @@
+package system
+
+import (
+  "github.com/MobRulesGames/glop/gin"
+  "math"
+  "sort"
+  "time"
+)
+
+// An Os can implement Clock to control the time that System uses for frame
+// pacing and frame statistics.  HeadlessOs does this so that tests never
+// have to wait in real time.
+type Clock interface {
+  Now() gin.Timestamp
+  Sleep(d gin.Timestamp)
+}
+
+type realClock struct {
+  start time.Time
+}
+
+func (c *realClock) Now() gin.Timestamp {
+  return gin.FromDuration(time.Since(c.start))
+}
+
+func (c *realClock) Sleep(d gin.Timestamp) {
+  time.Sleep(d.Duration())
+}
+
+// Frame timing statistics over the most recent frames.  A frame runs from
+// the end of one call to System.SwapBuffers() to the end of the next one, so
+// frame times include any time spent waiting on the frame rate limit.
+type FrameStats struct {
+  // Number of frames that these statistics cover.
+  Frames int
+
+  Min, Avg, Max gin.Timestamp
+
+  // 50th, 90th and 99th percentile frame times
+  P50, P90, P99 gin.Timestamp
+
+  // Average time per frame spent in the Os's Think(), in turning Os events
+  // into gin events, in SwapBuffers(), and sleeping to honor the frame rate
+  // limit.
+  Think, Input, Swap, Sleep gin.Timestamp
+}
+
+// Average frames per second, or 0 if no frames have been recorded.
+func (fs FrameStats) Fps() float64 {
+  if fs.Avg <= 0 {
+    return 0
+  }
+  return float64(gin.Second) / float64(fs.Avg)
+}
+
+// Number of frames that FrameStats covers.
+const frame_history = 120
+
+type frameRecord struct {
+  total, think, input, swap, sleep gin.Timestamp
+}
+
+// A framePacer limits the frame rate and keeps track of where the time in
+// each frame goes.
+type framePacer struct {
+  clock Clock
+
+  // Frame rate limits, 0 means unlimited
+  fps, unfocused_fps, minimized_fps float64
+
+  started   bool
+  frame_end gin.Timestamp
+
+  // When the next frame should end if the frame rate is being limited.
+  deadline gin.Timestamp
+
+  // Timings for the frame in progress.
+  current frameRecord
+
+  history [frame_history]frameRecord
+  count   int
+  next    int
+}
+
+func (p *framePacer) init(clock Clock) {
+  p.clock = clock
+  p.unfocused_fps = 30
+  p.minimized_fps = 10
+}
+
+// Returns the limit that applies to a window in the specified state.
+func (p *framePacer) limit(state WindowState) float64 {
+  fps := p.fps
+  background := 0.0
+  if state.Minimized {
+    background = p.minimized_fps
+  } else if !state.Focused {
+    background = p.unfocused_fps
+  }
+  if background > 0 && (fps == 0 || background < fps) {
+    fps = background
+  }
+  return fps
+}
+
+// Runs f and returns how long it took.
+func (p *framePacer) time(f func()) gin.Timestamp {
+  start := p.clock.Now()
+  f()
+  return p.clock.Now() - start
+}
+
+// Called after the buffers have been swapped, sleeps until the frame rate
+// limit allows the next frame to start and then records the frame.
+func (p *framePacer) endFrame(state WindowState) {
+  now := p.clock.Now()
+  if fps := p.limit(state); fps > 0 && p.started {
+    period := gin.Timestamp(float64(gin.Second) / fps)
+    p.deadline += period
+    // If we've fallen more than a frame behind there is no point in trying to
+    // catch up, that would just run the next few frames unlimited.
+    if p.deadline < now-period {
+      p.deadline = now
+    }
+    if p.deadline > now {
+      p.clock.Sleep(p.deadline - now)
+      end := p.clock.Now()
+      p.current.sleep = end - now
+      now = end
+    }
+  } else {
+    p.deadline = now
+  }
+  if p.started {
+    p.current.total = now - p.frame_end
+    p.history[p.next] = p.current
+    p.next = (p.next + 1) % frame_history
+    if p.count < frame_history {
+      p.count++
+    }
+  }
+  p.started = true
+  p.frame_end = now
+  p.current = frameRecord{}
+}
+
+type timestamps []gin.Timestamp
+
+func (t timestamps) Len() int           { return len(t) }
+func (t timestamps) Less(i, j int) bool { return t[i] < t[j] }
+func (t timestamps) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+
+func (p *framePacer) stats() FrameStats {
+  var fs FrameStats
+  fs.Frames = p.count
+  if p.count == 0 {
+    return fs
+  }
+  totals := make(timestamps, p.count)
+  var sum frameRecord
+  for i := 0; i < p.count; i++ {
+    r := p.history[i]
+    totals[i] = r.total
+    sum.total += r.total
+    sum.think += r.think
+    sum.input += r.input
+    sum.swap += r.swap
+    sum.sleep += r.sleep
+  }
+  sort.Sort(totals)
+  n := gin.Timestamp(p.count)
+  fs.Min = totals[0]
+  fs.Max = totals[len(totals)-1]
+  fs.Avg = sum.total / n
+  fs.P50 = percentile(totals, 0.5)
+  fs.P90 = percentile(totals, 0.9)
+  fs.P99 = percentile(totals, 0.99)
+  fs.Think = sum.think / n
+  fs.Input = sum.input / n
+  fs.Swap = sum.swap / n
+  fs.Sleep = sum.sleep / n
+  return fs
+}
+
+// Nearest-rank percentile of sorted, which must not be empty.
+func percentile(sorted timestamps, p float64) gin.Timestamp {
+  rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+  if rank < 0 {
+    rank = 0
+  }
+  if rank >= len(sorted) {
+    rank = len(sorted) - 1
+  }
+  return sorted[rank]
+}
@@ -0,0 +1,85 @@
+package system_test
+
+import (
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+  "github.com/MobRulesGames/glop/gin"
+  "github.com/MobRulesGames/glop/system"
+)
+
+func FramePacingSpec(c gospec.Context) {
+  h := system.MakeHeadlessOs()
+  sys := system.MakeWithInput(h, gin.Make())
+  sys.Startup()
+
+  // Runs a frame that does ms milliseconds of work.
+  frame := func(ms int64) {
+    h.Advance(ms)
+    sys.SwapBuffers()
+  }
+  sys.SwapBuffers()
+
+  c.Specify("The frame rate limit sleeps off the rest of each frame.", func() {
+    sys.SetFrameRateLimit(50)
+    for i := 0; i < 10; i++ {
+      frame(5)
+    }
+    stats := sys.FrameStats()
+    c.Expect(stats.Frames, Equals, 10)
+    c.Expect(stats.Min, Equals, gin.FromMs(20))
+    c.Expect(stats.Max, Equals, gin.FromMs(20))
+    c.Expect(stats.Sleep, Equals, gin.FromMs(15))
+    c.Expect(stats.Fps(), Equals, 50.0)
+    c.Expect(h.Now(), Equals, gin.FromMs(200))
+  })
+
+  c.Specify("Frames that run long don't make later frames run unlimited.", func() {
+    sys.SetFrameRateLimit(50)
+    frame(5)
+    frame(100)
+    frame(5)
+    c.Expect(h.Now(), Equals, gin.FromMs(140))
+  })
+
+  c.Specify("Unfocused and minimized windows are limited further.", func() {
+    h.SetWindowState(system.WindowState{Focused: false})
+    frame(5)
+    c.Expect(sys.FrameStats().Max, Equals, gin.Second/30)
+
+    h.SetWindowState(system.WindowState{Focused: true, Minimized: true})
+    frame(5)
+    frame(5)
+    c.Expect(sys.FrameStats().Max, Equals, gin.Second/10)
+
+    sys.SetBackgroundFrameRates(0, 0)
+    frame(5)
+    c.Expect(h.Now(), Equals, gin.Second/30+2*gin.Second/10+gin.FromMs(5))
+  })
+
+  c.Specify("Frame times are summarized with percentiles.", func() {
+    for i := int64(1); i <= 100; i++ {
+      frame(i)
+    }
+    stats := sys.FrameStats()
+    c.Expect(stats.Frames, Equals, 100)
+    c.Expect(stats.Min, Equals, gin.FromMs(1))
+    c.Expect(stats.Max, Equals, gin.FromMs(100))
+    c.Expect(stats.Avg, Equals, gin.Timestamp(50500))
+    c.Expect(stats.P50, Equals, gin.FromMs(50))
+    c.Expect(stats.P90, Equals, gin.FromMs(90))
+    c.Expect(stats.P99, Equals, gin.FromMs(99))
+    c.Expect(stats.Sleep, Equals, gin.Timestamp(0))
+  })
+
+  c.Specify("Only the most recent frames are kept.", func() {
+    for i := 0; i < 100; i++ {
+      frame(50)
+    }
+    for i := 0; i < 120; i++ {
+      frame(10)
+    }
+    stats := sys.FrameStats()
+    c.Expect(stats.Frames, Equals, 120)
+    c.Expect(stats.Max, Equals, gin.FromMs(10))
+  })
+}
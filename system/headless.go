@@ -0,0 +1,470 @@
+package system
+
+import (
+  "errors"
+  "fmt"
+  "github.com/MobRulesGames/glop/gin"
+  "image"
+  "sync"
+)
+
+// A HeadlessOs implements Os without a window or an OpenGl context.  Time only
+// passes when Advance() is called and input only happens when it is injected,
+// so it is useful for tests and for running glop code on a server.
+type HeadlessOs struct {
+  mutex sync.Mutex
+
+  now gin.Timestamp
+
+  events []gin.OsEvent
+  drops  []DropEvent
+
+  joysticks map[int]gin.Joystick
+
+  texts          []TextEvent
+  text_input     bool
+  text_x, text_y int
+
+  window_x, window_y, window_dx, window_dy int
+
+  options WindowOptions
+
+  monitors     []Monitor
+  window_mode  WindowMode
+  window_state WindowState
+
+  // Window position and size from before the window went full screen, so that
+  // it can be restored.
+  windowed_x, windowed_y, windowed_dx, windowed_dy int
+
+  cursor_x, cursor_y int
+  cursor_hidden      bool
+  cursor_confined    bool
+
+  // If cursor_image is nil then system_cursor is being used
+  cursor_image  image.Image
+  cursor_hot    image.Point
+  system_cursor SystemCursor
+
+  vsync bool
+
+  clipboard string
+}
+
+// Makes a HeadlessOs with a single 1920x1080 monitor.
+func MakeHeadlessOs() *HeadlessOs {
+  var h HeadlessOs
+  h.window_state.Focused = true
+  h.monitors = []Monitor{
+    {
+      Name:         "headless",
+      Dx:           1920,
+      Dy:           1080,
+      Refresh_rate: 60,
+      Primary:      true,
+      Modes: []DisplayMode{
+        {Dx: 1920, Dy: 1080, Refresh_rate: 60},
+        {Dx: 1280, Dy: 720, Refresh_rate: 60},
+        {Dx: 1024, Dy: 768, Refresh_rate: 60},
+      },
+    },
+  }
+  return &h
+}
+
+func (h *HeadlessOs) Startup() {}
+
+func (h *HeadlessOs) Think() {}
+
+func (h *HeadlessOs) CreateWindow(options WindowOptions) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.options = options
+  h.window_x, h.window_y = options.X, options.Y
+  h.window_dx, h.window_dy = options.Dx, options.Dy
+}
+
+func (h *HeadlessOs) SetWindowTitle(title string) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.options.Title = title
+}
+
+// There is no real context, so this is always exactly what was requested.
+func (h *HeadlessOs) GetContextAttributes() ContextAttributes {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  return h.options.Context
+}
+
+// Returns the options that the window was created with, with the title
+// updated by any calls to SetWindowTitle().
+func (h *HeadlessOs) WindowOptions() WindowOptions {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  return h.options
+}
+
+func (h *HeadlessOs) GetCursorPos() (int, int) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  return h.cursor_x, h.cursor_y
+}
+
+func (h *HeadlessOs) HideCursor(hide bool) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.cursor_hidden = hide
+}
+
+// Returns true iff the cursor is currently hidden.
+func (h *HeadlessOs) CursorHidden() bool {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  return h.cursor_hidden
+}
+
+func (h *HeadlessOs) WarpCursor(x, y int) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.cursor_x, h.cursor_y = x, y
+}
+
+func (h *HeadlessOs) ConfineCursor(confine bool) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.cursor_confined = confine
+}
+
+// Returns true iff the cursor is currently confined to the window.
+func (h *HeadlessOs) CursorConfined() bool {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  return h.cursor_confined
+}
+
+func (h *HeadlessOs) SetCursorImage(img image.Image, hot_x, hot_y int) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.cursor_image = img
+  h.cursor_hot = image.Point{hot_x, hot_y}
+}
+
+func (h *HeadlessOs) SetSystemCursor(cursor SystemCursor) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.cursor_image = nil
+  h.system_cursor = cursor
+}
+
+// Returns the current cursor.  If img is nil then the system cursor is being
+// used, otherwise img and hot are the values passed to SetCursorImage().
+func (h *HeadlessOs) Cursor() (img image.Image, hot image.Point, cursor SystemCursor) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  return h.cursor_image, h.cursor_hot, h.system_cursor
+}
+
+func (h *HeadlessOs) GetWindowDims() (int, int, int, int) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  return h.window_x, h.window_y, h.window_dx, h.window_dy
+}
+
+// Replaces the fake monitors that this HeadlessOs reports.  The first mode of
+// each monitor is treated as its native mode, it is the mode that the monitor
+// returns to when the window goes back to Windowed.
+func (h *HeadlessOs) SetMonitors(monitors []Monitor) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.monitors = monitors
+}
+
+func (h *HeadlessOs) GetMonitors() []Monitor {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  monitors := make([]Monitor, len(h.monitors))
+  copy(monitors, h.monitors)
+  return monitors
+}
+
+func (h *HeadlessOs) SetWindowMode(mode WindowMode, monitor int, display DisplayMode) error {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  if mode == Windowed {
+    if h.window_mode != Windowed {
+      h.window_x, h.window_y = h.windowed_x, h.windowed_y
+      h.window_dx, h.window_dy = h.windowed_dx, h.windowed_dy
+      h.restoreMonitorModes()
+    }
+    h.window_mode = Windowed
+    return nil
+  }
+  if monitor < 0 || monitor >= len(h.monitors) {
+    return fmt.Errorf("No monitor with index %d.", monitor)
+  }
+  m := &h.monitors[monitor]
+  if mode == ExclusiveFullscreen && display != (DisplayMode{}) {
+    found := false
+    for _, dm := range m.Modes {
+      if dm.Dx == display.Dx && dm.Dy == display.Dy &&
+        (display.Refresh_rate == 0 || dm.Refresh_rate == display.Refresh_rate) {
+        found = true
+        display = dm
+        break
+      }
+    }
+    if !found {
+      return fmt.Errorf("Monitor '%s' does not support %dx%d.", m.Name, display.Dx, display.Dy)
+    }
+  }
+  if h.window_mode == Windowed {
+    h.windowed_x, h.windowed_y = h.window_x, h.window_y
+    h.windowed_dx, h.windowed_dy = h.window_dx, h.window_dy
+  }
+  h.restoreMonitorModes()
+  if mode == ExclusiveFullscreen && display != (DisplayMode{}) {
+    m.Dx, m.Dy, m.Refresh_rate = display.Dx, display.Dy, display.Refresh_rate
+  }
+  h.window_x, h.window_y, h.window_dx, h.window_dy = m.X, m.Y, m.Dx, m.Dy
+  h.window_mode = mode
+  return nil
+}
+
+// Fake monitors keep their first mode as their native mode, so this puts
+// them all back in it.
+func (h *HeadlessOs) restoreMonitorModes() {
+  for i := range h.monitors {
+    m := &h.monitors[i]
+    if len(m.Modes) > 0 {
+      m.Dx, m.Dy, m.Refresh_rate = m.Modes[0].Dx, m.Modes[0].Dy, m.Modes[0].Refresh_rate
+    }
+  }
+}
+
+func (h *HeadlessOs) GetWindowMode() WindowMode {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  return h.window_mode
+}
+
+func (h *HeadlessOs) GetWindowState() WindowState {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  return h.window_state
+}
+
+// Sets the state that GetWindowState() reports, the window starts out
+// focused and not minimized.
+func (h *HeadlessOs) SetWindowState(state WindowState) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.window_state = state
+}
+
+func (h *HeadlessOs) SwapBuffers() {}
+
+// There is no context, so nothing can be rendered.
+func (h *HeadlessOs) BeginOffscreen(dx, dy int) error {
+  return errors.New("HeadlessOs has no OpenGl context to render with.")
+}
+
+func (h *HeadlessOs) EndOffscreen() {}
+
+func (h *HeadlessOs) ReadPixels(img *image.RGBA) error {
+  return errors.New("HeadlessOs has no OpenGl context to read from.")
+}
+
+func (h *HeadlessOs) GetInputEvents() ([]gin.OsEvent, gin.Timestamp) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  events := h.events
+  h.events = nil
+  return events, h.now
+}
+
+func (h *HeadlessOs) GetDropEvents() []DropEvent {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  drops := h.drops
+  h.drops = nil
+  return drops
+}
+
+func (h *HeadlessOs) GetTextEvents() []TextEvent {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  texts := h.texts
+  h.texts = nil
+  return texts
+}
+
+func (h *HeadlessOs) EnableTextInput(enable bool) bool {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.text_input = enable
+  return true
+}
+
+func (h *HeadlessOs) SetTextInputPosition(x, y int) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.text_x, h.text_y = x, y
+}
+
+// Returns whether text input is enabled and where the caret was last said to
+// be.
+func (h *HeadlessOs) TextInput() (enabled bool, x, y int) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  return h.text_input, h.text_x, h.text_y
+}
+
+func (h *HeadlessOs) GetJoysticks() []gin.Joystick {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  var joysticks []gin.Joystick
+  for _, j := range h.joysticks {
+    joysticks = append(joysticks, j)
+  }
+  return joysticks
+}
+
+func (h *HeadlessOs) EnableVSync(enable bool) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.vsync = enable
+}
+
+func (h *HeadlessOs) GetClipboardText() string {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  return h.clipboard
+}
+
+func (h *HeadlessOs) SetClipboardText(text string) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.clipboard = text
+}
+
+// Advances the clock by ms milliseconds.
+func (h *HeadlessOs) Advance(ms int64) {
+  h.AdvanceBy(gin.FromMs(ms))
+}
+
+// Advances the clock by t.
+func (h *HeadlessOs) AdvanceBy(t gin.Timestamp) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.now += t
+}
+
+// Sleeping just advances the clock, so a System made with a HeadlessOs can
+// limit its frame rate without actually waiting.
+func (h *HeadlessOs) Sleep(d gin.Timestamp) {
+  h.AdvanceBy(d)
+}
+
+// Returns the current time.
+func (h *HeadlessOs) Now() gin.Timestamp {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  return h.now
+}
+
+// Queues up an event to be returned from the next call to GetInputEvents().
+// The event's timestamp is set to the current time, and its cursor position
+// is set to the current cursor position.
+func (h *HeadlessOs) InjectEvent(id gin.KeyId, press_amt float64) {
+  h.InjectEventAt(id, press_amt, h.Now())
+}
+
+// Like InjectEvent(), but the event is stamped with t rather than the current
+// time, the way an Os whose events come from a different clock than its
+// horizon might stamp them.  t can be before the previous horizon or after
+// the current time.
+func (h *HeadlessOs) InjectEventAt(id gin.KeyId, press_amt float64, t gin.Timestamp) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.events = append(h.events, gin.OsEvent{
+    KeyId:     id,
+    Press_amt: press_amt,
+    X:         h.cursor_x,
+    Y:         h.cursor_y,
+    Timestamp: t,
+  })
+}
+
+// Moves the cursor to x, y in window coordinates.  This does not generate any
+// events, use InjectEvent() with gin.MouseXAxis and gin.MouseYAxis for that.
+func (h *HeadlessOs) SetCursorPos(x, y int) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.cursor_x, h.cursor_y = x, y
+}
+
+// Queues up a drop of paths at x, y in window coordinates, to be returned
+// from the next call to GetDropEvents().  The drop's timestamp is set to the
+// current time.
+func (h *HeadlessOs) InjectDrop(paths []string, x, y int) {
+  h.InjectDropAt(paths, x, y, h.Now())
+}
+
+// Like InjectDrop(), but the drop is stamped with t rather than the current
+// time.
+func (h *HeadlessOs) InjectDropAt(paths []string, x, y int, t gin.Timestamp) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.drops = append(h.drops, DropEvent{
+    Paths:     append([]string(nil), paths...),
+    X:         x,
+    Y:         y,
+    Timestamp: t,
+  })
+}
+
+// Connects j, replacing any joystick that already has its index.  Use
+// InjectEvent() with the keys from gin.JoystickAxisKey() and friends to
+// generate events for it.
+func (h *HeadlessOs) AttachJoystick(j gin.Joystick) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  if h.joysticks == nil {
+    h.joysticks = make(map[int]gin.Joystick)
+  }
+  h.joysticks[j.Index] = j
+}
+
+// Disconnects the joystick with the specified index.  Release events can be
+// injected for it the same as they would come from a real device, anything
+// left pressed is released by gin once the System notices that the joystick
+// is gone.
+func (h *HeadlessOs) DetachJoystick(index int) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  delete(h.joysticks, index)
+}
+
+// Queues up text as though it was typed, to be returned from the next call
+// to GetTextEvents().  Like a real input method, this does nothing while text
+// input is disabled.
+func (h *HeadlessOs) InjectText(text string) {
+  h.injectText(TextEvent{Text: text})
+}
+
+// Queues up a composition in progress, with the input method's caret at byte
+// offset cursor in text.
+func (h *HeadlessOs) InjectPreedit(text string, cursor int) {
+  h.injectText(TextEvent{Text: text, Preedit: true, Cursor: cursor})
+}
+
+func (h *HeadlessOs) injectText(event TextEvent) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  if !h.text_input {
+    return
+  }
+  event.Timestamp = h.now
+  h.texts = append(h.texts, event)
+}
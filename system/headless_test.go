@@ -0,0 +1,59 @@
+package system_test
+
+import (
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+  "github.com/MobRulesGames/glop/gin"
+  "github.com/MobRulesGames/glop/system"
+)
+
+func WindowModeSpec(c gospec.Context) {
+  h := system.MakeHeadlessOs()
+  sys := system.MakeWithInput(h, gin.Make())
+  sys.Startup()
+  sys.CreateWindow(system.WindowOptions{X: 10, Y: 20, Dx: 800, Dy: 600})
+
+  dims := func() []int {
+    x, y, dx, dy := sys.GetWindowDims()
+    return []int{x, y, dx, dy}
+  }
+
+  c.Specify("Borderless fullscreen covers the monitor without changing its mode.", func() {
+    c.Expect(sys.SetWindowMode(system.BorderlessFullscreen, 0, system.DisplayMode{}), IsNil)
+    c.Expect(sys.GetWindowMode(), Equals, system.BorderlessFullscreen)
+    c.Expect(dims(), ContainsInOrder, []int{0, 0, 1920, 1080})
+  })
+
+  c.Specify("Exclusive fullscreen changes the monitor's mode.", func() {
+    c.Expect(sys.SetWindowMode(system.ExclusiveFullscreen, 0, system.DisplayMode{Dx: 1280, Dy: 720}), IsNil)
+    c.Expect(dims(), ContainsInOrder, []int{0, 0, 1280, 720})
+    c.Expect(sys.GetMonitors()[0].Dx, Equals, 1280)
+    c.Expect(sys.GetMonitors()[0].Refresh_rate, Equals, 60.0)
+  })
+
+  c.Specify("Going back to windowed restores the window and the monitor.", func() {
+    c.Assume(sys.SetWindowMode(system.ExclusiveFullscreen, 0, system.DisplayMode{Dx: 1024, Dy: 768}), IsNil)
+    c.Assume(sys.SetWindowMode(system.BorderlessFullscreen, 0, system.DisplayMode{}), IsNil)
+    c.Expect(dims(), ContainsInOrder, []int{0, 0, 1920, 1080})
+    c.Expect(sys.SetWindowMode(system.Windowed, 0, system.DisplayMode{}), IsNil)
+    c.Expect(sys.GetWindowMode(), Equals, system.Windowed)
+    c.Expect(dims(), ContainsInOrder, []int{10, 20, 800, 600})
+    c.Expect(sys.GetMonitors()[0].Dx, Equals, 1920)
+  })
+
+  c.Specify("Unsupported modes and monitors are errors that change nothing.", func() {
+    c.Expect(sys.SetWindowMode(system.ExclusiveFullscreen, 0, system.DisplayMode{Dx: 640, Dy: 480}), Not(IsNil))
+    c.Expect(sys.SetWindowMode(system.BorderlessFullscreen, 1, system.DisplayMode{}), Not(IsNil))
+    c.Expect(sys.GetWindowMode(), Equals, system.Windowed)
+    c.Expect(dims(), ContainsInOrder, []int{10, 20, 800, 600})
+  })
+
+  c.Specify("A failed switch from exclusive fullscreen keeps the mode it had.", func() {
+    c.Assume(sys.SetWindowMode(system.ExclusiveFullscreen, 0, system.DisplayMode{Dx: 1280, Dy: 720}), IsNil)
+    c.Expect(sys.SetWindowMode(system.ExclusiveFullscreen, 0, system.DisplayMode{Dx: 640, Dy: 480}), Not(IsNil))
+    c.Expect(sys.SetWindowMode(system.BorderlessFullscreen, 1, system.DisplayMode{}), Not(IsNil))
+    c.Expect(sys.GetWindowMode(), Equals, system.ExclusiveFullscreen)
+    c.Expect(dims(), ContainsInOrder, []int{0, 0, 1280, 720})
+    c.Expect(sys.GetMonitors()[0].Dx, Equals, 1280)
+  })
+}
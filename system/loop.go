@@ -0,0 +1,184 @@
+package system
+
+import (
+  "github.com/MobRulesGames/glop/gin"
+)
+
+// A Simulation is anything that wants to be advanced in fixed size steps,
+// regardless of how often it is drawn.
+type Simulation interface {
+  // Advances the simulation by exactly one tick.  tick is the number of ticks
+  // that have been run before this one.  groups contains every event group
+  // whose timestamp falls within this tick, in the order that they happened.
+  Update(tick int64, groups []gin.EventGroup)
+
+  // Draws the simulation.  alpha is in the range [0, 1) and indicates how far
+  // real time has progressed from the most recent tick towards the next one,
+  // so that drawing can interpolate between the two.
+  Draw(alpha float64)
+}
+
+// Statistics about the ticks that a FixedLoop has run.
+type LoopStats struct {
+  // Total number of frames and ticks that have been run.
+  Frames int64
+  Ticks  int64
+
+  // Number of ticks run during the most recent frame, and the fewest and the
+  // most that were run during any single frame.
+  Last_steps int
+  Min_steps  int
+  Max_steps  int
+
+  // Number of frames in which more ticks were owed than the loop was allowed
+  // to run, and the total amount of time, in ms, that was discarded because
+  // of it.
+  Clamped_frames int64
+  Dropped_ms     float64
+}
+
+// Average number of ticks run per frame.
+func (s LoopStats) AvgSteps() float64 {
+  if s.Frames == 0 {
+    return 0
+  }
+  return float64(s.Ticks) / float64(s.Frames)
+}
+
+// A FixedLoop drives a Simulation at a fixed tick rate using an accumulator.
+// Each call to Frame() runs System.Think(), runs as many ticks as real time
+// requires, draws, and then swaps buffers.  If the simulation falls too far
+// behind then time is dropped rather than trying to catch up, otherwise a
+// slow tick would cause more ticks to be run next frame, which would be even
+// slower, and so on.
+type FixedLoop struct {
+  sys System
+  sim Simulation
+
+  tick_length gin.Timestamp
+  max_steps   int
+
+  started bool
+
+  // Horizon from the previous frame
+  last_horizon gin.Timestamp
+
+  // Time that has happened but that has not been simulated yet.  This and
+  // tick_length are whole microseconds so that they never drift, alpha is
+  // only worked out from them at the very end of a frame.
+  accumulator gin.Timestamp
+
+  // Timestamp at which the next tick starts
+  tick_start gin.Timestamp
+
+  tick int64
+
+  // Event groups that have not been handed to a tick yet because they happened
+  // after the start of the next tick.
+  pending []gin.EventGroup
+
+  stats LoopStats
+}
+
+// Makes a FixedLoop that runs sim at ticks_per_second.  By default at most
+// five ticks will be run in a single frame.
+func MakeFixedLoop(sys System, sim Simulation, ticks_per_second int) *FixedLoop {
+  l := &FixedLoop{
+    sys:       sys,
+    sim:       sim,
+    max_steps: 5,
+  }
+  l.SetTickRate(ticks_per_second)
+  return l
+}
+
+// Changes the rate at which ticks are run.  This can be done at any time, the
+// new rate applies starting with the next tick.  Ticks are a whole number of
+// microseconds long, so rates that don't divide a second evenly run very
+// slightly fast.
+func (l *FixedLoop) SetTickRate(ticks_per_second int) {
+  if ticks_per_second <= 0 || ticks_per_second > int(gin.Second) {
+    panic("ticks_per_second must be positive and at most one per microsecond")
+  }
+  l.tick_length = gin.Second / gin.Timestamp(ticks_per_second)
+}
+
+// Duration of a single tick.
+func (l *FixedLoop) TickLength() gin.Timestamp {
+  return l.tick_length
+}
+
+// Duration of a single tick, in ms.
+func (l *FixedLoop) TickMs() float64 {
+  return l.tick_length.FloatMs()
+}
+
+// Sets the maximum number of ticks that will be run in a single frame.  Any
+// time beyond this is dropped and recorded in LoopStats.Dropped_ms.
+func (l *FixedLoop) SetMaxSteps(max_steps int) {
+  if max_steps <= 0 {
+    panic("max_steps must be positive")
+  }
+  l.max_steps = max_steps
+}
+
+func (l *FixedLoop) Stats() LoopStats {
+  return l.stats
+}
+
+// Runs a single frame: thinks, runs any ticks that are due, draws and swaps
+// buffers.
+func (l *FixedLoop) Frame() {
+  l.sys.Think()
+  horizon := l.sys.Horizon()
+  l.pending = append(l.pending, l.sys.GetInputEvents()...)
+  if !l.started {
+    l.started = true
+    l.last_horizon = horizon
+    l.tick_start = horizon
+  }
+  l.accumulator += horizon - l.last_horizon
+  l.last_horizon = horizon
+
+  steps := int(l.accumulator / l.tick_length)
+  if steps > l.max_steps {
+    dropped := gin.Timestamp(steps-l.max_steps) * l.tick_length
+    l.accumulator -= dropped
+    l.stats.Clamped_frames++
+    l.stats.Dropped_ms += dropped.FloatMs()
+    steps = l.max_steps
+
+    // Events that happened during the dropped time are not thrown away, they
+    // will all go to the next tick.
+    l.tick_start += dropped
+  }
+
+  for i := 0; i < steps; i++ {
+    end := l.tick_start + l.tick_length
+    n := 0
+    for n < len(l.pending) && l.pending[n].Timestamp < end {
+      n++
+    }
+    l.sim.Update(l.tick, l.pending[0:n])
+    l.pending = l.pending[n:]
+    l.tick++
+    l.tick_start = end
+    l.accumulator -= l.tick_length
+  }
+  if len(l.pending) == 0 {
+    l.pending = nil
+  }
+
+  l.stats.Frames++
+  l.stats.Ticks += int64(steps)
+  l.stats.Last_steps = steps
+  if l.stats.Frames == 1 || steps < l.stats.Min_steps {
+    l.stats.Min_steps = steps
+  }
+  if steps > l.stats.Max_steps {
+    l.stats.Max_steps = steps
+  }
+
+  l.sim.Draw(float64(l.accumulator) / float64(l.tick_length))
+  l.sys.SwapBuffers()
+}
@@ -0,0 +1,97 @@
+package system_test
+
+import (
+  . "github.com/orfjackal/gospec/src/gospec"
+  "github.com/orfjackal/gospec/src/gospec"
+  "github.com/MobRulesGames/glop/gin"
+  "github.com/MobRulesGames/glop/system"
+)
+
+// Records everything that a FixedLoop does to it.
+type recordingSim struct {
+  ticks  []int64
+  groups [][]gin.EventGroup
+  alphas []float64
+}
+
+func (r *recordingSim) Update(tick int64, groups []gin.EventGroup) {
+  r.ticks = append(r.ticks, tick)
+  r.groups = append(r.groups, groups)
+}
+
+func (r *recordingSim) Draw(alpha float64) {
+  r.alphas = append(r.alphas, alpha)
+}
+
+func (r *recordingSim) alpha() float64 {
+  return r.alphas[len(r.alphas)-1]
+}
+
+func FixedLoopSpec(c gospec.Context) {
+  h := system.MakeHeadlessOs()
+  sys := system.MakeWithInput(h, gin.Make())
+  sys.Startup()
+  sim := &recordingSim{}
+  loop := system.MakeFixedLoop(sys, sim, 100)
+  loop.Frame()
+
+  c.Specify("The first frame draws without running any ticks.", func() {
+    c.Expect(len(sim.ticks), Equals, 0)
+    c.Expect(sim.alphas, ContainsExactly, []float64{0})
+  })
+
+  c.Specify("Ticks are run as time passes and alpha is what is left over.", func() {
+    h.Advance(25)
+    loop.Frame()
+    c.Expect(sim.ticks, ContainsInOrder, []int64{0, 1})
+    c.Expect(sim.alpha(), Equals, 0.5)
+    h.Advance(5)
+    loop.Frame()
+    c.Expect(loop.Stats().Last_steps, Equals, 1)
+    c.Expect(sim.alpha(), Equals, 0.0)
+  })
+
+  c.Specify("Ticks don't drift when the rate doesn't divide a second evenly.", func() {
+    loop.SetTickRate(60)
+    for i := 0; i < 600; i++ {
+      h.AdvanceBy(loop.TickLength())
+      loop.Frame()
+      c.Assume(loop.Stats().Last_steps, Equals, 1)
+      c.Assume(sim.alpha(), Equals, 0.0)
+    }
+    c.Expect(loop.Stats().Ticks, Equals, int64(600))
+    c.Expect(loop.Stats().Min_steps, Equals, 0)
+    c.Expect(loop.Stats().Max_steps, Equals, 1)
+  })
+
+  c.Specify("Time beyond max_steps ticks is dropped.", func() {
+    loop.SetMaxSteps(3)
+    h.Advance(1005)
+    loop.Frame()
+    stats := loop.Stats()
+    c.Expect(stats.Last_steps, Equals, 3)
+    c.Expect(stats.Clamped_frames, Equals, int64(1))
+    c.Expect(stats.Dropped_ms, Equals, 970.0)
+    c.Expect(sim.alpha(), Equals, 0.5)
+
+    h.Advance(5)
+    loop.Frame()
+    c.Expect(loop.Stats().Last_steps, Equals, 1)
+    c.Expect(loop.Stats().Clamped_frames, Equals, int64(1))
+    c.Expect(sim.alpha(), Equals, 0.0)
+  })
+
+  c.Specify("Events go to the tick that they happened during.", func() {
+    h.Advance(5)
+    h.InjectEvent('q', 1)
+    h.Advance(10)
+    h.InjectEvent('q', 0)
+    h.Advance(10)
+    loop.Frame()
+    c.Assume(len(sim.groups), Equals, 2)
+    c.Assume(len(sim.groups[0]), Equals, 1)
+    c.Assume(len(sim.groups[1]), Equals, 1)
+    c.Expect(sim.groups[0][0].Timestamp, Equals, gin.FromMs(5))
+    c.Expect(sim.groups[1][0].Timestamp, Equals, gin.FromMs(15))
+  })
+}
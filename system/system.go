@@ -1,7 +1,67 @@
 package system
 
 import (
+  "errors"
   "github.com/MobRulesGames/glop/gin"
+  "image"
+  "time"
+)
+
+// A DisplayMode is a resolution and refresh rate that a monitor supports.
+type DisplayMode struct {
+  Dx, Dy int
+
+  // In Hz, or 0 if it is unknown
+  Refresh_rate float64
+}
+
+// A Monitor describes a display attached to the system.
+type Monitor struct {
+  Name string
+
+  // Position and size of the monitor on the desktop, and the rate at which it
+  // is currently refreshing.
+  X, Y, Dx, Dy int
+  Refresh_rate float64
+
+  Primary bool
+
+  // All of the modes that the monitor supports
+  Modes []DisplayMode
+}
+
+type WindowMode int
+
+const (
+  // A normal, decorated, window
+  Windowed WindowMode = iota
+
+  // An undecorated window covering an entire monitor, without changing the
+  // monitor's display mode
+  BorderlessFullscreen
+
+  // An undecorated window covering an entire monitor, after changing the
+  // monitor's display mode
+  ExclusiveFullscreen
+)
+
+// Whether the window has focus and whether it is minimized.
+type WindowState struct {
+  Focused   bool
+  Minimized bool
+}
+
+// The standard cursors that every Os can provide.
+type SystemCursor int
+
+const (
+  CursorArrow SystemCursor = iota
+  CursorIBeam
+  CursorCrosshair
+  CursorHand
+  CursorResizeHorizontal
+  CursorResizeVertical
+  CursorWait
 )
 
 type System interface {
@@ -11,10 +71,16 @@ type System interface {
   // Call System.Think() every frame
   Think()
 
-  CreateWindow(x, y, width, height int)
+  CreateWindow(options WindowOptions)
   // TODO: implement this:
   // DestroyWindow(Window)
 
+  SetWindowTitle(title string)
+
+  // Returns the attributes of the OpenGl context that was actually created,
+  // which may not match what was requested in WindowOptions.
+  GetContextAttributes() ContextAttributes
+
   // Gets the cursor position in window coordinates with the cursor at the bottom left
   // corner of the window
   GetCursorPos() (x, y int)
@@ -23,13 +89,96 @@ type System interface {
   // locked.  It should still generate mouse move events.
   HideCursor(bool)
 
+  // Moves the cursor to x, y in window coordinates.
+  WarpCursor(x, y int)
+
+  // Confines/Unconfines the cursor to the window.  Unlike a hidden cursor, a
+  // confined cursor is still visible and can move around inside the window.
+  ConfineCursor(bool)
+
+  // Sets the image used for the cursor.  hot_x, hot_y is the point in img that
+  // is the actual location of the cursor.
+  SetCursorImage(img image.Image, hot_x, hot_y int)
+
+  // Sets the cursor to one of the standard cursors.
+  SetSystemCursor(SystemCursor)
+
   GetWindowDims() (x, y, dx, dy int)
 
+  // Returns all of the monitors attached to the system.
+  GetMonitors() []Monitor
+
+  // Switches the window between windowed and full screen modes without
+  // destroying the OpenGl context.  monitor is an index into the slice returned
+  // by GetMonitors().  display is only used for ExclusiveFullscreen, if it is
+  // the zero value the monitor's current mode is used.  If it fails the
+  // window and the monitors are left as they were.
+  SetWindowMode(mode WindowMode, monitor int, display DisplayMode) error
+  GetWindowMode() WindowMode
+
+  GetWindowState() WindowState
+
+  // Swaps buffers and then, if there is a frame rate limit, waits until it is
+  // time for the next frame to start.
   SwapBuffers()
+
+  // Limits the frame rate to fps frames per second, 0 removes the limit.
+  SetFrameRateLimit(fps float64)
+
+  // Sets the frame rate limits that apply while the window is unfocused and
+  // while it is minimized, these default to 30 and 10.  They only apply if
+  // they are lower than the regular limit, and 0 means that the regular
+  // limit applies.
+  SetBackgroundFrameRates(unfocused, minimized float64)
+
+  // Returns timing statistics over the most recent frames.
+  FrameStats() FrameStats
+
+  // Renders into a dx by dy offscreen framebuffer instead of the window and
+  // returns the result.  draw is called with the framebuffer bound and the
+  // viewport covering it, and must be called on the thread that owns the
+  // context.
+  RenderOffscreen(dx, dy int, draw func()) (*image.RGBA, error)
+
+  // Returns what has been drawn to the window since the most recent call to
+  // SwapBuffers(), so call this after drawing a frame and before swapping.
+  Screenshot() (*image.RGBA, error)
+
   GetInputEvents() []gin.EventGroup
 
+  // Returns the files that were dropped onto the window before the most
+  // recent call to Think().  Their timestamps are on the same clock as the
+  // timestamps of input events.
+  GetDropEvents() []DropEvent
+
+  // Returns the text that was typed before the most recent call to Think(),
+  // in the order it was typed.  Nothing is returned while text input is
+  // disabled.
+  GetTextEvents() []TextEvent
+
+  // Turns text input on or off, it starts off.  While it is on key presses
+  // can be taken by an input method to compose text with, so it should only
+  // be on while something that takes text, like a text field, has focus.
+  // Returns false if the Os can't report text, in which case text has to be
+  // worked out from key events instead.
+  EnableTextInput(enable bool) bool
+
+  // Tells the input method where the caret is, in window coordinates, so that
+  // it can show its composition and candidates next to it.
+  SetTextInputPosition(x, y int)
+
+  // Returns the event horizon from the most recent call to Think().  This is
+  // in the same units, and has the same origin, as the timestamps on the
+  // events returned by GetInputEvents(), which are microseconds since
+  // Startup().  Use Horizon().Ms() for the time in milliseconds.
+  Horizon() gin.Timestamp
+
   EnableVSync(bool)
 
+  // Gets and sets the text on the system clipboard.
+  GetClipboardText() string
+  SetClipboardText(string)
+
   // These probably shouldn't be here, probably always want to do the Think() approach
   //  Run()
   //  Quit()
@@ -50,7 +199,14 @@ type Os interface {
   // Currently glop only supports a single window, but this function could be called
   // more than once since a window could be destroyed so it can be recreated at different
   // dimensions or in full sreen mode.
-  CreateWindow(x, y, width, height int)
+  // If the requested context attributes can't be satisfied the Os should fall
+  // back to the closest context it can make rather than failing.
+  CreateWindow(options WindowOptions)
+
+  SetWindowTitle(title string)
+
+  // Returns the attributes of the context that was created by CreateWindow().
+  GetContextAttributes() ContextAttributes
 
   // TODO: implement this:
   // DestroyWindow(Window)
@@ -60,52 +216,204 @@ type Os interface {
   GetCursorPos() (x, y int)
 
   // Hides/Unhides the cursor.  A hidden cursor is invisible and its position is
-  // locked.  It should still generate mouse move events.
+  // locked.  It should still generate mouse move events.  While the cursor is
+  // hidden the pointer is grabbed and motion events report how far the mouse
+  // moved, even if it would have otherwise hit the edge of the screen.
   HideCursor(bool)
 
+  // Moves the cursor to x, y in window coordinates.  If the cursor is hidden
+  // this changes the position it is locked at.
+  WarpCursor(x, y int)
+
+  // Confines/Unconfines the cursor to the window.  Unlike a hidden cursor, a
+  // confined cursor is still visible and can move around inside the window.
+  ConfineCursor(bool)
+
+  // Sets the image used for the cursor.  hot_x, hot_y is the point in img,
+  // relative to the upper-left corner of img, that is the actual location of
+  // the cursor.
+  SetCursorImage(img image.Image, hot_x, hot_y int)
+
+  // Sets the cursor to one of the standard cursors, replacing any image set
+  // with SetCursorImage().
+  SetSystemCursor(SystemCursor)
+
   GetWindowDims() (x, y, dx, dy int)
 
+  // Returns all of the monitors attached to the system.  If the Os can't tell
+  // then it should return a single monitor that covers the whole desktop.
+  GetMonitors() []Monitor
+
+  // Switches the window between windowed and full screen modes.  The window
+  // should be resized rather than recreated wherever possible, so that the
+  // OpenGl context survives.  When returning to Windowed mode the window
+  // should go back to the position and size it had before it went full screen,
+  // and any display mode that was changed should be restored.
+  //
+  // monitor is an index into the slice returned by GetMonitors().  display is
+  // only used for ExclusiveFullscreen, in which case it must match the size of
+  // one of the monitor's modes, or be the zero value to keep the current mode.
+  // If display's refresh rate is 0 the highest available refresh rate is used.
+  SetWindowMode(mode WindowMode, monitor int, display DisplayMode) error
+
+  // Returns the mode most recently set successfully with SetWindowMode().
+  GetWindowMode() WindowMode
+
+  // Returns whether the window currently has focus and whether it is
+  // minimized.
+  GetWindowState() WindowState
+
   // Swap the OpenGl buffers on this window
   SwapBuffers()
 
+  // Creates a dx by dy framebuffer with color, depth and stencil buffers, and
+  // binds it so that everything is rendered to it instead of to the window.
+  // The viewport is set to cover the framebuffer.
+  BeginOffscreen(dx, dy int) error
+
+  // Unbinds and frees the framebuffer created by BeginOffscreen(), and
+  // restores the viewport.
+  EndOffscreen()
+
+  // Fills img with the pixels at the bottom left of the current framebuffer,
+  // which is the offscreen framebuffer between BeginOffscreen() and
+  // EndOffscreen() and the window's back buffer otherwise.  The top row of
+  // the framebuffer goes in the top row of img.
+  ReadPixels(img *image.RGBA) error
+
   // Returns all of the events in the order that they happened since the last call to
   // this function.  The events do not have to be in order according to KeyEvent.Timestamp,
   // but they will be sorted according to this value.  The timestamp returned is the event
   // horizon, no future events will have a timestamp less than or equal to it.
-  GetInputEvents() ([]gin.OsEvent, int64)
+  // Timestamps must come from a monotonic clock with microsecond resolution,
+  // the origin doesn't matter.  Events that fall outside of the window between
+  // the previous horizon and this one are moved to its edges.
+  GetInputEvents() ([]gin.OsEvent, gin.Timestamp)
+
+  // Returns all of the files dropped onto the window since the last call to
+  // this function.  Timestamps are on the same clock as the ones returned by
+  // GetInputEvents().
+  GetDropEvents() []DropEvent
+
+  // Returns all of the text events since the last call to this function.
+  // Timestamps are on the same clock as the ones returned by
+  // GetInputEvents().
+  GetTextEvents() []TextEvent
+
+  // Turns text input on or off, and returns false if it isn't supported.
+  EnableTextInput(enable bool) bool
+
+  // Moves the input method's caret to x, y in window coordinates.
+  SetTextInputPosition(x, y int)
+
+  // Returns the joysticks that are currently connected.  This is called right
+  // after GetInputEvents(), and every joystick that events were returned for
+  // must be in the list, except for the events that release everything on a
+  // joystick that was just removed.
+  GetJoysticks() []gin.Joystick
 
   EnableVSync(bool)
 
+  // Returns the text currently on the system clipboard, or the empty string if
+  // there is no text on the clipboard.
+  GetClipboardText() string
+
+  // Places text on the system clipboard, where other applications can get at
+  // it.
+  SetClipboardText(string)
+
   // These probably shouldn't be here, probably always want to do the Think() approach
   //  Run()
   //  Quit()
 }
 
 type sysObj struct {
-  os       Os
-  events   []gin.EventGroup
-  start_ms int64
+  os      Os
+  input   *gin.Input
+  events  []gin.EventGroup
+  drops   []DropEvent
+  texts   []TextEvent
+  start   gin.Timestamp
+  horizon gin.Timestamp
+  pacer   framePacer
 }
 
+// If os implements Clock then it is used for frame pacing, otherwise real
+// time is used.  Input events are sent to gin.In().
 func Make(os Os) System {
-  return &sysObj{
-    os: os,
+  return MakeWithInput(os, gin.In())
+}
+
+// Like Make, but input events are sent to input rather than to gin.In(), so
+// that tests can each have an Input of their own.
+func MakeWithInput(os Os, input *gin.Input) System {
+  sys := &sysObj{
+    os:    os,
+    input: input,
   }
+  clock, ok := os.(Clock)
+  if !ok {
+    clock = &realClock{time.Now()}
+  }
+  sys.pacer.init(clock)
+  return sys
 }
 func (sys *sysObj) Startup() {
   sys.os.Startup()
-  _, sys.start_ms = sys.os.GetInputEvents()
+  _, sys.start = sys.os.GetInputEvents()
 }
 func (sys *sysObj) Think() {
-  sys.os.Think()
+  sys.pacer.current.think += sys.pacer.time(sys.os.Think)
+  sys.pacer.current.input += sys.pacer.time(sys.processInput)
+}
+func (sys *sysObj) processInput() {
   events, horizon := sys.os.GetInputEvents()
+  drops := sys.os.GetDropEvents()
+  texts := sys.os.GetTextEvents()
+  sys.syncJoysticks(sys.os.GetJoysticks())
+  horizon -= sys.start
   for i := range events {
-    events[i].Timestamp -= sys.start_ms
+    events[i].Timestamp -= sys.start
+  }
+  for i := range drops {
+    drops[i].Timestamp -= sys.start
+  }
+  for i := range texts {
+    texts[i].Timestamp -= sys.start
+  }
+  events = orderEvents(events, sys.horizon, horizon)
+  sys.drops = orderDrops(drops, sys.horizon, horizon)
+  sys.texts = orderTexts(texts, sys.horizon, horizon)
+  if horizon > sys.horizon {
+    sys.horizon = horizon
+  }
+  sys.events = sys.input.Think(sys.horizon, false, events)
+}
+
+// Tells the input about joysticks that were connected or disconnected since the
+// last call, so that keys exist for them before their events are processed.
+func (sys *sysObj) syncJoysticks(joysticks []gin.Joystick) {
+  connected := make(map[int]bool)
+  for _, j := range joysticks {
+    connected[j.Index] = true
+  }
+  for _, j := range sys.input.Joysticks() {
+    if !connected[j.Index] {
+      sys.input.DisconnectJoystick(j.Index)
+    }
   }
-  sys.events = gin.In().Think(horizon-sys.start_ms, false, events)
+  for _, j := range joysticks {
+    sys.input.ConnectJoystick(j)
+  }
+}
+func (sys *sysObj) CreateWindow(options WindowOptions) {
+  sys.os.CreateWindow(options)
+}
+func (sys *sysObj) SetWindowTitle(title string) {
+  sys.os.SetWindowTitle(title)
 }
-func (sys *sysObj) CreateWindow(x, y, width, height int) {
-  sys.os.CreateWindow(x, y, width, height)
+func (sys *sysObj) GetContextAttributes() ContextAttributes {
+  return sys.os.GetContextAttributes()
 }
 func (sys *sysObj) GetCursorPos() (int, int) {
   return sys.os.GetCursorPos()
@@ -113,15 +421,97 @@ func (sys *sysObj) GetCursorPos() (int, int) {
 func (sys *sysObj) HideCursor(hide bool) {
   sys.os.HideCursor(hide)
 }
+func (sys *sysObj) WarpCursor(x, y int) {
+  sys.os.WarpCursor(x, y)
+}
+func (sys *sysObj) ConfineCursor(confine bool) {
+  sys.os.ConfineCursor(confine)
+}
+func (sys *sysObj) SetCursorImage(img image.Image, hot_x, hot_y int) {
+  sys.os.SetCursorImage(img, hot_x, hot_y)
+}
+func (sys *sysObj) SetSystemCursor(cursor SystemCursor) {
+  sys.os.SetSystemCursor(cursor)
+}
 func (sys *sysObj) GetWindowDims() (int, int, int, int) {
   return sys.os.GetWindowDims()
 }
+func (sys *sysObj) GetMonitors() []Monitor {
+  return sys.os.GetMonitors()
+}
+func (sys *sysObj) SetWindowMode(mode WindowMode, monitor int, display DisplayMode) error {
+  return sys.os.SetWindowMode(mode, monitor, display)
+}
+func (sys *sysObj) GetWindowMode() WindowMode {
+  return sys.os.GetWindowMode()
+}
+func (sys *sysObj) GetWindowState() WindowState {
+  return sys.os.GetWindowState()
+}
 func (sys *sysObj) SwapBuffers() {
-  sys.os.SwapBuffers()
+  sys.pacer.current.swap += sys.pacer.time(sys.os.SwapBuffers)
+  sys.pacer.endFrame(sys.os.GetWindowState())
+}
+func (sys *sysObj) SetFrameRateLimit(fps float64) {
+  sys.pacer.fps = fps
+}
+func (sys *sysObj) SetBackgroundFrameRates(unfocused, minimized float64) {
+  sys.pacer.unfocused_fps = unfocused
+  sys.pacer.minimized_fps = minimized
+}
+func (sys *sysObj) FrameStats() FrameStats {
+  return sys.pacer.stats()
+}
+func (sys *sysObj) RenderOffscreen(dx, dy int, draw func()) (*image.RGBA, error) {
+  err := sys.os.BeginOffscreen(dx, dy)
+  if err != nil {
+    return nil, err
+  }
+  defer sys.os.EndOffscreen()
+  draw()
+  img := image.NewRGBA(image.Rect(0, 0, dx, dy))
+  err = sys.os.ReadPixels(img)
+  if err != nil {
+    return nil, err
+  }
+  return img, nil
+}
+func (sys *sysObj) Screenshot() (*image.RGBA, error) {
+  _, _, dx, dy := sys.os.GetWindowDims()
+  if dx <= 0 || dy <= 0 {
+    return nil, errors.New("There is no window to take a screenshot of.")
+  }
+  img := image.NewRGBA(image.Rect(0, 0, dx, dy))
+  err := sys.os.ReadPixels(img)
+  if err != nil {
+    return nil, err
+  }
+  return img, nil
 }
 func (sys *sysObj) GetInputEvents() []gin.EventGroup {
   return sys.events
 }
+func (sys *sysObj) GetDropEvents() []DropEvent {
+  return sys.drops
+}
+func (sys *sysObj) GetTextEvents() []TextEvent {
+  return sys.texts
+}
+func (sys *sysObj) EnableTextInput(enable bool) bool {
+  return sys.os.EnableTextInput(enable)
+}
+func (sys *sysObj) SetTextInputPosition(x, y int) {
+  sys.os.SetTextInputPosition(x, y)
+}
+func (sys *sysObj) Horizon() gin.Timestamp {
+  return sys.horizon
+}
 func (sys *sysObj) EnableVSync(enable bool) {
   sys.os.EnableVSync(enable)
 }
+func (sys *sysObj) GetClipboardText() string {
+  return sys.os.GetClipboardText()
+}
+func (sys *sysObj) SetClipboardText(text string) {
+  sys.os.SetClipboardText(text)
+}
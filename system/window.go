@@ -0,0 +1,93 @@
+package system
+
+import (
+  "image"
+)
+
+type ContextProfile int
+
+const (
+  // A context that supports the deprecated fixed function api.  This is what
+  // glop has always used and is the default.
+  CompatibilityProfile ContextProfile = iota
+
+  // A context that only supports the core api of the requested version.
+  CoreProfile
+)
+
+// Attributes of an OpenGl context.  When requesting a context a zero value
+// means that glop doesn't care, when reporting the context that was actually
+// created a zero value means that there isn't one, or that the Os couldn't
+// tell.
+type ContextAttributes struct {
+  // OpenGl version, e.g. 3, 2.  Profile is only meaningful for versions 3.2
+  // and later.
+  Major, Minor int
+  Profile      ContextProfile
+
+  Depth_bits   int
+  Stencil_bits int
+
+  // Number of samples per pixel for multisample anti-aliasing
+  Samples int
+
+  // Whether the default framebuffer is sRGB capable
+  Srgb bool
+}
+
+// Everything that can be specified about a window when it is created.
+type WindowOptions struct {
+  Title string
+
+  // Position and size of the window.  A position of -1 lets the Os decide.
+  X, Y, Dx, Dy int
+
+  // The same icon at as many different sizes as are available, the Os will
+  // pick whichever suits it best.
+  Icons []image.Image
+
+  Resizable     bool
+  Decorated     bool
+  Always_on_top bool
+
+  // Limits on the size of the window if it is resizable, 0 means no limit.
+  Min_dx, Min_dy int
+  Max_dx, Max_dy int
+
+  // If Offscreen is set the window is never shown, instead the context
+  // renders to an invisible surface of size Dx by Dy.  On Linux this is a
+  // GLX pbuffer, so it works on X servers with no display attached, such as
+  // Xvfb with Mesa's llvmpipe.
+  Offscreen bool
+
+  // If Raw_mouse_motion is set MouseXAxis and MouseYAxis report motion
+  // straight from the mouse, without pointer acceleration and in fractions of
+  // a pixel where the mouse can do that, and keep reporting it when the
+  // cursor is stuck at the edge of the screen.  If Smooth_scroll is set the
+  // wheel keys report fractions of a click from touchpads and high
+  // resolution wheels.  Where the Os can't do these the usual events are
+  // reported instead.  On Linux both need XInput 2.1.
+  Raw_mouse_motion bool
+  Smooth_scroll    bool
+
+  Context ContextAttributes
+}
+
+// Makes a WindowOptions for a decorated, non-resizable window at the
+// specified position with the specified size, with a compatibility profile
+// context with a depth and stencil buffer.  This is the same window that
+// CreateWindow used to make.
+func MakeWindowOptions(x, y, width, height int) WindowOptions {
+  return WindowOptions{
+    Title:     "glop",
+    X:         x,
+    Y:         y,
+    Dx:        width,
+    Dy:        height,
+    Decorated: true,
+    Context: ContextAttributes{
+      Depth_bits:   16,
+      Stencil_bits: 8,
+    },
+  }
+}